@@ -8,7 +8,6 @@ import (
 	"math/rand"
 	"net"
 	"os"
-	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -61,11 +60,7 @@ func builtinFunctionInfo(ctx *types.TaskContext, args []types.Value, r *Registry
 	}
 
 	if len(args) == 0 {
-		names := make([]string, 0, len(r.funcs))
-		for name := range r.funcs {
-			names = append(names, name)
-		}
-		sort.Strings(names)
+		names := r.Names()
 		entries := make([]types.Value, 0, len(names))
 		for _, name := range names {
 			entries = append(entries, functionInfoEntry(name, signatureForFunction(name)))
@@ -211,86 +206,6 @@ func builtinThreads(ctx *types.TaskContext, args []types.Value) types.Result {
 	return types.Ok(types.NewList(result))
 }
 
-func builtinThreadPool(ctx *types.TaskContext, args []types.Value) types.Result {
-	if len(args) != 0 {
-		return types.Err(types.E_ARGS)
-	}
-	result := types.NewMap([][2]types.Value{
-		{types.NewStr("goroutines"), types.NewInt(int64(runtime.NumGoroutine()))},
-		{types.NewStr("cpus"), types.NewInt(int64(runtime.NumCPU()))},
-	})
-	return types.Ok(result)
-}
-
-func builtinSetThreadMode(ctx *types.TaskContext, args []types.Value) types.Result {
-	if len(args) != 1 {
-		return types.Err(types.E_ARGS)
-	}
-	switch args[0].(type) {
-	case types.IntValue, types.StrValue:
-		return types.Ok(types.NewInt(0))
-	default:
-		return types.Err(types.E_TYPE)
-	}
-}
-
-func builtinUsage(ctx *types.TaskContext, args []types.Value) types.Result {
-	if len(args) != 0 {
-		return types.Err(types.E_ARGS)
-	}
-	if !ctx.IsWizard {
-		return types.Err(types.E_PERM)
-	}
-
-	// Toast-compatible shape: 10 elements, first element is a 3-item load average list.
-	result := []types.Value{
-		types.NewList([]types.Value{types.NewFloat(0), types.NewFloat(0), types.NewFloat(0)}),
-		types.NewFloat(0), // user time
-		types.NewFloat(0), // system time
-		types.NewInt(0),   // minflt
-		types.NewInt(0),   // majflt
-		types.NewInt(0),   // inblock
-		types.NewInt(0),   // oublock
-		types.NewInt(0),   // nvcsw
-		types.NewInt(0),   // nivcsw
-		types.NewInt(0),   // nsignals
-	}
-	return types.Ok(types.NewList(result))
-}
-
-func builtinMallocStats(ctx *types.TaskContext, args []types.Value) types.Result {
-	if len(args) != 0 {
-		return types.Err(types.E_ARGS)
-	}
-	var mem runtime.MemStats
-	runtime.ReadMemStats(&mem)
-	result := types.NewMap([][2]types.Value{
-		{types.NewStr("alloc"), types.NewInt(int64(mem.Alloc))},
-		{types.NewStr("total_alloc"), types.NewInt(int64(mem.TotalAlloc))},
-		{types.NewStr("sys"), types.NewInt(int64(mem.Sys))},
-	})
-	return types.Ok(result)
-}
-
-func builtinMemoryUsage(ctx *types.TaskContext, args []types.Value) types.Result {
-	if len(args) != 0 {
-		return types.Err(types.E_ARGS)
-	}
-	// Windows compatibility: Toast returns E_FILE when /proc-style memory stats are unavailable.
-	return types.Err(types.E_FILE)
-}
-
-func builtinLogCacheStats(ctx *types.TaskContext, args []types.Value) types.Result {
-	if len(args) != 0 {
-		return types.Err(types.E_ARGS)
-	}
-	return types.Ok(types.NewList([]types.Value{
-		types.NewInt(0),
-		types.NewInt(0),
-		types.NewInt(0),
-	}))
-}
-
 func builtinDbDiskSize(ctx *types.TaskContext, args []types.Value) types.Result {
 	if len(args) != 0 {
 		return types.Err(types.E_ARGS)
@@ -277,12 +277,14 @@ func builtinArgon2(ctx *types.TaskContext, args []types.Value) types.Result {
 	const m = uint32(64 * 1024)
 	const p = uint8(2)
 	const keyLen = uint32(32)
-	h := argon2.IDKey([]byte(password.Value()), salt, t, m, p, keyLen)
-	encoded := fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", m, t, p,
-		base64.RawStdEncoding.EncodeToString(salt),
-		base64.RawStdEncoding.EncodeToString(h),
-	)
-	return types.Ok(types.NewStr(encoded))
+	return runInBackground(ctx, func() types.Result {
+		h := argon2.IDKey([]byte(password.Value()), salt, t, m, p, keyLen)
+		encoded := fmt.Sprintf("$argon2id$v=19$m=%d,t=%d,p=%d$%s$%s", m, t, p,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(h),
+		)
+		return types.Ok(types.NewStr(encoded))
+	})
 }
 
 func parseArgon2Hash(encoded string) (uint32, uint32, uint8, []byte, []byte, error) {
@@ -335,11 +337,13 @@ func builtinArgon2Verify(ctx *types.TaskContext, args []types.Value) types.Resul
 	if err != nil {
 		return types.Err(types.E_INVARG)
 	}
-	actual := argon2.IDKey([]byte(password), salt, t, m, p, uint32(len(expected)))
-	if subtle.ConstantTimeCompare(actual, expected) == 1 {
-		return types.Ok(types.NewInt(1))
-	}
-	return types.Ok(types.NewInt(0))
+	return runInBackground(ctx, func() types.Result {
+		actual := argon2.IDKey([]byte(password), salt, t, m, p, uint32(len(expected)))
+		if subtle.ConstantTimeCompare(actual, expected) == 1 {
+			return types.Ok(types.NewInt(1))
+		}
+		return types.Ok(types.NewInt(0))
+	})
 }
 
 func builtinCurl(ctx *types.TaskContext, args []types.Value) types.Result {
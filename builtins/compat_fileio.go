@@ -951,21 +951,24 @@ func builtinFileGrep(ctx *types.TaskContext, args []types.Value) types.Result {
 	if err != nil {
 		return types.Err(types.E_INVARG)
 	}
-	f, err := os.Open(resolveFilePath(path))
-	if err != nil {
-		return types.Err(types.E_FILE)
-	}
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
-	out := make([]types.Value, 0)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if re.MatchString(line) {
-			out = append(out, types.NewStr(line))
+	fullPath := resolveFilePath(path)
+	return runInBackground(ctx, func() types.Result {
+		f, err := os.Open(fullPath)
+		if err != nil {
+			return types.Err(types.E_FILE)
 		}
-	}
-	if err := scanner.Err(); err != nil {
-		return types.Err(types.E_FILE)
-	}
-	return types.Ok(types.NewList(out))
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		out := make([]types.Value, 0)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if re.MatchString(line) {
+				out = append(out, types.NewStr(line))
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return types.Err(types.E_FILE)
+		}
+		return types.Ok(types.NewList(out))
+	})
 }
@@ -343,11 +343,18 @@ func builtinCrypt(ctx *types.TaskContext, args []types.Value, store *db.Store) t
 	playerIsWizard := ctx.IsWizard || isPlayerWizard(store, ctx.Player)
 
 	// Determine algorithm from salt prefix
-	result, errCode := cryptPasswordWithPerm(password, salt, playerIsWizard)
-	if errCode != 0 {
-		return types.Err(errCode)
+	hash := func() types.Result {
+		result, errCode := cryptPasswordWithPerm(password, salt, playerIsWizard)
+		if errCode != 0 {
+			return types.Err(errCode)
+		}
+		return types.Ok(types.NewStr(result))
 	}
-	return types.Ok(types.NewStr(result))
+	// bcrypt and the SHA-2 schemes take long enough to run in the background
+	if strings.HasPrefix(salt, "$2") || strings.HasPrefix(salt, "$5$") || strings.HasPrefix(salt, "$6$") {
+		return runInBackground(ctx, hash)
+	}
+	return hash()
 }
 
 // cryptPasswordWithPerm implements crypt with algorithm detection and permission checking
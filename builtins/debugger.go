@@ -0,0 +1,266 @@
+package builtins
+
+import (
+	"barn/db"
+	"barn/debug"
+	"barn/types"
+	"time"
+)
+
+// builtinDebugBreak implements debug_break(obj, verb, line)
+// Sets a breakpoint on a line of the verb defined on obj and returns its
+// id. Scheduled tasks about to run that line pause until debug_continue()
+// or debug_step(). Wizard only.
+func builtinDebugBreak(ctx *types.TaskContext, args []types.Value, store *db.Store) types.Result {
+	if len(args) != 3 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	obj, ok1 := args[0].(types.ObjValue)
+	name, ok2 := args[1].(types.StrValue)
+	line, ok3 := args[2].(types.IntValue)
+	if !ok1 || !ok2 || !ok3 {
+		return types.Err(types.E_TYPE)
+	}
+	bp, errCode := debug.SetBreakpoint(store, obj.ID(), name.Value(), int(line.Val))
+	if errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+	return types.Ok(types.NewInt(bp.ID))
+}
+
+// builtinDebugClear implements debug_clear([id])
+// Removes one breakpoint, or all of them. Wizard only.
+func builtinDebugClear(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) > 1 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	if len(args) == 0 {
+		debug.ClearBreakpoints()
+		return types.Ok(types.NewInt(0))
+	}
+	id, ok := args[0].(types.IntValue)
+	if !ok {
+		return types.Err(types.E_TYPE)
+	}
+	if !debug.ClearBreakpoint(id.Val) {
+		return types.Err(types.E_INVARG)
+	}
+	return types.Ok(types.NewInt(0))
+}
+
+// builtinDebugBreakpoints implements debug_breakpoints()
+// Returns a list of ["id", "object", "verb", "line", "hits"] maps.
+// Wizard only.
+func builtinDebugBreakpoints(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 0 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	bps := debug.Breakpoints()
+	result := make([]types.Value, 0, len(bps))
+	for _, bp := range bps {
+		result = append(result, types.NewMap([][2]types.Value{
+			{types.NewStr("id"), types.NewInt(bp.ID)},
+			{types.NewStr("object"), types.NewObj(bp.Object)},
+			{types.NewStr("verb"), types.NewStr(bp.Verb)},
+			{types.NewStr("line"), types.NewInt(int64(bp.Line))},
+			{types.NewStr("hits"), types.NewInt(bp.Hits)},
+		}))
+	}
+	return types.Ok(types.NewList(result))
+}
+
+// builtinDebugTasks implements debug_tasks()
+// Returns a map for each paused task: "task_id", "reason" ("breakpoint" or
+// "step"), "breakpoint" (0 after a step), "seconds" paused, and the
+// "this", "verb", "verb_loc" and "line_number" where it stopped.
+// Wizard only.
+func builtinDebugTasks(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 0 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	sessions := debug.Sessions()
+	result := make([]types.Value, 0, len(sessions))
+	for _, s := range sessions {
+		top := debug.Frame{This: types.ObjNothing, VerbLoc: types.ObjNothing}
+		if frames := s.Target.Frames(); len(frames) > 0 {
+			top = frames[0]
+		}
+		result = append(result, types.NewMap([][2]types.Value{
+			{types.NewStr("task_id"), types.NewInt(s.TaskID)},
+			{types.NewStr("reason"), types.NewStr(s.Reason)},
+			{types.NewStr("breakpoint"), types.NewInt(s.Breakpoint)},
+			{types.NewStr("seconds"), durationSeconds(time.Since(s.Since))},
+			{types.NewStr("this"), types.NewObj(top.This)},
+			{types.NewStr("verb"), types.NewStr(top.Verb)},
+			{types.NewStr("verb_loc"), types.NewObj(top.VerbLoc)},
+			{types.NewStr("line_number"), types.NewInt(int64(top.Line))},
+		}))
+	}
+	return types.Ok(types.NewList(result))
+}
+
+// builtinDebugStack implements debug_stack(task_id)
+// Returns the paused task's activations, innermost first, as task_stack()
+// style maps with an extra "eval" flag. Wizard only.
+func builtinDebugStack(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 1 {
+		return types.Err(types.E_ARGS)
+	}
+	s, errCode := debugSessionArg(ctx, args[0])
+	if errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+	frames := s.Target.Frames()
+	result := make([]types.Value, 0, len(frames))
+	for _, f := range frames {
+		result = append(result, types.NewMap([][2]types.Value{
+			{types.NewStr("this"), types.NewObj(f.This)},
+			{types.NewStr("verb"), types.NewStr(f.Verb)},
+			{types.NewStr("programmer"), types.NewObj(f.Programmer)},
+			{types.NewStr("verb_loc"), types.NewObj(f.VerbLoc)},
+			{types.NewStr("player"), types.NewObj(f.Player)},
+			{types.NewStr("line_number"), types.NewInt(int64(f.Line))},
+			{types.NewStr("eval"), flagInt(f.Eval)},
+		}))
+	}
+	return types.Ok(types.NewList(result))
+}
+
+// builtinDebugLocals implements debug_locals(task_id [, frame])
+// Returns a map of the bound variables in a frame of a paused task
+// (1, the default, is the frame that stopped). Wizard only.
+func builtinDebugLocals(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) < 1 || len(args) > 2 {
+		return types.Err(types.E_ARGS)
+	}
+	s, errCode := debugSessionArg(ctx, args[0])
+	if errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+	frame, errCode := debugFrameArg(s, args[1:])
+	if errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+	vars, err := s.Target.Variables(frame)
+	if err != nil {
+		return types.Err(types.E_RANGE)
+	}
+	pairs := make([][2]types.Value, 0, len(vars))
+	for _, v := range vars {
+		pairs = append(pairs, [2]types.Value{types.NewStr(v.Name), v.Value})
+	}
+	return types.Ok(types.NewMap(pairs))
+}
+
+// builtinDebugEval implements debug_eval(task_id, code [, frame])
+// Runs code with the variables of a paused frame in scope, returning
+// {1, value} or {0, message} like eval(). A bare expression is returned
+// as if by "return <code>;". Assignments update the paused frame.
+// Wizard only.
+func builtinDebugEval(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) < 2 || len(args) > 3 {
+		return types.Err(types.E_ARGS)
+	}
+	s, errCode := debugSessionArg(ctx, args[0])
+	if errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+	code, ok := args[1].(types.StrValue)
+	if !ok {
+		return types.Err(types.E_TYPE)
+	}
+	frame, errCode := debugFrameArg(s, args[2:])
+	if errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+	val, err := s.Target.Evaluate(frame, code.Value())
+	if err != nil {
+		return types.Ok(types.NewList([]types.Value{types.NewInt(0), types.NewStr(err.Error())}))
+	}
+	return types.Ok(types.NewList([]types.Value{types.NewInt(1), val}))
+}
+
+// builtinDebugContinue implements debug_continue(task_id)
+// Lets a paused task run to its next breakpoint. Wizard only.
+func builtinDebugContinue(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 1 {
+		return types.Err(types.E_ARGS)
+	}
+	return debugResume(ctx, args[0], debug.StepNone)
+}
+
+// builtinDebugStep implements debug_step(task_id [, mode])
+// Lets a paused task run until the next line: "in" stops inside calls,
+// "over" (the default) in the same frame or a caller, "out" in a caller.
+// Wizard only.
+func builtinDebugStep(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) < 1 || len(args) > 2 {
+		return types.Err(types.E_ARGS)
+	}
+	mode := debug.StepOver
+	if len(args) == 2 {
+		name, ok := args[1].(types.StrValue)
+		if !ok {
+			return types.Err(types.E_TYPE)
+		}
+		if mode, ok = debug.ParseStepMode(name.Value()); !ok {
+			return types.Err(types.E_INVARG)
+		}
+	}
+	return debugResume(ctx, args[0], mode)
+}
+
+func debugResume(ctx *types.TaskContext, taskArg types.Value, mode debug.StepMode) types.Result {
+	s, errCode := debugSessionArg(ctx, taskArg)
+	if errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+	if debug.Continue(s.TaskID, mode) != nil {
+		return types.Err(types.E_INVARG)
+	}
+	return types.Ok(types.NewInt(0))
+}
+
+// debugSessionArg checks wizard permission and finds the paused task named
+// by a task id argument
+func debugSessionArg(ctx *types.TaskContext, arg types.Value) (*debug.Session, types.ErrorCode) {
+	id, ok := arg.(types.IntValue)
+	if !ok {
+		return nil, types.E_TYPE
+	}
+	if !ctx.IsWizard {
+		return nil, types.E_PERM
+	}
+	s := debug.Lookup(id.Val)
+	if s == nil {
+		return nil, types.E_INVARG
+	}
+	return s, types.E_NONE
+}
+
+// debugFrameArg converts an optional 1-based frame argument to a Target index
+func debugFrameArg(s *debug.Session, args []types.Value) (int, types.ErrorCode) {
+	if len(args) == 0 {
+		return 0, types.E_NONE
+	}
+	n, ok := args[0].(types.IntValue)
+	if !ok {
+		return 0, types.E_TYPE
+	}
+	if n.Val < 1 || n.Val > int64(len(s.Target.Frames())) {
+		return 0, types.E_RANGE
+	}
+	return int(n.Val) - 1, types.E_NONE
+}
@@ -2,17 +2,39 @@ package builtins
 
 import (
 	"barn/types"
-	"runtime"
 )
 
 // ============================================================================
 // GARBAGE COLLECTION BUILTINS
 // ============================================================================
 
+// GarbageCollector is the collector that finds unreachable anonymous
+// objects and waifs (vm.Collector). The builtins reach it through the
+// registry, since they can't import the VM.
+type GarbageCollector interface {
+	Request()       // Run a whole cycle between tasks
+	Stats() GCStats // Report for gc_stats()
+}
+
+// GCStats is what gc_stats() reports. Toast names the states of the values
+// its collector is looking at by color; Barn uses the ones that apply to a
+// tracing collector and reports the rest as 0.
+type GCStats struct {
+	Phase      string // idle, marking or sweeping
+	Black      int    // Anonymous objects and waifs the cycle has reached
+	Gray       int    // Values waiting to be traced
+	White      int    // Anonymous objects and waifs not reached yet
+	Purple     int    // Anonymous objects waiting to be recycled
+	Cycles     int64  // Cycles completed
+	Recycled   int64  // Anonymous objects recycled
+	WaifsFreed int64  // Waifs no longer tracked
+}
+
 // builtinRunGC implements run_gc()
-// Triggers garbage collection (wizard only)
-// Returns 0 on success
-func builtinRunGC(ctx *types.TaskContext, args []types.Value) types.Result {
+// Asks for a garbage collection cycle, which runs once the calling task
+// stops (wizard only)
+// Returns 0
+func builtinRunGC(ctx *types.TaskContext, args []types.Value, registry *Registry) types.Result {
 	if len(args) != 0 {
 		return types.Err(types.E_ARGS)
 	}
@@ -22,19 +44,17 @@ func builtinRunGC(ctx *types.TaskContext, args []types.Value) types.Result {
 		return types.Err(types.E_PERM)
 	}
 
-	// Trigger Go's garbage collector
-	// This is primarily symbolic since Go manages its own GC,
-	// but for anonymous objects with cyclic references, this provides
-	// a way to force collection
-	runtime.GC()
-
+	if registry.collector != nil {
+		registry.collector.Request()
+	}
 	return types.Ok(types.NewInt(0))
 }
 
 // builtinGCStats implements gc_stats()
 // Returns GC statistics map (wizard only)
-// Returns map with color keys: green, yellow, black, gray, white, purple, pink
-func builtinGCStats(ctx *types.TaskContext, args []types.Value) types.Result {
+// Returns map with color keys: green, yellow, black, gray, white, purple,
+// pink, and Barn's cycles, recycled, waifs_freed and phase
+func builtinGCStats(ctx *types.TaskContext, args []types.Value, registry *Registry) types.Result {
 	if len(args) != 0 {
 		return types.Err(types.E_ARGS)
 	}
@@ -44,19 +64,22 @@ func builtinGCStats(ctx *types.TaskContext, args []types.Value) types.Result {
 		return types.Err(types.E_PERM)
 	}
 
-	// Since Go manages its own GC and we don't have a tri-color marking
-	// algorithm like ToastStunt's cyclic reference collector,
-	// we return a map with all zeros
-	// In the future, if we implement anonymous object cycle detection,
-	// these could report actual statistics
+	stats := GCStats{Phase: "idle"}
+	if registry.collector != nil {
+		stats = registry.collector.Stats()
+	}
 	result := types.NewEmptyMap()
 	result = result.Set(types.NewStr("green"), types.NewInt(0))
 	result = result.Set(types.NewStr("yellow"), types.NewInt(0))
-	result = result.Set(types.NewStr("black"), types.NewInt(0))
-	result = result.Set(types.NewStr("gray"), types.NewInt(0))
-	result = result.Set(types.NewStr("white"), types.NewInt(0))
-	result = result.Set(types.NewStr("purple"), types.NewInt(0))
+	result = result.Set(types.NewStr("black"), types.NewInt(int64(stats.Black)))
+	result = result.Set(types.NewStr("gray"), types.NewInt(int64(stats.Gray)))
+	result = result.Set(types.NewStr("white"), types.NewInt(int64(stats.White)))
+	result = result.Set(types.NewStr("purple"), types.NewInt(int64(stats.Purple)))
 	result = result.Set(types.NewStr("pink"), types.NewInt(0))
+	result = result.Set(types.NewStr("cycles"), types.NewInt(stats.Cycles))
+	result = result.Set(types.NewStr("recycled"), types.NewInt(stats.Recycled))
+	result = result.Set(types.NewStr("waifs_freed"), types.NewInt(stats.WaifsFreed))
+	result = result.Set(types.NewStr("phase"), types.NewStr(stats.Phase))
 
 	return types.Ok(result)
 }
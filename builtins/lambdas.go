@@ -0,0 +1,121 @@
+package builtins
+
+import (
+	"barn/types"
+	"sort"
+)
+
+// ============================================================================
+// LAMBDA BUILTINS
+// ============================================================================
+
+// builtinMap calls fn on each element of a list
+// map(list, fn) -> list of fn's results
+func builtinMap(ctx *types.TaskContext, args []types.Value, r *Registry) types.Result {
+	list, fn, code := listAndLambda(args)
+	if code != types.E_NONE {
+		return types.Err(code)
+	}
+
+	results := make([]types.Value, 0, list.Len())
+	for i := 1; i <= list.Len(); i++ {
+		result := r.CallLambda(fn, []types.Value{list.Get(i)}, ctx)
+		if result.Flow == types.FlowException {
+			return result
+		}
+		results = append(results, result.Val)
+	}
+	return types.Ok(types.NewList(results))
+}
+
+// builtinFilter keeps the elements of a list fn returns a true value for
+// filter(list, fn) -> list
+func builtinFilter(ctx *types.TaskContext, args []types.Value, r *Registry) types.Result {
+	list, fn, code := listAndLambda(args)
+	if code != types.E_NONE {
+		return types.Err(code)
+	}
+
+	var kept []types.Value
+	for i := 1; i <= list.Len(); i++ {
+		elem := list.Get(i)
+		result := r.CallLambda(fn, []types.Value{elem}, ctx)
+		if result.Flow == types.FlowException {
+			return result
+		}
+		if result.Val.Truthy() {
+			kept = append(kept, elem)
+		}
+	}
+	return types.Ok(types.NewList(kept))
+}
+
+// builtinReduce folds a list with fn, from the left
+// reduce(list, fn [, initial]) -> value
+// fn is called as fn(accumulated, element). Without an initial value the
+// first element starts the fold, so an empty list raises E_INVARG.
+func builtinReduce(ctx *types.TaskContext, args []types.Value, r *Registry) types.Result {
+	if len(args) < 2 || len(args) > 3 {
+		return types.Err(types.E_ARGS)
+	}
+	list, fn, code := listAndLambda(args[:2])
+	if code != types.E_NONE {
+		return types.Err(code)
+	}
+
+	start := 1
+	var acc types.Value
+	if len(args) == 3 {
+		acc = args[2]
+	} else if list.Len() == 0 {
+		return types.Err(types.E_INVARG)
+	} else {
+		acc = list.Get(1)
+		start = 2
+	}
+
+	for i := start; i <= list.Len(); i++ {
+		result := r.CallLambda(fn, []types.Value{acc, list.Get(i)}, ctx)
+		if result.Flow == types.FlowException {
+			return result
+		}
+		acc = result.Val
+	}
+	return types.Ok(acc)
+}
+
+// sortWithLambda sorts elements in place with fn as the "less than"
+// comparison, keeping equal elements in order
+// sort(list, fn) -> list
+func sortWithLambda(ctx *types.TaskContext, elements []types.Value, fn types.LambdaValue, r *Registry) types.Result {
+	var failed *types.Result
+	sort.SliceStable(elements, func(i, j int) bool {
+		if failed != nil {
+			return false
+		}
+		result := r.CallLambda(fn, []types.Value{elements[i], elements[j]}, ctx)
+		if result.Flow == types.FlowException {
+			failed = &result
+			return false
+		}
+		return result.Val.Truthy()
+	})
+	if failed != nil {
+		return *failed
+	}
+	return types.Ok(types.NewList(elements))
+}
+
+// listAndLambda checks the (list, fn) arguments of map(), filter() and
+// reduce()
+func listAndLambda(args []types.Value) (types.ListValue, types.LambdaValue, types.ErrorCode) {
+	if len(args) != 2 {
+		return types.ListValue{}, types.LambdaValue{}, types.E_ARGS
+	}
+	list, ok := args[0].(types.ListValue)
+	fn, isLambda := args[1].(types.LambdaValue)
+	if !ok || !isLambda {
+		return types.ListValue{}, types.LambdaValue{}, types.E_TYPE
+	}
+	return list, fn, types.E_NONE
+}
@@ -4,6 +4,7 @@ import (
 	"barn/db"
 	"barn/types"
 	"math"
+	"strings"
 	"sync"
 )
 
@@ -23,6 +24,8 @@ const (
 	maxStringConcatLimit     = math.MaxInt32 - minStringConcatLimit
 	maxListValueBytesLimit   = math.MaxInt32 - minListValueBytesLimit
 	maxMapValueBytesLimit    = math.MaxInt32 - minMapValueBytesLimit
+	defaultMaxStackDepth     = 50 // LambdaMOO's DEFAULT_MAX_STACK_DEPTH, also the minimum
+	defaultMaxTaskMemory     = 0  // No limit
 )
 
 var (
@@ -31,10 +34,15 @@ var (
 		maxStringConcat   int
 		maxListValueBytes int
 		maxMapValueBytes  int
+		maxStackDepth     int
+		maxTaskMemory     int64
+		quota             quotaMode       // Which ownership quotas create() enforces
+		protected         map[string]bool // Builtin names with a true protect_<name> option
 	}{
 		maxStringConcat:   defaultMaxStringConcat,
 		maxListValueBytes: defaultMaxListValueBytes,
 		maxMapValueBytes:  defaultMaxMapValueBytes,
+		maxStackDepth:     defaultMaxStackDepth,
 	}
 )
 
@@ -46,6 +54,40 @@ func GetMaxStringConcat() int {
 	return serverOptionsCache.maxStringConcat
 }
 
+// GetMaxStackDepth returns the cached max_stack_depth: the most verb and
+// eval() activations a task may have before calls raise E_MAXREC.
+func GetMaxStackDepth() int {
+	serverOptionsCache.RLock()
+	defer serverOptionsCache.RUnlock()
+	return serverOptionsCache.maxStackDepth
+}
+
+// GetMaxTaskMemory returns the cached max_task_memory: the bytes a task's
+// values may hold before the task is aborted with E_QUOTA, or 0 for no limit.
+func GetMaxTaskMemory() int64 {
+	serverOptionsCache.RLock()
+	defer serverOptionsCache.RUnlock()
+	return serverOptionsCache.maxTaskMemory
+}
+
+// getQuotaMode returns which ownership quotas create() and recycle() keep,
+// as the ownership_quota and ownership_byte_quota options last loaded
+func getQuotaMode() quotaMode {
+	serverOptionsCache.RLock()
+	defer serverOptionsCache.RUnlock()
+	return serverOptionsCache.quota
+}
+
+// IsBuiltinProtected reports whether $server_options.protect_<name> was
+// true at the last load_server_options(). Calls to a protected builtin from
+// anywhere but #0 go to #0:bf_<name> if it exists; otherwise only wizards
+// may call it.
+func IsBuiltinProtected(name string) bool {
+	serverOptionsCache.RLock()
+	defer serverOptionsCache.RUnlock()
+	return serverOptionsCache.protected[name]
+}
+
 // findPropertyInherited finds a property anywhere in the inheritance chain
 // Returns the property or nil if not found
 func findPropertyInherited(objID types.ObjID, name string, store *db.Store) *db.Property {
@@ -86,6 +128,8 @@ func LoadServerOptionsFromStore(store *db.Store) int {
 	nextString := defaultMaxStringConcat
 	nextList := defaultMaxListValueBytes
 	nextMap := defaultMaxMapValueBytes
+	nextDepth := defaultMaxStackDepth
+	nextMemory := int64(defaultMaxTaskMemory)
 	loaded := 0
 
 	if store == nil {
@@ -93,7 +137,12 @@ func LoadServerOptionsFromStore(store *db.Store) int {
 		serverOptionsCache.maxStringConcat = nextString
 		serverOptionsCache.maxListValueBytes = nextList
 		serverOptionsCache.maxMapValueBytes = nextMap
+		serverOptionsCache.maxStackDepth = nextDepth
+		serverOptionsCache.maxTaskMemory = nextMemory
+		serverOptionsCache.quota = 0
+		serverOptionsCache.protected = nil
 		serverOptionsCache.Unlock()
+		types.SetUnicodeStrings(false)
 		return 0
 	}
 
@@ -104,7 +153,12 @@ func LoadServerOptionsFromStore(store *db.Store) int {
 		serverOptionsCache.maxStringConcat = nextString
 		serverOptionsCache.maxListValueBytes = nextList
 		serverOptionsCache.maxMapValueBytes = nextMap
+		serverOptionsCache.maxStackDepth = nextDepth
+		serverOptionsCache.maxTaskMemory = nextMemory
+		serverOptionsCache.quota = 0
+		serverOptionsCache.protected = nil
 		serverOptionsCache.Unlock()
+		types.SetUnicodeStrings(false)
 		return 0 // No server_options property
 	}
 
@@ -115,7 +169,12 @@ func LoadServerOptionsFromStore(store *db.Store) int {
 		serverOptionsCache.maxStringConcat = nextString
 		serverOptionsCache.maxListValueBytes = nextList
 		serverOptionsCache.maxMapValueBytes = nextMap
+		serverOptionsCache.maxStackDepth = nextDepth
+		serverOptionsCache.maxTaskMemory = nextMemory
+		serverOptionsCache.quota = 0
+		serverOptionsCache.protected = nil
 		serverOptionsCache.Unlock()
+		types.SetUnicodeStrings(false)
 		return 0 // server_options is not an object
 	}
 
@@ -146,15 +205,95 @@ func LoadServerOptionsFromStore(store *db.Store) int {
 		}
 	}
 
+	// Read max_stack_depth; like LambdaMOO, values below the default are raised to it
+	if prop := findPropertyInherited(serverOptsID, "max_stack_depth", store); prop != nil {
+		if intVal, ok := prop.Value.(types.IntValue); ok {
+			nextDepth = max(int(intVal.Val), defaultMaxStackDepth)
+			loaded++
+		}
+	}
+
+	// Read max_task_memory; zero or less means no limit
+	if prop := findPropertyInherited(serverOptsID, "max_task_memory", store); prop != nil {
+		if intVal, ok := prop.Value.(types.IntValue); ok {
+			nextMemory = max(intVal.Val, 0)
+			loaded++
+		}
+	}
+
+	// Read unicode_strings: string builtins and indexing count runes, not bytes
+	nextUnicode := false
+	if prop := findPropertyInherited(serverOptsID, "unicode_strings", store); prop != nil && prop.Value != nil {
+		nextUnicode = prop.Value.Truthy()
+		loaded++
+	}
+
+	// Read ownership_quota and ownership_byte_quota: whether create() charges
+	// owners' quotas itself rather than leaving it to an in-database wrapper
+	var nextQuota quotaMode
+	if prop := findPropertyInherited(serverOptsID, "ownership_quota", store); prop != nil && prop.Value != nil {
+		if prop.Value.Truthy() {
+			nextQuota |= quotaObjects
+		}
+		loaded++
+	}
+	if prop := findPropertyInherited(serverOptsID, "ownership_byte_quota", store); prop != nil && prop.Value != nil {
+		if prop.Value.Truthy() {
+			nextQuota |= quotaBytes
+		}
+		loaded++
+	}
+
+	// Read protect_<name> flags
+	protected := loadProtectFlags(serverOptsID, store)
+	loaded += len(protected)
+
 	serverOptionsCache.Lock()
 	serverOptionsCache.maxStringConcat = nextString
 	serverOptionsCache.maxListValueBytes = nextList
 	serverOptionsCache.maxMapValueBytes = nextMap
+	serverOptionsCache.maxStackDepth = nextDepth
+	serverOptionsCache.maxTaskMemory = nextMemory
+	serverOptionsCache.quota = nextQuota
+	serverOptionsCache.protected = protected
 	serverOptionsCache.Unlock()
+	types.SetUnicodeStrings(nextUnicode)
 
 	return loaded
 }
 
+// loadProtectFlags returns the builtin names whose protect_<name> option is
+// true on the server options object or its ancestors
+func loadProtectFlags(serverOptsID types.ObjID, store *db.Store) map[string]bool {
+	var protected map[string]bool
+	seen := make(map[types.ObjID]bool)
+	for id := serverOptsID; !seen[id]; {
+		seen[id] = true
+		obj := store.Get(id)
+		if obj == nil {
+			break
+		}
+		for propName := range obj.Properties {
+			name, ok := strings.CutPrefix(propName, "protect_")
+			if !ok || name == "" || protected[name] {
+				continue
+			}
+			// The nearest definition wins, so re-read through inheritance
+			if prop := findPropertyInherited(serverOptsID, propName, store); prop != nil && prop.Value != nil && prop.Value.Truthy() {
+				if protected == nil {
+					protected = make(map[string]bool)
+				}
+				protected[name] = true
+			}
+		}
+		if len(obj.Parents) == 0 {
+			break
+		}
+		id = obj.Parents[0]
+	}
+	return protected
+}
+
 func canonicalizeLimit(value, min, max int) int {
 	if value > 0 && value < min {
 		return min
@@ -214,10 +353,14 @@ func ValueBytes(v types.Value) int {
 	case types.ListValue:
 		// List contains: Var for the list itself + Var for length + elements
 		// Toast: sizeof(Var) + list_sizeof() where list_sizeof = sizeof(Var) + elements
+		if size, ok := val.ByteSize(); ok {
+			return size
+		}
 		size := varSize + varSize // list Var + length Var
 		for i := 1; i <= val.Len(); i++ {
 			size += ValueBytes(val.Get(i))
 		}
+		val.SetByteSize(size)
 		return size
 	case types.MapValue:
 		// Similar to list: Var for map + overhead + entries
@@ -263,6 +406,26 @@ func CheckListLimit(list types.ListValue) types.ErrorCode {
 	return types.E_NONE
 }
 
+// CheckListGrowth is CheckListLimit for result, a list made from base by
+// adding the elements added and dropping the elements removed. Unlike
+// CheckListLimit it doesn't walk result, and it records result's size so
+// the next change to it needn't either.
+func CheckListGrowth(base, result types.ListValue, added, removed []types.Value) types.ErrorCode {
+	size := ValueBytes(base)
+	for _, v := range added {
+		size += ValueBytes(v)
+	}
+	for _, v := range removed {
+		size -= ValueBytes(v)
+	}
+	result.SetByteSize(size)
+	limit := GetMaxListValueBytes()
+	if limit > 0 && size >= limit {
+		return types.E_QUOTA
+	}
+	return types.E_NONE
+}
+
 // CheckMapLimit checks if a map exceeds the max_map_value_bytes limit.
 // Returns E_QUOTA if limit exceeded, E_NONE otherwise.
 func CheckMapLimit(m types.MapValue) types.ErrorCode {
@@ -276,8 +439,14 @@ func CheckMapLimit(m types.MapValue) types.ErrorCode {
 // CheckStringLimit checks if a string exceeds the max_string_concat limit.
 // Returns E_QUOTA if limit exceeded, E_NONE otherwise.
 func CheckStringLimit(s string) types.ErrorCode {
+	return CheckStringLength(len(s))
+}
+
+// CheckStringLength is CheckStringLimit for a string of n bytes that has
+// not been built yet.
+func CheckStringLength(n int) types.ErrorCode {
 	limit := GetMaxStringConcat()
-	if limit > 0 && len(s) > limit {
+	if limit > 0 && n > limit {
 		return types.E_QUOTA
 	}
 	return types.E_NONE
@@ -0,0 +1,58 @@
+package builtins
+
+import (
+	"barn/db"
+	"barn/lint"
+	"barn/types"
+)
+
+// builtinLint implements lint([obj [, verb]])
+// Checks the verbs of the whole database, of one object, or one verb
+// (found through inheritance as verb_code() does) and returns a list of
+// ["object", "verb", "line", "check", "message"] maps. Wizard only.
+func builtinLint(ctx *types.TaskContext, args []types.Value, store *db.Store, registry *Registry) types.Result {
+	if len(args) > 2 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	linter := lint.New(store, registry.Arity)
+	var findings []lint.Finding
+	if len(args) == 0 {
+		findings = linter.All()
+	} else {
+		objVal, ok := args[0].(types.ObjValue)
+		if !ok {
+			return types.Err(types.E_TYPE)
+		}
+		obj := store.Get(objVal.ID())
+		if obj == nil {
+			return types.Err(types.E_INVIND)
+		}
+		if len(args) == 1 {
+			findings = linter.Object(obj)
+		} else {
+			name, ok := args[1].(types.StrValue)
+			if !ok {
+				return types.Err(types.E_TYPE)
+			}
+			verb, definer, err := store.FindVerb(obj.ID, name.Value())
+			if err != nil {
+				return types.Err(types.E_VERBNF)
+			}
+			findings = linter.Verb(store.Get(definer), verb)
+		}
+	}
+	result := make([]types.Value, 0, len(findings))
+	for _, f := range findings {
+		result = append(result, types.NewMap([][2]types.Value{
+			{types.NewStr("object"), types.NewObj(f.Object)},
+			{types.NewStr("verb"), types.NewStr(f.Verb)},
+			{types.NewStr("line"), types.NewInt(int64(f.Line))},
+			{types.NewStr("check"), types.NewStr(f.Check)},
+			{types.NewStr("message"), types.NewStr(f.Message)},
+		}))
+	}
+	return types.Ok(types.NewList(result))
+}
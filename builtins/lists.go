@@ -3,7 +3,9 @@ package builtins
 import (
 	"barn/types"
 	"fmt"
+	"slices"
 	"sort"
+	"strings"
 )
 
 // ============================================================================
@@ -42,7 +44,7 @@ func builtinListappend(ctx *types.TaskContext, args []types.Value) types.Result
 	result := list.InsertAt(index+1, value)
 
 	// Check size limit
-	if err := CheckListLimit(result); err != types.E_NONE {
+	if err := CheckListGrowth(list, result, []types.Value{value}, nil); err != types.E_NONE {
 		return types.Err(err)
 	}
 
@@ -261,7 +263,13 @@ func builtinIsMember(ctx *types.TaskContext, args []types.Value) types.Result {
 
 // builtinSort sorts a list
 // sort(list [, keys] [, natural] [, reverse]) -> list
-func builtinSort(ctx *types.TaskContext, args []types.Value) types.Result {
+// sort(list, fn) -> list, ordered by the lambda fn(a, b) meaning a < b
+//
+// With a non-empty keys list, list is ordered by the parallel element of
+// keys. The values compared must all be of one type: INT, FLOAT, OBJ, ERR or
+// STR. Strings compare case-insensitively, and with natural set, digit runs
+// compare as numbers ("item2" < "item10"). The sort is stable.
+func builtinSort(ctx *types.TaskContext, args []types.Value, r *Registry) types.Result {
 	if len(args) < 1 || len(args) > 4 {
 		return types.Err(types.E_ARGS)
 	}
@@ -271,21 +279,86 @@ func builtinSort(ctx *types.TaskContext, args []types.Value) types.Result {
 		return types.Err(types.E_TYPE)
 	}
 
-	// For now, implement simple sort (ignoring keys, natural, reverse)
-	// TODO: Implement full sort with all parameters
+	sortBy := list
+	if len(args) > 1 {
+		switch keys := args[1].(type) {
+		case types.LambdaValue:
+			if len(args) > 2 {
+				return types.Err(types.E_ARGS)
+			}
+			elements := make([]types.Value, list.Len())
+			copy(elements, list.Elements())
+			return sortWithLambda(ctx, elements, keys, r)
+		case types.ListValue:
+			if keys.Len() > 0 {
+				if keys.Len() != list.Len() {
+					return types.Err(types.E_INVARG)
+				}
+				sortBy = keys
+			}
+		default:
+			return types.Err(types.E_TYPE)
+		}
+	}
+	natural := len(args) > 2 && args[2].Truthy()
+	reverse := len(args) > 3 && args[3].Truthy()
 
-	// Copy list elements
-	elements := make([]types.Value, list.Len())
-	for i := 1; i <= list.Len(); i++ {
-		elements[i-1] = list.Get(i)
+	// Like Toast, a list of one is returned as it is, whatever it holds
+	if list.Len() <= 1 {
+		return types.Ok(list)
+	}
+
+	keys := sortBy.Elements()
+	for _, key := range keys {
+		if key.Type() != keys[0].Type() || !sortableType(key.Type()) {
+			return types.Err(types.E_TYPE)
+		}
+	}
+
+	sortList := func() types.Result {
+		order := make([]int, len(keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := keys[order[i]], keys[order[j]]
+			var cmp int
+			if as, ok := a.(types.StrValue); ok && natural {
+				cmp = naturalCompare(as.Value(), b.(types.StrValue).Value())
+			} else {
+				cmp = compareValues(a, b)
+			}
+			if reverse {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+
+		elements := list.Elements()
+		sorted := make([]types.Value, len(order))
+		for i, j := range order {
+			sorted[i] = elements[j]
+		}
+		return types.Ok(types.NewList(sorted))
+	}
+	// Sorting with a lambda calls back into the VM, so only plain sorts of
+	// long lists run in the background
+	if len(keys) >= threadedSortMin {
+		return runInBackground(ctx, sortList)
 	}
+	return sortList()
+}
 
-	// Sort using Go's sort package
-	sort.Slice(elements, func(i, j int) bool {
-		return compareValues(elements[i], elements[j]) < 0
-	})
+// threadedSortMin is the shortest list sort() orders in the background
+const threadedSortMin = 10000
 
-	return types.Ok(types.NewList(elements))
+// sortableType reports whether sort() can order values of type t
+func sortableType(t types.TypeCode) bool {
+	switch t {
+	case types.TYPE_INT, types.TYPE_FLOAT, types.TYPE_OBJ, types.TYPE_ERR, types.TYPE_STR:
+		return true
+	}
+	return false
 }
 
 // builtinReverse reverses a list or string
@@ -305,11 +378,9 @@ func builtinReverse(ctx *types.TaskContext, args []types.Value) types.Result {
 		}
 		return types.Ok(types.NewList(elements))
 	case types.StrValue:
-		runes := []rune(v.Value())
-		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
-			runes[i], runes[j] = runes[j], runes[i]
-		}
-		return types.Ok(types.NewStr(string(runes)))
+		chars := types.StrChars(v.Value())
+		slices.Reverse(chars)
+		return types.Ok(types.NewStr(strings.Join(chars, "")))
 	default:
 		return types.Err(types.E_INVARG)
 	}
@@ -383,13 +454,7 @@ func compareValues(a, b types.Value) int {
 		return 0
 
 	case types.StrValue:
-		bv := b.(types.StrValue)
-		if av.Value() < bv.Value() {
-			return -1
-		} else if av.Value() > bv.Value() {
-			return 1
-		}
-		return 0
+		return compareFolded(av.Value(), b.(types.StrValue).Value())
 
 	case types.ObjValue:
 		bv := b.(types.ObjValue)
@@ -422,6 +487,128 @@ func compareValues(a, b types.Value) int {
 	}
 }
 
+// compareFolded compares strings the way MOO collates them: byte by byte,
+// ignoring ASCII case, like strcasecmp
+func compareFolded(a, b string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ca, cb := lowerASCII(a[i]), lowerASCII(b[i])
+		if ca != cb {
+			if ca < cb {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// naturalCompare compares strings case-insensitively with runs of digits
+// compared by value, so "item2" < "item10". It follows strnatcasecmp, which
+// Toast uses: whitespace is skipped, and a run with a leading zero compares
+// as a fraction, digit by digit.
+func naturalCompare(a, b string) int {
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	for i, j := 0, 0; ; i, j = i+1, j+1 {
+		for isSpaceByte(at(a, i)) {
+			i++
+		}
+		for isSpaceByte(at(b, j)) {
+			j++
+		}
+		ca, cb := at(a, i), at(b, j)
+		if isDigitByte(ca) && isDigitByte(cb) {
+			var cmp int
+			if ca == '0' || cb == '0' {
+				cmp = compareDigitsLeft(a[i:], b[j:])
+			} else {
+				cmp = compareDigitsRight(a[i:], b[j:])
+			}
+			if cmp != 0 {
+				return cmp
+			}
+		}
+		if ca == 0 && cb == 0 {
+			return 0
+		}
+		ca, cb = lowerASCII(ca), lowerASCII(cb)
+		if ca < cb {
+			return -1
+		}
+		if ca > cb {
+			return 1
+		}
+	}
+}
+
+// compareDigitsRight compares two digit runs by value: the longer run is
+// larger, and between runs of one length the first difference decides
+func compareDigitsRight(a, b string) int {
+	bias := 0
+	for i := 0; ; i++ {
+		da := i < len(a) && isDigitByte(a[i])
+		db := i < len(b) && isDigitByte(b[i])
+		switch {
+		case !da && !db:
+			return bias
+		case !da:
+			return -1
+		case !db:
+			return 1
+		case bias == 0 && a[i] < b[i]:
+			bias = -1
+		case bias == 0 && a[i] > b[i]:
+			bias = 1
+		}
+	}
+}
+
+// compareDigitsLeft compares two digit runs as fractions: the first
+// difference decides, and a shorter run is smaller
+func compareDigitsLeft(a, b string) int {
+	for i := 0; ; i++ {
+		da := i < len(a) && isDigitByte(a[i])
+		db := i < len(b) && isDigitByte(b[i])
+		switch {
+		case !da && !db:
+			return 0
+		case !da:
+			return -1
+		case !db:
+			return 1
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+}
+
+func isDigitByte(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
 // builtinSlice: slice(list [, index] [, default_value]) → LIST
 // Extracts elements from each item in a list of lists, strings, or maps.
 func builtinSlice(ctx *types.TaskContext, args []types.Value) types.Result {
@@ -0,0 +1,106 @@
+package builtins
+
+import (
+	"testing"
+
+	"barn/types"
+)
+
+func strList(ss ...string) types.ListValue {
+	elems := make([]types.Value, len(ss))
+	for i, s := range ss {
+		elems[i] = types.NewStr(s)
+	}
+	return types.NewList(elems)
+}
+
+func intList(ns ...int64) types.ListValue {
+	elems := make([]types.Value, len(ns))
+	for i, n := range ns {
+		elems[i] = types.NewInt(n)
+	}
+	return types.NewList(elems)
+}
+
+func TestSort(t *testing.T) {
+	r := NewRegistry()
+	empty := types.NewEmptyList()
+	tests := []struct {
+		name string
+		args []types.Value
+		want types.Value
+		err  types.ErrorCode
+	}{
+		{"ints", []types.Value{intList(3, 1, 2)}, intList(1, 2, 3), types.E_NONE},
+		{"ignore case", []types.Value{strList("b", "C", "a")}, strList("a", "b", "C"), types.E_NONE},
+		{"equal strings keep order", []types.Value{strList("B", "a", "b")}, strList("a", "B", "b"), types.E_NONE},
+		{"reverse", []types.Value{intList(3, 1, 2), empty, types.NewInt(0), types.NewInt(1)}, intList(3, 2, 1), types.E_NONE},
+		{"natural", []types.Value{strList("a10", "a2", "a1"), empty, types.NewInt(1)}, strList("a1", "a2", "a10"), types.E_NONE},
+		{"not natural", []types.Value{strList("a10", "a2", "a1")}, strList("a1", "a10", "a2"), types.E_NONE},
+		{"natural leading zeros", []types.Value{strList("x010", "x9", "x02"), empty, types.NewInt(1)}, strList("x010", "x02", "x9"), types.E_NONE},
+		{"natural spaces", []types.Value{strList("a  2", "a 10"), empty, types.NewInt(1)}, strList("a  2", "a 10"), types.E_NONE},
+		{"keys", []types.Value{strList("a", "b", "c"), intList(2, 3, 1)}, strList("c", "a", "b"), types.E_NONE},
+		{"keys stable", []types.Value{strList("a", "b", "c", "d"), intList(2, 1, 2, 1)}, strList("b", "d", "a", "c"), types.E_NONE},
+		{"keys stable reversed", []types.Value{strList("a", "b", "c", "d"), intList(2, 1, 2, 1), types.NewInt(0), types.NewInt(1)}, strList("a", "c", "b", "d"), types.E_NONE},
+		{"single list element", []types.Value{types.NewList([]types.Value{intList(2, 1)})}, types.NewList([]types.Value{intList(2, 1)}), types.E_NONE},
+		{"keys length", []types.Value{intList(1, 2, 3), intList(1, 2)}, nil, types.E_INVARG},
+		{"mixed types", []types.Value{types.NewList([]types.Value{types.NewInt(1), types.NewStr("a")})}, nil, types.E_TYPE},
+		{"int and float", []types.Value{types.NewList([]types.Value{types.NewInt(1), types.NewFloat(0.5)})}, nil, types.E_TYPE},
+		{"lists", []types.Value{types.NewList([]types.Value{intList(2), intList(1)})}, nil, types.E_TYPE},
+		{"keys not a list", []types.Value{intList(1, 2), types.NewInt(1)}, nil, types.E_TYPE},
+		{"reverse is truthy", []types.Value{intList(1, 2), empty, types.NewInt(0), types.NewStr("yes")}, intList(2, 1), types.E_NONE},
+		{"reverse falsy", []types.Value{intList(2, 1), empty, types.NewInt(0), types.NewStr("")}, intList(1, 2), types.E_NONE},
+		{"too many args", []types.Value{intList(1), empty, types.NewInt(0), types.NewInt(0), types.NewInt(0)}, nil, types.E_ARGS},
+	}
+	for _, tt := range tests {
+		result := builtinSort(types.NewTaskContext(), tt.args, r)
+		if tt.err != types.E_NONE {
+			if result.Flow != types.FlowException || result.Error != tt.err {
+				t.Errorf("%s: got %v (error %v), want %v", tt.name, result.Val, result.Error, tt.err)
+			}
+			continue
+		}
+		if result.Flow != types.FlowNormal {
+			t.Errorf("%s: raised %v", tt.name, result.Error)
+			continue
+		}
+		// Compare printed forms so string case counts
+		if got := result.Val.String(); got != tt.want.String() {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"item2", "item10", -1},
+		{"Item2", "item10", -1},
+		{"abc", "ABC", 0},
+		{"1.5", "1.10", -1}, // Digits after a dot are still a number
+		{"x", "x1", -1},
+		{"", "", 0},
+		{"pic01", "pic1", -1}, // Leading zeros compare as fractions
+		{" a", "a", 0},
+	}
+	for _, tt := range tests {
+		if got := naturalCompare(tt.a, tt.b); sign(got) != tt.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := naturalCompare(tt.b, tt.a); sign(got) != -tt.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
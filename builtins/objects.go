@@ -12,70 +12,70 @@ func (r *Registry) RegisterObjectBuiltins(store *db.Store) {
 	// Object creation and lifecycle
 	r.Register("create", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinCreate(ctx, args, store, r)
-	})
+	}).Args(1, -1)
 
 	r.Register("recycle", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinRecycle(ctx, args, store, r)
-	})
+	}).Args(1, 1)
 
 	r.Register("valid", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinValid(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	r.Register("max_object", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinMaxObject(ctx, args, store)
-	})
+	}).Args(0, 0)
 
 	// Inheritance
 	r.Register("parent", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinParent(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	r.Register("parents", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinParents(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	r.Register("children", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinChildren(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	r.Register("ancestors", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinAncestors(ctx, args, store)
-	})
+	}).Args(1, 2)
 
 	r.Register("descendants", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinDescendants(ctx, args, store)
-	})
+	}).Args(1, 2)
 
 	r.Register("isa", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinIsa(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("chparent", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinChparent(ctx, args, store)
-	})
+	}).Args(2, 3)
 
 	r.Register("chparents", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinChparents(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	// Location and movement
 	r.Register("move", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinMove(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	// Player management
 	r.Register("is_player", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinIsPlayer(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	r.Register("set_player_flag", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinSetPlayerFlag(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("players", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinPlayers(ctx, args, store)
-	})
+	}).Args(0, 0)
 
 	r.Register("occupants", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinOccupants(ctx, args, store)
@@ -83,7 +83,7 @@ func (r *Registry) RegisterObjectBuiltins(store *db.Store) {
 
 	r.Register("renumber", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinRenumber(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	// Waif management
 	r.Register("new_waif", func(ctx *types.TaskContext, args []types.Value) types.Result {
@@ -92,7 +92,7 @@ func (r *Registry) RegisterObjectBuiltins(store *db.Store) {
 
 	r.Register("object_bytes", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinObjectBytes(ctx, args, store)
-	})
+	}).Args(1, 1)
 }
 
 // builtinCreate implements create(parent [, owner] [, anonymous] [, args])
@@ -340,8 +340,14 @@ func builtinCreate(ctx *types.TaskContext, args []types.Value, store *db.Store,
 	copied := copyInheritedProperties(obj, store)
 	obj.Properties = copied
 
+	// Charge the owner's quota, if the server keeps quotas
+	if errCode := checkOwnershipQuota(store, owner, obj); errCode != types.E_NONE {
+		return types.Err(errCode)
+	}
+
 	// Add object to store
 	if err := store.Add(obj); err != nil {
+		refundOwnershipQuota(store, obj)
 		return types.Err(types.E_QUOTA)
 	}
 
@@ -353,6 +359,7 @@ func builtinCreate(ctx *types.TaskContext, args []types.Value, store *db.Store,
 			parent := store.Get(parentID)
 			if parent != nil {
 				parent.Children = append(parent.Children, newID)
+				store.MarkDirty(parentID)
 			}
 		}
 	} else {
@@ -566,6 +573,7 @@ func builtinRecycle(ctx *types.TaskContext, args []types.Value, store *db.Store,
 			}
 		}
 		child.Parents = newChildParents
+		store.MarkDirty(childID)
 
 		// Add child to new parents' children lists
 		for _, newParentID := range objParents {
@@ -581,6 +589,7 @@ func builtinRecycle(ctx *types.TaskContext, args []types.Value, store *db.Store,
 				}
 				if !hasChild {
 					newParent.Children = append(newParent.Children, childID)
+					store.MarkDirty(newParentID)
 				}
 			}
 		}
@@ -591,6 +600,7 @@ func builtinRecycle(ctx *types.TaskContext, args []types.Value, store *db.Store,
 		content := store.Get(contentID)
 		if content != nil {
 			content.Location = types.ObjNothing
+			store.MarkDirty(contentID)
 		}
 	}
 	obj.Contents = []types.ObjID{}
@@ -600,6 +610,7 @@ func builtinRecycle(ctx *types.TaskContext, args []types.Value, store *db.Store,
 		oldLoc := store.Get(obj.Location)
 		if oldLoc != nil {
 			oldLoc.Contents = removeObjID(oldLoc.Contents, objID)
+			store.MarkDirty(oldLoc.ID)
 		}
 	}
 
@@ -615,6 +626,7 @@ func builtinRecycle(ctx *types.TaskContext, args []types.Value, store *db.Store,
 		parent := store.Get(parentID)
 		if parent != nil {
 			parent.Children = removeObjID(parent.Children, objID)
+			store.MarkDirty(parentID)
 		}
 	}
 
@@ -622,7 +634,9 @@ func builtinRecycle(ctx *types.TaskContext, args []types.Value, store *db.Store,
 	if err := store.Recycle(objID); err != nil {
 		return types.Err(types.E_INVARG)
 	}
-	store.NoteVerbCacheClear()
+
+	// Give the owner back its quota, if the server keeps quotas
+	refundOwnershipQuota(store, obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -876,6 +890,7 @@ func builtinChparent(ctx *types.TaskContext, args []types.Value, store *db.Store
 		oldParent := store.Get(oldParentID)
 		if oldParent != nil {
 			oldParent.Children = removeObjID(oldParent.Children, objVal.ID())
+			store.MarkDirty(oldParentID)
 			// Remove from ChparentChildren tracking
 			if oldParent.ChparentChildren != nil {
 				delete(oldParent.ChparentChildren, objVal.ID())
@@ -890,6 +905,7 @@ func builtinChparent(ctx *types.TaskContext, args []types.Value, store *db.Store
 		obj.Parents = []types.ObjID{newParentVal.ID()}
 		// Add to new parent's children
 		newParent.Children = append(newParent.Children, objVal.ID())
+		store.MarkDirty(newParent.ID)
 		// Track that this child was added via chparent (not create)
 		if newParent.ChparentChildren == nil {
 			newParent.ChparentChildren = make(map[types.ObjID]bool)
@@ -910,6 +926,8 @@ func builtinChparent(ctx *types.TaskContext, args []types.Value, store *db.Store
 		}
 	}
 	obj.Properties = newProps
+	store.InvalidateVerbCache()
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -1026,6 +1044,7 @@ func builtinChparents(ctx *types.TaskContext, args []types.Value, store *db.Stor
 		oldParent := store.Get(oldParentID)
 		if oldParent != nil {
 			oldParent.Children = removeObjID(oldParent.Children, objVal.ID())
+			store.MarkDirty(oldParentID)
 			// Remove from ChparentChildren tracking
 			if oldParent.ChparentChildren != nil {
 				delete(oldParent.ChparentChildren, objVal.ID())
@@ -1041,6 +1060,7 @@ func builtinChparents(ctx *types.TaskContext, args []types.Value, store *db.Stor
 		newParent := store.Get(newParentID)
 		if newParent != nil {
 			newParent.Children = append(newParent.Children, objVal.ID())
+			store.MarkDirty(newParentID)
 			// Track that this child was added via chparent (not create)
 			if newParent.ChparentChildren == nil {
 				newParent.ChparentChildren = make(map[types.ObjID]bool)
@@ -1062,6 +1082,8 @@ func builtinChparents(ctx *types.TaskContext, args []types.Value, store *db.Stor
 		}
 	}
 	obj.Properties = newProps
+	store.InvalidateVerbCache()
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -1098,17 +1120,20 @@ func builtinMove(ctx *types.TaskContext, args []types.Value, store *db.Store) ty
 		oldLoc := store.Get(what.Location)
 		if oldLoc != nil {
 			oldLoc.Contents = removeObjID(oldLoc.Contents, whatVal.ID())
+			store.MarkDirty(oldLoc.ID)
 		}
 	}
 
 	// Set new location
 	what.Location = whereVal.ID()
+	store.MarkDirty(what.ID)
 
 	// Add to new location's contents (if not moving to nothing)
 	if whereVal.ID() != types.ObjNothing {
 		where := store.Get(whereVal.ID())
 		if where != nil {
 			where.Contents = append(where.Contents, whatVal.ID())
+			store.MarkDirty(where.ID)
 		}
 	}
 
@@ -1566,6 +1591,7 @@ func builtinSetPlayerFlag(ctx *types.TaskContext, args []types.Value, store *db.
 	} else {
 		obj.Flags = obj.Flags.Clear(db.FlagUser)
 	}
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -1776,6 +1802,9 @@ func builtinNewWaif(ctx *types.TaskContext, args []types.Value, store *db.Store)
 
 	// Create the waif
 	waif := types.NewWaif(callerID, owner)
+	// Track it for waif_stats() and the garbage collector, which stops
+	// tracking it once nothing holds it
+	store.RegisterWaif(callerID, &waif)
 	return types.Ok(waif)
 }
 
@@ -1818,77 +1847,6 @@ func builtinObjectBytes(ctx *types.TaskContext, args []types.Value, store *db.St
 	}
 
 	// Calculate approximate byte size
-	bytes := calculateObjectBytes(obj, store)
+	bytes := db.ObjectBytes(obj)
 	return types.Ok(types.NewInt(int64(bytes)))
 }
-
-// calculateObjectBytes calculates approximate memory usage of an object
-// Based on ToastStunt's db_object_bytes implementation
-func calculateObjectBytes(obj *db.Object, store *db.Store) int {
-	// Start with object header size
-	// sizeof(Object) + sizeof(Object*) in C
-	count := 64 + 8 // Approximation for Go struct overhead
-
-	// Object name
-	count += len(obj.Name) + 1
-
-	// Verbs
-	for _, verb := range obj.Verbs {
-		count += 32 // Verb struct overhead
-		count += len(verb.Name) + 1
-		// Program AST size (if compiled)
-		if verb.Program != nil {
-			count += len(verb.Program.Statements) * 64 // Approximate statement size
-		}
-	}
-
-	// Property definitions (properties defined on this object)
-	for _, prop := range obj.Properties {
-		if prop.Defined {
-			count += 32 // Propdef struct overhead
-			count += len(prop.Name) + 1
-		}
-	}
-
-	// Property values (all properties including inherited)
-	for _, prop := range obj.Properties {
-		count += 24 // Pval struct overhead (minus Var size)
-		count += calculateValueBytes(prop.Value)
-	}
-
-	return count
-}
-
-// calculateValueBytes calculates approximate memory usage of a value
-// Based on ToastStunt's value_bytes function
-func calculateValueBytes(v types.Value) int {
-	size := 16 // Base Var struct size
-
-	switch val := v.(type) {
-	case types.StrValue:
-		size += len(val.Value()) + 1
-	case types.FloatValue:
-		size += 8 // sizeof(double)
-	case types.ListValue:
-		elements := val.Elements()
-		size += len(elements) * 16 // List overhead
-		for _, elem := range elements {
-			size += calculateValueBytes(elem)
-		}
-	case types.MapValue:
-		// Approximate map overhead
-		pairs := val.Pairs()
-		size += len(pairs) * 32 // Map node overhead
-		for _, pair := range pairs {
-			size += calculateValueBytes(pair[0]) // Key
-			size += calculateValueBytes(pair[1]) // Value
-		}
-	case types.WaifValue:
-		// Waif overhead - basic struct size
-		size += 64
-		// Note: Waif properties are stored on the class object, not the waif instance
-		// So we just count the waif struct overhead
-	}
-
-	return size
-}
@@ -0,0 +1,120 @@
+package builtins
+
+import (
+	"barn/db"
+	"barn/types"
+)
+
+// builtinExportPackage implements export_package(objects [, descendants [, format]])
+// Returns the package text (YAML by default, or JSON) for the given roots.
+// Wizard only.
+func builtinExportPackage(ctx *types.TaskContext, args []types.Value, store *db.Store) types.Result {
+	if len(args) < 1 || len(args) > 3 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+
+	var roots []types.ObjID
+	switch v := args[0].(type) {
+	case types.ObjValue:
+		roots = []types.ObjID{v.ID()}
+	case types.ListValue:
+		for _, elem := range v.Elements() {
+			obj, ok := elem.(types.ObjValue)
+			if !ok {
+				return types.Err(types.E_TYPE)
+			}
+			roots = append(roots, obj.ID())
+		}
+	default:
+		return types.Err(types.E_TYPE)
+	}
+	for _, id := range roots {
+		if !store.Valid(id) {
+			return types.Err(types.E_INVARG)
+		}
+	}
+
+	descendants := true
+	if len(args) >= 2 {
+		descendants = args[1].Truthy()
+	}
+	format := "yaml"
+	if len(args) == 3 {
+		s, ok := args[2].(types.StrValue)
+		if !ok {
+			return types.Err(types.E_TYPE)
+		}
+		format = s.Value()
+	}
+
+	pkg, err := store.ExportPackage(roots, descendants)
+	if err != nil {
+		return types.Err(types.E_INVARG)
+	}
+	data, err := pkg.Marshal(format)
+	if err != nil {
+		return types.Err(types.E_INVARG)
+	}
+	if code := CheckStringLimit(string(data)); code != types.E_NONE {
+		return types.Err(code)
+	}
+	return types.Ok(types.NewStr(string(data)))
+}
+
+// builtinImportPackage implements import_package(text [, owner [, dry_run]])
+// Returns ["objects" -> ["key" -> #new, ...], "conflicts" -> {messages}].
+// When there are conflicts nothing is created. Raises E_INVARG if the
+// import fails for any other reason. Wizard only.
+func builtinImportPackage(ctx *types.TaskContext, args []types.Value, store *db.Store) types.Result {
+	if len(args) < 1 || len(args) > 3 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+
+	text, ok := args[0].(types.StrValue)
+	if !ok {
+		return types.Err(types.E_TYPE)
+	}
+	opts := db.ImportOptions{Owner: ctx.Programmer}
+	if len(args) >= 2 {
+		owner, ok := args[1].(types.ObjValue)
+		if !ok {
+			return types.Err(types.E_TYPE)
+		}
+		if !store.Valid(owner.ID()) {
+			return types.Err(types.E_INVARG)
+		}
+		opts.Owner = owner.ID()
+	}
+	if len(args) == 3 {
+		opts.DryRun = args[2].Truthy()
+	}
+
+	pkg, err := db.ParsePackage([]byte(text.Value()))
+	if err != nil {
+		return types.Err(types.E_INVARG)
+	}
+	result, err := store.ImportPackage(pkg, opts)
+	if err != nil && len(result.Conflicts) == 0 {
+		// Conflicts are reported below; anything else means the import failed
+		return types.Err(types.E_INVARG)
+	}
+
+	objects := make([][2]types.Value, 0, len(result.Objects))
+	for key, id := range result.Objects {
+		objects = append(objects, [2]types.Value{types.NewStr(key), types.NewObj(id)})
+	}
+	conflicts := make([]types.Value, len(result.Conflicts))
+	for i, msg := range result.Conflicts {
+		conflicts[i] = types.NewStr(msg)
+	}
+	return types.Ok(types.NewMap([][2]types.Value{
+		{types.NewStr("objects"), types.NewMap(objects)},
+		{types.NewStr("conflicts"), types.NewList(conflicts)},
+	}))
+}
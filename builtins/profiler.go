@@ -0,0 +1,144 @@
+package builtins
+
+import (
+	"barn/profile"
+	"barn/types"
+	"sort"
+	"time"
+)
+
+// builtinProfilerStart implements profiler_start([lines])
+// Starts (or resumes) the verb profiler; a true lines argument also
+// charges cost to individual source lines. Wizard only.
+func builtinProfilerStart(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) > 1 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	lines := len(args) == 1 && args[0].Truthy()
+	profile.Start(lines)
+	return types.Ok(types.NewInt(0))
+}
+
+// builtinProfilerStop implements profiler_stop()
+// Pauses the profiler, keeping what it has collected. Wizard only.
+func builtinProfilerStop(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 0 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	profile.Stop()
+	return types.Ok(types.NewInt(0))
+}
+
+// builtinProfilerReset implements profiler_reset()
+// Discards everything the profiler has collected. Wizard only.
+func builtinProfilerReset(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 0 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	profile.Reset()
+	return types.Ok(types.NewInt(0))
+}
+
+// builtinProfilerStats implements profiler_stats([limit])
+// Returns ["running" -> INT, "lines" -> INT, "elapsed" -> FLOAT,
+// "verbs" -> LIST, "builtins" -> LIST]. Each verb is a map of definer,
+// verb, calls, ticks, time, self_time and builtin_time (seconds), plus
+// "lines" -> [line -> ["ticks" -> INT, "time" -> FLOAT]] when per-line
+// profiling is on. Verbs are ordered by self_time; limit keeps the first
+// limit verbs and builtins. Wizard only.
+func builtinProfilerStats(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) > 1 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	limit := -1
+	if len(args) == 1 {
+		n, ok := args[0].(types.IntValue)
+		if !ok {
+			return types.Err(types.E_TYPE)
+		}
+		if n.Val < 0 {
+			return types.Err(types.E_INVARG)
+		}
+		limit = int(n.Val)
+	}
+
+	snap := profile.Stats()
+	if limit >= 0 && len(snap.Verbs) > limit {
+		snap.Verbs = snap.Verbs[:limit]
+	}
+	if limit >= 0 && len(snap.Builtins) > limit {
+		snap.Builtins = snap.Builtins[:limit]
+	}
+
+	verbs := make([]types.Value, 0, len(snap.Verbs))
+	for _, vs := range snap.Verbs {
+		pairs := [][2]types.Value{
+			{types.NewStr("definer"), types.NewObj(vs.Definer)},
+			{types.NewStr("verb"), types.NewStr(vs.Verb)},
+			{types.NewStr("calls"), types.NewInt(vs.Calls)},
+			{types.NewStr("ticks"), types.NewInt(vs.Ticks)},
+			{types.NewStr("time"), durationSeconds(vs.TotalTime)},
+			{types.NewStr("self_time"), durationSeconds(vs.SelfTime)},
+			{types.NewStr("builtin_time"), durationSeconds(vs.BuiltinTime)},
+		}
+		if vs.Lines != nil {
+			lineNos := make([]int, 0, len(vs.Lines))
+			for line := range vs.Lines {
+				lineNos = append(lineNos, line)
+			}
+			sort.Ints(lineNos)
+			lines := make([][2]types.Value, 0, len(lineNos))
+			for _, line := range lineNos {
+				ls := vs.Lines[line]
+				lines = append(lines, [2]types.Value{types.NewInt(int64(line)), types.NewMap([][2]types.Value{
+					{types.NewStr("ticks"), types.NewInt(ls.Ticks)},
+					{types.NewStr("time"), durationSeconds(ls.Time)},
+				})})
+			}
+			pairs = append(pairs, [2]types.Value{types.NewStr("lines"), types.NewMap(lines)})
+		}
+		verbs = append(verbs, types.NewMap(pairs))
+	}
+
+	bfs := make([]types.Value, 0, len(snap.Builtins))
+	for _, bs := range snap.Builtins {
+		bfs = append(bfs, types.NewMap([][2]types.Value{
+			{types.NewStr("name"), types.NewStr(bs.Name)},
+			{types.NewStr("calls"), types.NewInt(bs.Calls)},
+			{types.NewStr("time"), durationSeconds(bs.Time)},
+		}))
+	}
+
+	return types.Ok(types.NewMap([][2]types.Value{
+		{types.NewStr("running"), flagInt(snap.Running)},
+		{types.NewStr("lines"), flagInt(snap.Lines)},
+		{types.NewStr("elapsed"), durationSeconds(snap.Elapsed)},
+		{types.NewStr("verbs"), types.NewList(verbs)},
+		{types.NewStr("builtins"), types.NewList(bfs)},
+	}))
+}
+
+// durationSeconds converts a duration to a MOO float of seconds
+func durationSeconds(d time.Duration) types.Value {
+	return types.NewFloat(d.Seconds())
+}
+
+// flagInt converts a bool to MOO 1 or 0
+func flagInt(b bool) types.Value {
+	if b {
+		return types.NewInt(1)
+	}
+	return types.NewInt(0)
+}
@@ -9,31 +9,31 @@ import (
 func (r *Registry) RegisterPropertyBuiltins(store *db.Store) {
 	r.Register("properties", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinProperties(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	r.Register("property_info", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinPropertyInfo(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("set_property_info", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinSetPropertyInfo(ctx, args, store)
-	})
+	}).Args(3, 3)
 
 	r.Register("add_property", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinAddProperty(ctx, args, store)
-	})
+	}).Args(4, 4)
 
 	r.Register("delete_property", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinDeleteProperty(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("clear_property", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinClearProperty(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("is_clear_property", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinIsClearProperty(ctx, args, store)
-	})
+	}).Args(2, 2)
 }
 
 // builtinProperties implements properties(object)
@@ -198,6 +198,7 @@ func builtinSetPropertyInfo(ctx *types.TaskContext, args []types.Value, store *d
 	default:
 		return types.Err(types.E_TYPE)
 	}
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -220,6 +221,10 @@ func builtinAddProperty(ctx *types.TaskContext, args []types.Value, store *db.St
 	}
 
 	value := args[2]
+	if types.ContainsLambda(value) {
+		// Lambdas only live in running tasks
+		return types.Err(types.E_TYPE)
+	}
 
 	objID := objVal.ID()
 	obj := store.Get(objID)
@@ -312,13 +317,14 @@ func builtinAddProperty(ctx *types.TaskContext, args []types.Value, store *db.St
 	// Create property (defined on this object via add_property)
 	prop := &db.Property{
 		Name:    propName,
-		Value:   value,
+		Value:   store.StoreValue(value),
 		Owner:   owner,
 		Perms:   perms,
 		Clear:   false,
 		Defined: true, // This property is defined on this object
 	}
 	obj.Properties[propName] = prop
+	store.PropertyWritten(obj, prop, nil)
 
 	// Update PropOrder so the property is written during dump_database().
 	// Defined properties go at the PropDefsCount position (before inherited ones).
@@ -378,6 +384,7 @@ func builtinDeleteProperty(ctx *types.TaskContext, args []types.Value, store *db
 
 	// Delete property from this object
 	delete(obj.Properties, propName)
+	store.ObjectChanged(obj)
 
 	// Also remove inherited copies from all descendants
 	removeInheritedProperty(objID, propName, store)
@@ -443,6 +450,7 @@ func builtinClearProperty(ctx *types.TaskContext, args []types.Value, store *db.
 	// Clear property by removing local entry
 	// This causes the property to inherit from parent
 	delete(obj.Properties, propName)
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -655,13 +663,15 @@ func propagatePropertyToDescendants(objID types.ObjID, prop *db.Property, store
 				continue
 			}
 			// Add inherited copy (Clear=true, Defined=false)
-			child.Properties[prop.Name] = &db.Property{
+			inherited := &db.Property{
 				Name:  prop.Name,
 				Value: prop.Value,
 				Owner: prop.Owner,
 				Perms: prop.Perms,
 				Clear: true,
 			}
+			child.Properties[prop.Name] = inherited
+			store.PropertyWritten(child, inherited, nil)
 			queue = append(queue, childID)
 		}
 	}
@@ -694,6 +704,7 @@ func removeInheritedProperty(objID types.ObjID, name string, store *db.Store) {
 			}
 			if prop, ok := child.Properties[name]; ok && !prop.Defined {
 				delete(child.Properties, name)
+				store.ObjectChanged(child)
 			}
 			queue = append(queue, childID)
 		}
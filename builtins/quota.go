@@ -0,0 +1,136 @@
+package builtins
+
+import (
+	"barn/db"
+	"barn/types"
+)
+
+// ============================================================================
+// OWNERSHIP QUOTAS
+// ============================================================================
+//
+// LambdaMOO before 1.8 kept object quotas in the server: a player whose
+// ownership_quota property was an integer could create that many more
+// objects, and got one back for each object recycled. Later servers left
+// quotas to the database (usually a #0:bf_create wrapper), so Barn keeps
+// them only when $server_options asks:
+//
+//   ownership_quota       create() and recycle() keep the owner's
+//                         ownership_quota count, as LambdaMOO did
+//   ownership_byte_quota  create() raises E_QUOTA when the objects the owner
+//                         has would, with the new one, take more than the
+//                         owner's ownership_byte_quota bytes by object_bytes(),
+//                         as the store's running totals count them
+//
+// Either quota is only kept for owners that have the property, with an
+// integer value.
+
+// quotaMode says which ownership quotas are kept
+type quotaMode uint8
+
+const (
+	quotaObjects quotaMode = 1 << iota // Count objects in ownership_quota
+	quotaBytes                         // Cap object_bytes() by ownership_byte_quota
+)
+
+// checkOwnershipQuota charges owner's quotas for obj, which create() is
+// about to add. It returns E_QUOTA, having charged nothing, if a quota is
+// used up.
+func checkOwnershipQuota(store *db.Store, owner types.ObjID, obj *db.Object) types.ErrorCode {
+	mode := getQuotaMode()
+	if mode == 0 || owner == obj.ID {
+		// Objects that own themselves have no one to charge
+		return types.E_NONE
+	}
+	ownerObj := store.Get(owner)
+	if ownerObj == nil {
+		return types.E_NONE
+	}
+
+	var left int64
+	countObjects := false
+	if mode&quotaObjects != 0 {
+		if quota, ok := quotaValue(store, ownerObj, "ownership_quota"); ok {
+			if quota <= 0 {
+				return types.E_QUOTA
+			}
+			left, countObjects = quota-1, true
+		}
+	}
+	if mode&quotaBytes != 0 {
+		if quota, ok := quotaValue(store, ownerObj, "ownership_byte_quota"); ok {
+			if store.OwnerBytes(owner)+int64(db.ObjectBytes(obj)) > quota {
+				return types.E_QUOTA
+			}
+		}
+	}
+	if countObjects {
+		setQuotaValue(store, ownerObj, "ownership_quota", left)
+	}
+	return types.E_NONE
+}
+
+// refundOwnershipQuota gives obj's owner back an object that recycle()
+// has destroyed, or that create() failed to add. Byte quotas need no
+// refund: the store stops counting the object's bytes when it goes.
+func refundOwnershipQuota(store *db.Store, obj *db.Object) {
+	if getQuotaMode()&quotaObjects == 0 || obj.Owner == obj.ID {
+		return
+	}
+	ownerObj := store.Get(obj.Owner)
+	if ownerObj == nil {
+		return
+	}
+	if quota, ok := quotaValue(store, ownerObj, "ownership_quota"); ok {
+		setQuotaValue(store, ownerObj, "ownership_quota", quota+1)
+	}
+}
+
+// quotaValue returns obj's value for a quota property, inherited if obj
+// has none of its own, and whether it is an integer
+func quotaValue(store *db.Store, obj *db.Object, name string) (int64, bool) {
+	seen := make(map[types.ObjID]bool)
+	queue := []*db.Object{obj}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if seen[cur.ID] {
+			continue
+		}
+		seen[cur.ID] = true
+		if prop, ok := cur.Properties[name]; ok && !prop.Clear {
+			n, isInt := prop.Value.(types.IntValue)
+			return n.Val, isInt
+		}
+		for _, parentID := range cur.Parents {
+			if parent := store.Get(parentID); parent != nil {
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return 0, false
+}
+
+// setQuotaValue gives obj its own value for a quota property it has
+func setQuotaValue(store *db.Store, obj *db.Object, name string, n int64) {
+	if prop, ok := obj.Properties[name]; ok {
+		old := prop.Value
+		prop.Clear = false
+		prop.Value = types.NewInt(n)
+		store.PropertyWritten(obj, prop, old)
+		return
+	}
+	// Inherited without a local entry: add one, as assigning it would
+	inherited := findPropertyInherited(obj.ID, name, store)
+	if inherited == nil {
+		return
+	}
+	prop := &db.Property{
+		Name:  name,
+		Value: types.NewInt(n),
+		Owner: inherited.Owner,
+		Perms: inherited.Perms,
+	}
+	obj.Properties[name] = prop
+	store.PropertyWritten(obj, prop, nil)
+}
@@ -0,0 +1,92 @@
+package builtins
+
+import (
+	"testing"
+
+	"barn/db"
+	"barn/types"
+)
+
+func TestOwnershipQuota(t *testing.T) {
+	store := db.NewStore()
+	system := db.NewObject(0, 0)
+	system.Properties["server_options"] = &db.Property{Name: "server_options", Value: types.NewObj(1), Owner: 0, Defined: true}
+	options := db.NewObject(1, 0)
+	player := db.NewObject(2, 2)
+	player.Flags = db.FlagProgrammer
+	player.Properties["ownership_quota"] = &db.Property{Name: "ownership_quota", Value: types.NewInt(2), Owner: 0, Defined: true}
+	player.Properties["ownership_byte_quota"] = &db.Property{Name: "ownership_byte_quota", Value: types.NewStr("none"), Owner: 0, Defined: true}
+	parent := db.NewObject(3, 2)
+	for _, obj := range []*db.Object{system, options, player, parent} {
+		store.Add(obj)
+	}
+	setOption := func(name string, on bool) {
+		value := types.NewInt(0)
+		if on {
+			value = types.NewInt(1)
+		}
+		options.Properties[name] = &db.Property{Name: name, Value: value, Owner: 0, Defined: true}
+		LoadServerOptionsFromStore(store)
+	}
+	defer LoadServerOptionsFromStore(nil)
+
+	reg := NewRegistry()
+	ctx := types.NewTaskContext()
+	ctx.Player = 2
+	ctx.Programmer = 2
+	create := func() types.Result {
+		return builtinCreate(ctx, []types.Value{types.NewObj(3)}, store, reg)
+	}
+	quotaLeft := func() types.Value {
+		return player.Properties["ownership_quota"].Value
+	}
+
+	// Off by default: cores that keep quotas in the database aren't charged
+	if result := create(); result.Flow != types.FlowNormal || !quotaLeft().Equal(types.NewInt(2)) {
+		t.Fatalf("create() with quotas off: %v, quota %v", result.Error, quotaLeft())
+	}
+
+	setOption("ownership_quota", true)
+	var made []types.Value
+	for i := 0; i < 2; i++ {
+		result := create()
+		if result.Flow != types.FlowNormal {
+			t.Fatalf("create() %d under quota: %v", i+1, result.Error)
+		}
+		made = append(made, result.Val)
+	}
+	if result := create(); result.Error != types.E_QUOTA || !quotaLeft().Equal(types.NewInt(0)) {
+		t.Fatalf("create() over quota: %v, quota %v; want E_QUOTA, 0", result.Error, quotaLeft())
+	}
+	if result := builtinRecycle(ctx, []types.Value{made[0]}, store, reg); result.Flow != types.FlowNormal || !quotaLeft().Equal(types.NewInt(1)) {
+		t.Fatalf("recycle(): %v, quota %v; want quota 1", result.Error, quotaLeft())
+	}
+	if result := create(); result.Flow != types.FlowNormal {
+		t.Fatalf("create() after recycle(): %v", result.Error)
+	}
+
+	// Owners without an integer quota aren't limited
+	player.Properties["ownership_quota"].Value = types.NewStr("unlimited")
+	if result := create(); result.Flow != types.FlowNormal {
+		t.Fatalf("create() with a non-integer quota: %v", result.Error)
+	}
+
+	// The byte quota caps what the owner's objects add up to
+	setOption("ownership_quota", false)
+	setOption("ownership_byte_quota", true)
+	player.Properties["ownership_byte_quota"].Value = types.NewInt(0)
+	used := store.OwnerBytes(2)
+	newBytes := int64(db.ObjectBytes(db.NewObject(99, 2)))
+	player.Properties["ownership_byte_quota"].Value = types.NewInt(used + newBytes)
+	result := create()
+	if result.Flow != types.FlowNormal {
+		t.Fatalf("create() within the byte quota: %v", result.Error)
+	}
+	if result := create(); result.Error != types.E_QUOTA {
+		t.Fatalf("create() over the byte quota: %v, want E_QUOTA", result.Error)
+	}
+	builtinRecycle(ctx, []types.Value{result.Val}, store, reg)
+	if result := create(); result.Flow != types.FlowNormal {
+		t.Fatalf("create() after recycle() freed bytes: %v", result.Error)
+	}
+}
@@ -3,6 +3,7 @@ package builtins
 import (
 	"barn/db"
 	"barn/types"
+	"sort"
 )
 
 // BuiltinFunc is a function type for builtin functions
@@ -13,108 +14,134 @@ type BuiltinFunc func(ctx *types.TaskContext, args []types.Value) types.Result
 // Returns the result of calling the verb, or E_VERBNF if verb not found
 type VerbCallerFunc func(objID types.ObjID, verbName string, args []types.Value, ctx *types.TaskContext) types.Result
 
+// LambdaCallerFunc is a callback for calling lambdas passed to builtins
+type LambdaCallerFunc func(fn types.LambdaValue, args []types.Value, ctx *types.TaskContext) types.Result
+
 // Registry holds all registered builtin functions
 type Registry struct {
 	funcs      map[string]BuiltinFunc
+	arities    map[string]builtinArity // Argument counts recorded with Args
 	byID       map[int]BuiltinFunc
 	nameToID   map[string]int
+	idToName   map[int]string
 	nextID     int
 	verbCaller VerbCallerFunc // Callback for calling verbs (set by evaluator)
+
+	lambdaCaller LambdaCallerFunc // Callback for calling lambdas (set by the VM)
+
+	collector GarbageCollector // Anonymous object and waif collector (set by the scheduler)
 }
 
 // NewRegistry creates a new builtin function registry
 func NewRegistry() *Registry {
 	r := &Registry{
 		funcs:    make(map[string]BuiltinFunc),
+		arities:  make(map[string]builtinArity),
 		byID:     make(map[int]BuiltinFunc),
 		nameToID: make(map[string]int),
+		idToName: make(map[int]string),
 		nextID:   0,
 	}
 
 	// Register type conversion builtins
-	r.Register("typeof", builtinTypeof)
-	r.Register("tostr", builtinTostr)
-	r.Register("toint", builtinToint)
-	r.Register("tofloat", builtinTofloat)
-	r.Register("toliteral", builtinToliteral)
-	r.Register("toobj", builtinToobj)
-	r.Register("equal", builtinEqual)
+	r.Register("typeof", builtinTypeof).Args(1, 1)
+	r.Register("tostr", builtinTostr).Args(0, -1)
+	r.Register("toint", builtinToint).Args(1, 1)
+	r.Register("tofloat", builtinTofloat).Args(1, 1)
+	r.Register("toliteral", builtinToliteral).Args(1, 1)
+	r.Register("toobj", builtinToobj).Args(1, 1)
+	r.Register("equal", builtinEqual).Args(2, 2)
 
 	// Register string builtins (Layer 7.1)
-	r.Register("length", builtinLength)
-	r.Register("strsub", builtinStrsub)
-	r.Register("strtr", builtinStrtr)
-	r.Register("index", builtinIndex)
-	r.Register("rindex", builtinRindex)
-	r.Register("strcmp", builtinStrcmp)
+	r.Register("length", builtinLength).Args(1, 1)
+	r.Register("strsub", builtinStrsub).Args(3, 4)
+	r.Register("strtr", builtinStrtr).Args(3, 4)
+	r.Register("index", builtinIndex).Args(2, 4)
+	r.Register("rindex", builtinRindex).Args(2, 4)
+	r.Register("strcmp", builtinStrcmp).Args(2, 2)
 	r.Register("upcase", builtinUpcase)
 	r.Register("downcase", builtinDowncase)
 	r.Register("capitalize", builtinCapitalize)
-	r.Register("explode", builtinExplode)
+	r.Register("explode", builtinExplode).Args(1, 3)
 	r.Register("implode", builtinImplode)
 	r.Register("trim", builtinTrim)
 	r.Register("ltrim", builtinLtrim)
 	r.Register("rtrim", builtinRtrim)
-	r.Register("match", builtinMatch)
-	r.Register("rmatch", builtinRmatch)
-	r.Register("substitute", builtinSubstitute)
+	r.Register("match", builtinMatch).Args(2, 3)
+	r.Register("rmatch", builtinRmatch).Args(2, 3)
+	r.Register("substitute", builtinSubstitute).Args(2, 2)
 	r.Register("all_members", builtinAllMembers)
 	r.Register("chr", builtinChr)
 	r.Register("parse_ansi", builtinParseAnsi)
 	r.Register("remove_ansi", builtinRemoveAnsi)
+	r.Register("normalize", builtinNormalize)
+	r.Register("string_width", builtinStringWidth)
 
 	// Register list builtins (Layer 7.2)
-	r.Register("listappend", builtinListappend)
-	r.Register("listinsert", builtinListinsert)
-	r.Register("listdelete", builtinListdelete)
-	r.Register("listset", builtinListset)
-	r.Register("setadd", builtinSetadd)
-	r.Register("setremove", builtinSetremove)
-	r.Register("is_member", builtinIsMember)
-	r.Register("sort", builtinSort)
-	r.Register("reverse", builtinReverse)
+	r.Register("listappend", builtinListappend).Args(2, 3)
+	r.Register("listinsert", builtinListinsert).Args(2, 3)
+	r.Register("listdelete", builtinListdelete).Args(2, 2)
+	r.Register("listset", builtinListset).Args(3, 3)
+	r.Register("setadd", builtinSetadd).Args(2, 2)
+	r.Register("setremove", builtinSetremove).Args(2, 2)
+	r.Register("is_member", builtinIsMember).Args(2, 2)
+	r.Register("sort", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinSort(ctx, args, r)
+	}).Args(1, 4)
+	r.Register("reverse", builtinReverse).Args(1, 1)
 	r.Register("unique", builtinUnique)
-	r.Register("slice", builtinSlice)
+	r.Register("slice", builtinSlice).Args(1, 3)
+
+	// Register lambda builtins
+	r.Register("map", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinMap(ctx, args, r)
+	}).Args(2, 2)
+	r.Register("filter", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinFilter(ctx, args, r)
+	}).Args(2, 2)
+	r.Register("reduce", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinReduce(ctx, args, r)
+	}).Args(2, 3)
 
 	// Register math builtins (Layer 7.3)
-	r.Register("abs", builtinAbs)
-	r.Register("min", builtinMin)
-	r.Register("max", builtinMax)
-	r.Register("random", builtinRandom)
-	r.Register("frandom", builtinFrandom)
+	r.Register("abs", builtinAbs).Args(1, 1)
+	r.Register("min", builtinMin).Args(1, -1)
+	r.Register("max", builtinMax).Args(1, -1)
+	r.Register("random", builtinRandom).Args(0, 2)
+	r.Register("frandom", builtinFrandom).Args(1, 2)
 	r.Register("reseed_random", builtinReseedRandom)
-	r.Register("sqrt", builtinSqrt)
-	r.Register("sin", builtinSin)
+	r.Register("sqrt", builtinSqrt).Args(1, 1)
+	r.Register("sin", builtinSin).Args(1, 1)
 	r.Register("cos", builtinCos)
 	r.Register("tan", builtinTan)
 	r.Register("asin", builtinAsin)
 	r.Register("acos", builtinAcos)
 	r.Register("acosh", builtinAcosh)
-	r.Register("atan", builtinAtan)
+	r.Register("atan", builtinAtan).Args(1, 2)
 	r.Register("atan2", builtinAtan2)
 	r.Register("asinh", builtinAsinh)
 	r.Register("atanh", builtinAtanh)
 	r.Register("sinh", builtinSinh)
 	r.Register("cosh", builtinCosh)
 	r.Register("tanh", builtinTanh)
-	r.Register("exp", builtinExp)
-	r.Register("log", builtinLog)
-	r.Register("log10", builtinLog10)
+	r.Register("exp", builtinExp).Args(1, 1)
+	r.Register("log", builtinLog).Args(1, 1)
+	r.Register("log10", builtinLog10).Args(1, 1)
 	r.Register("cbrt", builtinCbrt)
 	r.Register("round", builtinRound)
-	r.Register("ceil", builtinCeil)
-	r.Register("floor", builtinFloor)
-	r.Register("trunc", builtinTrunc)
-	r.Register("floatstr", builtinFloatstr)
+	r.Register("ceil", builtinCeil).Args(1, 1)
+	r.Register("floor", builtinFloor).Args(1, 1)
+	r.Register("trunc", builtinTrunc).Args(1, 1)
+	r.Register("floatstr", builtinFloatstr).Args(2, 3)
 	r.Register("distance", builtinDistance)
 	r.Register("relative_heading", builtinRelativeHeading)
 	r.Register("simplex_noise", builtinSimplexNoise)
 
 	// Register map builtins (Layer 7.5)
-	r.Register("mapkeys", builtinMapkeys)
-	r.Register("mapvalues", builtinMapvalues)
-	r.Register("mapdelete", builtinMapdelete)
-	r.Register("maphaskey", builtinMaphaskey)
+	r.Register("mapkeys", builtinMapkeys).Args(1, 1)
+	r.Register("mapvalues", builtinMapvalues).Args(1, -1)
+	r.Register("mapdelete", builtinMapdelete).Args(2, 2)
+	r.Register("maphaskey", builtinMaphaskey).Args(2, 3)
 	r.Register("mapmerge", builtinMapmerge)
 
 	// Register JSON builtins (Layer 10.1)
@@ -122,34 +149,34 @@ func NewRegistry() *Registry {
 	r.Register("parse_json", builtinParseJson)
 
 	// Register network builtins (Layer 12.5)
-	r.Register("notify", builtinNotify)
-	r.Register("listeners", builtinListeners)
-	r.Register("listen", builtinListen)
-	r.Register("unlisten", builtinUnlisten)
-	r.Register("connected_players", builtinConnectedPlayers)
-	r.Register("connection_name", builtinConnectionName)
+	r.Register("notify", builtinNotify).Args(2, 4)
+	r.Register("listeners", builtinListeners).Args(0, 1)
+	r.Register("listen", builtinListen).Args(2, 4)
+	r.Register("unlisten", builtinUnlisten).Args(1, 1)
+	r.Register("connected_players", builtinConnectedPlayers).Args(0, 1)
+	r.Register("connection_name", builtinConnectionName).Args(1, 2)
 	r.Register("connection_name_lookup", builtinConnectionNameLookup)
-	r.Register("connection_options", builtinConnectionOptions)
-	r.Register("boot_player", builtinBootPlayer)
+	r.Register("connection_options", builtinConnectionOptions).Args(1, 2)
+	r.Register("boot_player", builtinBootPlayer).Args(1, 1)
 	r.Register("switch_player", builtinSwitchPlayer)
-	r.Register("idle_seconds", builtinIdleSeconds)
-	r.Register("connected_seconds", builtinConnectedSeconds)
+	r.Register("idle_seconds", builtinIdleSeconds).Args(1, 1)
+	r.Register("connected_seconds", builtinConnectedSeconds).Args(1, 1)
 	r.Register("connection_info", builtinConnectionInfo)
-	r.Register("set_connection_option", builtinSetConnectionOption)
+	r.Register("set_connection_option", builtinSetConnectionOption).Args(3, 3)
 	r.Register("connection_option", builtinConnectionOption)
-	r.Register("open_network_connection", builtinOpenNetworkConnection)
+	r.Register("open_network_connection", builtinOpenNetworkConnection).Args(2, 3)
 	r.Register("read_http", builtinReadHTTP)
-	r.Register("flush_input", builtinFlushInput)
-	r.Register("force_input", builtinForceInput)
-	r.Register("read", builtinRead)
-	r.Register("buffered_output_length", builtinBufferedOutputLength)
-	r.Register("output_delimiters", builtinOutputDelimiters)
+	r.Register("flush_input", builtinFlushInput).Args(1, 1)
+	r.Register("force_input", builtinForceInput).Args(2, 3)
+	r.Register("read", builtinRead).Args(0, 2)
+	r.Register("buffered_output_length", builtinBufferedOutputLength).Args(0, 1)
+	r.Register("output_delimiters", builtinOutputDelimiters).Args(1, 1)
 
 	// Register crypto/encoding builtins (except crypt which needs store)
 	r.Register("encode_base64", builtinEncodeBase64)
 	r.Register("decode_base64", builtinDecodeBase64)
-	r.Register("encode_binary", builtinEncodeBinary)
-	r.Register("decode_binary", builtinDecodeBinary)
+	r.Register("encode_binary", builtinEncodeBinary).Args(1, -1)
+	r.Register("decode_binary", builtinDecodeBinary).Args(1, 2)
 
 	// Register hash builtins
 	r.Register("string_hash", builtinStringHash)
@@ -222,50 +249,66 @@ func NewRegistry() *Registry {
 	})
 	r.Register("function_info", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinFunctionInfo(ctx, args, r)
-	})
+	}).Args(0, 1)
 	r.Register("db_disk_size", builtinDbDiskSize)
-	r.Register("dump_database", builtinDumpDatabase)
+	r.Register("dump_database", builtinDumpDatabase).Args(0, 0)
 	r.Register("getenv", builtinGetenv)
 	r.Register("read_stdin", builtinReadStdin)
 	r.Register("spellcheck", builtinSpellcheck)
-	r.Register("set_thread_mode", builtinSetThreadMode)
-	r.Register("shutdown", builtinShutdown)
+	r.Register("set_thread_mode", builtinSetThreadMode).Args(0, 1)
+	r.Register("shutdown", builtinShutdown).Args(0, 1)
 	r.Register("task_local", builtinTaskLocal)
 	r.Register("set_task_local", builtinSetTaskLocal)
-	r.Register("task_id", builtinTaskID)
-	r.Register("ticks_left", builtinTicksLeft)
-	r.Register("seconds_left", builtinSecondsLeft)
+	r.Register("task_id", builtinTaskID).Args(0, 0)
+	r.Register("ticks_left", builtinTicksLeft).Args(0, 0)
+	r.Register("seconds_left", builtinSecondsLeft).Args(0, 0)
 	r.Register("task_perms", builtinTaskPerms)
 	r.Register("queue_info", builtinQueueInfo)
 	r.Register("finished_tasks", builtinFinishedTasks)
-	r.Register("thread_pool", builtinThreadPool)
+	r.Register("thread_pool", builtinThreadPool).Args(0, 3)
 	r.Register("threads", builtinThreads)
-	r.Register("usage", builtinUsage)
-	r.Register("malloc_stats", builtinMallocStats)
-	r.Register("memory_usage", builtinMemoryUsage)
-	r.Register("log_cache_stats", builtinLogCacheStats)
-	r.Register("exec", builtinExec)
-	r.Register("server_log", builtinServerLog)
-	r.Register("server_version", builtinServerVersion)
-	r.Register("time", builtinTime)
+	r.Register("usage", builtinUsage).Args(0, 1)
+	r.Register("profiler_start", builtinProfilerStart)
+	r.Register("profiler_stop", builtinProfilerStop)
+	r.Register("profiler_reset", builtinProfilerReset)
+	r.Register("profiler_stats", builtinProfilerStats)
+	r.Register("debug_clear", builtinDebugClear)
+	r.Register("debug_breakpoints", builtinDebugBreakpoints)
+	r.Register("debug_tasks", builtinDebugTasks)
+	r.Register("debug_stack", builtinDebugStack)
+	r.Register("debug_locals", builtinDebugLocals)
+	r.Register("debug_eval", builtinDebugEval)
+	r.Register("debug_continue", builtinDebugContinue)
+	r.Register("debug_step", builtinDebugStep)
+	r.Register("malloc_stats", builtinMallocStats).Args(0, 0)
+	r.Register("memory_usage", builtinMemoryUsage).Args(0, 1)
+	r.Register("exec", builtinExec).Args(1, 2)
+	r.Register("server_log", builtinServerLog).Args(1, -1)
+	r.Register("server_version", builtinServerVersion).Args(0, 1)
+	r.Register("time", builtinTime).Args(0, 0)
 	r.Register("ftime", builtinFtime)
-	r.Register("ctime", builtinCtime)
+	r.Register("ctime", builtinCtime).Args(0, 1)
 
 	// GC builtins
-	r.Register("run_gc", builtinRunGC)
-	r.Register("gc_stats", builtinGCStats)
+	r.Register("run_gc", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinRunGC(ctx, args, r)
+	})
+	r.Register("gc_stats", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinGCStats(ctx, args, r)
+	})
 
 	// Task management builtins
-	r.Register("queued_tasks", builtinQueuedTasks)
-	r.Register("kill_task", builtinKillTask)
-	r.Register("task_stack", builtinTaskStack)
-	r.Register("suspend", builtinSuspend)
-	r.Register("resume", builtinResume)
-	r.Register("callers", builtinCallers)
+	r.Register("queued_tasks", builtinQueuedTasks).Args(0, 2)
+	r.Register("kill_task", builtinKillTask).Args(1, 1)
+	r.Register("task_stack", builtinTaskStack).Args(1, 3)
+	r.Register("set_task_memory_exempt", builtinSetTaskMemoryExempt).Args(2, 2)
+	r.Register("suspend", builtinSuspend).Args(0, 1)
+	r.Register("resume", builtinResume).Args(1, 2)
+	r.Register("callers", builtinCallers).Args(0, 1)
 	r.Register("set_task_perms", builtinSetTaskPerms)
-	r.Register("caller_perms", builtinCallerPerms)
-	r.Register("raise", builtinRaise)
-	r.Register("yin", builtinYin)
+	r.Register("caller_perms", builtinCallerPerms).Args(0, 0)
+	r.Register("raise", builtinRaise).Args(1, 3)
+	r.Register("yin", builtinYin).Args(0, 3)
 
 	// Note: eval() builtin is registered by the Evaluator via RegisterEvalBuiltin()
 	// to avoid circular dependencies (eval needs parser which needs eval)
@@ -274,12 +317,43 @@ func NewRegistry() *Registry {
 }
 
 // Register adds a builtin function to the registry
-func (r *Registry) Register(name string, fn BuiltinFunc) {
+func (r *Registry) Register(name string, fn BuiltinFunc) Registration {
 	r.funcs[name] = fn
 	id := r.nextID
 	r.byID[id] = fn
 	r.nameToID[name] = id
+	r.idToName[id] = name
 	r.nextID++
+	return Registration{registry: r, name: name}
+}
+
+// builtinArity is how many arguments a builtin checks for
+type builtinArity struct {
+	min, max int // max is -1 for any number
+}
+
+// Registration is a builtin just added to a registry
+type Registration struct {
+	registry *Registry
+	name     string
+}
+
+// Args records how many arguments the builtin accepts: min to max, or any
+// number from min if max is -1. The linter and the language server check
+// calls against it.
+func (g Registration) Args(min, max int) {
+	g.registry.arities[g.name] = builtinArity{min: min, max: max}
+}
+
+// Arity returns the argument counts recorded for a builtin with Args; max
+// is -1 when any number of arguments is accepted. ok is false when none
+// were recorded.
+func (r *Registry) Arity(name string) (min, max int, ok bool) {
+	a, ok := r.arities[name]
+	if !ok {
+		return 0, -1, false
+	}
+	return a.min, a.max, true
 }
 
 // GetID returns the ID for a builtin function name
@@ -288,6 +362,12 @@ func (r *Registry) GetID(name string) (int, bool) {
 	return id, ok
 }
 
+// GetName returns the name a builtin function ID was registered under
+func (r *Registry) GetName(id int) (string, bool) {
+	name, ok := r.idToName[id]
+	return name, ok
+}
+
 // CallByID calls a builtin function by its ID
 func (r *Registry) CallByID(id int, ctx *types.TaskContext, args []types.Value) types.Result {
 	fn, ok := r.byID[id]
@@ -310,6 +390,16 @@ func (r *Registry) Has(name string) bool {
 	return ok
 }
 
+// Names returns the names of all registered builtins, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.funcs))
+	for name := range r.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // SetVerbCaller sets the callback for calling verbs
 func (r *Registry) SetVerbCaller(caller VerbCallerFunc) {
 	r.verbCaller = caller
@@ -324,18 +414,37 @@ func (r *Registry) CallVerb(objID types.ObjID, verbName string, args []types.Val
 	return r.verbCaller(objID, verbName, args, ctx)
 }
 
+// SetGarbageCollector sets the collector run_gc() and gc_stats() use
+func (r *Registry) SetGarbageCollector(c GarbageCollector) {
+	r.collector = c
+}
+
+// SetLambdaCaller sets the callback for calling lambdas
+func (r *Registry) SetLambdaCaller(caller LambdaCallerFunc) {
+	r.lambdaCaller = caller
+}
+
+// CallLambda calls a lambda using the registered lambda caller
+// Returns E_INVARG if no lambda caller is set
+func (r *Registry) CallLambda(fn types.LambdaValue, args []types.Value, ctx *types.TaskContext) types.Result {
+	if r.lambdaCaller == nil {
+		return types.Err(types.E_INVARG)
+	}
+	return r.lambdaCaller(fn, args, ctx)
+}
+
 // RegisterCryptoBuiltins registers crypto builtins that need store access
 func (r *Registry) RegisterCryptoBuiltins(store *db.Store) {
 	r.Register("crypt", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinCrypt(ctx, args, store)
-	})
+	}).Args(1, 2)
 }
 
 // RegisterSystemBuiltins registers system builtins that need store access
 func (r *Registry) RegisterSystemBuiltins(store *db.Store) {
 	r.Register("load_server_options", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinLoadServerOptions(ctx, args, store)
-	})
+	}).Args(0, 0)
 	r.Register("locate_by_name", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinLocateByName(ctx, args, store)
 	})
@@ -360,10 +469,25 @@ func (r *Registry) RegisterSystemBuiltins(store *db.Store) {
 	r.Register("verb_cache_stats", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinVerbCacheStats(ctx, args, store)
 	})
+	r.Register("log_cache_stats", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinLogCacheStats(ctx, args, store)
+	})
+	r.Register("debug_break", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinDebugBreak(ctx, args, store)
+	})
+	r.Register("lint", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinLint(ctx, args, store, r)
+	})
 	r.Register("reset_max_object", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinResetMaxObject(ctx, args, store)
+	}).Args(0, 0)
+	r.Register("value_bytes", builtinValueBytes).Args(1, 1)
+	r.Register("export_package", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinExportPackage(ctx, args, store)
+	})
+	r.Register("import_package", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return builtinImportPackage(ctx, args, store)
 	})
-	r.Register("value_bytes", builtinValueBytes)
 
 	// Re-register set_task_perms with store access so it can update
 	// ctx.IsWizard when the programmer changes (matches Toast's behavior
@@ -0,0 +1,37 @@
+package builtins
+
+import (
+	"testing"
+
+	"barn/types"
+)
+
+func TestRegistryArity(t *testing.T) {
+	r := NewRegistry()
+	for _, tc := range []struct {
+		name     string
+		min, max int
+		ok       bool
+	}{
+		{"tostr", 0, -1, true},
+		{"strsub", 3, 4, true},
+		{"set_thread_mode", 0, 1, true},
+		{"upcase", 0, -1, false},
+	} {
+		min, max, ok := r.Arity(tc.name)
+		if min != tc.min || max != tc.max || ok != tc.ok {
+			t.Errorf("Arity(%q) = %d, %d, %v; want %d, %d, %v", tc.name, min, max, ok, tc.min, tc.max, tc.ok)
+		}
+	}
+
+	// function_info() keeps its own signatures, whatever the linter is told
+	info := func(name string) string {
+		return builtinFunctionInfo(types.NewTaskContext(), []types.Value{types.NewStr(name)}, r).Val.String()
+	}
+	if got, want := info("tostr"), `{"tostr", 1, 1, {-1}}`; got != want {
+		t.Errorf("function_info(\"tostr\") = %s, want %s", got, want)
+	}
+	if got, want := info("strsub"), `{"strsub", 0, -1, {-1}}`; got != want {
+		t.Errorf("function_info(\"strsub\") = %s, want %s", got, want)
+	}
+}
@@ -15,7 +15,8 @@ import (
 // length(str) -> int
 // length(list) -> int
 // length(map) -> int
-// For strings, returns the raw string length (number of characters), not decoded byte count
+// For strings, returns the raw string length (number of characters), not decoded byte count;
+// characters are bytes, or runes in unicode string mode
 func builtinLength(ctx *types.TaskContext, args []types.Value) types.Result {
 	if len(args) != 1 {
 		return types.Err(types.E_ARGS)
@@ -24,7 +25,7 @@ func builtinLength(ctx *types.TaskContext, args []types.Value) types.Result {
 	switch v := args[0].(type) {
 	case types.StrValue:
 		// Return raw string length (like C strlen) - do NOT decode ~XX escapes
-		return types.Ok(types.IntValue{Val: int64(len(v.Value()))})
+		return types.Ok(types.IntValue{Val: int64(types.StrLen(v.Value()))})
 	case types.ListValue:
 		return types.Ok(types.IntValue{Val: int64(v.Len())})
 	case types.MapValue:
@@ -153,9 +154,9 @@ func builtinIndex(ctx *types.TaskContext, args []types.Value) types.Result {
 	h := haystack.Value()
 	n := needle.Value()
 
-	// Convert to runes for proper indexing
-	hRunes := []rune(h)
-	nRunes := []rune(n)
+	// Convert to characters for indexing
+	hRunes := strChars(h)
+	nRunes := strChars(n)
 
 	// Start searching from position (offset + 1) in 1-based terms
 	// which is offset in 0-based terms
@@ -177,7 +178,7 @@ func builtinIndex(ctx *types.TaskContext, args []types.Value) types.Result {
 					break
 				}
 			} else {
-				if unicode.ToLower(hChar) != unicode.ToLower(nChar) {
+				if foldChar(hChar) != foldChar(nChar) {
 					match = false
 					break
 				}
@@ -223,9 +224,9 @@ func builtinRindex(ctx *types.TaskContext, args []types.Value) types.Result {
 	h := haystack.Value()
 	n := needle.Value()
 
-	// Convert to runes
-	hRunes := []rune(h)
-	nRunes := []rune(n)
+	// Convert to characters
+	hRunes := strChars(h)
+	nRunes := strChars(n)
 
 	// Handle offset (4th argument)
 	// offset <= 0: specifies search end position (length + offset)
@@ -267,7 +268,7 @@ func builtinRindex(ctx *types.TaskContext, args []types.Value) types.Result {
 					break
 				}
 			} else {
-				if unicode.ToLower(hChar) != unicode.ToLower(nChar) {
+				if foldChar(hChar) != foldChar(nChar) {
 					match = false
 					break
 				}
@@ -313,7 +314,7 @@ func builtinUpcase(ctx *types.TaskContext, args []types.Value) types.Result {
 		return types.Err(types.E_TYPE)
 	}
 
-	return types.Ok(types.NewStr(strings.ToUpper(str.Value())))
+	return types.Ok(types.NewStr(upcaseString(str.Value())))
 }
 
 // builtinDowncase converts string to lowercase
@@ -328,7 +329,7 @@ func builtinDowncase(ctx *types.TaskContext, args []types.Value) types.Result {
 		return types.Err(types.E_TYPE)
 	}
 
-	return types.Ok(types.NewStr(strings.ToLower(str.Value())))
+	return types.Ok(types.NewStr(downcaseString(str.Value())))
 }
 
 // builtinCapitalize capitalizes first letter of each word
@@ -601,39 +602,97 @@ func builtinStrtr(ctx *types.TaskContext, args []types.Value) types.Result {
 
 // replaceAllCaseInsensitive performs case-insensitive string replacement
 func replaceAllCaseInsensitive(s, old, new string) string {
-	// Convert to runes for proper character handling
-	sRunes := []rune(s)
-	oldRunes := []rune(old)
+	sChars := strChars(s)
+	oldChars := strChars(old)
 
-	if len(oldRunes) == 0 {
+	if len(oldChars) == 0 {
 		return s
 	}
 
-	var result []rune
+	// Copy s through in pieces, so bytes that are not part of a match are
+	// kept exactly as they were
+	var result strings.Builder
+	copied, pos := 0, 0 // Byte offsets: copied up to, and of sChars[i]
 	i := 0
-	for i < len(sRunes) {
+	for i < len(sChars) {
 		// Check if we have a match at current position
-		if i+len(oldRunes) <= len(sRunes) {
+		if i+len(oldChars) <= len(sChars) {
 			match := true
-			for j := 0; j < len(oldRunes); j++ {
-				if unicode.ToLower(sRunes[i+j]) != unicode.ToLower(oldRunes[j]) {
+			for j := 0; j < len(oldChars); j++ {
+				if foldChar(sChars[i+j]) != foldChar(oldChars[j]) {
 					match = false
 					break
 				}
 			}
 			if match {
 				// Found a match - add replacement
-				result = append(result, []rune(new)...)
-				i += len(oldRunes)
+				result.WriteString(s[copied:pos])
+				result.WriteString(new)
+				pos += types.StrOffset(s[pos:], len(oldChars))
+				copied = pos
+				i += len(oldChars)
 				continue
 			}
 		}
-		// No match - add current character
-		result = append(result, sRunes[i])
+		// No match - move past current character
+		pos += types.StrOffset(s[pos:], 1)
 		i++
 	}
+	result.WriteString(s[copied:])
+
+	return result.String()
+}
+
+// strChars returns s as characters: its runes in unicode string mode,
+// otherwise its bytes
+func strChars(s string) []rune {
+	if types.UnicodeStrings() {
+		return []rune(s)
+	}
+	chars := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		chars[i] = rune(s[i])
+	}
+	return chars
+}
+
+// foldChar lowers c for case-insensitive matching. Outside unicode string
+// mode only ASCII letters have case, as in LambdaMOO.
+func foldChar(c rune) rune {
+	if types.UnicodeStrings() {
+		return unicode.ToLower(c)
+	}
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// upcaseString and downcaseString change the case of every letter in
+// unicode string mode, and of ASCII letters otherwise
+func upcaseString(s string) string {
+	if types.UnicodeStrings() {
+		return strings.ToUpper(s)
+	}
+	return mapASCII(s, 'a', 'z', 'A'-'a')
+}
 
-	return string(result)
+func downcaseString(s string) string {
+	if types.UnicodeStrings() {
+		return strings.ToLower(s)
+	}
+	return mapASCII(s, 'A', 'Z', 'a'-'A')
+}
+
+// mapASCII adds delta to every byte of s from lo to hi
+func mapASCII(s string, lo, hi byte, delta int) string {
+	b := []byte(s)
+	for i, c := range b {
+		if lo <= c && c <= hi {
+			b[i] = byte(int(c) + delta)
+		}
+	}
+	return string(b)
 }
 
 // ============================================================================
@@ -6,6 +6,7 @@ import (
 	"barn/types"
 	"bytes"
 	"context"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -607,26 +608,46 @@ func builtinLoadServerOptions(ctx *types.TaskContext, args []types.Value, store
 }
 
 // builtinVerbCacheStats implements verb_cache_stats()
-// Returns a compatibility structure where element 5 is a 17-int stats vector.
+// Returns {hits, negative_hits, misses, generation, histogram}; the
+// histogram is the 17-int compatibility vector, reset on each call.
 func builtinVerbCacheStats(ctx *types.TaskContext, args []types.Value, store *db.Store) types.Result {
 	if len(args) != 0 {
 		return types.Err(types.E_ARGS)
 	}
 
-	stats := store.ConsumeVerbCacheStats()
-	statsVals := make([]types.Value, len(stats))
-	for i, v := range stats {
-		statsVals[i] = types.NewInt(v)
+	stats := store.VerbCacheStats()
+	histogram := store.ConsumeVerbCacheStats()
+	histVals := make([]types.Value, len(histogram))
+	for i, v := range histogram {
+		histVals[i] = types.NewInt(v)
 	}
 
-	compat := []types.Value{
-		types.NewInt(0),
-		types.NewInt(0),
-		types.NewInt(0),
-		types.NewInt(0),
-		types.NewList(statsVals),
+	return types.Ok(types.NewList([]types.Value{
+		types.NewInt(stats.Hits),
+		types.NewInt(stats.NegativeHits),
+		types.NewInt(stats.Misses),
+		types.NewInt(stats.Generation),
+		types.NewList(histVals),
+	}))
+}
+
+// builtinLogCacheStats implements log_cache_stats()
+// Writes the verb cache counters to the server log and returns
+// {hits, negative_hits, misses}.
+func builtinLogCacheStats(ctx *types.TaskContext, args []types.Value, store *db.Store) types.Result {
+	if len(args) != 0 {
+		return types.Err(types.E_ARGS)
 	}
-	return types.Ok(types.NewList(compat))
+
+	stats := store.VerbCacheStats()
+	log.Printf("Verb cache: %d hits, %d negative hits, %d misses, %d entries, generation %d",
+		stats.Hits, stats.NegativeHits, stats.Misses, stats.Entries, stats.Generation)
+
+	return types.Ok(types.NewList([]types.Value{
+		types.NewInt(stats.Hits),
+		types.NewInt(stats.NegativeHits),
+		types.NewInt(stats.Misses),
+	}))
 }
 
 // builtinResetMaxObject implements reset_max_object()
@@ -382,11 +382,13 @@ func builtinRaise(ctx *types.TaskContext, args []types.Value) types.Result {
 	}
 }
 
-// builtinTaskStack: task_stack(task_id [, include_line_numbers]) → LIST
+// builtinTaskStack: task_stack(task_id [, include_line_numbers [, include_memory]]) → LIST
 // Returns the call stack for a suspended task
 // Each frame is a map with keys: this, verb, programmer, verb_loc, player, line_number
+// With include_memory, each frame ends with the bytes its variables held
+// when the task was last measured (see max_task_memory)
 func builtinTaskStack(ctx *types.TaskContext, args []types.Value) types.Result {
-	if len(args) < 1 || len(args) > 2 {
+	if len(args) < 1 || len(args) > 3 {
 		return types.Err(types.E_ARGS)
 	}
 
@@ -397,13 +399,14 @@ func builtinTaskStack(ctx *types.TaskContext, args []types.Value) types.Result {
 
 	// Second arg (include_line_numbers) is optional, defaults to false
 	includeLineNumbers := false
-	if len(args) == 2 {
+	if len(args) >= 2 {
 		includeVal, ok := args[1].(types.IntValue)
 		if !ok {
 			return types.Err(types.E_TYPE)
 		}
 		includeLineNumbers = includeVal.Val != 0
 	}
+	includeMemory := len(args) == 3 && args[2].Truthy()
 
 	taskID := taskIDVal.Val
 
@@ -432,22 +435,47 @@ func builtinTaskStack(ctx *types.TaskContext, args []types.Value) types.Result {
 	result := make([]types.Value, 0, len(callStack))
 	for i := len(callStack) - 1; i >= 0; i-- {
 		frame := callStack[i]
-		if includeLineNumbers {
-			result = append(result, frame.ToList())
-		} else {
+		frameList := frame.ToList().(types.ListValue)
+		if !includeLineNumbers {
 			// Omit line number (6th element) → 5-element list
-			frameList := frame.ToList().(types.ListValue)
-			truncated := make([]types.Value, frameList.Len()-1)
-			for j := 0; j < frameList.Len()-1; j++ {
-				truncated[j] = frameList.Get(j + 1)
-			}
-			result = append(result, types.NewList(truncated))
+			frameList = frameList.Slice(1, frameList.Len()-1)
 		}
+		if includeMemory {
+			frameList = frameList.Append(types.NewInt(frame.MemoryBytes))
+		}
+		result = append(result, frameList)
 	}
 
 	return types.Ok(types.NewList(result))
 }
 
+// builtinSetTaskMemoryExempt: set_task_memory_exempt(task_id, exempt) → none
+// Exempts a task from max_task_memory, or ends its exemption. Wizard only.
+func builtinSetTaskMemoryExempt(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 2 {
+		return types.Err(types.E_ARGS)
+	}
+	taskIDVal, ok := args[0].(types.IntValue)
+	if !ok {
+		return types.Err(types.E_TYPE)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+
+	var t *task.Task
+	if taskIDVal.Val == ctx.TaskID {
+		t, _ = ctx.Task.(*task.Task)
+	} else {
+		t = task.GetManager().GetTask(taskIDVal.Val)
+	}
+	if t == nil {
+		return types.Err(types.E_INVARG)
+	}
+	t.SetMemoryExempt(args[1].Truthy())
+	return types.Ok(types.NewInt(0))
+}
+
 // builtinYin: yin([threshold [, ticks [, seconds]]]) → none
 // Yields execution if resources are low.
 // Currently implemented as a no-op since we don't have tick-based execution.
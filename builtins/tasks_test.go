@@ -0,0 +1,49 @@
+package builtins
+
+import (
+	"testing"
+
+	"barn/task"
+	"barn/types"
+)
+
+func TestTaskMemoryBuiltins(t *testing.T) {
+	mgr := task.GetManager()
+	tk := mgr.CreateTask(2, 30000, 5.0)
+	defer mgr.RemoveTask(tk.ID)
+	tk.PushFrame(task.ActivationFrame{This: 2, Player: 2, Programmer: 2, Verb: "outer", VerbLoc: 2, LineNumber: 3})
+	tk.PushFrame(task.ActivationFrame{This: 2, Player: 2, Programmer: 2, Verb: "inner", VerbLoc: 2, LineNumber: 7})
+	tk.UpdateMemoryUsage(1500, []int64{1000, 500})
+
+	wizard := types.NewTaskContext()
+	wizard.Programmer = 2
+	wizard.IsWizard = true
+	id := types.NewInt(tk.ID)
+
+	result := builtinTaskStack(wizard, []types.Value{id, types.NewInt(1), types.NewInt(1)})
+	if want := `{{#2, "inner", #2, #2, #2, 7, 500}, {#2, "outer", #2, #2, #2, 3, 1000}}`; result.Flow != types.FlowNormal || result.Val.String() != want {
+		t.Errorf("task_stack(id, 1, 1) = %v %v, want %s", result.Error, result.Val, want)
+	}
+	result = builtinTaskStack(wizard, []types.Value{id, types.NewInt(0), types.NewInt(1)})
+	if want := `{{#2, "inner", #2, #2, #2, 500}, {#2, "outer", #2, #2, #2, 1000}}`; result.Val.String() != want {
+		t.Errorf("task_stack(id, 0, 1) = %v, want %s", result.Val, want)
+	}
+	if got := tk.ToQueuedTaskInfo().(types.ListValue).Get(10); !got.Equal(types.NewInt(1500)) {
+		t.Errorf("queued_tasks() bytes = %v, want 1500", got)
+	}
+
+	programmer := types.NewTaskContext()
+	programmer.Programmer = 2
+	if result := builtinSetTaskMemoryExempt(programmer, []types.Value{id, types.NewInt(1)}); result.Error != types.E_PERM {
+		t.Errorf("set_task_memory_exempt by a programmer: %v, want E_PERM", result.Error)
+	}
+	if result := builtinSetTaskMemoryExempt(wizard, []types.Value{types.NewInt(-99), types.NewInt(1)}); result.Error != types.E_INVARG {
+		t.Errorf("set_task_memory_exempt of no task: %v, want E_INVARG", result.Error)
+	}
+	if builtinSetTaskMemoryExempt(wizard, []types.Value{id, types.NewInt(1)}); !tk.IsMemoryExempt() {
+		t.Error("set_task_memory_exempt(id, 1) left the task unexempt")
+	}
+	if builtinSetTaskMemoryExempt(wizard, []types.Value{id, types.NewInt(0)}); tk.IsMemoryExempt() {
+		t.Error("set_task_memory_exempt(id, 0) left the task exempt")
+	}
+}
@@ -0,0 +1,209 @@
+package builtins
+
+import (
+	"barn/task"
+	"barn/types"
+	"log"
+	"runtime"
+	"sync"
+)
+
+// ============================================================================
+// BACKGROUND THREADS
+// ============================================================================
+//
+// Toast runs some expensive builtins on a pool of background threads so one
+// call doesn't stall every other task. Barn does the same: a threaded
+// builtin checks its arguments and permissions as usual, then hands the
+// slow part to runInBackground. If the calling activation's thread mode is
+// on (see set_thread_mode()), the task is suspended, the work runs on the
+// thread pool, and the scheduler resumes the task with the work's value, or
+// raises the error it returned, where the builtin was called. Otherwise the
+// work runs at once, on the scheduler goroutine.
+//
+// Work run in the background must not touch the database or the task: it
+// gets the builtin's arguments and nothing else that can change.
+
+// defaultThreadPoolSize is the number of workers the pool starts with, as
+// Toast's TOTAL_BACKGROUND_THREADS
+const defaultThreadPoolSize = 2
+
+// threadPool runs background work on at most size goroutines at once; the
+// rest waits in a queue. Workers exit when the queue is empty.
+type threadPool struct {
+	mu        sync.Mutex
+	size      int      // Most workers at once; 0 runs all work in the foreground
+	queue     []func() // Work waiting for a worker
+	active    int      // Workers running
+	completed int64    // Work finished since the server started
+}
+
+var backgroundThreads = &threadPool{size: defaultThreadPoolSize}
+
+// enabled reports whether the pool takes new work
+func (p *threadPool) enabled() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size > 0
+}
+
+// submit queues work and starts a worker if the pool has room for one
+func (p *threadPool) submit(work func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queue = append(p.queue, work)
+	if p.active < p.size {
+		p.active++
+		go p.worker()
+	}
+}
+
+// worker runs queued work until the queue is empty, or the pool has shrunk
+// below the workers running. A disabled pool keeps one worker until the
+// work queued before it was disabled is done.
+func (p *threadPool) worker() {
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 || p.active > max(p.size, 1) {
+			p.active--
+			p.mu.Unlock()
+			return
+		}
+		work := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		work()
+
+		p.mu.Lock()
+		p.completed++
+		p.mu.Unlock()
+	}
+}
+
+// resize sets the most workers the pool runs. Work already queued keeps its
+// place; if size is 0, it still runs, but nothing new is queued.
+func (p *threadPool) resize(size int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	for p.active < min(max(p.size, 1), len(p.queue)) {
+		p.active++
+		go p.worker()
+	}
+}
+
+// stats returns the pool's size, workers running, work queued and work
+// completed
+func (p *threadPool) stats() (size, active, queued int, completed int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size, p.active, len(p.queue), p.completed
+}
+
+// threadedCaller is the VM calling a builtin (TaskContext.CallerVM)
+type threadedCaller interface {
+	Suspendable() bool
+	ThreadMode() bool
+	SetThreadMode(on bool)
+}
+
+// runInBackground runs a threaded builtin's work on the thread pool if the
+// caller allows it, suspending the task until the work is done, or else
+// runs it now. See BACKGROUND THREADS above.
+func runInBackground(ctx *types.TaskContext, work func() types.Result) types.Result {
+	caller, ok := ctx.CallerVM.(threadedCaller)
+	if !ok || !caller.Suspendable() || !caller.ThreadMode() || !backgroundThreads.enabled() {
+		return work()
+	}
+	t, ok := ctx.Task.(*task.Task)
+	if !ok {
+		return work()
+	}
+
+	t.SuspendBackground()
+	backgroundThreads.submit(func() { t.CompleteBackground(runBackgroundWork(work)) })
+	return types.Suspend(-1)
+}
+
+// runBackgroundWork runs work on a pool worker, turning a panic into E_EXEC
+// rather than letting it take down the server
+func runBackgroundWork(work func() types.Result) (result types.Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("PANIC in background builtin: %v", r)
+			result = types.Err(types.E_EXEC)
+		}
+	}()
+	return work()
+}
+
+// builtinSetThreadMode implements set_thread_mode([mode])
+// With no argument, returns 1 if threaded builtins called by this verb run
+// in the background, 0 if not. With one, turns that on or off for the rest
+// of this verb, and returns 0.
+func builtinSetThreadMode(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) > 1 {
+		return types.Err(types.E_ARGS)
+	}
+	caller, _ := ctx.CallerVM.(threadedCaller)
+	if len(args) == 0 {
+		if caller != nil && !caller.ThreadMode() {
+			return types.Ok(types.NewInt(0))
+		}
+		return types.Ok(types.NewInt(1))
+	}
+	mode, ok := args[0].(types.IntValue)
+	if !ok {
+		return types.Err(types.E_TYPE)
+	}
+	if caller != nil {
+		caller.SetThreadMode(mode.Val != 0)
+	}
+	return types.Ok(types.NewInt(0))
+}
+
+// builtinThreadPool implements thread_pool([function, pool [, value]])
+// With no arguments, returns a map describing the pool: "workers" (the
+// most that run at once), "active", "queued" and "completed", and the
+// server's "goroutines" and "cpus". thread_pool("INIT", "MAIN", n) sets the
+// pool's size; 0 or less runs threaded builtins in the foreground.
+// Resizing is wizard only.
+func builtinThreadPool(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) == 0 {
+		size, active, queued, completed := backgroundThreads.stats()
+		return types.Ok(types.NewMap([][2]types.Value{
+			{types.NewStr("workers"), types.NewInt(int64(size))},
+			{types.NewStr("active"), types.NewInt(int64(active))},
+			{types.NewStr("queued"), types.NewInt(int64(queued))},
+			{types.NewStr("completed"), types.NewInt(completed)},
+			{types.NewStr("goroutines"), types.NewInt(int64(runtime.NumGoroutine()))},
+			{types.NewStr("cpus"), types.NewInt(int64(runtime.NumCPU()))},
+		}))
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return types.Err(types.E_ARGS)
+	}
+	function, ok1 := args[0].(types.StrValue)
+	pool, ok2 := args[1].(types.StrValue)
+	if !ok1 || !ok2 {
+		return types.Err(types.E_TYPE)
+	}
+	size := int64(0)
+	if len(args) == 3 {
+		n, ok := args[2].(types.IntValue)
+		if !ok {
+			return types.Err(types.E_TYPE)
+		}
+		size = n.Val
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+	if function.Value() != "INIT" || pool.Value() != "MAIN" {
+		return types.Err(types.E_INVARG)
+	}
+	backgroundThreads.resize(int(max(size, 0)))
+	return types.Ok(types.NewInt(1))
+}
@@ -0,0 +1,113 @@
+package builtins
+
+import (
+	"testing"
+	"time"
+
+	"barn/task"
+	"barn/types"
+)
+
+// fakeThreadedCaller stands in for the VM calling a threaded builtin
+type fakeThreadedCaller struct {
+	suspendable bool
+	threadsOff  bool
+}
+
+func (c *fakeThreadedCaller) Suspendable() bool     { return c.suspendable }
+func (c *fakeThreadedCaller) ThreadMode() bool      { return !c.threadsOff }
+func (c *fakeThreadedCaller) SetThreadMode(on bool) { c.threadsOff = !on }
+
+// waitForState waits for a task run in the background to leave Suspended
+func waitForState(t *testing.T, tk *task.Task, want task.TaskState) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for tk.GetState() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("task state = %v, want %v", tk.GetState(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunInBackground(t *testing.T) {
+	tk := task.NewTask(1, 2, 30000, 5.0)
+	tk.SetState(task.TaskRunning)
+	caller := &fakeThreadedCaller{suspendable: true}
+	ctx := types.NewTaskContext()
+	ctx.Task = tk
+	ctx.CallerVM = caller
+
+	result := runInBackground(ctx, func() types.Result { return types.Ok(types.NewInt(42)) })
+	if result.Flow != types.FlowSuspend {
+		t.Fatalf("runInBackground from a suspendable caller: flow %v, want a suspend", result.Flow)
+	}
+	waitForState(t, tk, task.TaskQueued)
+	if tk.WakeError != nil || tk.WakeValue == nil || !tk.WakeValue.Equal(types.NewInt(42)) {
+		t.Errorf("task woke with %v (error %v), want 42", tk.WakeValue, tk.WakeError)
+	}
+
+	// An error, or a panic, wakes the task to raise it
+	tk.SetState(task.TaskRunning)
+	runInBackground(ctx, func() types.Result { panic("boom") })
+	waitForState(t, tk, task.TaskQueued)
+	if tk.WakeError == nil || tk.WakeError.Error != types.E_EXEC {
+		t.Errorf("task woke from a panic with error %v, want E_EXEC", tk.WakeError)
+	}
+
+	// With thread mode off, or a caller that can't suspend, the work runs now
+	tk.SetState(task.TaskRunning)
+	caller.SetThreadMode(false)
+	if result := runInBackground(ctx, func() types.Result { return types.Ok(types.NewInt(1)) }); result.Flow != types.FlowNormal {
+		t.Errorf("runInBackground with thread mode off: flow %v, want it run now", result.Flow)
+	}
+	caller.SetThreadMode(true)
+	caller.suspendable = false
+	if result := runInBackground(ctx, func() types.Result { return types.Ok(types.NewInt(1)) }); result.Flow != types.FlowNormal {
+		t.Errorf("runInBackground in a lambda: flow %v, want it run now", result.Flow)
+	}
+}
+
+func TestThreadPoolBuiltins(t *testing.T) {
+	defer backgroundThreads.resize(defaultThreadPoolSize)
+	caller := &fakeThreadedCaller{suspendable: true}
+	ctx := types.NewTaskContext()
+	ctx.CallerVM = caller
+
+	if result := builtinSetThreadMode(ctx, nil); !result.Val.Equal(types.NewInt(1)) {
+		t.Errorf("set_thread_mode() = %v, want 1", result.Val)
+	}
+	builtinSetThreadMode(ctx, []types.Value{types.NewInt(0)})
+	if result := builtinSetThreadMode(ctx, nil); !result.Val.Equal(types.NewInt(0)) {
+		t.Errorf("set_thread_mode() after set_thread_mode(0) = %v, want 0", result.Val)
+	}
+	if result := builtinSetThreadMode(ctx, []types.Value{types.NewStr("on")}); result.Error != types.E_TYPE {
+		t.Errorf("set_thread_mode(\"on\"): %v, want E_TYPE", result.Error)
+	}
+
+	resize := []types.Value{types.NewStr("INIT"), types.NewStr("MAIN"), types.NewInt(4)}
+	if result := builtinThreadPool(ctx, resize); result.Error != types.E_PERM {
+		t.Errorf("thread_pool(\"INIT\", \"MAIN\", 4) by a programmer: %v, want E_PERM", result.Error)
+	}
+	ctx.IsWizard = true
+	if result := builtinThreadPool(ctx, []types.Value{types.NewStr("INIT"), types.NewStr("EXTRA"), types.NewInt(4)}); result.Error != types.E_INVARG {
+		t.Errorf("thread_pool on an unknown pool: %v, want E_INVARG", result.Error)
+	}
+	builtinThreadPool(ctx, resize)
+	stats := builtinThreadPool(ctx, nil).Val.(types.MapValue)
+	if workers, _ := stats.Get(types.NewStr("workers")); !workers.Equal(types.NewInt(4)) {
+		t.Errorf("thread_pool() workers = %v after resizing to 4", workers)
+	}
+	for _, key := range []string{"active", "queued", "completed", "goroutines", "cpus"} {
+		if _, ok := stats.Get(types.NewStr(key)); !ok {
+			t.Errorf("thread_pool() has no %q", key)
+		}
+	}
+
+	// A pool of 0 runs threaded builtins in the foreground
+	builtinThreadPool(ctx, []types.Value{types.NewStr("INIT"), types.NewStr("MAIN"), types.NewInt(0)})
+	ctx.Task = task.NewTask(1, 2, 30000, 5.0)
+	if result := runInBackground(ctx, func() types.Result { return types.Ok(types.NewInt(1)) }); result.Flow != types.FlowNormal {
+		t.Errorf("runInBackground with an empty pool: flow %v, want it run now", result.Flow)
+	}
+}
@@ -77,6 +77,9 @@ func valueToStr(val types.Value) string {
 	case types.MapValue:
 		return "[map]"
 
+	case types.LambdaValue:
+		return v.String()
+
 	default:
 		return ""
 	}
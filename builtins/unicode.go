@@ -0,0 +1,107 @@
+package builtins
+
+import (
+	"barn/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// ============================================================================
+// UNICODE STRING BUILTINS
+// ============================================================================
+
+// normForms are the forms normalize() accepts
+var normForms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+// builtinNormalize puts a UTF-8 string in a Unicode normalization form
+// normalize(str [, form]) -> str
+// form is "NFC" (the default), "NFD", "NFKC" or "NFKD", in any case.
+// Raises E_INVARG for another form, or if str is not valid UTF-8.
+func builtinNormalize(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) < 1 || len(args) > 2 {
+		return types.Err(types.E_ARGS)
+	}
+
+	str, ok := args[0].(types.StrValue)
+	if !ok {
+		return types.Err(types.E_TYPE)
+	}
+
+	form := norm.NFC
+	if len(args) == 2 {
+		name, ok := args[1].(types.StrValue)
+		if !ok {
+			return types.Err(types.E_TYPE)
+		}
+		form, ok = normForms[strings.ToUpper(name.Value())]
+		if !ok {
+			return types.Err(types.E_INVARG)
+		}
+	}
+
+	s := str.Value()
+	if !utf8.ValidString(s) {
+		return types.Err(types.E_INVARG)
+	}
+	result := form.String(s)
+
+	// Decomposition can make a string longer
+	if err := CheckStringLimit(result); err != types.E_NONE {
+		return types.Err(err)
+	}
+
+	return types.Ok(types.NewStr(result))
+}
+
+// builtinStringWidth returns how many terminal columns a UTF-8 string takes
+// string_width(str) -> int
+// East Asian wide and fullwidth characters take two columns; combining
+// marks, format characters and control characters take none.
+// Raises E_INVARG if str is not valid UTF-8.
+func builtinStringWidth(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 1 {
+		return types.Err(types.E_ARGS)
+	}
+
+	str, ok := args[0].(types.StrValue)
+	if !ok {
+		return types.Err(types.E_TYPE)
+	}
+
+	s := str.Value()
+	if !utf8.ValidString(s) {
+		return types.Err(types.E_INVARG)
+	}
+
+	total := 0
+	for _, r := range s {
+		total += runeWidth(r)
+	}
+	return types.Ok(types.IntValue{Val: int64(total)})
+}
+
+// runeWidth returns the number of columns r takes on a terminal
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || (r >= 0x7f && r < 0xa0):
+		return 0 // Control characters
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0 // Combining marks and format characters
+	case r >= 0x1160 && r <= 0x11ff:
+		return 0 // Hangul vowels and final consonants join the syllable before them
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,98 @@
+package builtins
+
+import (
+	"testing"
+
+	"barn/types"
+)
+
+func TestUnicodeStringBuiltins(t *testing.T) {
+	call := func(fn func(*types.TaskContext, []types.Value) types.Result, args ...types.Value) string {
+		t.Helper()
+		result := fn(types.NewTaskContext(), args)
+		if result.Flow == types.FlowException {
+			return result.Error.String()
+		}
+		return result.Val.String()
+	}
+	str := types.NewStr
+	name := str("Zoë Ådahl")
+
+	tests := []struct {
+		what         string
+		got          func() string
+		bytes, runes string
+	}{
+		{"length", func() string { return call(builtinLength, name) }, "11", "9"},
+		{"index", func() string { return call(builtinIndex, name, str("a")) }, "9", "7"},
+		{"index folds case", func() string { return call(builtinIndex, name, str("å")) }, "0", "5"},
+		{"rindex", func() string { return call(builtinRindex, name, str("L")) }, "11", "9"},
+		{"strsub", func() string { return call(builtinStrsub, name, str("Ë"), str("e")) }, `"Zo~C3~AB ~C3~85dahl"`, `"Zoe Ådahl"`},
+		{"upcase", func() string { return call(builtinUpcase, name) }, `"ZO~C3~AB ~C3~85DAHL"`, `"ZOË ÅDAHL"`},
+		{"downcase", func() string { return call(builtinDowncase, name) }, `"zo~C3~AB ~C3~85dahl"`, `"zoë ådahl"`},
+		{"reverse", func() string { return call(builtinReverse, str("aé")) }, `"~A9~C3a"`, `"éa"`},
+	}
+	for _, tt := range tests {
+		if got := tt.got(); got != tt.bytes {
+			t.Errorf("%s: got %s in byte mode, want %s", tt.what, got, tt.bytes)
+		}
+	}
+	types.SetUnicodeStrings(true)
+	defer types.SetUnicodeStrings(false)
+	for _, tt := range tests {
+		if got := tt.got(); got != tt.runes {
+			t.Errorf("%s: got %s in unicode mode, want %s", tt.what, got, tt.runes)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	composed, decomposed := "é", "é"
+	tests := []struct {
+		args []types.Value
+		want types.Value
+		err  types.ErrorCode
+	}{
+		{[]types.Value{types.NewStr(decomposed)}, types.NewStr(composed), types.E_NONE},
+		{[]types.Value{types.NewStr(composed), types.NewStr("nfd")}, types.NewStr(decomposed), types.E_NONE},
+		{[]types.Value{types.NewStr("ﬁ"), types.NewStr("NFKC")}, types.NewStr("fi"), types.E_NONE},
+		{[]types.Value{types.NewStr(composed), types.NewStr("NFX")}, nil, types.E_INVARG},
+		{[]types.Value{types.NewStr("\xff")}, nil, types.E_INVARG},
+		{[]types.Value{types.NewInt(1)}, nil, types.E_TYPE},
+	}
+	for _, tt := range tests {
+		result := builtinNormalize(types.NewTaskContext(), tt.args)
+		if tt.err != types.E_NONE {
+			if result.Flow != types.FlowException || result.Error != tt.err {
+				t.Errorf("normalize(%v): got %v, want %v", tt.args, result.Val, tt.err)
+			}
+			continue
+		}
+		if result.Flow != types.FlowNormal || result.Val.(types.StrValue).Value() != tt.want.(types.StrValue).Value() {
+			t.Errorf("normalize(%v) = %v (error %v), want %q", tt.args, result.Val, result.Error, tt.want.(types.StrValue).Value())
+		}
+	}
+}
+
+func TestStringWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+	}{
+		{"hello", 5},
+		{"日本語", 6},
+		{"é", 1},   // Combining acute accent
+		{"ｆｕｌｌ", 8}, // Fullwidth letters
+		{"a​b", 2},  // Zero-width space
+		{"", 0},
+	}
+	for _, tt := range tests {
+		result := builtinStringWidth(types.NewTaskContext(), []types.Value{types.NewStr(tt.s)})
+		if result.Flow != types.FlowNormal || result.Val.(types.IntValue).Val != tt.want {
+			t.Errorf("string_width(%q) = %v, want %d", tt.s, result.Val, tt.want)
+		}
+	}
+	if result := builtinStringWidth(types.NewTaskContext(), []types.Value{types.NewStr("\xc3")}); result.Error != types.E_INVARG {
+		t.Errorf("string_width of invalid UTF-8: got %v, want E_INVARG", result.Error)
+	}
+}
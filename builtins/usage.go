@@ -0,0 +1,214 @@
+package builtins
+
+import (
+	"barn/types"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// RESOURCE USAGE BUILTINS
+// ============================================================================
+//
+// usage() and memory_usage() return Toast's lists, read from the operating
+// system: getrusage(2) (see usage_unix.go), /proc/loadavg and
+// /proc/self/statm. Where one of those isn't available, usage() reports
+// zeros and memory_usage() raises E_FILE, as Toast does. Given a
+// true argument, both return a map instead that adds numbers from the Go
+// runtime; malloc_stats() always returns a map of the runtime's.
+
+// processUsage is what getrusage(RUSAGE_SELF) reports about the server
+type processUsage struct {
+	userTime, systemTime float64 // CPU seconds
+	minflt, majflt       int64   // Page reclaims and page faults
+	inblock, oublock     int64   // Block input and output operations
+	nvcsw, nivcsw        int64   // Voluntary and involuntary context switches
+	nsignals             int64   // Signals received
+	maxrss               int64   // Most resident memory, in kilobytes
+}
+
+// processMemory is the server's memory from /proc/self/statm, in kilobytes
+type processMemory struct {
+	virtual, resident, shared, text, data int64
+}
+
+// builtinUsage implements usage([extended])
+// Returns Toast's list: {{load1, load5, load15}, user time, system time,
+// page reclaims, page faults, block inputs, block outputs, voluntary
+// context switches, involuntary context switches, signals received}.
+// With extended true, returns a map of those and the Go runtime's
+// goroutines and garbage collection (wizard only)
+func builtinUsage(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) > 1 {
+		return types.Err(types.E_ARGS)
+	}
+	if !ctx.IsWizard {
+		return types.Err(types.E_PERM)
+	}
+
+	load := loadAverage()
+	loadList := types.NewList([]types.Value{types.NewFloat(load[0]), types.NewFloat(load[1]), types.NewFloat(load[2])})
+	usage := readProcessUsage()
+	if len(args) == 0 || !args[0].Truthy() {
+		return types.Ok(types.NewList([]types.Value{
+			loadList,
+			types.NewFloat(usage.userTime),
+			types.NewFloat(usage.systemTime),
+			types.NewInt(usage.minflt),
+			types.NewInt(usage.majflt),
+			types.NewInt(usage.inblock),
+			types.NewInt(usage.oublock),
+			types.NewInt(usage.nvcsw),
+			types.NewInt(usage.nivcsw),
+			types.NewInt(usage.nsignals),
+		}))
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return types.Ok(types.NewMap([][2]types.Value{
+		{types.NewStr("load"), loadList},
+		{types.NewStr("user_time"), types.NewFloat(usage.userTime)},
+		{types.NewStr("system_time"), types.NewFloat(usage.systemTime)},
+		{types.NewStr("minflt"), types.NewInt(usage.minflt)},
+		{types.NewStr("majflt"), types.NewInt(usage.majflt)},
+		{types.NewStr("inblock"), types.NewInt(usage.inblock)},
+		{types.NewStr("oublock"), types.NewInt(usage.oublock)},
+		{types.NewStr("nvcsw"), types.NewInt(usage.nvcsw)},
+		{types.NewStr("nivcsw"), types.NewInt(usage.nivcsw)},
+		{types.NewStr("nsignals"), types.NewInt(usage.nsignals)},
+		{types.NewStr("maxrss"), types.NewInt(usage.maxrss)},
+		{types.NewStr("goroutines"), types.NewInt(int64(runtime.NumGoroutine()))},
+		{types.NewStr("cpus"), types.NewInt(int64(runtime.NumCPU()))},
+		{types.NewStr("gc_cycles"), types.NewInt(int64(mem.NumGC))},
+		{types.NewStr("gc_pause_total"), types.NewFloat(time.Duration(mem.PauseTotalNs).Seconds())},
+		{types.NewStr("gc_cpu_fraction"), types.NewFloat(mem.GCCPUFraction)},
+	}))
+}
+
+// builtinMemoryUsage implements memory_usage([extended])
+// Returns Toast's list: {virtual, resident, shared, text, data + stack},
+// in kilobytes; raises E_FILE where the system doesn't report them. With
+// extended true, returns a map of those, where available, and the Go
+// runtime's heap, stacks and total memory, also in kilobytes
+func builtinMemoryUsage(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) > 1 {
+		return types.Err(types.E_ARGS)
+	}
+
+	proc, ok := readProcessMemory()
+	if len(args) == 0 || !args[0].Truthy() {
+		if !ok {
+			return types.Err(types.E_FILE)
+		}
+		return types.Ok(types.NewList([]types.Value{
+			types.NewInt(proc.virtual),
+			types.NewInt(proc.resident),
+			types.NewInt(proc.shared),
+			types.NewInt(proc.text),
+			types.NewInt(proc.data),
+		}))
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var pairs [][2]types.Value
+	if ok {
+		pairs = append(pairs,
+			[2]types.Value{types.NewStr("virtual"), types.NewInt(proc.virtual)},
+			[2]types.Value{types.NewStr("resident"), types.NewInt(proc.resident)},
+			[2]types.Value{types.NewStr("shared"), types.NewInt(proc.shared)},
+			[2]types.Value{types.NewStr("text"), types.NewInt(proc.text)},
+			[2]types.Value{types.NewStr("data"), types.NewInt(proc.data)},
+		)
+	}
+	pairs = append(pairs,
+		[2]types.Value{types.NewStr("heap_inuse"), types.NewInt(int64(mem.HeapInuse / 1024))},
+		[2]types.Value{types.NewStr("heap_idle"), types.NewInt(int64(mem.HeapIdle / 1024))},
+		[2]types.Value{types.NewStr("stack_inuse"), types.NewInt(int64(mem.StackInuse / 1024))},
+		[2]types.Value{types.NewStr("runtime_sys"), types.NewInt(int64(mem.Sys / 1024))},
+	)
+	return types.Ok(types.NewMap(pairs))
+}
+
+// builtinMallocStats implements malloc_stats()
+// Toast prints its allocator's statistics to the log; Barn returns the Go
+// runtime's as a map. Sizes are in bytes and times in seconds
+func builtinMallocStats(ctx *types.TaskContext, args []types.Value) types.Result {
+	if len(args) != 0 {
+		return types.Err(types.E_ARGS)
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	lastGC := 0.0
+	if mem.LastGC != 0 {
+		lastGC = float64(mem.LastGC) / float64(time.Second)
+	}
+	lastPause := time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	result := types.NewMap([][2]types.Value{
+		{types.NewStr("alloc"), types.NewInt(int64(mem.Alloc))},
+		{types.NewStr("total_alloc"), types.NewInt(int64(mem.TotalAlloc))},
+		{types.NewStr("sys"), types.NewInt(int64(mem.Sys))},
+		{types.NewStr("mallocs"), types.NewInt(int64(mem.Mallocs))},
+		{types.NewStr("frees"), types.NewInt(int64(mem.Frees))},
+		{types.NewStr("heap_alloc"), types.NewInt(int64(mem.HeapAlloc))},
+		{types.NewStr("heap_sys"), types.NewInt(int64(mem.HeapSys))},
+		{types.NewStr("heap_idle"), types.NewInt(int64(mem.HeapIdle))},
+		{types.NewStr("heap_inuse"), types.NewInt(int64(mem.HeapInuse))},
+		{types.NewStr("heap_released"), types.NewInt(int64(mem.HeapReleased))},
+		{types.NewStr("heap_objects"), types.NewInt(int64(mem.HeapObjects))},
+		{types.NewStr("stack_inuse"), types.NewInt(int64(mem.StackInuse))},
+		{types.NewStr("next_gc"), types.NewInt(int64(mem.NextGC))},
+		{types.NewStr("num_gc"), types.NewInt(int64(mem.NumGC))},
+		{types.NewStr("last_gc"), types.NewFloat(lastGC)},
+		{types.NewStr("last_pause"), types.NewFloat(lastPause.Seconds())},
+		{types.NewStr("pause_total"), types.NewFloat(time.Duration(mem.PauseTotalNs).Seconds())},
+	})
+	return types.Ok(result)
+}
+
+// loadAverage returns the 1, 5 and 15 minute load averages, or zeros if
+// the system doesn't report them
+func loadAverage() [3]float64 {
+	var load [3]float64
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return load
+	}
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(load) && i < len(fields); i++ {
+		load[i], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	return load
+}
+
+// readProcessMemory reads the server's memory from /proc/self/statm;
+// false if the system doesn't report it
+func readProcessMemory() (processMemory, bool) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return processMemory{}, false
+	}
+	// size resident shared text lib data dt, in pages
+	fields := strings.Fields(string(data))
+	if len(fields) < 6 {
+		return processMemory{}, false
+	}
+	var pages [6]int64
+	for i := range pages {
+		if pages[i], err = strconv.ParseInt(fields[i], 10, 64); err != nil {
+			return processMemory{}, false
+		}
+	}
+	kb := int64(os.Getpagesize() / 1024)
+	return processMemory{
+		virtual:  pages[0] * kb,
+		resident: pages[1] * kb,
+		shared:   pages[2] * kb,
+		text:     pages[3] * kb,
+		data:     pages[5] * kb,
+	}, true
+}
@@ -0,0 +1,83 @@
+package builtins
+
+import (
+	"os"
+	"testing"
+
+	"barn/types"
+)
+
+func TestUsage(t *testing.T) {
+	programmer := types.NewTaskContext()
+	if result := builtinUsage(programmer, nil); result.Error != types.E_PERM {
+		t.Errorf("usage() by a programmer: %v, want E_PERM", result.Error)
+	}
+
+	wizard := types.NewTaskContext()
+	wizard.IsWizard = true
+	result := builtinUsage(wizard, nil)
+	list, ok := result.Val.(types.ListValue)
+	if !ok || list.Len() != 10 {
+		t.Fatalf("usage() = %v, want a list of 10", result.Val)
+	}
+	if load, ok := list.Get(1).(types.ListValue); !ok || load.Len() != 3 {
+		t.Errorf("usage()[1] = %v, want 3 load averages", list.Get(1))
+	}
+	user, ok1 := list.Get(2).(types.FloatValue)
+	system, ok2 := list.Get(3).(types.FloatValue)
+	if !ok1 || !ok2 || user.Val+system.Val <= 0 {
+		t.Errorf("usage() CPU times = %v, %v; want some time used", list.Get(2), list.Get(3))
+	}
+	for i := 4; i <= 10; i++ {
+		if n, ok := list.Get(i).(types.IntValue); !ok || n.Val < 0 {
+			t.Errorf("usage()[%d] = %v, want a count", i, list.Get(i))
+		}
+	}
+
+	extended, ok := builtinUsage(wizard, []types.Value{types.NewInt(1)}).Val.(types.MapValue)
+	if !ok {
+		t.Fatal("usage(1) didn't return a map")
+	}
+	for _, key := range []string{"load", "user_time", "maxrss", "nvcsw", "goroutines", "gc_cycles", "gc_pause_total"} {
+		if _, ok := extended.Get(types.NewStr(key)); !ok {
+			t.Errorf("usage(1) has no %q", key)
+		}
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	ctx := types.NewTaskContext()
+	result := builtinMemoryUsage(ctx, nil)
+	if _, err := os.Stat("/proc/self/statm"); err != nil {
+		if result.Error != types.E_FILE {
+			t.Errorf("memory_usage() without /proc: %v, want E_FILE", result.Error)
+		}
+	} else {
+		list, ok := result.Val.(types.ListValue)
+		if !ok || list.Len() != 5 {
+			t.Fatalf("memory_usage() = %v, want a list of 5", result.Val)
+		}
+		virtual, resident := list.Get(1).(types.IntValue), list.Get(2).(types.IntValue)
+		if resident.Val <= 0 || virtual.Val < resident.Val {
+			t.Errorf("memory_usage() = %v, want resident memory within virtual", list)
+		}
+	}
+
+	extended, ok := builtinMemoryUsage(ctx, []types.Value{types.NewInt(1)}).Val.(types.MapValue)
+	if !ok {
+		t.Fatal("memory_usage(1) didn't return a map")
+	}
+	if heap, _ := extended.Get(types.NewStr("heap_inuse")); heap == nil || heap.(types.IntValue).Val <= 0 {
+		t.Errorf("memory_usage(1) heap_inuse = %v, want the heap's size", heap)
+	}
+
+	stats, ok := builtinMallocStats(ctx, nil).Val.(types.MapValue)
+	if !ok {
+		t.Fatal("malloc_stats() didn't return a map")
+	}
+	for _, key := range []string{"alloc", "total_alloc", "sys", "heap_objects", "num_gc", "pause_total"} {
+		if _, ok := stats.Get(types.NewStr(key)); !ok {
+			t.Errorf("malloc_stats() has no %q", key)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package builtins
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// readProcessUsage asks getrusage(2) about the server
+func readProcessUsage() processUsage {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return processUsage{}
+	}
+	maxrss := int64(ru.Maxrss)
+	if runtime.GOOS == "darwin" {
+		maxrss /= 1024 // Bytes there, kilobytes elsewhere
+	}
+	return processUsage{
+		userTime:   time.Duration(ru.Utime.Nano()).Seconds(),
+		systemTime: time.Duration(ru.Stime.Nano()).Seconds(),
+		minflt:     int64(ru.Minflt),
+		majflt:     int64(ru.Majflt),
+		inblock:    int64(ru.Inblock),
+		oublock:    int64(ru.Oublock),
+		nvcsw:      int64(ru.Nvcsw),
+		nivcsw:     int64(ru.Nivcsw),
+		nsignals:   int64(ru.Nsignals),
+		maxrss:     maxrss,
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+// +build windows
+
+package builtins
+
+// readProcessUsage reports zeros: Windows has no getrusage(2)
+func readProcessUsage() processUsage {
+	return processUsage{}
+}
@@ -79,40 +79,40 @@ func (r *Registry) RegisterVerbBuiltins(store *db.Store) {
 	// Verb listing and information
 	r.Register("verbs", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinVerbs(ctx, args, store)
-	})
+	}).Args(1, 1)
 
 	r.Register("verb_info", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinVerbInfo(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("verb_args", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinVerbArgs(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("verb_code", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinVerbCode(ctx, args, store)
-	})
+	}).Args(2, 4)
 
 	// Verb management
 	r.Register("add_verb", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinAddVerb(ctx, args, store)
-	})
+	}).Args(3, 3)
 
 	r.Register("delete_verb", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinDeleteVerb(ctx, args, store)
-	})
+	}).Args(2, 2)
 
 	r.Register("set_verb_info", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinSetVerbInfo(ctx, args, store)
-	})
+	}).Args(3, 3)
 
 	r.Register("set_verb_args", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinSetVerbArgs(ctx, args, store)
-	})
+	}).Args(3, 3)
 
 	r.Register("set_verb_code", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinSetVerbCode(ctx, args, store)
-	})
+	}).Args(3, 3)
 
 	r.Register("disassemble", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinDisassemble(ctx, args, store)
@@ -120,7 +120,7 @@ func (r *Registry) RegisterVerbBuiltins(store *db.Store) {
 
 	r.Register("respond_to", func(ctx *types.TaskContext, args []types.Value) types.Result {
 		return builtinRespondTo(ctx, args, store)
-	})
+	}).Args(2, 2)
 }
 
 // builtinRespondTo: respond_to(object, verb_name) → INT
@@ -198,8 +198,8 @@ func builtinVerbs(ctx *types.TaskContext, args []types.Value, store *db.Store) t
 	}
 
 	// Collect verb names
-	names := make([]types.Value, 0, len(obj.Verbs))
-	for _, verb := range obj.Verbs {
+	names := make([]types.Value, 0, len(obj.VerbList))
+	for _, verb := range obj.VerbList {
 		names = append(names, types.NewStr(verb.Name))
 	}
 
@@ -501,10 +501,13 @@ func builtinAddVerb(ctx *types.TaskContext, args []types.Value, store *db.Store)
 	}
 
 	// Add verb to object (use first name as key).
-	// MOO allows same-name verbs on the same object; newest definition shadows older ones.
+	// MOO allows same-name verbs on the same object. Lookups use the first in
+	// VerbList; the map keeps the newest.
 	obj.Verbs[names[0]] = verb
 	// Add to VerbList for indexing
 	obj.VerbList = append(obj.VerbList, verb)
+	store.InvalidateVerbCache()
+	store.ObjectChanged(obj)
 
 	// Return 1-based index
 	return types.Ok(types.NewInt(int64(len(obj.VerbList))))
@@ -571,6 +574,8 @@ func builtinDeleteVerb(ctx *types.TaskContext, args []types.Value, store *db.Sto
 			}
 		}
 	}
+	store.InvalidateVerbCache()
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -646,6 +651,8 @@ func builtinSetVerbInfo(ctx *types.TaskContext, args []types.Value, store *db.St
 		}
 		obj.Verbs[verb.Name] = verb
 	}
+	store.InvalidateVerbCache()
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -701,6 +708,7 @@ func builtinSetVerbArgs(ctx *types.TaskContext, args []types.Value, store *db.St
 		Prep: prepStr,
 		That: iobjStr,
 	}
+	store.ObjectChanged(obj)
 
 	return types.Ok(types.NewInt(0))
 }
@@ -773,6 +781,7 @@ func builtinSetVerbCode(ctx *types.TaskContext, args []types.Value, store *db.St
 	// Update verb
 	verb.Code = lines
 	verb.Program = program
+	store.ObjectChanged(obj)
 
 	// Return empty list (success)
 	return types.Ok(types.NewList([]types.Value{}))
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"barn/builtins"
+	"barn/db"
+	"barn/parser"
+	"barn/types"
+	"barn/vm"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// fmtCommand prints the canonical form of the MOO code in each path, or
+// in stdin if there are none. With write, changed files are rewritten
+// instead.
+func fmtCommand(paths []string, write bool) {
+	if len(paths) == 0 {
+		if write {
+			fmt.Fprintf(os.Stderr, "Error: -fmt-write needs files to rewrite\n")
+			os.Exit(1)
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		out, err := formatSource(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<stdin>: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.WriteString(out)
+		return
+	}
+
+	failed := false
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+			continue
+		}
+		out, err := formatSource(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		if !write {
+			os.Stdout.WriteString(out)
+			continue
+		}
+		if out != string(src) {
+			if err := os.WriteFile(path, []byte(out), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// formatSource formats a file's worth of MOO code, newline-terminated
+func formatSource(src string) (string, error) {
+	lines, err := parser.Format(src)
+	if err != nil || len(lines) == 0 {
+		return "", err
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// fmtDBCommand reformats every verb in store and reports each one it
+// changed. A verb is left alone if it does not parse or if its formatted
+// code would compile differently. The result is written to outPath if
+// there is one.
+func fmtDBCommand(store *db.Store, kind, outPath string) {
+	objs := store.All()
+	sort.Slice(objs, func(i, j int) bool { return objs[i].ID < objs[j].ID })
+
+	registry := vm.BuildVMRegistry(store)
+	verbs, changed, skipped := 0, 0, 0
+	for _, obj := range objs {
+		for _, verb := range obj.VerbList {
+			verbs++
+			name := fmt.Sprintf("#%d:%s", obj.ID, verb.Name)
+			src := strings.Join(verb.Code, "\n")
+			lines, err := parser.Format(src)
+			if err != nil {
+				fmt.Printf("%s: skipped: %v\n", name, err)
+				skipped++
+				continue
+			}
+			if slices.Equal(lines, verb.Code) {
+				continue
+			}
+			if err := checkBytecode(registry, src, strings.Join(lines, "\n")); err != nil {
+				fmt.Printf("%s: skipped: %v\n", name, err)
+				skipped++
+				continue
+			}
+			fmt.Printf("%s: %d of %d lines changed\n", name, linesChanged(verb.Code, lines), len(lines))
+			verb.Code = lines
+			verb.Program = nil
+			verb.BytecodeCache = nil
+			changed++
+		}
+	}
+
+	fmt.Printf("%d of %d verbs reformatted, %d skipped\n", changed, verbs, skipped)
+	if outPath == "" {
+		fmt.Println("Nothing written; pass -dump <path> to save the result")
+		return
+	}
+	saveStore(store, kind, outPath)
+	fmt.Printf("Database written to %s\n", outPath)
+}
+
+// checkBytecode makes sure the formatted version of a verb compiles to
+// the same instructions, constants and variables; line numbers may differ
+func checkBytecode(registry *builtins.Registry, before, after string) error {
+	progA, err := compileSource(registry, before)
+	if err != nil {
+		return fmt.Errorf("does not compile: %v", err)
+	}
+	progB, err := compileSource(registry, after)
+	if err != nil ||
+		!slices.Equal(progA.Code, progB.Code) ||
+		!slices.Equal(progA.VarNames, progB.VarNames) ||
+		!slices.EqualFunc(progA.Constants, progB.Constants, func(x, y types.Value) bool { return x.Equal(y) }) {
+		return fmt.Errorf("formatting would change its bytecode")
+	}
+	return nil
+}
+
+func compileSource(registry *builtins.Registry, src string) (*vm.Program, error) {
+	stmts, err := parser.NewParser(src).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	return vm.NewCompilerWithRegistry(registry).CompileStatements(stmts)
+}
+
+// linesChanged counts the formatted lines that do not appear in the
+// original
+func linesChanged(before, after []string) int {
+	seen := make(map[string]int, len(before))
+	for _, line := range before {
+		seen[line]++
+	}
+	n := 0
+	for _, line := range after {
+		if seen[line] > 0 {
+			seen[line]--
+		} else {
+			n++
+		}
+	}
+	return n
+}
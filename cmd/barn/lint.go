@@ -0,0 +1,40 @@
+package main
+
+import (
+	"barn/db"
+	"barn/lint"
+	"barn/vm"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// lintCommand prints what the linter finds in every verb and exits 1 if
+// it found anything
+func lintCommand(store *db.Store, format string) {
+	findings := lint.New(store, vm.BuildVMRegistry(store).Arity).All()
+
+	switch format {
+	case "json":
+		if findings == nil {
+			findings = []lint.Finding{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "text", "":
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		fmt.Fprintf(os.Stderr, "%d findings\n", len(findings))
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -lint-format %q (want text or json)\n", format)
+		os.Exit(1)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"barn/db"
 	"barn/parser"
+	"barn/profile"
 	"barn/server"
 	"barn/trace"
 	"barn/types"
@@ -18,12 +19,25 @@ import (
 
 func main() {
 	dbPath := flag.String("db", "Test.db", "Database file path")
+	dbBackend := flag.String("db-backend", db.BackendTextdump, "Storage backend for -db: textdump or kv")
+	lazyLoad := flag.Bool("lazy-load", false, "Index the textdump at startup and read each object's properties and verb code on first use")
 	port := flag.Int("port", 7777, "Listen port")
 
 	// Trace flags
 	traceEnabled := flag.Bool("trace", false, "Enable execution tracing")
 	traceFilter := flag.String("trace-filter", "", "Trace filter pattern (glob, e.g., 'do_*' or 'user_*')")
 
+	// Profiler flags
+	profileOut := flag.String("profile", "", "Profile verb execution from startup and write the profile to this file at shutdown")
+	profileFormat := flag.String("profile-format", profile.FormatPprof, "Output format for -profile: pprof (for go tool pprof) or folded (for flame graphs)")
+	profileLines := flag.Bool("profile-lines", false, "Also charge profiled cost to source lines (see profiler_stats())")
+
+	// Compiler flags
+	noOptimize := flag.Bool("no-optimize", false, "Run verbs as compiled, without the bytecode optimizer (for checking optimizer parity)")
+
+	// Debugger flags
+	dapPort := flag.Int("dap-port", 0, "Serve the Debug Adapter Protocol on this loopback port so editors can attach to the MOO debugger (0=disabled)")
+
 	// Inspection flags
 	verbCode := flag.String("verb-code", "", "Dump verb code for #obj:verb (e.g., #0:do_login_command)")
 	listVerbs := flag.String("list-verbs", "", "List all verbs on an object (e.g., #0)")
@@ -32,48 +46,80 @@ func main() {
 	dumpObjRaw := flag.String("dump-obj-raw", "", "Dump raw database fields for an object (e.g., #39)")
 	verbLookup := flag.String("verb-lookup", "", "Show where a verb would be found (e.g., #39:find_exact)")
 	ancestry := flag.String("ancestry", "", "Show full parent chain for an object (e.g., #39)")
+	dbStatsFlag := flag.Bool("db-stats", false, "Report database statistics (object sizes, verbs per owner, inheritance depth)")
+	dbStatsFormat := flag.String("db-stats-format", "table", "Output format for -db-stats: table or json")
+	dbStatsTop := flag.Int("db-stats-top", 20, "Number of entries in each -db-stats top list (0=all)")
+	lintFlag := flag.Bool("lint", false, "Check every verb for likely bugs (exits 1 if any are found)")
+	lintFormat := flag.String("lint-format", "text", "Output format for -lint: text or json")
+
+	// Formatter flags
+	fmtFlag := flag.Bool("fmt", false, "Print MOO code from the named files, or stdin, in canonical form")
+	fmtWrite := flag.Bool("fmt-write", false, "With -fmt, rewrite the files in place instead of printing them")
+	fmtDB := flag.Bool("fmt-db", false, "Reformat every verb in the database and report the changes (writes the result to -dump)")
 
 	// Database operations
 	dumpPath := flag.String("dump", "", "Dump database to path and exit")
+	dumpBackend := flag.String("dump-backend", db.BackendTextdump, "Storage backend for -dump: textdump or kv (converts between backends)")
 	checkpointInterval := flag.Int("checkpoint-interval", 3600, "Checkpoint interval in seconds (0=disabled)")
+	compact := flag.Bool("compact", false, "Renumber all live objects into a dense range (writes the result to -dump)")
+	compactMap := flag.String("compact-map", "", "Path for the old->new object mapping written by -compact (default: <dump>.map)")
+
+	// Package operations
+	exportPackage := flag.String("export-package", "", "Export objects and their descendants as a package (e.g., \"#12,#34\")")
+	importPackage := flag.String("import-package", "", "Import a package file into the database (writes the result to -dump)")
+	packageOut := flag.String("package-out", "", "Write the exported package to this file instead of stdout")
+	packageFormat := flag.String("package-format", "yaml", "Package format for -export-package: yaml or json")
+	packageDescendants := flag.Bool("package-descendants", true, "Include descendants of the exported objects")
+	importOwner := flag.String("import-owner", "#2", "Owner for imported objects whose owner cannot be resolved")
+	importDryRun := flag.Bool("import-dry-run", false, "Only check the package for conflicts")
 
 	flag.Parse()
 
-	// Handle -dump flag: dump database and exit
-	if *dumpPath != "" {
-		database, err := db.LoadDatabase(*dbPath)
-		if err != nil {
-			log.Fatalf("Failed to load database: %v", err)
-		}
-		store := database.NewStoreFromDatabase()
+	if *noOptimize {
+		vm.SetOptimize(false)
+	}
 
-		f, err := os.Create(*dumpPath)
-		if err != nil {
-			log.Fatalf("Failed to create dump file: %v", err)
-		}
+	// Handle package export/import
+	if *exportPackage != "" {
+		exportPackageCommand(*dbPath, *dbBackend, *exportPackage, *packageDescendants, *packageFormat, *packageOut)
+		return
+	}
+	if *importPackage != "" {
+		importPackageCommand(*dbPath, *dbBackend, *importPackage, *importOwner, *importDryRun, *dumpPath, *dumpBackend)
+		return
+	}
 
-		writer := db.NewWriter(f, store)
-		if err := writer.WriteDatabase(); err != nil {
-			f.Close()
-			log.Fatalf("Failed to write database: %v", err)
-		}
-		f.Close()
+	// Handle -fmt and -fmt-db: format and exit
+	if *fmtFlag {
+		fmtCommand(flag.Args(), *fmtWrite)
+		return
+	}
+	if *fmtDB {
+		fmtDBCommand(loadStore(*dbPath, *dbBackend), *dumpBackend, *dumpPath)
+		return
+	}
+
+	// Handle -compact: renumber, dump and exit
+	if *compact {
+		compactCommand(*dbPath, *dbBackend, *dumpPath, *dumpBackend, *compactMap)
+		return
+	}
 
+	// Handle -dump flag: dump database and exit
+	if *dumpPath != "" {
+		store := loadStore(*dbPath, *dbBackend)
+		saveStore(store, *dumpBackend, *dumpPath)
 		log.Printf("Database dumped to %s", *dumpPath)
 		return
 	}
 
 	// Check if any inspection flag is set
 	isInspection := *verbCode != "" || *listVerbs != "" || *objInfo != "" || *evalExpr != "" ||
-		*dumpObjRaw != "" || *verbLookup != "" || *ancestry != ""
+		*dumpObjRaw != "" || *verbLookup != "" || *ancestry != "" || *dbStatsFlag || *lintFlag
 
 	if isInspection {
 		// Load database for inspection
-		database, err := db.LoadDatabase(*dbPath)
-		if err != nil {
-			log.Fatalf("Failed to load database: %v", err)
-		}
-		store := database.NewStoreFromDatabase()
+		store := loadStore(*dbPath, *dbBackend)
 
 		if *verbCode != "" {
 			dumpVerbCode(store, *verbCode)
@@ -96,6 +142,12 @@ func main() {
 		if *ancestry != "" {
 			ancestryCommand(store, *ancestry)
 		}
+		if *dbStatsFlag {
+			dbStatsCommand(store, *dbStatsFormat, *dbStatsTop)
+		}
+		if *lintFlag {
+			lintCommand(store, *lintFormat)
+		}
 		return
 	}
 
@@ -124,16 +176,91 @@ func main() {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
+	backend, err := db.OpenBackend(*dbBackend, *dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	if textdump, ok := backend.(*db.TextdumpBackend); ok {
+		textdump.Lazy = *lazyLoad
+	}
+	srv.SetBackend(backend)
+
 	if err := srv.LoadDatabase(); err != nil {
 		log.Fatalf("Failed to load database: %v", err)
 	}
 
+	if *profileOut != "" {
+		if *profileFormat != profile.FormatPprof && *profileFormat != profile.FormatFolded {
+			log.Fatalf("Unknown -profile-format %q (want %s or %s)", *profileFormat, profile.FormatPprof, profile.FormatFolded)
+		}
+		profile.Start(*profileLines)
+		log.Printf("Profiling enabled (writing %s profile to %s at shutdown)", *profileFormat, *profileOut)
+	}
+
+	if *dapPort != 0 {
+		if err := srv.ServeDebugAdapter(*dapPort); err != nil {
+			log.Fatalf("Failed to start debug adapter: %v", err)
+		}
+	}
+
 	log.Printf("Starting server on port %d...", *port)
-	if err := srv.Start(); err != nil {
+	err = srv.Start()
+	if *profileOut != "" {
+		if perr := writeProfile(*profileOut, *profileFormat); perr != nil {
+			log.Printf("Failed to write profile: %v", perr)
+		}
+	}
+	if err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
 
+// writeProfile writes the verb profiler's data to path
+func writeProfile(path, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := profile.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadStore loads the database at path through the given backend
+func loadStore(path, kind string) *db.Store {
+	backend, err := db.OpenBackend(kind, path)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer backend.Close()
+
+	store, err := backend.Load()
+	if err != nil {
+		log.Fatalf("Failed to load database: %v", err)
+	}
+	return store
+}
+
+// saveStore writes store to path, replacing whatever is there
+func saveStore(store *db.Store, kind, path string) {
+	if kind == db.BackendKV {
+		os.Remove(path)
+	}
+	backend, err := db.OpenBackend(kind, path)
+	if err != nil {
+		log.Fatalf("Failed to open dump: %v", err)
+	}
+	if err := backend.Save(store, nil); err != nil {
+		backend.Close()
+		log.Fatalf("Failed to write database: %v", err)
+	}
+	if err := backend.Close(); err != nil {
+		log.Fatalf("Failed to close dump: %v", err)
+	}
+}
+
 // parseObjID parses "#N" or "N" to types.ObjID
 func parseObjID(s string) (types.ObjID, error) {
 	s = strings.TrimPrefix(s, "#")
@@ -569,3 +696,126 @@ func ancestryCommand(store *db.Store, spec string) {
 
 	fmt.Printf("\nTotal depth: %d\n", depth)
 }
+
+// exportPackageCommand writes a package for the given comma-separated roots
+func exportPackageCommand(dbPath, dbBackend, spec string, descendants bool, format, outPath string) {
+	var roots []types.ObjID
+	for _, part := range strings.Split(spec, ",") {
+		id, err := parseObjID(strings.TrimSpace(part))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		roots = append(roots, id)
+	}
+
+	store := loadStore(dbPath, dbBackend)
+
+	pkg, err := store.ExportPackage(roots, descendants)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	data, err := pkg.Marshal(format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if outPath == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(outPath, data, 0644); err != nil {
+		log.Fatalf("Failed to write package: %v", err)
+	}
+	log.Printf("Exported %d objects to %s", len(pkg.Objects), outPath)
+}
+
+// importPackageCommand imports a package file and dumps the resulting database
+func importPackageCommand(dbPath, dbBackend, pkgPath, ownerSpec string, dryRun bool, outPath, dumpBackend string) {
+	if outPath == "" && !dryRun {
+		fmt.Fprintf(os.Stderr, "Error: -import-package needs -dump <path> for the resulting database (or -import-dry-run)\n")
+		os.Exit(1)
+	}
+	owner, err := parseObjID(ownerSpec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(pkgPath)
+	if err != nil {
+		log.Fatalf("Failed to read package: %v", err)
+	}
+	pkg, err := db.ParsePackage(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store := loadStore(dbPath, dbBackend)
+
+	result, err := store.ImportPackage(pkg, db.ImportOptions{Owner: owner, DryRun: dryRun})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		for _, c := range result.Conflicts {
+			fmt.Fprintf(os.Stderr, "  conflict: %s\n", c)
+		}
+		os.Exit(1)
+	}
+
+	keys := make([]string, 0, len(result.Objects))
+	for key := range result.Objects {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return result.Objects[keys[i]] < result.Objects[keys[j]] })
+	for _, key := range keys {
+		fmt.Printf("@%-30s -> #%d\n", key, result.Objects[key])
+	}
+	if dryRun {
+		fmt.Println("(dry run, nothing written)")
+		return
+	}
+
+	saveStore(store, dumpBackend, outPath)
+	log.Printf("Imported %d objects; database written to %s", len(result.Objects), outPath)
+}
+
+// compactCommand renumbers the database densely and writes it with a mapping file
+func compactCommand(dbPath, dbBackend, outPath, dumpBackend, mapPath string) {
+	if outPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: -compact needs -dump <path> for the compacted database\n")
+		os.Exit(1)
+	}
+	if mapPath == "" {
+		mapPath = outPath + ".map"
+	}
+
+	store := loadStore(dbPath, dbBackend)
+	before := store.MaxObject()
+
+	result := store.Compact()
+
+	saveStore(store, dumpBackend, outPath)
+
+	mf, err := os.Create(mapPath)
+	if err != nil {
+		log.Fatalf("Failed to create mapping file: %v", err)
+	}
+	if err := result.WriteMapping(mf); err != nil {
+		mf.Close()
+		log.Fatalf("Failed to write mapping file: %v", err)
+	}
+	mf.Close()
+
+	moved := 0
+	for oldID, newID := range result.Mapping {
+		if oldID != newID {
+			moved++
+		}
+	}
+	log.Printf("Compacted: max_object #%d -> #%d, %d objects renumbered, %d verbs rewritten, %d dangling references set to #-1",
+		before, store.MaxObject(), moved, result.VerbsChanged, result.DanglingRefs)
+	log.Printf("Database written to %s, mapping written to %s", outPath, mapPath)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"barn/builtins"
+	"barn/db"
+	"barn/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// dbStats is the -db-stats report
+type dbStats struct {
+	Objects      int              `json:"objects"`
+	Recycled     int              `json:"recycled"`
+	MaxObject    int64            `json:"max_object"`
+	FlagCounts   map[string]int   `json:"flag_counts"`
+	TopObjects   []objectSize     `json:"top_objects"`
+	TopProps     []propertySize   `json:"top_properties"`
+	VerbOwners   []verbOwnerStats `json:"verbs_by_owner"`
+	Anonymous    int              `json:"anonymous_objects"`
+	Waifs        int              `json:"waifs"`
+	WaifsByClass map[string]int   `json:"waifs_by_class"`
+	DeepChains   []inheritChain   `json:"deepest_inheritance"`
+}
+
+type objectSize struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Bytes int    `json:"bytes"`
+}
+
+type propertySize struct {
+	ID       int64  `json:"id"`
+	Property string `json:"property"`
+	Bytes    int    `json:"bytes"`
+}
+
+type verbOwnerStats struct {
+	Owner       int64  `json:"owner"`
+	Name        string `json:"name"`
+	Verbs       int    `json:"verbs"`
+	SourceBytes int    `json:"source_bytes"`
+}
+
+type inheritChain struct {
+	ID    int64   `json:"id"`
+	Depth int     `json:"depth"`
+	Chain []int64 `json:"chain"`
+}
+
+// dbStatsCommand prints what is taking up space in the database
+func dbStatsCommand(store *db.Store, format string, top int) {
+	stats := collectDBStats(store, top)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "table", "":
+		printDBStats(store, stats)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown -db-stats-format %q (want table or json)\n", format)
+		os.Exit(1)
+	}
+}
+
+func collectDBStats(store *db.Store, top int) *dbStats {
+	stats := &dbStats{
+		MaxObject:    int64(store.MaxObject()),
+		FlagCounts:   make(map[string]int),
+		WaifsByClass: make(map[string]int),
+	}
+
+	all := store.All()
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+
+	flagNames := []struct {
+		flag db.ObjectFlags
+		name string
+	}{
+		{db.FlagUser, "player"},
+		{db.FlagProgrammer, "programmer"},
+		{db.FlagWizard, "wizard"},
+		{db.FlagRead, "read"},
+		{db.FlagWrite, "write"},
+		{db.FlagFertile, "fertile"},
+		{db.FlagAnonymous, "anonymous"},
+	}
+
+	owners := make(map[types.ObjID]*verbOwnerStats)
+	for _, obj := range all {
+		for _, f := range flagNames {
+			if obj.Flags.Has(f.flag) {
+				stats.FlagCounts[f.name]++
+			}
+		}
+		if obj.Anonymous {
+			stats.Anonymous++
+			continue
+		}
+		stats.Objects++
+
+		stats.TopObjects = append(stats.TopObjects, objectSize{
+			ID:    int64(obj.ID),
+			Name:  obj.Name,
+			Bytes: db.ObjectBytes(obj),
+		})
+
+		for name, prop := range obj.Properties {
+			if prop.Clear || prop.Value == nil {
+				continue
+			}
+			stats.TopProps = append(stats.TopProps, propertySize{
+				ID:       int64(obj.ID),
+				Property: name,
+				Bytes:    builtins.ValueBytes(prop.Value),
+			})
+		}
+
+		for _, verb := range obj.VerbList {
+			ov := owners[verb.Owner]
+			if ov == nil {
+				ov = &verbOwnerStats{Owner: int64(verb.Owner)}
+				if owner := store.Get(verb.Owner); owner != nil {
+					ov.Name = owner.Name
+				}
+				owners[verb.Owner] = ov
+			}
+			ov.Verbs++
+			for _, line := range verb.Code {
+				ov.SourceBytes += len(line) + 1
+			}
+		}
+	}
+	// A slot recycled before the database was written has no object at all
+	for id := types.ObjID(0); id <= store.MaxObject(); id++ {
+		if obj := store.GetUnsafe(id); obj == nil || obj.Recycled {
+			stats.Recycled++
+		}
+	}
+
+	sort.SliceStable(stats.TopObjects, func(i, j int) bool { return stats.TopObjects[i].Bytes > stats.TopObjects[j].Bytes })
+	sort.SliceStable(stats.TopProps, func(i, j int) bool {
+		if stats.TopProps[i].Bytes != stats.TopProps[j].Bytes {
+			return stats.TopProps[i].Bytes > stats.TopProps[j].Bytes
+		}
+		if stats.TopProps[i].ID != stats.TopProps[j].ID {
+			return stats.TopProps[i].ID < stats.TopProps[j].ID
+		}
+		return stats.TopProps[i].Property < stats.TopProps[j].Property
+	})
+	stats.TopObjects = truncateTop(stats.TopObjects, top)
+	stats.TopProps = truncateTop(stats.TopProps, top)
+
+	for _, ov := range owners {
+		stats.VerbOwners = append(stats.VerbOwners, *ov)
+	}
+	sort.Slice(stats.VerbOwners, func(i, j int) bool {
+		if stats.VerbOwners[i].SourceBytes != stats.VerbOwners[j].SourceBytes {
+			return stats.VerbOwners[i].SourceBytes > stats.VerbOwners[j].SourceBytes
+		}
+		return stats.VerbOwners[i].Owner < stats.VerbOwners[j].Owner
+	})
+	stats.VerbOwners = truncateTop(stats.VerbOwners, top)
+
+	for classID, count := range store.WaifCountByClass() {
+		stats.Waifs += count
+		stats.WaifsByClass[fmt.Sprintf("#%d", classID)] = count
+	}
+
+	stats.DeepChains = deepestChains(store, all, top)
+	return stats
+}
+
+func truncateTop[T any](items []T, top int) []T {
+	if top > 0 && len(items) > top {
+		return items[:top]
+	}
+	return items
+}
+
+// deepestChains finds the objects with the longest parent chains.
+// Depth follows the deepest parent when an object has several.
+func deepestChains(store *db.Store, all []*db.Object, top int) []inheritChain {
+	depth := make(map[types.ObjID]int)
+	next := make(map[types.ObjID]types.ObjID)
+	onStack := make(map[types.ObjID]bool)
+
+	var measure func(id types.ObjID) int
+	measure = func(id types.ObjID) int {
+		if d, ok := depth[id]; ok {
+			return d
+		}
+		obj := store.Get(id)
+		if obj == nil || onStack[id] {
+			return 0
+		}
+		onStack[id] = true
+		best, bestParent := 0, types.ObjNothing
+		for _, pid := range obj.Parents {
+			if d := measure(pid) + 1; d > best {
+				best, bestParent = d, pid
+			}
+		}
+		onStack[id] = false
+		depth[id] = best
+		next[id] = bestParent
+		return best
+	}
+
+	chains := make([]inheritChain, 0, len(all))
+	for _, obj := range all {
+		if obj.Anonymous {
+			continue
+		}
+		chains = append(chains, inheritChain{ID: int64(obj.ID), Depth: measure(obj.ID)})
+	}
+	sort.SliceStable(chains, func(i, j int) bool { return chains[i].Depth > chains[j].Depth })
+	chains = truncateTop(chains, top)
+
+	for i := range chains {
+		id := types.ObjID(chains[i].ID)
+		for steps := 0; id != types.ObjNothing && steps <= chains[i].Depth; steps++ {
+			chains[i].Chain = append(chains[i].Chain, int64(id))
+			id = next[id]
+		}
+	}
+	return chains
+}
+
+func printDBStats(store *db.Store, stats *dbStats) {
+	fmt.Printf("=== Database Statistics ===\n")
+	fmt.Printf("Objects:    %d live, %d recycled slots (max_object #%d)\n", stats.Objects, stats.Recycled, stats.MaxObject)
+	fmt.Printf("Anonymous:  %d\n", stats.Anonymous)
+	fmt.Printf("Waifs:      %d\n", stats.Waifs)
+
+	fmt.Printf("\n--- Objects by flag ---\n")
+	for _, name := range []string{"player", "programmer", "wizard", "read", "write", "fertile", "anonymous"} {
+		fmt.Printf("  %-12s %d\n", name, stats.FlagCounts[name])
+	}
+
+	fmt.Printf("\n--- Top objects by object_bytes ---\n")
+	for _, o := range stats.TopObjects {
+		fmt.Printf("  %10d  #%-7d %s\n", o.Bytes, o.ID, o.Name)
+	}
+
+	fmt.Printf("\n--- Top properties by value_bytes ---\n")
+	for _, p := range stats.TopProps {
+		fmt.Printf("  %10d  #%d.%s\n", p.Bytes, p.ID, p.Property)
+	}
+
+	fmt.Printf("\n--- Verbs by owner ---\n")
+	fmt.Printf("  %-8s %-24s %7s %12s\n", "owner", "name", "verbs", "source")
+	for _, v := range stats.VerbOwners {
+		fmt.Printf("  #%-7d %-24s %7d %12d\n", v.Owner, v.Name, v.Verbs, v.SourceBytes)
+	}
+
+	if len(stats.WaifsByClass) > 0 {
+		fmt.Printf("\n--- Waifs by class ---\n")
+		classes := make([]string, 0, len(stats.WaifsByClass))
+		for class := range stats.WaifsByClass {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			fmt.Printf("  %-8s %d\n", class, stats.WaifsByClass[class])
+		}
+	}
+
+	fmt.Printf("\n--- Deepest inheritance chains ---\n")
+	for _, c := range stats.DeepChains {
+		parts := make([]string, len(c.Chain))
+		for i, id := range c.Chain {
+			parts[i] = fmt.Sprintf("#%d", id)
+		}
+		name := ""
+		if obj := store.Get(types.ObjID(c.ID)); obj != nil {
+			name = obj.Name
+		}
+		fmt.Printf("  depth %-3d %-24s %s\n", c.Depth, name, strings.Join(parts, " -> "))
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"barn/db"
+	"barn/lsp"
+	"barn/vm"
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	dbPath := flag.String("db", "Test.db", "Database file path")
+	dbBackend := flag.String("db-backend", db.BackendTextdump, "Storage backend for -db: textdump or kv")
+	specDir := flag.String("spec", "spec/builtins", "Directory of builtin documentation")
+	flag.Parse()
+
+	// stdout carries the protocol
+	log.SetOutput(os.Stderr)
+
+	backend, err := db.OpenBackend(*dbBackend, *dbPath)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	store, err := backend.Load()
+	backend.Close()
+	if err != nil {
+		log.Fatalf("Failed to load database: %v", err)
+	}
+
+	docs, err := lsp.LoadDocs(*specDir)
+	if err != nil {
+		log.Printf("No builtin documentation: %v", err)
+	}
+
+	server := lsp.NewServer(store, vm.BuildVMRegistry(store), docs)
+	if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatalf("LSP: %v", err)
+	}
+}
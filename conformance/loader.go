@@ -18,32 +18,56 @@ type LoadedTest struct {
 	Test  TestCase
 }
 
-// LoadAllTests walks the conformance test directory and loads all test cases
+// LocalTestPath holds barn's own conformance suites, in the same format
+const LocalTestPath = "conformance/testdata"
+
+// LoadAllTests walks the conformance test directories and loads all test cases
 func LoadAllTests() ([]LoadedTest, error) {
 	var loaded []LoadedTest
 
 	// Get absolute path to test directory
 	// Try multiple path resolutions since tests run from different locations
-	testDir := ""
-	candidates := []string{
+	testDir := findTestDir(
 		TestPath,                                    // relative to cwd
 		filepath.Join("..", TestPath),               // if running from conformance/
 		filepath.Join("../..", "cow_py", "tests", "conformance"), // absolute fallback
+	)
+	localDir := findTestDir(LocalTestPath, "testdata")
+
+	if testDir == "" && localDir == "" {
+		return nil, fmt.Errorf("could not find conformance test directory (tried %v and %v)", TestPath, LocalTestPath)
+	}
+
+	for _, dir := range []string{testDir, localDir} {
+		if dir == "" {
+			continue
+		}
+		tests, err := loadTestDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, tests...)
 	}
 
+	return loaded, nil
+}
+
+// findTestDir returns the absolute path of the first candidate that exists
+func findTestDir(candidates ...string) string {
 	for _, candidate := range candidates {
 		abs, err := filepath.Abs(candidate)
 		if err == nil {
 			if _, err := os.Stat(abs); err == nil {
-				testDir = abs
-				break
+				return abs
 			}
 		}
 	}
+	return ""
+}
 
-	if testDir == "" {
-		return nil, fmt.Errorf("could not find conformance test directory (tried %v)", candidates)
-	}
+// loadTestDir loads every .yaml file under testDir
+func loadTestDir(testDir string) ([]LoadedTest, error) {
+	var loaded []LoadedTest
 
 	// Walk the directory tree
 	err := filepath.Walk(testDir, func(path string, info os.FileInfo, err error) error {
@@ -710,6 +710,8 @@ func typeNameToCode(name string) (types.TypeCode, bool) {
 		return types.TYPE_WAIF, true
 	case "bool":
 		return types.TYPE_BOOL, true
+	case "lambda":
+		return types.TYPE_LAMBDA, true
 	default:
 		return 0, false
 	}
@@ -738,6 +740,8 @@ func typeCodeToName(code types.TypeCode) string {
 		return "waif"
 	case types.TYPE_BOOL:
 		return "bool"
+	case types.TYPE_LAMBDA:
+		return "lambda"
 	default:
 		return fmt.Sprintf("unknown(%d)", code)
 	}
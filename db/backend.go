@@ -0,0 +1,114 @@
+package db
+
+import (
+	"fmt"
+	"os"
+)
+
+// Backend persists a Store between server runs.
+// Load is called once at startup; Save is called for every checkpoint
+// and at shutdown. tasks may be nil when there is no scheduler.
+type Backend interface {
+	Load() (*Store, error)
+	Save(store *Store, tasks TaskSource) error
+	Close() error
+	Path() string
+}
+
+// Backend kinds accepted by OpenBackend
+const (
+	BackendTextdump = "textdump"
+	BackendKV       = "kv"
+)
+
+// OpenBackend returns the backend of the given kind for path
+func OpenBackend(kind, path string) (Backend, error) {
+	switch kind {
+	case BackendTextdump, "":
+		return NewTextdumpBackend(path), nil
+	case BackendKV:
+		return OpenKVBackend(path)
+	default:
+		return nil, fmt.Errorf("unknown database backend %q (want %s or %s)", kind, BackendTextdump, BackendKV)
+	}
+}
+
+// TextdumpBackend stores the whole database as a LambdaMOO v17 textdump.
+// Every save rewrites the file: it is written to a temp file next to the
+// database and renamed over it, so a crash never leaves a partial dump.
+type TextdumpBackend struct {
+	path       string
+	generation int // Temp file generation (0, 1), alternated per save
+
+	// Lazy defers reading property values and verb source until each
+	// object is first used (see LoadDatabaseLazy)
+	Lazy bool
+}
+
+// NewTextdumpBackend creates a textdump backend for path
+func NewTextdumpBackend(path string) *TextdumpBackend {
+	return &TextdumpBackend{path: path}
+}
+
+// Path returns the database file path
+func (b *TextdumpBackend) Path() string {
+	return b.path
+}
+
+// Load parses the textdump into a new Store
+func (b *TextdumpBackend) Load() (*Store, error) {
+	if b.Lazy {
+		return LoadDatabaseLazy(b.path)
+	}
+	database, err := LoadDatabase(b.path)
+	if err != nil {
+		return nil, err
+	}
+	return database.NewStoreFromDatabase(), nil
+}
+
+// Save writes a full textdump and atomically replaces the database file
+func (b *TextdumpBackend) Save(store *Store, tasks TaskSource) error {
+	tempPath := fmt.Sprintf("%s.#%d#", b.path, b.generation)
+	if err := writeTextdump(tempPath, store, tasks); err != nil {
+		return err
+	}
+
+	// Remove the previous generation's temp file if an earlier save left one
+	os.Remove(fmt.Sprintf("%s.#%d#", b.path, 1-b.generation))
+
+	if err := atomicRename(tempPath, b.path); err != nil {
+		return fmt.Errorf("rename temp to main: %w", err)
+	}
+	b.generation = 1 - b.generation
+	return nil
+}
+
+// Close is a no-op; the textdump holds no open files between saves
+func (b *TextdumpBackend) Close() error {
+	return nil
+}
+
+// writeTextdump writes a full textdump of store to path
+func writeTextdump(path string, store *Store, tasks TaskSource) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+
+	writer := NewWriter(f, store)
+	if tasks != nil {
+		writer.SetTaskSource(tasks)
+	}
+	if err := writer.WriteDatabase(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("write database: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("close temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"barn/types"
+	"sync"
+)
+
+// ============================================================================
+// OBJECT SIZES
+// ============================================================================
+//
+// ObjectBytes estimates an object's memory as ToastStunt's db_object_bytes
+// does; object_bytes() reports it and the ownership byte quota charges it.
+// Once OwnerBytes is first asked, the store keeps each owner's total,
+// updated as objects are added and recycled and have properties written,
+// rather than measuring every object again. Bulk changes (imports,
+// renumbering, compaction) drop the totals to be measured afresh.
+
+// byteTotals is the store's object_bytes() total for each owner
+type byteTotals struct {
+	mu      sync.Mutex
+	objects map[types.ObjID]objectSize // nil until measured
+	owners  map[types.ObjID]int64
+}
+
+// objectSize is what an object was last counted as, and against whom
+type objectSize struct {
+	owner types.ObjID
+	bytes int64
+}
+
+// OwnerBytes returns the object_bytes() total of the objects owner owns
+func (s *Store) OwnerBytes(owner types.ObjID) int64 {
+	t := &s.bytes
+	t.mu.Lock()
+	if t.objects != nil {
+		defer t.mu.Unlock()
+		return t.owners[owner]
+	}
+	t.mu.Unlock()
+
+	// Lock the store first, as Add and Recycle do
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.objects == nil {
+		t.objects = make(map[types.ObjID]objectSize, len(s.objects))
+		t.owners = make(map[types.ObjID]int64)
+		for _, obj := range s.objects {
+			if !obj.Recycled {
+				s.materialize(obj)
+				t.countLocked(obj, int64(ObjectBytes(obj)))
+			}
+		}
+	}
+	return t.owners[owner]
+}
+
+// propertyWritten counts the change in obj's size from writing prop, whose
+// value replaced old (nil if prop is new to obj)
+func (t *byteTotals) propertyWritten(obj *Object, prop *Property, old types.Value) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	size, ok := t.objects[obj.ID]
+	if !ok {
+		return
+	}
+	delta := int64(ValueBytes(prop.Value))
+	if old != nil {
+		delta -= int64(ValueBytes(old))
+	} else {
+		delta += propertyBytes(prop)
+	}
+	t.countLocked(obj, size.bytes+delta)
+}
+
+// changed measures obj again
+func (t *byteTotals) changed(obj *Object) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.objects[obj.ID]; ok {
+		t.countLocked(obj, int64(ObjectBytes(obj)))
+	}
+}
+
+// added counts an object the store has just added; the caller holds s.mu
+func (t *byteTotals) added(obj *Object) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.objects != nil {
+		t.countLocked(obj, int64(ObjectBytes(obj)))
+	}
+}
+
+// recycled stops counting an object; the caller holds s.mu
+func (t *byteTotals) recycled(id types.ObjID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if size, ok := t.objects[id]; ok {
+		t.owners[size.owner] -= size.bytes
+		delete(t.objects, id)
+	}
+}
+
+// reset drops the totals, to be measured again when next asked
+func (t *byteTotals) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.objects, t.owners = nil, nil
+}
+
+// countLocked records obj as bytes in size, against its current owner
+func (t *byteTotals) countLocked(obj *Object, bytes int64) {
+	if size, ok := t.objects[obj.ID]; ok {
+		t.owners[size.owner] -= size.bytes
+	}
+	t.objects[obj.ID] = objectSize{owner: obj.Owner, bytes: bytes}
+	t.owners[obj.Owner] += bytes
+}
+
+// ObjectBytes returns the approximate memory an object uses
+// Based on ToastStunt's db_object_bytes implementation
+func ObjectBytes(obj *Object) int {
+	// Start with object header size
+	// sizeof(Object) + sizeof(Object*) in C
+	count := 64 + 8 // Approximation for Go struct overhead
+
+	// Object name
+	count += len(obj.Name) + 1
+
+	// Verbs
+	for _, verb := range obj.Verbs {
+		count += 32 // Verb struct overhead
+		count += len(verb.Name) + 1
+		// Program AST size (if compiled)
+		if verb.Program != nil {
+			count += len(verb.Program.Statements) * 64 // Approximate statement size
+		}
+	}
+
+	// Property definitions and values (all properties including inherited)
+	for _, prop := range obj.Properties {
+		count += int(propertyBytes(prop))
+		count += ValueBytes(prop.Value)
+	}
+
+	return count
+}
+
+// propertyBytes is a property's overhead, without its value
+func propertyBytes(prop *Property) int64 {
+	count := 24 // Pval struct overhead (minus Var size)
+	if prop.Defined {
+		count += 32 // Propdef struct overhead
+		count += len(prop.Name) + 1
+	}
+	return int64(count)
+}
+
+// ValueBytes returns the approximate memory a value uses
+// Based on ToastStunt's value_bytes function
+func ValueBytes(v types.Value) int {
+	size := 16 // Base Var struct size
+
+	switch val := v.(type) {
+	case types.StrValue:
+		size += len(val.Value()) + 1
+	case types.FloatValue:
+		size += 8 // sizeof(double)
+	case types.ListValue:
+		elements := val.Elements()
+		size += len(elements) * 16 // List overhead
+		for _, elem := range elements {
+			size += ValueBytes(elem)
+		}
+	case types.MapValue:
+		// Approximate map overhead
+		pairs := val.Pairs()
+		size += len(pairs) * 32 // Map node overhead
+		for _, pair := range pairs {
+			size += ValueBytes(pair[0]) // Key
+			size += ValueBytes(pair[1]) // Value
+		}
+	case types.WaifValue:
+		// Waif overhead - basic struct size
+		size += 64
+		// Note: Waif properties are stored on the class object, not the waif instance
+		// So we just count the waif struct overhead
+	}
+
+	return size
+}
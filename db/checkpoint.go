@@ -32,25 +32,28 @@ func (r DumpReason) String() string {
 
 // CheckpointManager handles periodic database checkpointing
 type CheckpointManager struct {
-	mu         sync.Mutex
-	dbPath     string // Path to main database file
-	store      *Store
-	generation int  // Checkpoint generation number (0, 1)
-	lastSave   time.Time
-	interval   time.Duration
-	stopChan   chan struct{}
-	doneChan   chan struct{}
+	mu       sync.Mutex
+	backend  Backend // Where checkpoints are saved
+	store    *Store
+	lastSave time.Time
+	interval time.Duration
+	stopChan chan struct{}
+	doneChan chan struct{}
 }
 
-// NewCheckpointManager creates a new checkpoint manager
+// NewCheckpointManager creates a checkpoint manager that saves textdumps to dbPath
 func NewCheckpointManager(dbPath string, store *Store, interval time.Duration) *CheckpointManager {
+	return NewCheckpointManagerWithBackend(NewTextdumpBackend(dbPath), store, interval)
+}
+
+// NewCheckpointManagerWithBackend creates a checkpoint manager that saves through backend
+func NewCheckpointManagerWithBackend(backend Backend, store *Store, interval time.Duration) *CheckpointManager {
 	return &CheckpointManager{
-		dbPath:     dbPath,
-		store:      store,
-		generation: 0,
-		interval:   interval,
-		stopChan:   make(chan struct{}),
-		doneChan:   make(chan struct{}),
+		backend:  backend,
+		store:    store,
+		interval: interval,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
 	}
 }
 
@@ -90,60 +93,25 @@ func (cm *CheckpointManager) checkpointLoop() {
 	}
 }
 
-// Checkpoint performs a database checkpoint
-// The process is:
-// 1. Write to a temporary file (db.#N# where N is 0 or 1)
-// 2. Remove the previous checkpoint file
-// 3. Rename temp file to main database file
+// Checkpoint performs a database checkpoint through the backend.
+// A panic dump bypasses the backend and always writes a full textdump
+// next to the database (<path>.PANIC), so it stays readable by any server.
 func (cm *CheckpointManager) Checkpoint(reason DumpReason) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
 	start := time.Now()
 
-	// Generate temp filename based on reason
-	var tempPath string
 	if reason == DumpPanic {
-		tempPath = cm.dbPath + ".PANIC"
-	} else {
-		tempPath = fmt.Sprintf("%s.#%d#", cm.dbPath, cm.generation)
-	}
-
-	// Write to temp file
-	tempFile, err := os.Create(tempPath)
-	if err != nil {
-		return fmt.Errorf("create temp file: %w", err)
-	}
-
-	writer := NewWriter(tempFile, cm.store)
-	if err := writer.WriteDatabase(); err != nil {
-		tempFile.Close()
-		os.Remove(tempPath)
-		return fmt.Errorf("write database: %w", err)
-	}
-
-	if err := tempFile.Close(); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("close temp file: %w", err)
-	}
-
-	// Remove previous checkpoint (other generation)
-	if reason != DumpPanic {
-		prevGen := 1 - cm.generation
-		prevPath := fmt.Sprintf("%s.#%d#", cm.dbPath, prevGen)
-		os.Remove(prevPath) // Ignore error if file doesn't exist
-	}
-
-	// Atomic rename temp -> main database
-	if err := atomicRename(tempPath, cm.dbPath); err != nil {
-		return fmt.Errorf("rename temp to main: %w", err)
+		if err := writeTextdump(cm.backend.Path()+".PANIC", cm.store, nil); err != nil {
+			return err
+		}
+	} else if err := cm.backend.Save(cm.store, nil); err != nil {
+		return err
 	}
 
 	// Update state
 	cm.lastSave = time.Now()
-	if reason != DumpPanic {
-		cm.generation = 1 - cm.generation // Toggle between 0 and 1
-	}
 
 	duration := time.Since(start)
 	fmt.Printf("Checkpoint (%s) completed in %v\n", reason, duration)
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"barn/types"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// CompactResult reports what Compact changed
+type CompactResult struct {
+	Mapping      map[types.ObjID]types.ObjID // Old ID -> new ID for every live object
+	DanglingRefs int                         // References to missing objects rewritten to #-1
+	VerbsChanged int                         // Verbs whose code had object literals rewritten
+}
+
+// Compact renumbers every live object into a dense range starting at #0.
+// Regular objects keep their relative order and are followed by anonymous objects.
+// Every reference is rewritten: object fields, property values (including map
+// keys and waifs) and object literals in verb code. References to objects that
+// no longer exist would otherwise alias a renumbered object, so they become #-1.
+// This is an offline operation; it must not run while tasks hold object numbers.
+func (s *Store) Compact() *CompactResult {
+	s.materializeAll()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes.reset()
+	s.waifs.reset()
+	s.MarkAllDirty()
+
+	var regular, anonymous []types.ObjID
+	for id, obj := range s.objects {
+		if obj == nil || obj.Recycled || obj.Flags.Has(FlagInvalid) {
+			continue
+		}
+		if obj.Anonymous {
+			anonymous = append(anonymous, id)
+		} else {
+			regular = append(regular, id)
+		}
+	}
+	sort.Slice(regular, func(i, j int) bool { return regular[i] < regular[j] })
+	sort.Slice(anonymous, func(i, j int) bool { return anonymous[i] < anonymous[j] })
+
+	result := &CompactResult{Mapping: make(map[types.ObjID]types.ObjID, len(regular)+len(anonymous))}
+	next := types.ObjID(0)
+	for _, id := range append(regular, anonymous...) {
+		result.Mapping[id] = next
+		next++
+	}
+
+	remap := func(id types.ObjID) types.ObjID {
+		if id < 0 {
+			return id
+		}
+		if newID, ok := result.Mapping[id]; ok {
+			return newID
+		}
+		result.DanglingRefs++
+		return types.ObjNothing
+	}
+	remapList := func(ids []types.ObjID) []types.ObjID {
+		out := make([]types.ObjID, 0, len(ids))
+		for _, id := range ids {
+			if newID := remap(id); newID >= 0 {
+				out = append(out, newID)
+			}
+		}
+		return out
+	}
+
+	// Verb code literals for missing objects are rewritten to #-1 as well.
+	codeMap := make(map[types.ObjID]types.ObjID, len(result.Mapping))
+	for oldID, newID := range result.Mapping {
+		codeMap[oldID] = newID
+	}
+	for id := types.ObjID(0); id <= s.highWaterID; id++ {
+		if _, live := codeMap[id]; !live {
+			codeMap[id] = types.ObjNothing
+		}
+	}
+
+	objects := make(map[types.ObjID]*Object, len(result.Mapping))
+	for oldID, newID := range result.Mapping {
+		obj := s.objects[oldID]
+		obj.ID = newID
+		obj.Owner = remap(obj.Owner)
+		obj.Location = remap(obj.Location)
+		obj.Parents = remapList(obj.Parents)
+		obj.Children = remapList(obj.Children)
+		obj.Contents = remapList(obj.Contents)
+		obj.AnonymousChildren = remapList(obj.AnonymousChildren)
+		if obj.ChparentChildren != nil {
+			remapped := make(map[types.ObjID]bool, len(obj.ChparentChildren))
+			for cid, v := range obj.ChparentChildren {
+				if ncid := remap(cid); ncid >= 0 {
+					remapped[ncid] = v
+				}
+			}
+			obj.ChparentChildren = remapped
+		}
+
+		for _, prop := range obj.Properties {
+			prop.Owner = remap(prop.Owner)
+			if prop.Value != nil {
+				prop.Value = remapValue(prop.Value, remap)
+			}
+		}
+
+		for _, verb := range obj.VerbList {
+			verb.Owner = remap(verb.Owner)
+			if code, changed := RewriteObjectLiterals(verb.Code, codeMap); changed {
+				verb.Code = code
+				verb.Program = nil
+				verb.BytecodeCache = nil
+				result.VerbsChanged++
+			}
+		}
+
+		objects[newID] = obj
+	}
+
+	s.objects = objects
+	s.verbCache.invalidate()
+	s.recycledID = []types.ObjID{}
+	s.waifRegistry = nil
+	s.maxObjID = types.ObjID(len(regular)) - 1
+	s.highWaterID = next - 1
+
+	return result
+}
+
+// remapValue rewrites object references inside a value
+func remapValue(v types.Value, remap func(types.ObjID) types.ObjID) types.Value {
+	switch val := v.(type) {
+	case types.ObjValue:
+		if val.IsAnonymous() {
+			return types.NewAnon(remap(val.ID()))
+		}
+		return types.NewObj(remap(val.ID()))
+	case types.ListValue:
+		elems := val.Elements()
+		out := make([]types.Value, len(elems))
+		for i, elem := range elems {
+			out[i] = remapValue(elem, remap)
+		}
+		return types.NewList(out)
+	case types.MapValue:
+		pairs := val.Pairs()
+		out := make([][2]types.Value, len(pairs))
+		for i, pair := range pairs {
+			out[i] = [2]types.Value{remapValue(pair[0], remap), remapValue(pair[1], remap)}
+		}
+		return types.NewMap(out)
+	case types.WaifValue:
+		waif := types.NewWaif(remap(val.Class()), remap(val.Owner()))
+		for _, name := range val.PropertyNames() {
+			pv, _ := val.GetProperty(name)
+			waif = waif.SetProperty(name, remapValue(pv, remap))
+		}
+		return waif
+	default:
+		return v
+	}
+}
+
+// WriteMapping writes the old->new mapping as "old<TAB>new" lines sorted by old ID
+func (r *CompactResult) WriteMapping(w io.Writer) error {
+	ids := make([]types.ObjID, 0, len(r.Mapping))
+	for id := range r.Mapping {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	if _, err := fmt.Fprintln(w, "# old\tnew"); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := fmt.Fprintf(w, "#%d\t#%d\n", id, r.Mapping[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"barn/types"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompactRenumbersDensely(t *testing.T) {
+	store := NewStore()
+
+	sys := NewObject(0, 0)
+	sys.Properties["thing"] = &Property{Name: "thing", Value: types.NewObj(10), Owner: 0, Defined: true}
+	sys.PropOrder = []string{"thing"}
+	sys.PropDefsCount = 1
+
+	thing := NewObject(10, 0)
+	thing.Parents = []types.ObjID{0}
+	thing.Location = 20
+	thing.Properties["refs"] = &Property{
+		Name: "refs",
+		Value: types.NewMap([][2]types.Value{
+			{types.NewObj(20), types.NewList([]types.Value{types.NewObj(10), types.NewObj(15)})},
+		}),
+		Owner:   10,
+		Defined: true,
+	}
+	waif := types.NewWaif(10, 20).SetProperty("home", types.NewObj(20))
+	thing.Properties["waif"] = &Property{Name: "waif", Value: waif, Owner: 10, Defined: true}
+	thing.PropOrder = []string{"refs", "waif"}
+	thing.PropDefsCount = 2
+	verb := &Verb{Name: "go", Names: []string{"go"}, Owner: 20, Code: []string{`return {#20, #15, "#20"};`}}
+	thing.VerbList = []*Verb{verb}
+	thing.Verbs["go"] = verb
+
+	room := NewObject(20, 20)
+	room.Flags = FlagUser
+	room.Contents = []types.ObjID{10}
+	sys.Children = []types.ObjID{10}
+
+	gone := NewObject(15, 0)
+	for _, obj := range []*Object{sys, thing, room, gone} {
+		if err := store.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Recycle(15)
+
+	result := store.Compact()
+
+	if store.MaxObject() != 2 {
+		t.Fatalf("MaxObject() = %d, want 2", store.MaxObject())
+	}
+	if result.Mapping[10] != 1 || result.Mapping[20] != 2 {
+		t.Fatalf("mapping = %v", result.Mapping)
+	}
+
+	if got := store.Get(0).Properties["thing"].Value; !got.Equal(types.NewObj(1)) {
+		t.Errorf("$thing = %s, want #1", got)
+	}
+	newThing := store.Get(1)
+	if newThing.Location != 2 || newThing.Parents[0] != 0 {
+		t.Errorf("thing location/parent = #%d/#%d", newThing.Location, newThing.Parents[0])
+	}
+	refs := newThing.Properties["refs"].Value.(types.MapValue)
+	inner, ok := refs.Get(types.NewObj(2))
+	if !ok {
+		t.Fatalf("map key not renumbered: %s", refs)
+	}
+	if want := "{#1, #-1}"; inner.String() != want {
+		t.Errorf("map value = %s, want %s", inner, want)
+	}
+	newWaif := newThing.Properties["waif"].Value.(types.WaifValue)
+	home, _ := newWaif.GetProperty("home")
+	if newWaif.Class() != 1 || newWaif.Owner() != 2 || !home.Equal(types.NewObj(2)) {
+		t.Errorf("waif not renumbered: class #%d owner #%d home %s", newWaif.Class(), newWaif.Owner(), home)
+	}
+	if code := newThing.VerbList[0].Code[0]; code != `return {#2, #-1, "#20"};` {
+		t.Errorf("verb code = %q", code)
+	}
+	if newThing.VerbList[0].Owner != 2 {
+		t.Errorf("verb owner = #%d, want #2", newThing.VerbList[0].Owner)
+	}
+	if players := store.Players(); len(players) != 1 || players[0] != 2 {
+		t.Errorf("players = %v, want [#2]", players)
+	}
+	if result.DanglingRefs != 1 {
+		t.Errorf("DanglingRefs = %d, want 1", result.DanglingRefs)
+	}
+
+	var buf bytes.Buffer
+	if err := result.WriteMapping(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "#10\t#1\n") {
+		t.Errorf("mapping file missing #10 entry:\n%s", buf.String())
+	}
+}
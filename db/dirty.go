@@ -0,0 +1,96 @@
+package db
+
+import (
+	"barn/types"
+	"sync"
+)
+
+// ============================================================================
+// CHANGE TRACKING
+// ============================================================================
+//
+// The store records which objects changed since a backend last saved
+// them, so that the kv backend writes only those. Store methods record
+// their own changes; code that changes objects directly reports each
+// change with PropertyWritten, ObjectChanged or MarkDirty, and each waif
+// property write with WaifPropertyWritten. A bulk change (imports,
+// renumbering, compaction) marks everything.
+
+// dirtySet is the objects changed since the last TakeDirty
+type dirtySet struct {
+	mu  sync.Mutex
+	ids map[types.ObjID]struct{}
+	all bool // Any object may have changed
+}
+
+// PropertyWritten records that prop, a property of obj, was given a new
+// value. old is the value it replaced, or nil if prop was just added to
+// obj.
+func (s *Store) PropertyWritten(obj *Object, prop *Property, old types.Value) {
+	if s == nil {
+		return
+	}
+	s.MarkDirty(obj.ID)
+	s.bytes.propertyWritten(obj, prop, old)
+	s.waifs.propertyWritten(obj, prop.Value)
+}
+
+// ObjectChanged records a change to obj other than a property value:
+// properties added or removed, its verbs, name, owner or flags
+func (s *Store) ObjectChanged(obj *Object) {
+	if s == nil {
+		return
+	}
+	s.MarkDirty(obj.ID)
+	s.bytes.changed(obj)
+	s.waifs.changed(obj)
+}
+
+// MarkDirty records that the given objects changed in what a save
+// writes, such as their location, contents, parents or children
+func (s *Store) MarkDirty(ids ...types.ObjID) {
+	if s == nil {
+		return
+	}
+	d := &s.dirty
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.all {
+		return
+	}
+	if d.ids == nil {
+		d.ids = make(map[types.ObjID]struct{})
+	}
+	for _, id := range ids {
+		d.ids[id] = struct{}{}
+	}
+}
+
+// MarkAllDirty records that any object may have changed, as after a bulk
+// change
+func (s *Store) MarkAllDirty() {
+	if s == nil {
+		return
+	}
+	d := &s.dirty
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.all, d.ids = true, nil
+}
+
+// TakeDirty returns the objects changed since it was last called, or all
+// true if any may have, and starts recording afresh
+func (s *Store) TakeDirty() (ids []types.ObjID, all bool) {
+	d := &s.dirty
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.all {
+		ids = make([]types.ObjID, 0, len(d.ids))
+		for id := range d.ids {
+			ids = append(ids, id)
+		}
+	}
+	all = d.all
+	d.ids, d.all = nil, false
+	return ids, all
+}
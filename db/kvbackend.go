@@ -0,0 +1,352 @@
+package db
+
+import (
+	"barn/types"
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Key layout of the kv backend
+const (
+	kvKeyMeta       = "meta"
+	kvKeyTasks      = "tasks"
+	kvPrefixObject  = "obj/"
+	kvPrefixAnon    = "anon/"
+	kvFormatVersion = 1
+)
+
+// KVBackend stores one record per object in an append-only key-value file.
+//
+// Each record holds the object in textdump form followed by its verb
+// programs, so loading reuses the textdump reader object by object instead
+// of parsing one huge file. A save serializes only the objects the store
+// marked changed (see TakeDirty) and writes the records whose bytes
+// changed, plus deletes for objects that are gone; an unchanged world
+// costs a commit record. After a waif write or a bulk change, or for a
+// store this backend didn't load or save, it checks every object.
+type KVBackend struct {
+	mu     sync.Mutex
+	log    *kvLog
+	hashes map[string]uint64 // Key -> hash of the record as last loaded or saved
+	synced *Store            // The store the records hold, as of the last Load or Save
+
+	written int // Records written by the last Save
+	deleted int // Records deleted by the last Save
+}
+
+// OpenKVBackend opens or creates a kv database at path
+func OpenKVBackend(path string) (*KVBackend, error) {
+	log, err := openKVLog(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &KVBackend{log: log, hashes: make(map[string]uint64)}
+	// Until Load runs, treat every stored record as stale so the first
+	// Save rewrites the live ones and deletes the rest
+	for _, key := range log.Keys() {
+		b.hashes[key] = 0
+	}
+	return b, nil
+}
+
+// Path returns the database file path
+func (b *KVBackend) Path() string {
+	return b.log.path
+}
+
+// LastSave reports how many records the last Save wrote and deleted
+func (b *KVBackend) LastSave() (written, deleted int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.written, b.deleted
+}
+
+// Load rebuilds a Store from the object records
+func (b *KVBackend) Load() (*Store, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	meta, ok, err := b.log.Get(kvKeyMeta)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("kv database %s is empty", b.log.path)
+	}
+	maxObject, err := parseKVMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	b.hashes[kvKeyMeta] = hashRecord(meta)
+
+	database := &Database{Version: 17, Objects: make(map[types.ObjID]*Object)}
+	for _, key := range b.log.Keys() {
+		anonymous := strings.HasPrefix(key, kvPrefixAnon)
+		if !anonymous && !strings.HasPrefix(key, kvPrefixObject) && key != kvKeyTasks {
+			continue
+		}
+		data, _, err := b.log.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		b.hashes[key] = hashRecord(data)
+
+		r := bufio.NewReader(bytes.NewReader(data))
+		if key == kvKeyTasks {
+			if err := database.readTaskSections(r); err != nil {
+				return nil, fmt.Errorf("read tasks: %w", err)
+			}
+			continue
+		}
+		if err := database.readKVObject(r, anonymous); err != nil {
+			return nil, fmt.Errorf("read %s: %w", key, err)
+		}
+	}
+
+	// Same post-processing as a textdump load
+	database.resolvePropertyNames()
+	database.resolveWaifProperties()
+
+	store := database.NewStoreFromDatabase()
+	// Trailing recycled slots leave no record; keep max_object() stable
+	if maxObject > store.maxObjID {
+		store.maxObjID = maxObject
+	}
+	if maxObject > store.highWaterID {
+		store.highWaterID = maxObject
+	}
+	b.synced = store
+	return store, nil
+}
+
+// readKVObject reads one object record: the object followed by its verb programs
+func (db *Database) readKVObject(r *bufio.Reader, anonymous bool) error {
+	obj, err := db.readObject(r)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return nil
+	}
+	obj.Anonymous = anonymous
+	db.Objects[obj.ID] = obj
+
+	count, err := readInt(r)
+	if err != nil {
+		return fmt.Errorf("read verb count: %w", err)
+	}
+	for i := 0; i < count; i++ {
+		if err := db.readVerbCode(r); err != nil {
+			return fmt.Errorf("read verb code %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// readTaskSections reads the queued, suspended and interrupted task sections
+func (db *Database) readTaskSections(r *bufio.Reader) error {
+	if err := db.readQueuedTasks(r); err != nil {
+		return err
+	}
+	if err := db.readSuspendedTasks(r); err != nil {
+		return err
+	}
+	return db.readInterruptedTasks(r)
+}
+
+// Save writes the records of the objects that changed since the last Load
+// or Save
+func (b *KVBackend) Save(store *Store, tasks TaskSource) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dirty, all := store.TakeDirty()
+	if store != b.synced {
+		all = true
+	}
+	if err := b.save(store, tasks, dirty, all); err != nil {
+		// Keep the changes for the next save
+		if all {
+			store.MarkAllDirty()
+		} else {
+			store.MarkDirty(dirty...)
+		}
+		return err
+	}
+	b.synced = store
+
+	if garbage := b.log.Garbage(); garbage > kvCompactMinGarbage && garbage > b.log.live {
+		if err := b.log.Compact(); err != nil {
+			return fmt.Errorf("compact kv database: %w", err)
+		}
+	}
+	return nil
+}
+
+// save writes the records for the dirty objects, or for every object if
+// all is true, the tasks and the meta record; the caller holds b.mu
+func (b *KVBackend) save(store *Store, tasks TaskSource, dirty []types.ObjID, all bool) error {
+	puts := make(map[string][]byte)
+	hashes := make(map[string]uint64, len(b.hashes))
+	if !all {
+		for key, h := range b.hashes {
+			hashes[key] = h
+		}
+	}
+	put := func(key string, data []byte) {
+		h := hashRecord(data)
+		hashes[key] = h
+		if old, ok := b.hashes[key]; !ok || old != h {
+			puts[key] = data
+		}
+	}
+	encode := func(obj *Object) error {
+		data, err := encodeKVObject(store, obj)
+		if err != nil {
+			return fmt.Errorf("encode #%d: %w", obj.ID, err)
+		}
+		put(kvObjectKey(obj), data)
+		return nil
+	}
+
+	maxID := store.MaxObject()
+	if all {
+		for id := types.ObjID(0); id <= maxID; id++ {
+			obj := store.GetUnsafe(id)
+			if obj == nil || obj.Recycled || obj.Anonymous {
+				continue
+			}
+			if err := encode(obj); err != nil {
+				return err
+			}
+		}
+		for _, obj := range store.GetAnonymousObjects() {
+			if err := encode(obj); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, id := range dirty {
+			obj := store.GetUnsafe(id)
+			if obj == nil || obj.Recycled {
+				// Gone: drop whichever record it had
+				delete(hashes, kvPrefixObject+strconv.FormatInt(int64(id), 10))
+				delete(hashes, kvPrefixAnon+strconv.FormatInt(int64(id), 10))
+				continue
+			}
+			if err := encode(obj); err != nil {
+				return err
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, store)
+	if tasks != nil {
+		w.SetTaskSource(tasks)
+	}
+	if err := w.writeTaskSections(); err != nil {
+		return fmt.Errorf("encode tasks: %w", err)
+	}
+	put(kvKeyTasks, buf.Bytes())
+
+	put(kvKeyMeta, []byte(fmt.Sprintf("format %d\nmax_object %d\n", kvFormatVersion, maxID)))
+
+	var deletes []string
+	for key := range b.hashes {
+		if _, ok := hashes[key]; !ok {
+			deletes = append(deletes, key)
+		}
+	}
+
+	if err := b.log.Write(puts, deletes); err != nil {
+		return err
+	}
+	b.hashes = hashes
+	b.written, b.deleted = len(puts), len(deletes)
+	return nil
+}
+
+// Close closes the kv database file
+func (b *KVBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.log.Close()
+}
+
+// kvObjectKey returns the record key for an object
+func kvObjectKey(obj *Object) string {
+	if obj.Anonymous {
+		return kvPrefixAnon + strconv.FormatInt(int64(obj.ID), 10)
+	}
+	return kvPrefixObject + strconv.FormatInt(int64(obj.ID), 10)
+}
+
+// encodeKVObject serializes an object and its verb programs in textdump form
+func encodeKVObject(store *Store, obj *Object) ([]byte, error) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, store)
+	if err := w.writeObject(obj); err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, verb := range obj.VerbList {
+		if len(verb.Code) > 0 {
+			count++
+		}
+	}
+	if err := w.writeInt(count); err != nil {
+		return nil, err
+	}
+	for idx, verb := range obj.VerbList {
+		if len(verb.Code) == 0 {
+			continue
+		}
+		if err := w.writeVerbProgram(obj.ID, idx, verb.Code); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseKVMeta parses the meta record and returns the saved max_object
+func parseKVMeta(data []byte) (types.ObjID, error) {
+	maxObject := types.ObjID(-1)
+	format := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		field, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("kv meta %s: %w", field, err)
+		}
+		switch field {
+		case "format":
+			format = int(n)
+		case "max_object":
+			maxObject = types.ObjID(n)
+		}
+	}
+	if format != kvFormatVersion {
+		return 0, fmt.Errorf("unsupported kv database format %d", format)
+	}
+	return maxObject, nil
+}
+
+func hashRecord(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
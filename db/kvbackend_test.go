@@ -0,0 +1,170 @@
+package db
+
+import (
+	"barn/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newKVTestStore(t *testing.T) *Store {
+	t.Helper()
+	store := NewStore()
+
+	root := NewObject(1, 2)
+	root.Name = "Root"
+	root.Properties["desc"] = &Property{Name: "desc", Value: types.NewStr("root"), Owner: 2, Perms: PropRead, Defined: true}
+	root.PropOrder = []string{"desc"}
+	root.PropDefsCount = 1
+	verb := &Verb{Name: "look", Names: []string{"look"}, Owner: 2, Perms: VerbRead | VerbExecute, ArgSpec: VerbArgs{This: "this", Prep: "none", That: "none"}, Code: []string{`return this.desc;`}}
+	root.VerbList = []*Verb{verb}
+	root.Verbs["look"] = verb
+
+	wiz := NewObject(2, 2)
+	wiz.Name = "Wizard"
+	wiz.Flags = FlagUser | FlagProgrammer | FlagWizard
+
+	child := NewObject(3, 2)
+	child.Name = "Child"
+	child.Parents = []types.ObjID{1}
+	child.Properties["desc"] = &Property{Name: "desc", Value: types.NewList([]types.Value{types.NewInt(1), types.NewObj(2)}), Owner: 2, Perms: PropRead}
+	root.Children = []types.ObjID{3}
+
+	for _, obj := range []*Object{NewObject(0, 2), root, wiz, child} {
+		if err := store.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestKVBackendRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.kv")
+	backend, err := OpenKVBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Save(newKVTestStore(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	backend.Close()
+
+	backend, err = OpenKVBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	store, err := backend.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if store.MaxObject() != 3 {
+		t.Errorf("MaxObject() = %d, want 3", store.MaxObject())
+	}
+	if obj := store.Get(2); obj == nil || obj.Name != "Wizard" || !obj.Flags.Has(FlagWizard) {
+		t.Fatalf("#2 = %+v", obj)
+	}
+	child := store.Get(3)
+	if child == nil {
+		t.Fatal("#3 missing after load")
+	}
+	want := types.NewList([]types.Value{types.NewInt(1), types.NewObj(2)})
+	if got := child.Properties["desc"].Value; !got.Equal(want) {
+		t.Errorf("#3.desc = %s, want %s", got, want)
+	}
+	verb, defObj, err := store.FindVerb(3, "look")
+	if err != nil || defObj != 1 || len(verb.Code) != 1 || verb.Code[0] != `return this.desc;` {
+		t.Errorf("FindVerb(#3, look) = %+v, %d, %v", verb, defObj, err)
+	}
+}
+
+func TestKVBackendWritesOnlyChangedObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.kv")
+	backend, err := OpenKVBackend(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	store := newKVTestStore(t)
+	if err := backend.Save(store, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Save(store, nil); err != nil {
+		t.Fatal(err)
+	}
+	if written, deleted := backend.LastSave(); written != 0 || deleted != 0 {
+		t.Errorf("unchanged save wrote %d and deleted %d records", written, deleted)
+	}
+
+	wiz := store.Get(2)
+	wiz.Name = "Archwizard"
+	store.ObjectChanged(wiz)
+	if err := store.Recycle(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Save(store, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Only #2 is rewritten and #3 deleted; meta is unchanged because the
+	// recycled #3 is still the highest slot
+	if written, deleted := backend.LastSave(); written != 1 || deleted != 1 {
+		t.Errorf("save wrote %d and deleted %d records, want 1 and 1", written, deleted)
+	}
+
+	// After a bulk change every object is checked, but only changes written
+	store.MarkAllDirty()
+	if err := backend.Save(store, nil); err != nil {
+		t.Fatal(err)
+	}
+	if written, deleted := backend.LastSave(); written != 0 || deleted != 0 {
+		t.Errorf("save after MarkAllDirty wrote %d and deleted %d records, want none", written, deleted)
+	}
+}
+
+func TestKVLogDropsUncommittedBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.kv")
+	l, err := openKVLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(map[string][]byte{"a": []byte("1")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	committed := l.size
+	l.Close()
+
+	// Simulate a crash partway through the next batch: a put with no commit
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKVRecord(f, kvOpPut, "a", []byte("2"))
+	f.Write([]byte{0xde, 0xad})
+	f.Close()
+
+	l, err = openKVLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got, _, _ := l.Get("a"); string(got) != "1" {
+		t.Errorf("a = %q, want %q", got, "1")
+	}
+	if l.size != committed {
+		t.Errorf("size = %d, want truncation to %d", l.size, committed)
+	}
+
+	if err := l.Write(map[string][]byte{"b": []byte("3")}, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	// Only the commit record is left over
+	if keys := l.Keys(); len(keys) != 1 || keys[0] != "b" || l.Garbage() != kvHeaderSize {
+		t.Errorf("after compact keys = %v, garbage = %d", keys, l.Garbage())
+	}
+}
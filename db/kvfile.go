@@ -0,0 +1,338 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+// kvMagic starts every key-value database file
+const kvMagic = "BARNKV1\n"
+
+// Record operations in the key-value log
+const (
+	kvOpPut    = 1
+	kvOpDelete = 2
+	kvOpCommit = 3
+)
+
+// kvHeaderSize is crc32 + op + key length + value length
+const kvHeaderSize = 4 + 1 + 4 + 4
+
+// kvCompactMinGarbage is the smallest amount of dead data worth compacting
+const kvCompactMinGarbage = 4 << 20
+
+// kvEntry locates a live value inside the log file
+type kvEntry struct {
+	offset int64 // Offset of the value bytes
+	length int64 // Length of the value
+	record int64 // Size of the whole record, for garbage accounting
+}
+
+// kvLog is an append-only key-value file.
+// Each record is [crc32][op][keylen][vallen][key][value]. Puts and deletes
+// are written in batches that end with a commit record; on open, records
+// after the last commit (a batch cut short by a crash) are discarded, so a
+// batch is applied entirely or not at all. Old versions of a key stay in
+// the file as garbage until compact rewrites it.
+type kvLog struct {
+	path  string
+	f     *os.File
+	index map[string]kvEntry
+	size  int64 // Committed file size
+	live  int64 // Bytes of records holding live values
+}
+
+// openKVLog opens or creates the log at path and rebuilds its index
+func openKVLog(path string) (*kvLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open kv database: %w", err)
+	}
+	l := &kvLog{path: path, f: f, index: make(map[string]kvEntry)}
+	if err := l.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// recover scans the file, applying committed batches and truncating any
+// trailing partial batch
+func (l *kvLog) recover() error {
+	info, err := l.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := l.f.WriteAt([]byte(kvMagic), 0); err != nil {
+			return fmt.Errorf("write kv header: %w", err)
+		}
+		l.size = int64(len(kvMagic))
+		return l.f.Sync()
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(l.f, 0, info.Size()))
+	magic := make([]byte, len(kvMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != kvMagic {
+		return fmt.Errorf("%s is not a kv database", l.path)
+	}
+
+	type pendingOp struct {
+		op    byte
+		key   string
+		entry kvEntry
+	}
+	var pending []pendingOp
+	offset := int64(len(kvMagic))
+	committed := offset
+	header := make([]byte, kvHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+		sum := binary.BigEndian.Uint32(header[0:4])
+		op := header[4]
+		keyLen := int64(binary.BigEndian.Uint32(header[5:9]))
+		valLen := int64(binary.BigEndian.Uint32(header[9:13]))
+		if offset+kvHeaderSize+keyLen+valLen > info.Size() {
+			break
+		}
+		body := make([]byte, keyLen+valLen)
+		if _, err := io.ReadFull(r, body); err != nil {
+			break
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:])
+		crc.Write(body)
+		if crc.Sum32() != sum {
+			break
+		}
+
+		recordSize := kvHeaderSize + keyLen + valLen
+		switch op {
+		case kvOpPut, kvOpDelete:
+			pending = append(pending, pendingOp{
+				op:  op,
+				key: string(body[:keyLen]),
+				entry: kvEntry{
+					offset: offset + kvHeaderSize + keyLen,
+					length: valLen,
+					record: recordSize,
+				},
+			})
+		case kvOpCommit:
+			for _, p := range pending {
+				l.apply(p.op, p.key, p.entry)
+			}
+			pending = pending[:0]
+			committed = offset + recordSize
+		default:
+			return fmt.Errorf("kv database %s: unknown record op %d at offset %d", l.path, op, offset)
+		}
+		offset += recordSize
+	}
+
+	// Anything past the last commit was never acknowledged; drop it
+	if committed < info.Size() {
+		if err := l.f.Truncate(committed); err != nil {
+			return fmt.Errorf("truncate partial kv batch: %w", err)
+		}
+	}
+	l.size = committed
+	return nil
+}
+
+// apply updates the index for one committed record
+func (l *kvLog) apply(op byte, key string, entry kvEntry) {
+	if old, ok := l.index[key]; ok {
+		l.live -= old.record
+		delete(l.index, key)
+	}
+	if op == kvOpPut {
+		l.index[key] = entry
+		l.live += entry.record
+	}
+}
+
+// Get returns the value stored under key
+func (l *kvLog) Get(key string) ([]byte, bool, error) {
+	entry, ok := l.index[key]
+	if !ok {
+		return nil, false, nil
+	}
+	buf := make([]byte, entry.length)
+	if _, err := l.f.ReadAt(buf, entry.offset); err != nil {
+		return nil, false, fmt.Errorf("read kv %q: %w", key, err)
+	}
+	return buf, true, nil
+}
+
+// Keys returns every live key in sorted order
+func (l *kvLog) Keys() []string {
+	keys := make([]string, 0, len(l.index))
+	for key := range l.index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Write appends puts and deletes as one batch and syncs it to disk.
+// The batch becomes visible only after the commit record is durable.
+func (l *kvLog) Write(puts map[string][]byte, deletes []string) error {
+	if len(puts) == 0 && len(deletes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(puts))
+	for key := range puts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	type applied struct {
+		op    byte
+		key   string
+		entry kvEntry
+	}
+	ops := make([]applied, 0, len(keys)+len(deletes))
+
+	w := bufio.NewWriterSize(io.NewOffsetWriter(l.f, l.size), 1<<16)
+	offset := l.size
+	for _, key := range keys {
+		size, err := writeKVRecord(w, kvOpPut, key, puts[key])
+		if err != nil {
+			return l.abort(err)
+		}
+		ops = append(ops, applied{kvOpPut, key, kvEntry{
+			offset: offset + kvHeaderSize + int64(len(key)),
+			length: int64(len(puts[key])),
+			record: size,
+		}})
+		offset += size
+	}
+	for _, key := range deletes {
+		size, err := writeKVRecord(w, kvOpDelete, key, nil)
+		if err != nil {
+			return l.abort(err)
+		}
+		ops = append(ops, applied{op: kvOpDelete, key: key})
+		offset += size
+	}
+	size, err := writeKVRecord(w, kvOpCommit, "", nil)
+	if err != nil {
+		return l.abort(err)
+	}
+	offset += size
+
+	if err := w.Flush(); err != nil {
+		return l.abort(err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return l.abort(err)
+	}
+
+	for _, op := range ops {
+		l.apply(op.op, op.key, op.entry)
+	}
+	l.size = offset
+	return nil
+}
+
+// abort discards a partially written batch
+func (l *kvLog) abort(err error) error {
+	l.f.Truncate(l.size)
+	return fmt.Errorf("write kv batch: %w", err)
+}
+
+// writeKVRecord writes one record and returns its size
+func writeKVRecord(w io.Writer, op byte, key string, value []byte) (int64, error) {
+	header := make([]byte, kvHeaderSize)
+	header[4] = op
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(key)))
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(value)))
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write([]byte(key))
+	crc.Write(value)
+	binary.BigEndian.PutUint32(header[0:4], crc.Sum32())
+
+	for _, part := range [][]byte{header, []byte(key), value} {
+		if _, err := w.Write(part); err != nil {
+			return 0, err
+		}
+	}
+	return int64(kvHeaderSize + len(key) + len(value)), nil
+}
+
+// Garbage returns the number of bytes held by overwritten or deleted records
+func (l *kvLog) Garbage() int64 {
+	return l.size - int64(len(kvMagic)) - l.live
+}
+
+// Compact rewrites the file with only the live values, as a single batch
+func (l *kvLog) Compact() error {
+	tempPath := l.path + ".compact"
+	os.Remove(tempPath)
+	fresh, err := openKVLog(tempPath)
+	if err != nil {
+		return err
+	}
+
+	puts := make(map[string][]byte, len(l.index))
+	for key := range l.index {
+		value, _, err := l.Get(key)
+		if err != nil {
+			fresh.Close()
+			os.Remove(tempPath)
+			return err
+		}
+		puts[key] = value
+	}
+	if err := fresh.Write(puts, nil); err != nil {
+		fresh.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := fresh.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	l.f.Close()
+	renameErr := atomicRename(tempPath, l.path)
+	reopened, err := openKVLog(l.path)
+	if renameErr != nil {
+		os.Remove(tempPath)
+		if err == nil {
+			*l = *reopened
+		}
+		return fmt.Errorf("replace compacted kv database: %w", renameErr)
+	}
+	if err != nil {
+		return err
+	}
+	*l = *reopened
+	return nil
+}
+
+// Close closes the underlying file
+func (l *kvLog) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
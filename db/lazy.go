@@ -0,0 +1,430 @@
+package db
+
+import (
+	"barn/types"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// lazyObject records where an object's unread data lives in the database file
+type lazyObject struct {
+	propOffset int64         // Offset of the first property value, or -1 if already read
+	verbCode   map[int]int64 // Verb index -> offset of its first code line
+}
+
+// lazyLoader reads deferred object data from the database file.
+// The file stays open until every object has been loaded; checkpoints
+// rename a new file over the path, which leaves this handle valid.
+type lazyLoader struct {
+	mu      sync.Mutex
+	f       *os.File
+	db      *Database // Value decoding context (v17, no waifs)
+	pending atomic.Int64
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// lazyScanner is the state of the indexing pass
+type lazyScanner struct {
+	db      *Database
+	f       *os.File
+	counter *countingReader
+	r       *bufio.Reader
+}
+
+// offset returns the file offset of the next unread byte
+func (sc *lazyScanner) offset() int64 {
+	return sc.counter.n - int64(sc.r.Buffered())
+}
+
+// LoadDatabaseLazy loads a v17 textdump without parsing property values
+// or verb source. The first pass reads each object's header (name, flags,
+// hierarchy, verb and property definitions) and records where its values
+// and verb programs start; the Store reads them the first time the object
+// is handed out. Objects whose values contain waifs are read immediately,
+// because waif references are numbered in file order.
+// Other database versions are loaded eagerly.
+func LoadDatabaseLazy(path string) (*Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	counter := &countingReader{r: f}
+	sc := &lazyScanner{
+		db:      &Database{Objects: make(map[types.ObjID]*Object)},
+		f:       f,
+		counter: counter,
+		r:       bufio.NewReaderSize(counter, 1<<20),
+	}
+
+	header, err := sc.r.ReadString('\n')
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if !strings.Contains(header, "Format Version 17") {
+		f.Close()
+		database, err := LoadDatabase(path)
+		if err != nil {
+			return nil, err
+		}
+		return database.NewStoreFromDatabase(), nil
+	}
+	sc.db.Version = 17
+
+	store, err := sc.scan()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// scan runs the indexing pass over everything after the header
+func (sc *lazyScanner) scan() (*Store, error) {
+	db, r := sc.db, sc.r
+
+	if err := db.readPlayersV17(r); err != nil {
+		return nil, fmt.Errorf("read players: %w", err)
+	}
+	if err := db.readFinalizations(r); err != nil {
+		return nil, fmt.Errorf("read finalizations: %w", err)
+	}
+	if err := db.readClocks(r); err != nil {
+		return nil, fmt.Errorf("read clocks: %w", err)
+	}
+	if err := db.readTaskSections(r); err != nil {
+		return nil, fmt.Errorf("read tasks: %w", err)
+	}
+	if err := db.readActiveConnections(r); err != nil {
+		return nil, fmt.Errorf("read active connections: %w", err)
+	}
+
+	objCount, err := readInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("read object count: %w", err)
+	}
+	for i := 0; i < objCount; i++ {
+		obj, err := sc.readObject()
+		if err != nil {
+			return nil, fmt.Errorf("read object %d: %w", i, err)
+		}
+		if obj != nil {
+			db.Objects[obj.ID] = obj
+		}
+	}
+
+	// Anonymous objects come in batches terminated by a count of 0
+	for {
+		count, err := readInt(r)
+		if err != nil {
+			return nil, fmt.Errorf("read anonymous objects: %w", err)
+		}
+		if count == 0 {
+			break
+		}
+		for i := 0; i < count; i++ {
+			obj, err := sc.readObject()
+			if err != nil {
+				return nil, fmt.Errorf("read anonymous object: %w", err)
+			}
+			if obj != nil {
+				obj.Anonymous = true
+				db.Objects[obj.ID] = obj
+			}
+		}
+	}
+
+	verbCount, err := readInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("read verb count: %w", err)
+	}
+	for i := 0; i < verbCount; i++ {
+		if err := sc.indexVerbCode(); err != nil {
+			return nil, fmt.Errorf("read verb code %d: %w", i, err)
+		}
+	}
+
+	db.resolvePropertyNames()
+	db.resolveWaifProperties()
+
+	store := db.NewStoreFromDatabase()
+	loader := &lazyLoader{f: sc.f, db: &Database{Version: 17}}
+	for _, obj := range db.Objects {
+		if obj.lazy != nil {
+			loader.pending.Add(1)
+		}
+	}
+	if loader.pending.Load() == 0 {
+		sc.f.Close()
+		return store, nil
+	}
+	store.loader = loader
+	return store, nil
+}
+
+// readObject reads an object header and indexes or reads its property values
+func (sc *lazyScanner) readObject() (*Object, error) {
+	obj, err := sc.db.readObjectHeader(sc.r)
+	if err != nil || obj == nil {
+		return obj, err
+	}
+
+	start := sc.offset()
+	hasWaif := false
+	for range obj.PropOrder {
+		waif, err := skipValue(sc.r)
+		if err != nil {
+			return nil, err
+		}
+		hasWaif = hasWaif || waif
+		// Owner and perms
+		if err := skipLine(sc.r); err != nil {
+			return nil, err
+		}
+		if err := skipLine(sc.r); err != nil {
+			return nil, err
+		}
+	}
+
+	obj.lazy = &lazyObject{propOffset: start}
+	if hasWaif {
+		// Read the values now, in file order, from a second reader
+		vr := bufio.NewReader(io.NewSectionReader(sc.f, start, sc.offset()-start))
+		if err := sc.db.readPropertyValues(vr, obj); err != nil {
+			return nil, err
+		}
+		obj.lazy.propOffset = -1
+	}
+	return obj, nil
+}
+
+// indexVerbCode records where one "#obj:index" verb program starts and skips it
+func (sc *lazyScanner) indexVerbCode() error {
+	line, err := sc.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSpace(line)
+	objPart, idxPart, ok := strings.Cut(line, ":")
+	if !ok || !strings.HasPrefix(objPart, "#") {
+		return fmt.Errorf("invalid verb reference: %s", line)
+	}
+	objID, err := strconv.ParseInt(objPart[1:], 10, 64)
+	if err != nil {
+		return fmt.Errorf("parse verb object ID: %w", err)
+	}
+	verbIndex, err := strconv.Atoi(idxPart)
+	if err != nil {
+		return fmt.Errorf("parse verb index: %w", err)
+	}
+
+	start := sc.offset()
+	for {
+		line, err := readSliceLine(sc.r)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(line, []byte(".")) {
+			break
+		}
+	}
+
+	obj := sc.db.Objects[types.ObjID(objID)]
+	if obj == nil || obj.lazy == nil || verbIndex >= len(obj.VerbList) {
+		return nil
+	}
+	if obj.lazy.verbCode == nil {
+		obj.lazy.verbCode = make(map[int]int64)
+	}
+	obj.lazy.verbCode[verbIndex] = start
+	return nil
+}
+
+// materialize reads an object's deferred property values and verb code
+func (s *Store) materialize(obj *Object) {
+	l := s.loader
+	if l == nil || obj == nil || l.pending.Load() == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if obj.lazy == nil {
+		return
+	}
+	if err := l.load(obj); err != nil {
+		fmt.Fprintf(os.Stderr, "Lazy load of #%d failed: %v\n", obj.ID, err)
+	}
+	obj.lazy = nil
+	if l.pending.Add(-1) == 0 {
+		l.f.Close()
+	}
+}
+
+// materializeAll loads every deferred object
+func (s *Store) materializeAll() {
+	if s.loader == nil || s.loader.pending.Load() == 0 {
+		return
+	}
+	s.mu.RLock()
+	objs := make([]*Object, 0, len(s.objects))
+	for _, obj := range s.objects {
+		objs = append(objs, obj)
+	}
+	s.mu.RUnlock()
+	for _, obj := range objs {
+		s.materialize(obj)
+	}
+}
+
+// load reads obj's deferred data; the caller holds l.mu
+func (l *lazyLoader) load(obj *Object) error {
+	if obj.lazy.propOffset >= 0 {
+		r := bufio.NewReader(io.NewSectionReader(l.f, obj.lazy.propOffset, 1<<62))
+		if err := l.db.readPropertyValues(r, obj); err != nil {
+			return err
+		}
+	}
+	for idx, offset := range obj.lazy.verbCode {
+		r := bufio.NewReader(io.NewSectionReader(l.f, offset, 1<<62))
+		var code []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			line = strings.TrimRight(line, "\n\r")
+			if line == "." {
+				break
+			}
+			code = append(code, line)
+		}
+		obj.VerbList[idx].Code = code
+	}
+	return nil
+}
+
+// readSliceLine returns the next line without its newline. The slice is only
+// valid until the next read; lines longer than the buffer come back truncated.
+func readSliceLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	for errors.Is(err, bufio.ErrBufferFull) {
+		_, err = r.ReadSlice('\n')
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// skipLine discards one line
+func skipLine(r *bufio.Reader) error {
+	_, err := readSliceLine(r)
+	return err
+}
+
+// skipInt reads a line holding an integer without allocating
+func skipInt(r *bufio.Reader) (int, error) {
+	line, err := readSliceLine(r)
+	if err != nil {
+		return 0, err
+	}
+	line = bytes.TrimSpace(line)
+	neg := false
+	if len(line) > 0 && line[0] == '-' {
+		neg, line = true, line[1:]
+	}
+	if len(line) == 0 {
+		return 0, fmt.Errorf("parse int: empty line")
+	}
+	n := 0
+	for _, c := range line {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("parse int: %q", line)
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// skipValue skips one encoded value and reports whether it contains a waif
+func skipValue(r *bufio.Reader) (bool, error) {
+	typeCode, err := skipInt(r)
+	if err != nil {
+		return false, err
+	}
+	switch typeCode {
+	case TypeInt, TypeObj, TypeStr, TypeErr, TypeCatch, TypeFinally, TypeFloat, TypeAnon, TypeBool:
+		return false, skipLine(r)
+	case TypeClear, TypeNone:
+		return false, nil
+	case TypeList, TypeMap:
+		count, err := skipInt(r)
+		if err != nil {
+			return false, err
+		}
+		if typeCode == TypeMap {
+			count *= 2
+		}
+		hasWaif := false
+		for i := 0; i < count; i++ {
+			waif, err := skipValue(r)
+			if err != nil {
+				return false, err
+			}
+			hasWaif = hasWaif || waif
+		}
+		return hasWaif, nil
+	case TypeWaif:
+		// Skip the marker line through the "." terminator of a definition;
+		// a reference is just the marker and the terminator
+		marker, err := readSliceLine(r)
+		if err != nil {
+			return true, err
+		}
+		if len(marker) > 0 && marker[0] == 'c' {
+			for i := 0; i < 3; i++ { // class, owner, propdefs length
+				if err := skipLine(r); err != nil {
+					return true, err
+				}
+			}
+			for {
+				idx, err := skipInt(r)
+				if err != nil {
+					return true, err
+				}
+				if idx < 0 {
+					break
+				}
+				if _, err := skipValue(r); err != nil {
+					return true, err
+				}
+			}
+		}
+		return true, skipLine(r)
+	default:
+		return false, fmt.Errorf("unknown value type %d", typeCode)
+	}
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"barn/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDatabaseLazyDefersObjects(t *testing.T) {
+	store := newKVTestStore(t)
+
+	// A waif-valued property forces #2 to be read during indexing
+	root := store.Get(1)
+	root.Properties[":home"] = &Property{Name: ":home", Value: types.NewObj(0), Owner: 2, Perms: PropRead, Defined: true}
+	root.PropOrder = append(root.PropOrder, ":home")
+	root.PropDefsCount++
+	waif := types.NewWaif(1, 2).SetProperty("home", types.NewObj(3))
+	store.Get(2).Properties["pet"] = &Property{Name: "pet", Value: waif, Owner: 2, Perms: PropRead, Defined: true}
+	store.Get(2).PropOrder = []string{"pet"}
+	store.Get(2).PropDefsCount = 1
+
+	path := filepath.Join(t.TempDir(), "world.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWriter(f, store).WriteDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	lazy, err := LoadDatabaseLazy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lazy.objects[3].lazy == nil || len(lazy.objects[3].Properties) != 0 {
+		t.Fatal("#3 was read eagerly")
+	}
+	if lazy.objects[2].lazy == nil || lazy.objects[2].lazy.propOffset != -1 {
+		t.Fatal("#2 holds a waif and should have been read during indexing")
+	}
+
+	child := lazy.Get(3)
+	if child.lazy != nil {
+		t.Fatal("Get(#3) did not load the object")
+	}
+	want := types.NewList([]types.Value{types.NewInt(1), types.NewObj(2)})
+	if got := child.Properties["desc"].Value; !got.Equal(want) {
+		t.Errorf("#3.desc = %s, want %s", got, want)
+	}
+	if prop := child.Properties["desc"]; prop.Owner != 2 || prop.Perms != PropRead {
+		t.Errorf("#3.desc owner/perms = %d/%s", prop.Owner, prop.Perms)
+	}
+
+	verb, defObj, err := lazy.FindVerb(3, "look")
+	if err != nil || defObj != 1 || len(verb.Code) != 1 || verb.Code[0] != `return this.desc;` {
+		t.Errorf("FindVerb(#3, look) = %+v, %d, %v", verb, defObj, err)
+	}
+
+	pet, ok := lazy.Get(2).Properties["pet"].Value.(types.WaifValue)
+	if !ok {
+		t.Fatalf("#2.pet = %v, want a waif", lazy.Get(2).Properties["pet"].Value)
+	}
+	if home, _ := pet.GetProperty("home"); home == nil || !home.Equal(types.NewObj(3)) {
+		t.Errorf("#2.pet.home = %v, want #3", home)
+	}
+
+	lazy.All()
+	if n := lazy.loader.pending.Load(); n != 0 {
+		t.Errorf("%d objects still pending after All()", n)
+	}
+}
@@ -36,6 +36,11 @@ type Object struct {
 	// AnonymousChildren tracks anonymous children created from this parent
 	// Used for invalidation when parent hierarchy changes
 	AnonymousChildren []types.ObjID
+
+	// lazy is set while property values and verb code are still unread in
+	// the database file (see LoadDatabaseLazy); the Store fills them in on
+	// first access
+	lazy *lazyObject
 }
 
 // Property represents a property on an object
@@ -0,0 +1,1007 @@
+package db
+
+import (
+	"barn/types"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PackageFormatVersion is the version written to exported packages.
+const PackageFormatVersion = 1
+
+// Package is a portable snapshot of a set of objects.
+// Object numbers are not preserved: references are written symbolically as
+// "@key" (an object inside the package), "$name" (a corified object on #0)
+// or "#N" (a literal reference). Only #0 and the negative numbers mean the
+// same thing in every database; importing any other #N is a conflict, and an
+// owner given as #N goes to ImportOptions.Owner.
+type Package struct {
+	Format  int             `yaml:"format" json:"format"`
+	Objects []PackageObject `yaml:"objects" json:"objects"`
+}
+
+// PackageObject is one exported object
+type PackageObject struct {
+	Key        string            `yaml:"key" json:"key"`
+	SourceID   int64             `yaml:"source_id" json:"source_id"`
+	Corified   string            `yaml:"corified,omitempty" json:"corified,omitempty"`
+	Name       string            `yaml:"name" json:"name"`
+	Flags      int               `yaml:"flags" json:"flags"`
+	Owner      string            `yaml:"owner" json:"owner"`
+	Parents    []string          `yaml:"parents" json:"parents"`
+	Location   string            `yaml:"location" json:"location"`
+	Properties []PackageProperty `yaml:"properties,omitempty" json:"properties,omitempty"` // Defined on this object
+	Inherited  []PackageProperty `yaml:"inherited,omitempty" json:"inherited,omitempty"`   // Non-clear values of inherited properties
+	Verbs      []PackageVerb     `yaml:"verbs,omitempty" json:"verbs,omitempty"`
+}
+
+// PackageProperty is a property definition or inherited value
+type PackageProperty struct {
+	Name  string        `yaml:"name" json:"name"`
+	Owner string        `yaml:"owner" json:"owner"`
+	Perms string        `yaml:"perms" json:"perms"`
+	Value *PackageValue `yaml:"value,omitempty" json:"value,omitempty"` // nil means clear
+}
+
+// PackageVerb is a verb with its source code
+type PackageVerb struct {
+	Names string   `yaml:"names" json:"names"`
+	Owner string   `yaml:"owner" json:"owner"`
+	Perms string   `yaml:"perms" json:"perms"`
+	This  string   `yaml:"dobj" json:"dobj"`
+	Prep  string   `yaml:"prep" json:"prep"`
+	That  string   `yaml:"iobj" json:"iobj"`
+	Code  []string `yaml:"code,omitempty" json:"code,omitempty"`
+}
+
+// PackageValue is a type-tagged MOO value with symbolic object references
+type PackageValue struct {
+	Type    string                  `yaml:"type" json:"type"`
+	Int     int64                   `yaml:"int,omitempty" json:"int,omitempty"`
+	Float   float64                 `yaml:"float,omitempty" json:"float,omitempty"`
+	Str     string                  `yaml:"str,omitempty" json:"str,omitempty"`
+	Bool    bool                    `yaml:"bool,omitempty" json:"bool,omitempty"`
+	Err     string                  `yaml:"err,omitempty" json:"err,omitempty"`
+	Ref     string                  `yaml:"ref,omitempty" json:"ref,omitempty"`     // obj value, or waif class
+	Owner   string                  `yaml:"owner,omitempty" json:"owner,omitempty"` // waif owner
+	Items   []PackageValue          `yaml:"items,omitempty" json:"items,omitempty"`
+	Entries []PackageMapEntry       `yaml:"entries,omitempty" json:"entries,omitempty"`
+	Props   map[string]PackageValue `yaml:"props,omitempty" json:"props,omitempty"` // waif properties
+}
+
+// PackageMapEntry is a single key/value pair of a map value
+type PackageMapEntry struct {
+	Key   PackageValue `yaml:"key" json:"key"`
+	Value PackageValue `yaml:"value" json:"value"`
+}
+
+// packageFlagMask strips lifecycle flags that must not travel between databases
+const packageFlagMask = ^(FlagAnonymous | FlagInvalid | FlagRecycled)
+
+// Marshal encodes the package as "yaml" or "json"
+func (p *Package) Marshal(format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "", "yaml", "yml":
+		return yaml.Marshal(p)
+	case "json":
+		return json.MarshalIndent(p, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown package format: %s", format)
+	}
+}
+
+// ParsePackage decodes a package from JSON or YAML
+func ParsePackage(data []byte) (*Package, error) {
+	pkg := &Package{}
+	trimmed := bytes.TrimSpace(data)
+	var err error
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(trimmed, pkg)
+	} else {
+		err = yaml.Unmarshal(trimmed, pkg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse package: %w", err)
+	}
+	if pkg.Format != PackageFormatVersion {
+		return nil, fmt.Errorf("unsupported package format version %d", pkg.Format)
+	}
+	return pkg, nil
+}
+
+// --- Export ---
+
+// packageExporter carries the symbolic naming state for one export
+type packageExporter struct {
+	store    *Store
+	keys     map[types.ObjID]string
+	corified map[types.ObjID]string
+}
+
+// ExportPackage builds a package from the given root objects.
+// When descendants is true every (non-anonymous) descendant of each root is included.
+func (s *Store) ExportPackage(roots []types.ObjID, descendants bool) (*Package, error) {
+	s.materializeAll()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	included := make(map[types.ObjID]bool)
+	queue := []types.ObjID{}
+	for _, id := range roots {
+		obj := s.objects[id]
+		if obj == nil || obj.Recycled || obj.Anonymous {
+			return nil, fmt.Errorf("object #%d is not a valid exportable object", id)
+		}
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if included[id] {
+			continue
+		}
+		obj := s.objects[id]
+		if obj == nil || obj.Recycled || obj.Anonymous {
+			continue
+		}
+		included[id] = true
+		if descendants {
+			queue = append(queue, obj.Children...)
+		}
+	}
+
+	ids := make([]types.ObjID, 0, len(included))
+	for id := range included {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	e := &packageExporter{
+		store:    s,
+		keys:     make(map[types.ObjID]string),
+		corified: s.corifiedNamesLocked(),
+	}
+
+	// Assign keys: the corified name when there is one, otherwise objN.
+	used := make(map[string]bool)
+	for _, id := range ids {
+		key := e.corified[id]
+		if key == "" || used[key] {
+			key = fmt.Sprintf("obj%d", id)
+		}
+		for used[key] {
+			key += "_"
+		}
+		used[key] = true
+		e.keys[id] = key
+	}
+
+	pkg := &Package{Format: PackageFormatVersion}
+	for _, id := range ids {
+		po, err := e.exportObject(s.objects[id])
+		if err != nil {
+			return nil, err
+		}
+		pkg.Objects = append(pkg.Objects, po)
+	}
+	return pkg, nil
+}
+
+// corifiedNamesLocked maps objects to the #0 property that names them.
+// When several properties point at one object the alphabetically first wins.
+// Caller must hold s.mu.
+func (s *Store) corifiedNamesLocked() map[types.ObjID]string {
+	result := make(map[types.ObjID]string)
+	sysObj := s.objects[0]
+	if sysObj == nil {
+		return result
+	}
+	names := make([]string, 0, len(sysObj.Properties))
+	for name := range sysObj.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop := sysObj.Properties[name]
+		if prop == nil || prop.Clear {
+			continue
+		}
+		ref, ok := prop.Value.(types.ObjValue)
+		if !ok || ref.IsAnonymous() || ref.ID() < 0 {
+			continue
+		}
+		if _, exists := result[ref.ID()]; !exists {
+			result[ref.ID()] = name
+		}
+	}
+	return result
+}
+
+// ref converts an object number to its symbolic package form
+func (e *packageExporter) ref(id types.ObjID) string {
+	if key, ok := e.keys[id]; ok {
+		return "@" + key
+	}
+	if name, ok := e.corified[id]; ok {
+		return "$" + name
+	}
+	return fmt.Sprintf("#%d", id)
+}
+
+func (e *packageExporter) exportObject(obj *Object) (PackageObject, error) {
+	po := PackageObject{
+		Key:      e.keys[obj.ID],
+		SourceID: int64(obj.ID),
+		Corified: e.corified[obj.ID],
+		Name:     obj.Name,
+		Flags:    int(obj.Flags & packageFlagMask),
+		Owner:    e.ref(obj.Owner),
+		Parents:  []string{},
+		Location: e.ref(obj.Location),
+	}
+	for _, pid := range obj.Parents {
+		po.Parents = append(po.Parents, e.ref(pid))
+	}
+
+	localCount := obj.PropDefsCount
+	if localCount > len(obj.PropOrder) {
+		localCount = len(obj.PropOrder)
+	}
+	local := make(map[string]bool, localCount)
+	for i := 0; i < localCount; i++ {
+		name := obj.PropOrder[i]
+		prop := obj.Properties[name]
+		if prop == nil {
+			continue
+		}
+		local[name] = true
+		pp, err := e.exportProperty(prop)
+		if err != nil {
+			return po, fmt.Errorf("#%d.%s: %w", obj.ID, name, err)
+		}
+		po.Properties = append(po.Properties, pp)
+	}
+
+	inherited := make([]string, 0, len(obj.Properties))
+	for name, prop := range obj.Properties {
+		if !local[name] && !prop.Clear {
+			inherited = append(inherited, name)
+		}
+	}
+	sort.Strings(inherited)
+	for _, name := range inherited {
+		pp, err := e.exportProperty(obj.Properties[name])
+		if err != nil {
+			return po, fmt.Errorf("#%d.%s: %w", obj.ID, name, err)
+		}
+		po.Inherited = append(po.Inherited, pp)
+	}
+
+	for _, verb := range obj.VerbList {
+		code := make([]string, len(verb.Code))
+		copy(code, verb.Code)
+		po.Verbs = append(po.Verbs, PackageVerb{
+			Names: verb.Name,
+			Owner: e.ref(verb.Owner),
+			Perms: verb.Perms.String(),
+			This:  verb.ArgSpec.This,
+			Prep:  verb.ArgSpec.Prep,
+			That:  verb.ArgSpec.That,
+			Code:  code,
+		})
+	}
+	return po, nil
+}
+
+func (e *packageExporter) exportProperty(prop *Property) (PackageProperty, error) {
+	pp := PackageProperty{
+		Name:  prop.Name,
+		Owner: e.ref(prop.Owner),
+		Perms: prop.Perms.String(),
+	}
+	if !prop.Clear && prop.Value != nil {
+		v, err := e.exportValue(prop.Value)
+		if err != nil {
+			return pp, err
+		}
+		pp.Value = &v
+	}
+	return pp, nil
+}
+
+func (e *packageExporter) exportValue(v types.Value) (PackageValue, error) {
+	switch val := v.(type) {
+	case types.IntValue:
+		return PackageValue{Type: "int", Int: val.Val}, nil
+	case types.FloatValue:
+		return PackageValue{Type: "float", Float: val.Val}, nil
+	case types.StrValue:
+		return PackageValue{Type: "str", Str: val.Value()}, nil
+	case types.BoolValue:
+		return PackageValue{Type: "bool", Bool: val.Val}, nil
+	case types.ErrValue:
+		return PackageValue{Type: "err", Err: val.Code().String()}, nil
+	case types.ObjValue:
+		if val.IsAnonymous() {
+			return PackageValue{}, fmt.Errorf("anonymous object reference #%d cannot be exported", val.ID())
+		}
+		return PackageValue{Type: "obj", Ref: e.ref(val.ID())}, nil
+	case types.ListValue:
+		items := make([]PackageValue, 0, val.Len())
+		for i := 1; i <= val.Len(); i++ {
+			item, err := e.exportValue(val.Get(i))
+			if err != nil {
+				return PackageValue{}, err
+			}
+			items = append(items, item)
+		}
+		return PackageValue{Type: "list", Items: items}, nil
+	case types.MapValue:
+		pairs := val.Pairs()
+		entries := make([]PackageMapEntry, 0, len(pairs))
+		for _, pair := range pairs {
+			k, err := e.exportValue(pair[0])
+			if err != nil {
+				return PackageValue{}, err
+			}
+			mv, err := e.exportValue(pair[1])
+			if err != nil {
+				return PackageValue{}, err
+			}
+			entries = append(entries, PackageMapEntry{Key: k, Value: mv})
+		}
+		return PackageValue{Type: "map", Entries: entries}, nil
+	case types.WaifValue:
+		props := make(map[string]PackageValue)
+		for _, name := range val.PropertyNames() {
+			pv, _ := val.GetProperty(name)
+			ev, err := e.exportValue(pv)
+			if err != nil {
+				return PackageValue{}, err
+			}
+			props[name] = ev
+		}
+		return PackageValue{Type: "waif", Ref: e.ref(val.Class()), Owner: e.ref(val.Owner()), Props: props}, nil
+	default:
+		return PackageValue{}, fmt.Errorf("value of type %s cannot be exported", v.Type())
+	}
+}
+
+// --- Import ---
+
+// ImportOptions controls ImportPackage
+type ImportOptions struct {
+	// Owner receives ownership of anything whose owner is a literal #N or
+	// cannot be resolved in the target database (typically players of the
+	// source MOO).
+	Owner types.ObjID
+	// DryRun only runs conflict detection; nothing is created.
+	DryRun bool
+}
+
+// ImportResult reports the outcome of ImportPackage
+type ImportResult struct {
+	Objects   map[string]types.ObjID // Package key -> new object number
+	Conflicts []string
+}
+
+// packageImporter carries resolution state for one import
+type packageImporter struct {
+	store     *Store
+	pkg       *Package
+	opts      ImportOptions
+	byKey     map[string]*PackageObject
+	newIDs    map[string]types.ObjID
+	conflicts []string
+}
+
+// ImportPackage creates the package's objects in this store with fresh object numbers.
+// Conflicts (unresolvable references, clashing $names or property definitions,
+// inheritance cycles) abort the import before anything is created; they are
+// reported in the result together with a non-nil error.
+func (s *Store) ImportPackage(pkg *Package, opts ImportOptions) (*ImportResult, error) {
+	s.materializeAll()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	im := &packageImporter{
+		store:  s,
+		pkg:    pkg,
+		opts:   opts,
+		byKey:  make(map[string]*PackageObject),
+		newIDs: make(map[string]types.ObjID),
+	}
+
+	for i := range pkg.Objects {
+		po := &pkg.Objects[i]
+		if po.Key == "" {
+			im.conflict("object with source #%d has no key", po.SourceID)
+			continue
+		}
+		if _, dup := im.byKey[po.Key]; dup {
+			im.conflict("duplicate package key @%s", po.Key)
+			continue
+		}
+		im.byKey[po.Key] = po
+	}
+
+	order := im.topoOrder()
+
+	// Provisional numbering lets conflict checks and value decoding resolve @refs.
+	next := s.highWaterID + 1
+	for _, po := range order {
+		im.newIDs[po.Key] = next
+		next++
+	}
+
+	im.checkConflicts(order)
+
+	result := &ImportResult{Objects: make(map[string]types.ObjID), Conflicts: im.conflicts}
+	if len(im.conflicts) > 0 {
+		return result, fmt.Errorf("package has %d conflict(s)", len(im.conflicts))
+	}
+	if opts.DryRun {
+		for key, id := range im.newIDs {
+			result.Objects[key] = id
+		}
+		return result, nil
+	}
+
+	s.bytes.reset()
+	s.waifs.reset()
+	s.MarkAllDirty()
+	codeMap := make(map[types.ObjID]types.ObjID, len(order))
+	for _, po := range order {
+		codeMap[types.ObjID(po.SourceID)] = im.newIDs[po.Key]
+	}
+	for _, po := range order {
+		if err := im.createObject(po, codeMap); err != nil {
+			return result, err
+		}
+		result.Objects[po.Key] = im.newIDs[po.Key]
+	}
+	// Locations may point at package objects created later in the order
+	for _, po := range order {
+		im.placeObject(po)
+	}
+	for _, po := range order {
+		if po.Corified != "" {
+			s.corifyLocked(po.Corified, im.newIDs[po.Key], im.owner(""))
+		}
+	}
+	return result, nil
+}
+
+func (im *packageImporter) conflict(format string, args ...any) {
+	im.conflicts = append(im.conflicts, fmt.Sprintf(format, args...))
+}
+
+// topoOrder orders package objects so in-package parents come before children
+func (im *packageImporter) topoOrder() []*PackageObject {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var order []*PackageObject
+	var visit func(po *PackageObject)
+	visit = func(po *PackageObject) {
+		switch state[po.Key] {
+		case done:
+			return
+		case visiting:
+			im.conflict("inheritance cycle through @%s", po.Key)
+			return
+		}
+		state[po.Key] = visiting
+		for _, ref := range po.Parents {
+			if strings.HasPrefix(ref, "@") {
+				if parent, ok := im.byKey[ref[1:]]; ok {
+					visit(parent)
+				}
+			}
+		}
+		state[po.Key] = done
+		order = append(order, po)
+	}
+	for i := range im.pkg.Objects {
+		po := &im.pkg.Objects[i]
+		if im.byKey[po.Key] == po {
+			visit(po)
+		}
+	}
+	return order
+}
+
+// resolve maps a symbolic reference to an object number in the target store
+func (im *packageImporter) resolve(ref string) (types.ObjID, error) {
+	switch {
+	case strings.HasPrefix(ref, "@"):
+		if id, ok := im.newIDs[ref[1:]]; ok {
+			return id, nil
+		}
+		return types.ObjNothing, fmt.Errorf("unknown package object %s", ref)
+	case strings.HasPrefix(ref, "$"):
+		name := ref[1:]
+		if sysObj := im.store.objects[0]; sysObj != nil {
+			if prop := sysObj.Properties[name]; prop != nil && !prop.Clear {
+				if v, ok := prop.Value.(types.ObjValue); ok && im.store.validLocked(v.ID()) {
+					return v.ID(), nil
+				}
+			}
+		}
+		// The reference may be satisfied by an object this package corifies.
+		for key, po := range im.byKey {
+			if po.Corified == name {
+				return im.newIDs[key], nil
+			}
+		}
+		return types.ObjNothing, fmt.Errorf("%s is not defined on #0", ref)
+	case strings.HasPrefix(ref, "#"):
+		id, err := strconv.ParseInt(ref[1:], 10, 64)
+		if err != nil {
+			return types.ObjNothing, fmt.Errorf("invalid object reference %q", ref)
+		}
+		if id > 0 {
+			return types.ObjNothing, fmt.Errorf("%s is neither in the package nor corified", ref)
+		}
+		return types.ObjID(id), nil
+	case ref == "":
+		return types.ObjNothing, nil
+	default:
+		return types.ObjNothing, fmt.Errorf("invalid object reference %q", ref)
+	}
+}
+
+// owner resolves an owner reference, falling back to ImportOptions.Owner.
+// A literal #N owner is never kept: in the target database that number is
+// some other object, quite possibly a wizard.
+func (im *packageImporter) owner(ref string) types.ObjID {
+	if strings.HasPrefix(ref, "#") {
+		return im.opts.Owner
+	}
+	id, err := im.resolve(ref)
+	if err != nil || (!im.store.validLocked(id) && !im.isNew(id)) {
+		return im.opts.Owner
+	}
+	return id
+}
+
+func (im *packageImporter) isNew(id types.ObjID) bool {
+	for _, nid := range im.newIDs {
+		if nid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validLocked is Valid without locking. Caller must hold s.mu.
+func (s *Store) validLocked(id types.ObjID) bool {
+	if id < 0 {
+		return false
+	}
+	obj, ok := s.objects[id]
+	return ok && !obj.Recycled && !obj.Flags.Has(FlagInvalid)
+}
+
+func (im *packageImporter) checkConflicts(order []*PackageObject) {
+	s := im.store
+	for _, po := range order {
+		// Parents must resolve to something that exists (or will).
+		seen := make(map[string]string)
+		for _, ref := range po.Parents {
+			pid, err := im.resolve(ref)
+			if err != nil {
+				im.conflict("@%s: parent %v", po.Key, err)
+				continue
+			}
+			if !s.validLocked(pid) && !im.isNew(pid) {
+				im.conflict("@%s: parent %s does not exist in the target database", po.Key, ref)
+				continue
+			}
+			// Every property visible through this parent must be unique across parents.
+			for _, name := range im.visibleProperties(pid) {
+				if other, dup := seen[name]; dup && other != ref {
+					im.conflict("@%s: property %q is inherited from both %s and %s", po.Key, name, other, ref)
+				}
+				seen[name] = ref
+			}
+		}
+		for _, pp := range po.Properties {
+			if by, clash := seen[pp.Name]; clash {
+				im.conflict("@%s: property %q is already defined on ancestor %s", po.Key, pp.Name, by)
+			}
+		}
+
+		if po.Location != "" {
+			if _, err := im.resolve(po.Location); err != nil {
+				im.conflict("@%s: location %v", po.Key, err)
+			}
+		}
+
+		// Corified names must not displace an existing #0 property.
+		if po.Corified != "" {
+			if sysObj := s.objects[0]; sysObj != nil {
+				if prop := sysObj.Properties[po.Corified]; prop != nil && !prop.Clear {
+					if v, ok := prop.Value.(types.ObjValue); ok && s.validLocked(v.ID()) {
+						im.conflict("@%s: $%s already refers to #%d in the target database", po.Key, po.Corified, v.ID())
+					}
+				}
+			}
+		}
+
+		// Values may only reference things that resolve.
+		props := append(append([]PackageProperty{}, po.Properties...), po.Inherited...)
+		for _, pp := range props {
+			if pp.Value == nil {
+				continue
+			}
+			if _, err := im.decodeValue(*pp.Value); err != nil {
+				im.conflict("@%s.%s: %v", po.Key, pp.Name, err)
+			}
+		}
+	}
+}
+
+// visibleProperties lists every property name defined on id or its ancestors,
+// including package objects that have not been created yet.
+func (im *packageImporter) visibleProperties(id types.ObjID) []string {
+	var names []string
+	visited := make(map[types.ObjID]bool)
+	var walk func(types.ObjID)
+	walk = func(cur types.ObjID) {
+		if visited[cur] {
+			return
+		}
+		visited[cur] = true
+		if po := im.pendingByID(cur); po != nil {
+			for _, pp := range po.Properties {
+				names = append(names, pp.Name)
+			}
+			for _, ref := range po.Parents {
+				if pid, err := im.resolve(ref); err == nil {
+					walk(pid)
+				}
+			}
+			return
+		}
+		obj := im.store.objects[cur]
+		if obj == nil || obj.Recycled {
+			return
+		}
+		for name := range obj.Properties {
+			names = append(names, name)
+		}
+	}
+	walk(id)
+	return names
+}
+
+func (im *packageImporter) pendingByID(id types.ObjID) *PackageObject {
+	for key, nid := range im.newIDs {
+		if nid == id {
+			return im.byKey[key]
+		}
+	}
+	return nil
+}
+
+func (im *packageImporter) decodeValue(pv PackageValue) (types.Value, error) {
+	switch pv.Type {
+	case "int":
+		return types.NewInt(pv.Int), nil
+	case "float":
+		return types.NewFloat(pv.Float), nil
+	case "str":
+		return types.NewStr(pv.Str), nil
+	case "bool":
+		return types.NewBool(pv.Bool), nil
+	case "err":
+		code, ok := types.ErrorFromString(pv.Err)
+		if !ok {
+			return nil, fmt.Errorf("unknown error code %q", pv.Err)
+		}
+		return types.NewErr(code), nil
+	case "obj":
+		id, err := im.resolve(pv.Ref)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewObj(id), nil
+	case "list":
+		items := make([]types.Value, 0, len(pv.Items))
+		for _, item := range pv.Items {
+			v, err := im.decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return types.NewList(items), nil
+	case "map":
+		pairs := make([][2]types.Value, 0, len(pv.Entries))
+		for _, entry := range pv.Entries {
+			k, err := im.decodeValue(entry.Key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := im.decodeValue(entry.Value)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, [2]types.Value{k, v})
+		}
+		return types.NewMap(pairs), nil
+	case "waif":
+		class, err := im.resolve(pv.Ref)
+		if err != nil {
+			return nil, err
+		}
+		waif := types.NewWaif(class, im.owner(pv.Owner))
+		names := make([]string, 0, len(pv.Props))
+		for name := range pv.Props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v, err := im.decodeValue(pv.Props[name])
+			if err != nil {
+				return nil, err
+			}
+			waif = waif.SetProperty(name, v)
+		}
+		return waif, nil
+	default:
+		return nil, fmt.Errorf("unknown value type %q", pv.Type)
+	}
+}
+
+// createObject materializes one package object. Parents are created first
+// (see topoOrder) so inherited properties can be copied from the live store.
+func (im *packageImporter) createObject(po *PackageObject, codeMap map[types.ObjID]types.ObjID) error {
+	s := im.store
+	id := im.newIDs[po.Key]
+	obj := NewObject(id, im.owner(po.Owner))
+	obj.Name = po.Name
+	obj.Flags = ObjectFlags(po.Flags) & packageFlagMask
+
+	for _, ref := range po.Parents {
+		pid, _ := im.resolve(ref)
+		obj.Parents = append(obj.Parents, pid)
+	}
+
+	// Locally defined properties lead PropOrder (see Writer.writeProperties).
+	for _, pp := range po.Properties {
+		prop, err := im.buildProperty(pp)
+		if err != nil {
+			return fmt.Errorf("@%s.%s: %w", po.Key, pp.Name, err)
+		}
+		prop.Defined = true
+		obj.Properties[pp.Name] = prop
+		obj.PropOrder = append(obj.PropOrder, pp.Name)
+	}
+	obj.PropDefsCount = len(po.Properties)
+
+	overrides := make(map[string]PackageProperty, len(po.Inherited))
+	for _, pp := range po.Inherited {
+		overrides[pp.Name] = pp
+	}
+	for _, name := range s.inheritedPropertyOrderLocked(obj) {
+		if _, exists := obj.Properties[name]; exists {
+			continue
+		}
+		def := s.findDefiningPropertyLocked(obj.Parents, name)
+		if def == nil {
+			continue
+		}
+		prop := &Property{Name: name, Value: def.Value, Owner: def.Owner, Perms: def.Perms, Clear: true}
+		if pp, ok := overrides[name]; ok {
+			override, err := im.buildProperty(pp)
+			if err != nil {
+				return fmt.Errorf("@%s.%s: %w", po.Key, name, err)
+			}
+			prop = override
+		}
+		obj.Properties[name] = prop
+		obj.PropOrder = append(obj.PropOrder, name)
+	}
+
+	for _, pv := range po.Verbs {
+		names := strings.Fields(pv.Names)
+		if len(names) == 0 {
+			return fmt.Errorf("@%s: verb with empty name", po.Key)
+		}
+		code, _ := RewriteObjectLiterals(pv.Code, codeMap)
+		verb := &Verb{
+			Name:    pv.Names,
+			Names:   names,
+			Owner:   im.owner(pv.Owner),
+			Perms:   parsePackageVerbPerms(pv.Perms),
+			ArgSpec: VerbArgs{This: pv.This, Prep: pv.Prep, That: pv.That},
+			Code:    code,
+		}
+		obj.VerbList = append(obj.VerbList, verb)
+		obj.Verbs[names[0]] = verb
+	}
+
+	s.objects[id] = obj
+	if id > s.highWaterID {
+		s.highWaterID = id
+	}
+	if id > s.maxObjID {
+		s.maxObjID = id
+	}
+
+	for _, pid := range obj.Parents {
+		if parent := s.objects[pid]; parent != nil {
+			parent.Children = append(parent.Children, id)
+		}
+	}
+
+	return nil
+}
+
+// placeObject moves a created package object into its location, once every
+// package object exists
+func (im *packageImporter) placeObject(po *PackageObject) {
+	s := im.store
+	id := im.newIDs[po.Key]
+	if loc, err := im.resolve(po.Location); err == nil && s.validLocked(loc) {
+		s.objects[id].Location = loc
+		s.objects[loc].Contents = append(s.objects[loc].Contents, id)
+	}
+}
+
+func (im *packageImporter) buildProperty(pp PackageProperty) (*Property, error) {
+	prop := &Property{
+		Name:  pp.Name,
+		Owner: im.owner(pp.Owner),
+		Perms: parsePackagePropertyPerms(pp.Perms),
+		Clear: pp.Value == nil,
+	}
+	if pp.Value != nil {
+		v, err := im.decodeValue(*pp.Value)
+		if err != nil {
+			return nil, err
+		}
+		prop.Value = v
+	}
+	return prop, nil
+}
+
+// inheritedPropertyOrderLocked lists ancestor property names in self-first,
+// depth-first order, matching Writer.collectPropertyNames. Caller must hold s.mu.
+func (s *Store) inheritedPropertyOrderLocked(obj *Object) []string {
+	var names []string
+	visited := map[types.ObjID]bool{obj.ID: true}
+	var walk func(types.ObjID)
+	walk = func(id types.ObjID) {
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+		cur := s.objects[id]
+		if cur == nil || cur.Recycled {
+			return
+		}
+		for i := 0; i < cur.PropDefsCount && i < len(cur.PropOrder); i++ {
+			names = append(names, cur.PropOrder[i])
+		}
+		for _, pid := range cur.Parents {
+			walk(pid)
+		}
+	}
+	for _, pid := range obj.Parents {
+		walk(pid)
+	}
+	return names
+}
+
+// findDefiningPropertyLocked returns the nearest ancestor copy of a property.
+// Caller must hold s.mu.
+func (s *Store) findDefiningPropertyLocked(parents []types.ObjID, name string) *Property {
+	visited := make(map[types.ObjID]bool)
+	queue := append([]types.ObjID{}, parents...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		cur := s.objects[id]
+		if cur == nil || cur.Recycled {
+			continue
+		}
+		if prop := cur.Properties[name]; prop != nil {
+			return prop
+		}
+		queue = append(queue, cur.Parents...)
+	}
+	return nil
+}
+
+// corifyLocked points #0.name at id, adding the property if needed.
+// Caller must hold s.mu.
+func (s *Store) corifyLocked(name string, id types.ObjID, owner types.ObjID) {
+	sysObj := s.objects[0]
+	if sysObj == nil {
+		return
+	}
+	if prop := sysObj.Properties[name]; prop != nil {
+		prop.Value = types.NewObj(id)
+		prop.Clear = false
+		return
+	}
+
+	prop := &Property{Name: name, Value: types.NewObj(id), Owner: owner, Perms: PropRead, Defined: true}
+	sysObj.Properties[name] = prop
+	pos := sysObj.PropDefsCount
+	if pos > len(sysObj.PropOrder) {
+		pos = len(sysObj.PropOrder)
+	}
+	sysObj.PropOrder = append(sysObj.PropOrder, "")
+	copy(sysObj.PropOrder[pos+1:], sysObj.PropOrder[pos:])
+	sysObj.PropOrder[pos] = name
+	sysObj.PropDefsCount++
+
+	// Descendants of #0 see the new property as an inherited clear copy.
+	queue := append([]types.ObjID{}, sysObj.Children...)
+	visited := make(map[types.ObjID]bool)
+	for len(queue) > 0 {
+		cid := queue[0]
+		queue = queue[1:]
+		if visited[cid] {
+			continue
+		}
+		visited[cid] = true
+		child := s.objects[cid]
+		if child == nil || child.Recycled {
+			continue
+		}
+		if _, exists := child.Properties[name]; !exists {
+			child.Properties[name] = &Property{Name: name, Value: prop.Value, Owner: owner, Perms: prop.Perms, Clear: true}
+		}
+		queue = append(queue, child.Children...)
+	}
+}
+
+func parsePackagePropertyPerms(s string) PropertyPerms {
+	var perms PropertyPerms
+	for _, c := range strings.ToLower(s) {
+		switch c {
+		case 'r':
+			perms |= PropRead
+		case 'w':
+			perms |= PropWrite
+		case 'c':
+			perms |= PropChown
+		}
+	}
+	return perms
+}
+
+func parsePackageVerbPerms(s string) VerbPerms {
+	var perms VerbPerms
+	for _, c := range strings.ToLower(s) {
+		switch c {
+		case 'r':
+			perms |= VerbRead
+		case 'w':
+			perms |= VerbWrite
+		case 'x':
+			perms |= VerbExecute
+		case 'd':
+			perms |= VerbDebug
+		}
+	}
+	return perms
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"barn/types"
+	"strings"
+	"testing"
+)
+
+// newPackageTestStore builds #0 (system), #1 (root with a "description" prop,
+// corified as $root), #2 (a child of #1 corified as $thing) and #3 (a child
+// of #2).
+func newPackageTestStore(t *testing.T) *Store {
+	t.Helper()
+	store := NewStore()
+
+	sys := NewObject(0, 0)
+	root := NewObject(1, 0)
+	root.Name = "root"
+	root.Properties["description"] = &Property{Name: "description", Value: types.NewStr(""), Owner: 0, Perms: PropRead, Defined: true}
+	root.PropOrder = []string{"description"}
+	root.PropDefsCount = 1
+
+	thing := NewObject(2, 0)
+	thing.Name = "generic thing"
+	thing.Parents = []types.ObjID{1}
+	thing.Properties["description"] = &Property{Name: "description", Value: types.NewStr("A thing."), Owner: 0, Perms: PropRead}
+	thing.Properties["weight"] = &Property{Name: "weight", Value: types.NewList([]types.Value{types.NewInt(1), types.NewObj(3)}), Owner: 0, Perms: PropRead | PropWrite, Defined: true}
+	thing.PropOrder = []string{"weight", "description"}
+	thing.PropDefsCount = 1
+	verb := &Verb{Name: "look l*ook", Names: []string{"look", "l*ook"}, Owner: 0, Perms: VerbRead | VerbExecute,
+		ArgSpec: VerbArgs{This: "this", Prep: "none", That: "none"}, Code: []string{`return {#3, "#3", #1};`}}
+	thing.VerbList = []*Verb{verb}
+	thing.Verbs["look"] = verb
+
+	sub := NewObject(3, 0)
+	sub.Name = "sub thing"
+	sub.Parents = []types.ObjID{2}
+	sub.Properties["weight"] = &Property{Name: "weight", Owner: 0, Perms: PropRead | PropWrite, Clear: true}
+	sub.Properties["description"] = &Property{Name: "description", Owner: 0, Perms: PropRead, Clear: true}
+	sub.PropOrder = []string{"weight", "description"}
+
+	root.Children = []types.ObjID{2}
+	thing.Children = []types.ObjID{3}
+
+	sys.Properties["root"] = &Property{Name: "root", Value: types.NewObj(1), Owner: 0, Perms: PropRead, Defined: true}
+	sys.Properties["thing"] = &Property{Name: "thing", Value: types.NewObj(2), Owner: 0, Perms: PropRead, Defined: true}
+	sys.PropOrder = []string{"root", "thing"}
+	sys.PropDefsCount = 2
+
+	for _, obj := range []*Object{sys, root, thing, sub} {
+		if err := store.Add(obj); err != nil {
+			t.Fatalf("Add(#%d): %v", obj.ID, err)
+		}
+	}
+	return store
+}
+
+func TestExportPackageSymbolicRefs(t *testing.T) {
+	store := newPackageTestStore(t)
+
+	pkg, err := store.ExportPackage([]types.ObjID{2}, true)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+	if len(pkg.Objects) != 2 {
+		t.Fatalf("exported %d objects, want 2", len(pkg.Objects))
+	}
+
+	thing := pkg.Objects[0]
+	if thing.Key != "thing" || thing.Corified != "thing" {
+		t.Errorf("thing key/corified = %q/%q, want thing/thing", thing.Key, thing.Corified)
+	}
+	if len(thing.Parents) != 1 || thing.Parents[0] != "$root" {
+		t.Errorf("thing parents = %v, want [$root]", thing.Parents)
+	}
+	if got := thing.Properties[0].Value.Items[1].Ref; got != "@obj3" {
+		t.Errorf("weight[2] ref = %q, want @obj3", got)
+	}
+	if len(thing.Inherited) != 1 || thing.Inherited[0].Name != "description" {
+		t.Errorf("inherited = %+v, want description override", thing.Inherited)
+	}
+
+	sub := pkg.Objects[1]
+	if len(sub.Parents) != 1 || sub.Parents[0] != "@thing" {
+		t.Errorf("sub parents = %v, want [@thing]", sub.Parents)
+	}
+}
+
+func TestPackageRoundTripIntoOtherStore(t *testing.T) {
+	source := newPackageTestStore(t)
+	pkg, err := source.ExportPackage([]types.ObjID{2}, true)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+
+	for _, format := range []string{"yaml", "json"} {
+		data, err := pkg.Marshal(format)
+		if err != nil {
+			t.Fatalf("Marshal(%s): %v", format, err)
+		}
+		parsed, err := ParsePackage(data)
+		if err != nil {
+			t.Fatalf("ParsePackage(%s): %v", format, err)
+		}
+
+		// Target: same #0/#1 layout but with a gap so numbers shift.
+		target := newPackageTestStore(t)
+		sys := target.Get(0)
+		delete(sys.Properties, "thing")
+		sys.PropOrder = []string{"root"}
+		sys.PropDefsCount = 1
+
+		result, err := target.ImportPackage(parsed, ImportOptions{Owner: 0})
+		if err != nil {
+			t.Fatalf("ImportPackage(%s): %v (conflicts %v)", format, err, result.Conflicts)
+		}
+		newThing, newSub := result.Objects["thing"], result.Objects["obj3"]
+		if newThing != 4 || newSub != 5 {
+			t.Fatalf("new ids = %d, %d, want 4, 5", newThing, newSub)
+		}
+
+		thing := target.Get(newThing)
+		weight := thing.Properties["weight"].Value.(types.ListValue)
+		if ref := weight.Get(2).(types.ObjValue).ID(); ref != newSub {
+			t.Errorf("%s: weight[2] = #%d, want #%d", format, ref, newSub)
+		}
+		if desc := thing.Properties["description"]; desc.Clear || desc.Value.(types.StrValue).Value() != "A thing." {
+			t.Errorf("%s: description override lost: %+v", format, desc)
+		}
+		if code := thing.VerbList[0].Code[0]; code != `return {#5, "#3", #1};` {
+			t.Errorf("%s: verb code = %q", format, code)
+		}
+		if sub := target.Get(newSub); len(sub.Parents) != 1 || sub.Parents[0] != newThing {
+			t.Errorf("%s: sub parents = %v", format, sub.Parents)
+		}
+		if prop := target.Get(0).Properties["thing"]; prop == nil || !prop.Value.Equal(types.NewObj(newThing)) {
+			t.Errorf("%s: $thing not corified: %+v", format, prop)
+		}
+		if _, _, err := target.FindVerb(newSub, "look"); err != nil {
+			t.Errorf("%s: inherited verb not found: %v", format, err)
+		}
+	}
+}
+
+func TestImportPackageLocationCreatedLater(t *testing.T) {
+	store := newPackageTestStore(t)
+	pkg, err := store.ExportPackage([]types.ObjID{2}, true)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+	// @thing is created before @obj3, its child, but sits inside it
+	for i := range pkg.Objects {
+		if pkg.Objects[i].Key == "thing" {
+			pkg.Objects[i].Location = "@obj3"
+		}
+	}
+	pkg.Objects[0].Corified = ""
+
+	result, err := store.ImportPackage(pkg, ImportOptions{Owner: 0})
+	if err != nil {
+		t.Fatalf("ImportPackage: %v (conflicts %v)", err, result.Conflicts)
+	}
+	thing, sub := store.Get(result.Objects["thing"]), store.Get(result.Objects["obj3"])
+	if thing.Location != sub.ID || len(sub.Contents) != 1 || sub.Contents[0] != thing.ID {
+		t.Errorf("thing location = #%d, sub contents = %v; want thing inside #%d", thing.Location, sub.Contents, sub.ID)
+	}
+}
+
+func TestImportPackageConflicts(t *testing.T) {
+	store := newPackageTestStore(t)
+	pkg, err := store.ExportPackage([]types.ObjID{2}, false)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+	pkg.Objects[0].Properties = append(pkg.Objects[0].Properties, PackageProperty{Name: "description", Owner: "#0", Perms: "r"})
+	pkg.Objects[0].Parents = append(pkg.Objects[0].Parents, "$missing")
+
+	before := store.NextID()
+	result, err := store.ImportPackage(pkg, ImportOptions{Owner: 0})
+	if err == nil {
+		t.Fatal("expected conflicts, got none")
+	}
+	joined := strings.Join(result.Conflicts, "\n")
+	for _, want := range []string{"$missing", `"description"`, "$thing already refers"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("conflicts missing %q:\n%s", want, joined)
+		}
+	}
+	if store.NextID() != before {
+		t.Errorf("conflicting import created objects")
+	}
+}
+
+func TestImportPackageLiteralOwnerIsForeign(t *testing.T) {
+	source := newPackageTestStore(t)
+	pkg, err := source.ExportPackage([]types.ObjID{3}, false)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+	po := &pkg.Objects[0]
+	po.Owner = "#4"
+	po.Properties = append(po.Properties, PackageProperty{Name: "secret", Owner: "#4", Perms: "r"})
+	po.Verbs = append(po.Verbs, PackageVerb{Names: "run", Owner: "#4", Perms: "rx", This: "this", Prep: "none", That: "none"})
+
+	// In the target, #4 is a wizard that has nothing to do with the package
+	target := newPackageTestStore(t)
+	wizard := NewObject(4, 4)
+	wizard.Flags = FlagWizard | FlagUser
+	if err := target.Add(wizard); err != nil {
+		t.Fatalf("Add(#4): %v", err)
+	}
+
+	result, err := target.ImportPackage(pkg, ImportOptions{Owner: 1})
+	if err != nil {
+		t.Fatalf("ImportPackage: %v (conflicts %v)", err, result.Conflicts)
+	}
+	obj := target.Get(result.Objects["obj3"])
+	if obj.Owner != 1 {
+		t.Errorf("object owner = #%d, want #1", obj.Owner)
+	}
+	if owner := obj.Properties["secret"].Owner; owner != 1 {
+		t.Errorf("property owner = #%d, want #1", owner)
+	}
+	if owner := obj.Verbs["run"].Owner; owner != 1 {
+		t.Errorf("verb owner = #%d, want #1", owner)
+	}
+}
+
+func TestImportPackageLiteralRefsConflict(t *testing.T) {
+	store := newPackageTestStore(t)
+	pkg, err := store.ExportPackage([]types.ObjID{2}, false)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+	po := &pkg.Objects[0]
+	po.Corified = ""
+	po.Parents = []string{"#1"}
+	po.Location = "#3"
+	po.Properties[0].Value = &PackageValue{Type: "obj", Ref: "#57"}
+	po.Inherited = append(po.Inherited, PackageProperty{Name: "description", Owner: "#0", Perms: "r",
+		Value: &PackageValue{Type: "waif", Ref: "#2", Owner: "#0"}})
+
+	before := store.NextID()
+	result, err := store.ImportPackage(pkg, ImportOptions{Owner: 0})
+	if err == nil {
+		t.Fatal("expected conflicts, got none")
+	}
+	joined := strings.Join(result.Conflicts, "\n")
+	for _, want := range []string{"parent #1", "location #3", "weight: #57", "description: #2"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("conflicts missing %q:\n%s", want, joined)
+		}
+	}
+	if store.NextID() != before {
+		t.Errorf("conflicting import created objects")
+	}
+
+	// #0 and #-1 mean the same everywhere
+	po.Parents = []string{"$root"}
+	po.Location = "#-1"
+	po.Properties[0].Value = &PackageValue{Type: "obj", Ref: "#0"}
+	po.Inherited = po.Inherited[:len(po.Inherited)-1]
+	if result, err := store.ImportPackage(pkg, ImportOptions{Owner: 0}); err != nil {
+		t.Errorf("ImportPackage: %v (conflicts %v)", err, result.Conflicts)
+	}
+}
+
+func TestImportPackageDryRunLeavesStoreClean(t *testing.T) {
+	store := newPackageTestStore(t)
+	pkg, err := store.ExportPackage([]types.ObjID{3}, false)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+	store.TakeDirty()
+
+	if result, err := store.ImportPackage(pkg, ImportOptions{Owner: 0, DryRun: true}); err != nil {
+		t.Fatalf("ImportPackage: %v (conflicts %v)", err, result.Conflicts)
+	}
+	if ids, all := store.TakeDirty(); all || len(ids) != 0 {
+		t.Errorf("dry run left dirty objects %v (all %v)", ids, all)
+	}
+
+	pkg.Objects[0].Parents = []string{"$missing"}
+	if _, err := store.ImportPackage(pkg, ImportOptions{Owner: 0}); err == nil {
+		t.Fatal("expected conflicts, got none")
+	}
+	if ids, all := store.TakeDirty(); all || len(ids) != 0 {
+		t.Errorf("rejected import left dirty objects %v (all %v)", ids, all)
+	}
+}
+
+func TestImportPackageDryRunKeepsByteTotals(t *testing.T) {
+	store := newPackageTestStore(t)
+	pkg, err := store.ExportPackage([]types.ObjID{3}, false)
+	if err != nil {
+		t.Fatalf("ExportPackage: %v", err)
+	}
+	before := store.OwnerBytes(0)
+
+	if result, err := store.ImportPackage(pkg, ImportOptions{Owner: 0, DryRun: true}); err != nil {
+		t.Fatalf("ImportPackage: %v (conflicts %v)", err, result.Conflicts)
+	}
+	if store.bytes.objects == nil {
+		t.Error("dry run dropped the byte totals")
+	}
+
+	if result, err := store.ImportPackage(pkg, ImportOptions{Owner: 0}); err != nil {
+		t.Fatalf("ImportPackage: %v (conflicts %v)", err, result.Conflicts)
+	}
+	if after := store.OwnerBytes(0); after <= before {
+		t.Errorf("OwnerBytes(#0) = %d after import, want more than %d", after, before)
+	}
+}
@@ -22,6 +22,9 @@ type Database struct {
 	// savedWaifs tracks WAIFs during loading for reference resolution.
 	// Index corresponds to the WAIF save index in the database file.
 	savedWaifs []waifLoadData
+
+	// Waifs lists every WAIF defined in the file, for registration with the Store.
+	Waifs []types.WaifValue
 }
 
 // waifLoadData holds a WAIF and its raw indexed properties during loading.
@@ -45,6 +48,9 @@ func (db *Database) NewStoreFromDatabase() *Store {
 			store.maxObjID = id
 		}
 	}
+	for i := range db.Waifs {
+		store.RegisterWaif(db.Waifs[i].Class(), &db.Waifs[i])
+	}
 	return store
 }
 
@@ -852,6 +858,21 @@ func (db *Database) readObjectV4(r *bufio.Reader) (*Object, error) {
 
 // readObject reads a single object
 func (db *Database) readObject(r *bufio.Reader) (*Object, error) {
+	obj, err := db.readObjectHeader(r)
+	if err != nil || obj == nil {
+		return obj, err
+	}
+	if err := db.readPropertyValues(r, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// readObjectHeader reads an object up to (not including) its property values.
+// PropOrder is filled with the local propdef names followed by
+// "_inherited_N" placeholders for the inherited slots, one per stored value.
+// Returns nil for a recycled slot.
+func (db *Database) readObjectHeader(r *bufio.Reader) (*Object, error) {
 	// Read object ID line: "#123" or "#123 recycled"
 	line, err := r.ReadString('\n')
 	if err != nil {
@@ -1047,25 +1068,28 @@ func (db *Database) readObject(r *bufio.Reader) (*Object, error) {
 	// Store PropDefsCount for later name resolution
 	obj.PropDefsCount = propDefCount
 	obj.PropOrder = make([]string, totalPropCount)
-
-	// Read property values
 	for i := 0; i < totalPropCount; i++ {
-		var propName string
 		if i < propDefCount {
-			propName = propDefs[i]
+			obj.PropOrder[i] = propDefs[i]
 		} else {
 			// Inherited property - name will be resolved later
-			propName = fmt.Sprintf("_inherited_%d", i)
+			obj.PropOrder[i] = fmt.Sprintf("_inherited_%d", i)
 		}
+	}
 
-		obj.PropOrder[i] = propName // Track order for resolution
+	return obj, nil
+}
 
+// readPropertyValues reads one value/owner/perms triple per PropOrder entry
+func (db *Database) readPropertyValues(r *bufio.Reader, obj *Object) error {
+	var err error
+	for i, propName := range obj.PropOrder {
 		prop := &Property{Name: propName}
 
 		// Value
 		prop.Value, err = db.readValue(r)
 		if err != nil {
-			return nil, fmt.Errorf("prop %d (%s) value: %w", i, propName, err)
+			return fmt.Errorf("prop %d (%s) value: %w", i, propName, err)
 		}
 
 		// If value is nil, this is a CLEAR property (type code 5)
@@ -1077,20 +1101,20 @@ func (db *Database) readObject(r *bufio.Reader) (*Object, error) {
 		// Owner
 		prop.Owner, err = readObjID(r)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// Perms
 		perms, err := readInt(r)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		prop.Perms = PropertyPerms(perms)
 
 		obj.Properties[propName] = prop
 	}
 
-	return obj, nil
+	return nil
 }
 
 // readAnonymousObjects reads anonymous objects section (v17)
@@ -1609,6 +1633,20 @@ func (db *Database) resolvePropertyNames() {
 		// Build the full list of property names by walking up the parent chain
 		allNames := db.collectPropertyNamesRaw(obj)
 
+		// Lazily loaded objects have no Property entries yet; only their
+		// order is resolved, and values are read under these names later
+		if obj.lazy != nil {
+			names := make([]string, len(obj.PropOrder))
+			for i, oldName := range obj.PropOrder {
+				names[i] = oldName
+				if i < len(allNames) {
+					names[i] = allNames[i]
+				}
+			}
+			resolvedByID[id] = resolvedProps{properties: obj.Properties, propOrder: names}
+			continue
+		}
+
 		// Now rename _inherited_N properties to their actual names
 		newProperties := make(map[string]*Property)
 		newPropOrder := make([]string, 0, len(obj.PropOrder))
@@ -1699,6 +1737,7 @@ func (db *Database) collectPropertyNames(obj *Object) []string {
 // Must be called after resolvePropertyNames so that PropOrder is final.
 func (db *Database) resolveWaifProperties() {
 	for _, wd := range db.savedWaifs {
+		db.Waifs = append(db.Waifs, wd.waif)
 		classObj := db.Objects[wd.waif.Class()]
 		if classObj == nil {
 			continue
@@ -375,3 +375,19 @@ func TestRoundTripPreservesInheritedOverrideProperty(t *testing.T) {
 			beforeProp.Value, afterProp.Value)
 	}
 }
+
+func TestWriteRefusesLambdaProperty(t *testing.T) {
+	store := NewStore()
+	obj := NewObject(0, 0)
+	fn := types.NewLambda(nil, nil, "{} => 0")
+	obj.Properties["f"] = &Property{Name: "f", Value: types.NewList([]types.Value{fn}), Defined: true}
+	obj.PropOrder = []string{"f"}
+	obj.PropDefsCount = 1
+	store.Add(obj)
+
+	var out strings.Builder
+	err := NewWriter(&out, store).WriteDatabase()
+	if err == nil || !strings.Contains(err.Error(), `"f" holds a lambda`) {
+		t.Fatalf("WriteDatabase = %v, want an error naming property f", err)
+	}
+}
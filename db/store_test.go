@@ -2,6 +2,8 @@ package db
 
 import (
 	"barn/types"
+	"fmt"
+	"sort"
 	"testing"
 )
 
@@ -212,3 +214,91 @@ func TestPropertyPermsString(t *testing.T) {
 		}
 	}
 }
+
+func TestOwnerBytesTracksChanges(t *testing.T) {
+	store := NewStore()
+	player := NewObject(1, 1)
+	store.Add(player)
+	thing := NewObject(2, 1)
+	store.Add(thing)
+
+	// measured reports what measuring every object afresh gives
+	measured := func(owner types.ObjID) int64 {
+		var total int64
+		for _, obj := range store.All() {
+			if obj.Owner == owner {
+				total += int64(ObjectBytes(obj))
+			}
+		}
+		return total
+	}
+	check := func(what string) {
+		t.Helper()
+		if got, want := store.OwnerBytes(1), measured(1); got != want {
+			t.Errorf("OwnerBytes(#1) after %s = %d, want %d", what, got, want)
+		}
+	}
+	check("adding objects")
+
+	prop := &Property{Name: "description", Value: types.NewStr("a thing"), Owner: 1, Defined: true}
+	thing.Properties[prop.Name] = prop
+	store.PropertyWritten(thing, prop, nil)
+	check("adding a property")
+
+	old := prop.Value
+	prop.Value = types.NewList([]types.Value{types.NewStr("a much longer description"), types.NewInt(3)})
+	store.PropertyWritten(thing, prop, old)
+	check("writing a property")
+
+	other := NewObject(3, 3)
+	store.Add(other)
+	thing.Owner = 3
+	store.ObjectChanged(thing)
+	check("changing an owner")
+	if got, want := store.OwnerBytes(3), measured(3); got != want {
+		t.Errorf("OwnerBytes(#3) = %d, want %d", got, want)
+	}
+
+	store.Recycle(3)
+	if got := store.OwnerBytes(3); got != int64(ObjectBytes(thing)) {
+		t.Errorf("OwnerBytes(#3) after recycling it = %d, want only #2's %d", got, ObjectBytes(thing))
+	}
+}
+
+func TestWaifWriteMarksHolders(t *testing.T) {
+	store := NewStore()
+	waif := types.NewWaif(1, 1)
+	inner := types.NewWaif(1, 1)
+	holder := NewObject(1, 1)
+	holder.Properties["items"] = &Property{Name: "items", Value: types.NewList([]types.Value{waif}), Owner: 1, Defined: true}
+	store.Add(holder)
+	store.Add(NewObject(2, 1))
+	later := NewObject(3, 1)
+	store.Add(later)
+	store.TakeDirty()
+
+	dirty := func(what string, want ...types.ObjID) {
+		t.Helper()
+		ids, all := store.TakeDirty()
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		if all || fmt.Sprint(ids) != fmt.Sprint(want) {
+			t.Errorf("dirty after %s = %v (all %v), want %v", what, ids, all, want)
+		}
+	}
+
+	store.WaifPropertyWritten(waif.SetProperty("inner", inner), inner)
+	dirty("writing a held waif", 1)
+
+	store.WaifPropertyWritten(inner.SetProperty("x", types.NewInt(1)), types.NewInt(1))
+	dirty("writing a waif inside a held waif", 1)
+
+	prop := &Property{Name: "slot", Value: types.NewMap([][2]types.Value{{types.NewStr("w"), inner}}), Owner: 1, Defined: true}
+	later.Properties[prop.Name] = prop
+	store.PropertyWritten(later, prop, nil)
+	store.TakeDirty()
+	store.WaifPropertyWritten(inner.SetProperty("x", types.NewInt(2)), types.NewInt(2))
+	dirty("storing the waif in another object", 1, 3)
+
+	store.WaifPropertyWritten(types.NewWaif(1, 1), types.NewInt(0))
+	dirty("writing an unheld waif")
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"barn/types"
+	"testing"
+)
+
+func TestFindVerbCachesAndInvalidates(t *testing.T) {
+	store := newKVTestStore(t)
+
+	if _, defObj, err := store.FindVerb(3, "look"); err != nil || defObj != 1 {
+		t.Fatalf("FindVerb(#3, look) = %d, %v", defObj, err)
+	}
+	if _, _, err := store.FindVerb(3, "look"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.FindVerb(3, "missing"); err == nil {
+		t.Fatal("FindVerb(#3, missing) succeeded")
+	}
+	if _, _, err := store.FindVerb(3, "missing"); err == nil {
+		t.Fatal("FindVerb(#3, missing) succeeded from the cache")
+	}
+	stats := store.VerbCacheStats()
+	if stats.Hits != 1 || stats.NegativeHits != 1 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("stats = %+v, want 1 hit, 1 negative hit, 2 misses, 2 entries", stats)
+	}
+
+	// A verb added to the child must shadow the cached inherited one
+	child := store.Get(3)
+	verb := &Verb{Name: "look", Names: []string{"look"}, Owner: 2, Perms: VerbRead | VerbExecute}
+	child.VerbList = append(child.VerbList, verb)
+	child.Verbs["look"] = verb
+	store.InvalidateVerbCache()
+
+	got, defObj, err := store.FindVerb(3, "look")
+	if err != nil || got != verb || defObj != 3 {
+		t.Errorf("after add, FindVerb(#3, look) = %p, %d, %v; want %p on #3", got, defObj, err, verb)
+	}
+	if stats := store.VerbCacheStats(); stats.Generation != 1 || stats.Entries != 1 {
+		t.Errorf("after invalidate stats = %+v, want generation 1 and 1 entry", stats)
+	}
+}
+
+func TestFindVerbMatchesAliasesInTableOrder(t *testing.T) {
+	store := NewStore()
+	obj := NewObject(1, 1)
+	first := &Verb{Name: "g*et take", Names: []string{"g*et", "take"}}
+	second := &Verb{Name: "get grab", Names: []string{"get", "grab"}}
+	obj.VerbList = []*Verb{first, second}
+	obj.Verbs["g*et"] = first
+	obj.Verbs["get"] = second
+	if err := store.Add(obj); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first matching verb in table order is used, even over a later
+	// verb whose primary name is exactly the one looked up
+	for _, name := range []string{"get", "ge"} {
+		for i := 0; i < 20; i++ {
+			store.InvalidateVerbCache()
+			if verb, _, _ := store.FindVerb(1, name); verb != first {
+				t.Fatalf("FindVerb(%s) = %v, want the first verb", name, verb)
+			}
+		}
+	}
+	if verb, _, _ := store.FindVerb(1, "grab"); verb != second {
+		t.Errorf("FindVerb(grab) = %v, want the second verb", verb)
+	}
+	entries := store.VerbCacheStats().Entries
+	if _, _, err := store.FindVerb(types.ObjID(7), "get"); err == nil {
+		t.Error("FindVerb on a missing object succeeded")
+	}
+	if store.VerbCacheStats().Entries != entries {
+		t.Error("lookup from a missing object was cached")
+	}
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"barn/parser"
+	"barn/types"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -25,3 +27,45 @@ func CompileVerb(code []string) (*VerbProgram, []string) {
 
 	return &VerbProgram{Statements: statements}, nil
 }
+
+// RewriteObjectLiterals replaces #N object literals in verb source according to mapping.
+// Literals inside strings and comments are left alone because the lexer skips them.
+// Returns the rewritten lines and whether anything changed.
+func RewriteObjectLiterals(code []string, mapping map[types.ObjID]types.ObjID) ([]string, bool) {
+	if len(code) == 0 || len(mapping) == 0 {
+		return code, false
+	}
+
+	source := strings.Join(code, "\n")
+	lexer := parser.NewLexer(source)
+
+	var out strings.Builder
+	last := 0
+	changed := false
+	for {
+		tok := lexer.NextToken()
+		if tok.Type == parser.TOKEN_EOF {
+			break
+		}
+		if tok.Type != parser.TOKEN_OBJECT {
+			continue
+		}
+		id, err := strconv.ParseInt(tok.Value[1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		newID, ok := mapping[types.ObjID(id)]
+		if !ok || newID == types.ObjID(id) {
+			continue
+		}
+		out.WriteString(source[last:tok.Position.Offset])
+		out.WriteString(fmt.Sprintf("#%d", newID))
+		last = tok.Position.Offset + len(tok.Value)
+		changed = true
+	}
+	if !changed {
+		return code, false
+	}
+	out.WriteString(source[last:])
+	return strings.Split(out.String(), "\n"), true
+}
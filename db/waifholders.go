@@ -0,0 +1,134 @@
+package db
+
+import (
+	"barn/types"
+	"sync"
+)
+
+// ============================================================================
+// WAIF HOLDERS
+// ============================================================================
+//
+// Every copy of a waif shares its properties, so writing one changes each
+// object whose properties hold the waif, directly or inside a list, map or
+// other waif. Once a waif property is first written, the store keeps an
+// index from each waif to the objects holding it, updated as property
+// values are written, and the write marks only those objects dirty. An
+// object is not dropped when it stops holding a waif; that only costs a
+// needless save. Bulk changes drop the index to be built afresh.
+
+// waifHolders maps waif identities to the objects holding them
+type waifHolders struct {
+	mu      sync.Mutex
+	holders map[uintptr]map[types.ObjID]struct{} // nil until first needed
+}
+
+// WaifPropertyWritten records that a property of waif was set to value
+func (s *Store) WaifPropertyWritten(waif types.WaifValue, value types.Value) {
+	if s == nil {
+		return
+	}
+	h := &s.waifs
+	h.mu.Lock()
+	built := h.holders != nil
+	h.mu.Unlock()
+	if !built {
+		s.indexWaifHolders()
+	}
+
+	h.mu.Lock()
+	ids := make([]types.ObjID, 0, len(h.holders[waif.Identity()]))
+	for id := range h.holders[waif.Identity()] {
+		ids = append(ids, id)
+	}
+	// The holders of waif now hold any waif in value too
+	for _, id := range ids {
+		h.indexLocked(id, value)
+	}
+	h.mu.Unlock()
+	s.MarkDirty(ids...)
+}
+
+// indexWaifHolders builds the index from every object's properties
+func (s *Store) indexWaifHolders() {
+	// Lock the store first, as Add does
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := &s.waifs
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holders != nil {
+		return
+	}
+	h.holders = make(map[uintptr]map[types.ObjID]struct{})
+	for _, obj := range s.objects {
+		if !obj.Recycled {
+			s.materialize(obj)
+			h.objectLocked(obj)
+		}
+	}
+}
+
+// propertyWritten indexes the waifs in a property value of obj
+func (h *waifHolders) propertyWritten(obj *Object, v types.Value) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holders != nil {
+		h.indexLocked(obj.ID, v)
+	}
+}
+
+// changed indexes the waifs in all of obj's properties; Add calls it with
+// s.mu held
+func (h *waifHolders) changed(obj *Object) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holders != nil {
+		h.objectLocked(obj)
+	}
+}
+
+// reset drops the index, to be built again when next needed
+func (h *waifHolders) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.holders = nil
+}
+
+// objectLocked indexes the waifs in obj's properties
+func (h *waifHolders) objectLocked(obj *Object) {
+	for _, prop := range obj.Properties {
+		if prop.Value != nil {
+			h.indexLocked(obj.ID, prop.Value)
+		}
+	}
+}
+
+// indexLocked records id as holding every waif in v
+func (h *waifHolders) indexLocked(id types.ObjID, v types.Value) {
+	switch val := v.(type) {
+	case types.ListValue:
+		for _, elem := range val.Elements() {
+			h.indexLocked(id, elem)
+		}
+	case types.MapValue:
+		for _, pair := range val.Pairs() {
+			h.indexLocked(id, pair[0])
+			h.indexLocked(id, pair[1])
+		}
+	case types.WaifValue:
+		key := val.Identity()
+		if _, ok := h.holders[key][id]; ok {
+			// Indexed already, with the waifs it holds
+			return
+		}
+		if h.holders[key] == nil {
+			h.holders[key] = make(map[types.ObjID]struct{})
+		}
+		h.holders[key][id] = struct{}{}
+		for _, name := range val.PropertyNames() {
+			prop, _ := val.GetProperty(name)
+			h.indexLocked(id, prop)
+		}
+	}
+}
@@ -166,6 +166,11 @@ func (w *Writer) writeValue(v types.Value) error {
 		}
 		return w.writeWaif(val)
 
+	case types.LambdaValue:
+		// Lambdas hold compiled code and cannot be saved; one left in a
+		// suspended task's variables is restored as 0
+		return w.writeInt(TypeNone)
+
 	default:
 		// Unknown type - try to handle as None
 		return w.writeInt(TypeNone)
@@ -344,6 +344,11 @@ func (w *Writer) writeProperty(prop *Property) error {
 			return err
 		}
 	} else {
+		// The VM refuses to store lambdas in properties; never save one
+		// as something it is not
+		if types.ContainsLambda(prop.Value) {
+			return fmt.Errorf("property %q holds a lambda, which cannot be saved", prop.Name)
+		}
 		if err := w.writeValue(prop.Value); err != nil {
 			return err
 		}
@@ -391,25 +396,29 @@ func (w *Writer) writeVerbPrograms() error {
 
 	// Write each verb program
 	for _, v := range verbs {
-		// Verb location: #objnum:verbindex
-		if err := w.writeString(fmt.Sprintf("#%d:%d", v.objID, v.verbIdx)); err != nil {
+		if err := w.writeVerbProgram(v.objID, v.verbIdx, v.code); err != nil {
 			return err
 		}
+	}
 
-		// Code lines
-		for _, line := range v.code {
-			if err := w.writeString(line); err != nil {
-				return err
-			}
-		}
+	return nil
+}
 
-		// End marker
-		if err := w.writeString("."); err != nil {
+// writeVerbProgram writes one verb program: "#objnum:verbindex", code lines, "."
+func (w *Writer) writeVerbProgram(objID types.ObjID, verbIdx int, code []string) error {
+	if err := w.writeString(fmt.Sprintf("#%d:%d", objID, verbIdx)); err != nil {
+		return err
+	}
+
+	// Code lines
+	for _, line := range code {
+		if err := w.writeString(line); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	// End marker
+	return w.writeString(".")
 }
 
 // argspecToInt converts argument spec string to integer code
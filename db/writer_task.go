@@ -18,6 +18,20 @@ func (w *Writer) SetTaskSource(ts TaskSource) {
 	w.taskSource = ts
 }
 
+// writeTaskSections writes the queued, suspended and interrupted task sections
+func (w *Writer) writeTaskSections() error {
+	if err := w.writeQueuedTasks(); err != nil {
+		return fmt.Errorf("write queued tasks: %w", err)
+	}
+	if err := w.writeSuspendedTasks(); err != nil {
+		return fmt.Errorf("write suspended tasks: %w", err)
+	}
+	if err := w.writeInterruptedTasks(); err != nil {
+		return fmt.Errorf("write interrupted tasks: %w", err)
+	}
+	return w.Flush()
+}
+
 // writeQueuedTasks writes all queued (forked) tasks
 func (w *Writer) writeQueuedTasks() error {
 	var tasks []*task.Task
@@ -0,0 +1,537 @@
+package debug
+
+import (
+	"barn/db"
+	"barn/types"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DAPServer serves the Debug Adapter Protocol so editors can attach to the
+// debugger. Threads are paused tasks; a verb's source is named "#obj:verb"
+// (a ".moo" suffix is allowed) and served through source references.
+type DAPServer struct {
+	store *db.Store
+	exec  func(func()) // Runs a function on the scheduler goroutine
+	ln    net.Listener
+}
+
+// ListenDAP starts listening on addr. exec must run its argument on the
+// goroutine that runs MOO tasks and wait for it, so requests touching the
+// database or a paused VM never race with running tasks.
+func ListenDAP(addr string, store *db.Store, exec func(func())) (*DAPServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &DAPServer{store: store, exec: exec, ln: ln}, nil
+}
+
+// Addr returns the listening address
+func (s *DAPServer) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Serve accepts debugger clients until Close
+func (s *DAPServer) Serve() error {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting clients
+func (s *DAPServer) Close() error {
+	return s.ln.Close()
+}
+
+// dapMessage is a DAP request, response or event
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"` // Set on responses
+	Message    string          `json:"message,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Body       any             `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name            string `json:"name,omitempty"`
+	Path            string `json:"path,omitempty"`
+	SourceReference int    `json:"sourceReference,omitempty"`
+}
+
+// verbRef names a verb by its definer
+type verbRef struct {
+	obj  types.ObjID
+	verb string
+}
+
+func (v verbRef) String() string {
+	return fmt.Sprintf("#%d:%s", v.obj, v.verb)
+}
+
+// frameRef is a frame handed to the client by stackTrace
+type frameRef struct {
+	taskID int64
+	index  int
+}
+
+// dapConn is one attached client
+type dapConn struct {
+	srv *DAPServer
+	rw  net.Conn
+
+	writeMu sync.Mutex
+	seq     int
+
+	mu          sync.Mutex
+	frames      []frameRef         // frameId-1 -> frame, until the next resume
+	sources     []verbRef          // sourceReference-1 -> verb
+	sourceIDs   map[verbRef]int    // verb -> sourceReference
+	breakpoints map[string][]int64 // source name -> breakpoints set for it
+}
+
+func (s *DAPServer) serveConn(rw net.Conn) {
+	c := &dapConn{
+		srv:         s,
+		rw:          rw,
+		sourceIDs:   make(map[verbRef]int),
+		breakpoints: make(map[string][]int64),
+	}
+	// Notify asynchronously: listeners run on the scheduler goroutine
+	stop := Listen(func(s *Session) { go c.stopped(s) })
+	defer func() {
+		stop()
+		c.detach()
+		rw.Close()
+	}()
+
+	r := bufio.NewReader(rw)
+	for {
+		msg, err := readDAPMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("DAP %s: %v", rw.RemoteAddr(), err)
+			}
+			return
+		}
+		if msg.Type != "request" {
+			continue
+		}
+		if !c.handle(msg) {
+			return
+		}
+	}
+}
+
+// readDAPMessage reads one Content-Length framed message
+func readDAPMessage(r *bufio.Reader) (*dapMessage, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bad Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var msg dapMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (c *dapConn) send(msg dapMessage) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.seq++
+	msg.Seq = c.seq
+	body, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("DAP: encoding %s: %v", msg.Type, err)
+		return
+	}
+	fmt.Fprintf(c.rw, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (c *dapConn) respond(req *dapMessage, body any) {
+	success := true
+	c.send(dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Body: body})
+}
+
+func (c *dapConn) fail(req *dapMessage, format string, args ...any) {
+	success := false
+	c.send(dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *dapConn) event(name string, body any) {
+	c.send(dapMessage{Type: "event", Event: name, Body: body})
+}
+
+// stopped tells the client a task paused
+func (c *dapConn) stopped(s *Session) {
+	body := map[string]any{
+		"reason":            s.Reason,
+		"threadId":          s.TaskID,
+		"allThreadsStopped": false,
+	}
+	if s.Breakpoint != 0 {
+		body["hitBreakpointIds"] = []int64{s.Breakpoint}
+	}
+	c.event("stopped", body)
+}
+
+// detach removes the client's breakpoints and lets paused tasks run on
+func (c *dapConn) detach() {
+	c.mu.Lock()
+	for _, ids := range c.breakpoints {
+		for _, id := range ids {
+			ClearBreakpoint(id)
+		}
+	}
+	c.breakpoints = nil
+	c.mu.Unlock()
+	for _, s := range Sessions() {
+		Continue(s.TaskID, StepNone)
+	}
+}
+
+// handle answers one request; returns false when the client disconnects
+func (c *dapConn) handle(req *dapMessage) bool {
+	switch req.Command {
+	case "initialize":
+		c.respond(req, map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		})
+		c.event("initialized", nil)
+	case "attach", "launch":
+		c.respond(req, nil)
+	case "configurationDone":
+		c.respond(req, nil)
+		for _, s := range Sessions() {
+			c.stopped(s)
+		}
+	case "setBreakpoints":
+		c.setBreakpoints(req)
+	case "threads":
+		c.threads(req)
+	case "stackTrace":
+		c.stackTrace(req)
+	case "scopes":
+		c.scopes(req)
+	case "variables":
+		c.variables(req)
+	case "source":
+		c.source(req)
+	case "evaluate":
+		c.evaluate(req)
+	case "continue", "next", "stepIn", "stepOut":
+		c.resume(req)
+	case "disconnect":
+		c.respond(req, nil)
+		return false
+	default:
+		c.fail(req, "%s is not supported", req.Command)
+	}
+	return true
+}
+
+// parseSource finds the verb a DAP source names
+func parseSource(src dapSource) (verbRef, bool) {
+	name := src.Name
+	if src.Path != "" {
+		name = path.Base(src.Path)
+	}
+	name = strings.TrimSuffix(name, ".moo")
+	obj, verb, ok := strings.Cut(strings.TrimPrefix(name, "#"), ":")
+	if !ok || verb == "" {
+		return verbRef{}, false
+	}
+	n, err := strconv.ParseInt(obj, 10, 64)
+	if err != nil {
+		return verbRef{}, false
+	}
+	return verbRef{obj: types.ObjID(n), verb: verb}, true
+}
+
+func (c *dapConn) setBreakpoints(req *dapMessage) {
+	var args struct {
+		Source      dapSource `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	ref, ok := parseSource(args.Source)
+	if !ok {
+		c.fail(req, "source %q does not name a verb as #obj:verb", args.Source.Name+args.Source.Path)
+		return
+	}
+
+	// Each request replaces the breakpoints previously set for the source
+	key := ref.String()
+	c.mu.Lock()
+	old := c.breakpoints[key]
+	delete(c.breakpoints, key)
+	c.mu.Unlock()
+	for _, id := range old {
+		ClearBreakpoint(id)
+	}
+
+	var ids []int64
+	result := make([]map[string]any, 0, len(args.Breakpoints))
+	for _, want := range args.Breakpoints {
+		var bp Breakpoint
+		var errCode types.ErrorCode
+		c.srv.exec(func() { bp, errCode = SetBreakpoint(c.srv.store, ref.obj, ref.verb, want.Line) })
+		if errCode != types.E_NONE {
+			result = append(result, map[string]any{"verified": false, "line": want.Line, "message": errCode.String()})
+			continue
+		}
+		ids = append(ids, bp.ID)
+		result = append(result, map[string]any{"id": bp.ID, "verified": true, "line": bp.Line})
+	}
+	c.mu.Lock()
+	c.breakpoints[key] = ids
+	c.mu.Unlock()
+	c.respond(req, map[string]any{"breakpoints": result})
+}
+
+func (c *dapConn) threads(req *dapMessage) {
+	threads := []map[string]any{}
+	c.srv.exec(func() {
+		for _, s := range Sessions() {
+			name := fmt.Sprintf("task %d", s.TaskID)
+			if frames := s.Target.Frames(); len(frames) > 0 {
+				name += " " + frameName(frames[len(frames)-1])
+			}
+			threads = append(threads, map[string]any{"id": s.TaskID, "name": name})
+		}
+	})
+	c.respond(req, map[string]any{"threads": threads})
+}
+
+// frameName names a frame for display; eval() and eval-command code
+// has no verb
+func frameName(f Frame) string {
+	if f.Eval || f.Verb == "" {
+		return "(eval)"
+	}
+	return verbRef{obj: f.VerbLoc, verb: f.Verb}.String()
+}
+
+// sourceFor returns the DAP source for a verb, assigning a reference
+func (c *dapConn) sourceFor(ref verbRef) dapSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.sourceIDs[ref]
+	if !ok {
+		c.sources = append(c.sources, ref)
+		id = len(c.sources)
+		c.sourceIDs[ref] = id
+	}
+	return dapSource{Name: ref.String(), SourceReference: id}
+}
+
+func (c *dapConn) stackTrace(req *dapMessage) {
+	var args struct {
+		ThreadID int64 `json:"threadId"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	s := Lookup(args.ThreadID)
+	if s == nil {
+		c.fail(req, "task %d is not paused", args.ThreadID)
+		return
+	}
+	var frames []Frame
+	c.srv.exec(func() { frames = s.Target.Frames() })
+
+	result := make([]map[string]any, 0, len(frames))
+	for i, f := range frames {
+		c.mu.Lock()
+		c.frames = append(c.frames, frameRef{taskID: s.TaskID, index: i})
+		id := len(c.frames)
+		c.mu.Unlock()
+		frame := map[string]any{"id": id, "name": frameName(f), "line": f.Line, "column": 1}
+		if !f.Eval && f.Verb != "" {
+			frame["source"] = c.sourceFor(verbRef{obj: f.VerbLoc, verb: f.Verb})
+		}
+		result = append(result, frame)
+	}
+	c.respond(req, map[string]any{"stackFrames": result, "totalFrames": len(result)})
+}
+
+// frame resolves a frameId from stackTrace
+func (c *dapConn) frame(id int) (*Session, int, error) {
+	c.mu.Lock()
+	if id < 1 || id > len(c.frames) {
+		c.mu.Unlock()
+		return nil, 0, fmt.Errorf("unknown frame %d", id)
+	}
+	ref := c.frames[id-1]
+	c.mu.Unlock()
+	s := Lookup(ref.taskID)
+	if s == nil {
+		return nil, 0, fmt.Errorf("task %d is not paused", ref.taskID)
+	}
+	return s, ref.index, nil
+}
+
+func (c *dapConn) scopes(req *dapMessage) {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	if _, _, err := c.frame(args.FrameID); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	// A frame's only scope shares its id
+	c.respond(req, map[string]any{"scopes": []map[string]any{
+		{"name": "Locals", "variablesReference": args.FrameID, "expensive": false},
+	}})
+}
+
+func (c *dapConn) variables(req *dapMessage) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	s, index, err := c.frame(args.VariablesReference)
+	if err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	var vars []Variable
+	c.srv.exec(func() { vars, err = s.Target.Variables(index) })
+	if err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	result := make([]map[string]any, 0, len(vars))
+	for _, v := range vars {
+		result = append(result, map[string]any{"name": v.Name, "value": v.Value.String(), "variablesReference": 0})
+	}
+	c.respond(req, map[string]any{"variables": result})
+}
+
+func (c *dapConn) source(req *dapMessage) {
+	var args struct {
+		Source          dapSource `json:"source"`
+		SourceReference int       `json:"sourceReference"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	id := args.SourceReference
+	if id == 0 {
+		id = args.Source.SourceReference
+	}
+	c.mu.Lock()
+	var ref verbRef
+	ok := id >= 1 && id <= len(c.sources)
+	if ok {
+		ref = c.sources[id-1]
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.fail(req, "unknown source %d", id)
+		return
+	}
+
+	var code []string
+	var found bool
+	c.srv.exec(func() {
+		if verb, defObj, err := c.srv.store.FindVerb(ref.obj, ref.verb); err == nil && defObj == ref.obj {
+			code, found = verb.Code, true
+		}
+	})
+	if !found {
+		c.fail(req, "%s no longer exists", ref)
+		return
+	}
+	c.respond(req, map[string]any{"content": strings.Join(code, "\n"), "mimeType": "text/x-moo"})
+}
+
+func (c *dapConn) evaluate(req *dapMessage) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	s, index, err := c.frame(args.FrameID)
+	if err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	var val types.Value
+	c.srv.exec(func() { val, err = s.Target.Evaluate(index, args.Expression) })
+	if err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	c.respond(req, map[string]any{"result": val.String(), "variablesReference": 0})
+}
+
+func (c *dapConn) resume(req *dapMessage) {
+	var args struct {
+		ThreadID int64 `json:"threadId"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	mode := map[string]StepMode{"continue": StepNone, "next": StepOver, "stepIn": StepIn, "stepOut": StepOut}[req.Command]
+
+	// Frame ids only last while the task is stopped
+	c.mu.Lock()
+	c.frames = nil
+	c.mu.Unlock()
+
+	if err := Continue(args.ThreadID, mode); err != nil {
+		c.fail(req, "%v", err)
+		return
+	}
+	if req.Command == "continue" {
+		c.respond(req, map[string]any{"allThreadsContinued": false})
+		return
+	}
+	c.respond(req, nil)
+}
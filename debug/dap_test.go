@@ -0,0 +1,210 @@
+package debug
+
+import (
+	"barn/db"
+	"barn/task"
+	"barn/types"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeTarget is a paused task with one frame
+type fakeTarget struct{}
+
+func (fakeTarget) Frames() []Frame {
+	return []Frame{{This: 1, Player: 2, Programmer: 2, Verb: "look", VerbLoc: 1, Line: 2}}
+}
+
+func (fakeTarget) Variables(frame int) ([]Variable, error) {
+	return []Variable{{Name: "x", Value: types.NewStr("hi")}}, nil
+}
+
+func (fakeTarget) Evaluate(frame int, code string) (types.Value, error) {
+	return types.NewStr(code), nil
+}
+
+type dapClient struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	seq    int
+	events []dapMessage
+}
+
+// request sends a request and returns its response, saving events seen
+// on the way
+func (c *dapClient) request(command string, args any) dapMessage {
+	c.t.Helper()
+	c.seq++
+	raw, _ := json.Marshal(args)
+	body, _ := json.Marshal(dapMessage{Seq: c.seq, Type: "request", Command: command, Arguments: raw})
+	fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq {
+			c.t.Fatalf("response to request %d, want %d", msg.RequestSeq, c.seq)
+		}
+		return msg
+	}
+}
+
+func (c *dapClient) read() dapMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, err := readDAPMessage(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return *msg
+}
+
+// body decodes a successful response's body
+func (c *dapClient) body(msg dapMessage, v any) {
+	c.t.Helper()
+	if msg.Success == nil || !*msg.Success {
+		c.t.Fatalf("%s failed: %s", msg.Command, msg.Message)
+	}
+	raw, _ := json.Marshal(msg.Body)
+	if err := json.Unmarshal(raw, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestDAPSession(t *testing.T) {
+	store := db.NewStore()
+	obj := db.NewObject(1, 2)
+	verb := &db.Verb{Name: "l*ook", Names: []string{"l*ook"}, Owner: 2, Code: []string{"x = \"hi\";", "return x;"}}
+	obj.Verbs[verb.Name] = verb
+	obj.VerbList = []*db.Verb{verb}
+	store.Add(obj)
+
+	srv, err := ListenDAP("127.0.0.1:0", store, func(fn func()) { fn() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go srv.Serve()
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &dapClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	t.Cleanup(ClearBreakpoints)
+
+	c.request("initialize", map[string]any{"adapterID": "moo"})
+	c.request("attach", nil)
+	var bps struct {
+		Breakpoints []struct {
+			ID       int64 `json:"id"`
+			Verified bool  `json:"verified"`
+		} `json:"breakpoints"`
+	}
+	c.body(c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": "/src/#1:look.moo"},
+		"breakpoints": []map[string]any{{"line": 2}, {"line": 40}},
+	}), &bps)
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[1].Verified {
+		t.Fatalf("breakpoints = %+v, want line 2 verified and line 40 rejected", bps.Breakpoints)
+	}
+	if got := Breakpoints(); len(got) != 1 || got[0].Object != 1 || got[0].Line != 2 {
+		t.Fatalf("Breakpoints() = %+v", got)
+	}
+	if reason, id := Check(99, 1, Location{Object: 1, Verb: "lo", Line: 2}); reason != ReasonBreakpoint || id != bps.Breakpoints[0].ID {
+		t.Errorf("Check through an alias = %q, %d", reason, id)
+	}
+
+	tk := task.NewTask(42, 2, 1000, 5.0)
+	tk.PauseDebug()
+	Pause(tk, fakeTarget{}, ReasonBreakpoint, bps.Breakpoints[0].ID, 1)
+	defer Forget(tk.ID)
+	c.request("configurationDone", nil)
+
+	var threads struct {
+		Threads []struct {
+			ID int64 `json:"id"`
+		} `json:"threads"`
+	}
+	c.body(c.request("threads", nil), &threads)
+	if len(threads.Threads) != 1 || threads.Threads[0].ID != 42 {
+		t.Fatalf("threads = %+v, want task 42", threads.Threads)
+	}
+	stopped := false
+	for _, ev := range c.events {
+		stopped = stopped || ev.Event == "stopped"
+	}
+	if !stopped {
+		t.Error("no stopped event for the paused task")
+	}
+
+	var trace struct {
+		StackFrames []struct {
+			ID     int       `json:"id"`
+			Name   string    `json:"name"`
+			Line   int       `json:"line"`
+			Source dapSource `json:"source"`
+		} `json:"stackFrames"`
+	}
+	c.body(c.request("stackTrace", map[string]any{"threadId": 42}), &trace)
+	if len(trace.StackFrames) != 1 || trace.StackFrames[0].Name != "#1:look" || trace.StackFrames[0].Line != 2 {
+		t.Fatalf("stackTrace = %+v", trace.StackFrames)
+	}
+	frameID := trace.StackFrames[0].ID
+
+	var source struct {
+		Content string `json:"content"`
+	}
+	c.body(c.request("source", map[string]any{"sourceReference": trace.StackFrames[0].Source.SourceReference}), &source)
+	if source.Content != "x = \"hi\";\nreturn x;" {
+		t.Errorf("source = %q", source.Content)
+	}
+
+	var vars struct {
+		Variables []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"variables"`
+	}
+	c.body(c.request("variables", map[string]any{"variablesReference": frameID}), &vars)
+	if len(vars.Variables) != 1 || vars.Variables[0].Value != `"hi"` {
+		t.Errorf("variables = %+v, want x = \"hi\"", vars.Variables)
+	}
+	var evaluated struct {
+		Result string `json:"result"`
+	}
+	c.body(c.request("evaluate", map[string]any{"expression": "x", "frameId": frameID}), &evaluated)
+	if evaluated.Result != `"x"` {
+		t.Errorf("evaluate = %q", evaluated.Result)
+	}
+
+	c.body(c.request("next", map[string]any{"threadId": 42}), &struct{}{})
+	if tk.GetState() != task.TaskQueued || Lookup(42) != nil {
+		t.Errorf("after next: state %v, session %v; want the task queued", tk.GetState(), Lookup(42))
+	}
+	if reason, _ := Check(42, 2, Location{Object: 1, Verb: "inner", Line: 1}); reason != "" {
+		t.Errorf("step over stopped inside a call: %q", reason)
+	}
+	if reason, _ := Check(42, 1, Location{Object: 1, Verb: "look", Line: 3}); reason != ReasonStep {
+		t.Errorf("step over did not stop at the next line: %q", reason)
+	}
+	if msg := c.request("stackTrace", map[string]any{"threadId": 42}); *msg.Success {
+		t.Error("stackTrace succeeded for a running task")
+	}
+
+	c.request("disconnect", nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(Breakpoints()) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(Breakpoints()) != 0 {
+		t.Error("breakpoints survived the client disconnecting")
+	}
+}
@@ -0,0 +1,355 @@
+// Package debug implements breakpoints and stepping for MOO tasks.
+//
+// Breakpoints name a verb by its definer and a source line. While any
+// breakpoint or step is pending, the VM reports each new line a scheduled
+// task reaches to Check. A task that hits a breakpoint or finishes a step is
+// paused (suspended until the debugger continues it) and registered as a
+// Session, whose Target lets wizard builtins and the DAP server inspect the
+// paused VM.
+package debug
+
+import (
+	"barn/db"
+	"barn/task"
+	"barn/types"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stop reasons, named as in DAP "stopped" events
+const (
+	ReasonBreakpoint = "breakpoint"
+	ReasonStep       = "step"
+)
+
+// ErrNotPaused is returned when continuing a task the debugger has not stopped
+var ErrNotPaused = errors.New("task is not paused in the debugger")
+
+// StepMode says where a continued task stops next
+type StepMode int
+
+const (
+	StepNone StepMode = iota // Run to the next breakpoint
+	StepIn                   // Stop at the next line, entering calls
+	StepOver                 // Stop at the next line in this frame or a caller
+	StepOut                  // Stop at the next line in a caller
+)
+
+// ParseStepMode parses "in", "over" or "out"
+func ParseStepMode(s string) (StepMode, bool) {
+	switch s {
+	case "in":
+		return StepIn, true
+	case "over":
+		return StepOver, true
+	case "out":
+		return StepOut, true
+	}
+	return StepNone, false
+}
+
+// Location is the line a task is about to execute
+type Location struct {
+	Object types.ObjID // Object defining the running verb
+	Verb   string      // Name the verb was called by
+	Line   int
+}
+
+// Breakpoint stops tasks about to run a line of a verb
+type Breakpoint struct {
+	ID     int64
+	Object types.ObjID // Object defining the verb
+	Verb   string      // Verb name as given when the breakpoint was set
+	Line   int
+	Hits   int64
+
+	verb *db.Verb // Matches calls through any of the verb's names
+}
+
+func (bp *Breakpoint) matches(loc Location) bool {
+	return bp.Line == loc.Line && bp.Object == loc.Object && bp.verb.MatchesName(loc.Verb)
+}
+
+// Frame describes one activation of a paused task
+type Frame struct {
+	This       types.ObjID
+	Player     types.ObjID
+	Programmer types.ObjID
+	Verb       string
+	VerbLoc    types.ObjID
+	Line       int
+	Eval       bool // An eval() activation rather than a verb
+}
+
+// Variable is a bound local variable
+type Variable struct {
+	Name  string
+	Value types.Value
+}
+
+// Target is a paused VM. Frame indexes count from the innermost frame (0).
+// Targets are not safe for concurrent use; call them from the scheduler
+// goroutine.
+type Target interface {
+	Frames() []Frame
+	Variables(frame int) ([]Variable, error)
+	// Evaluate runs MOO code in the frame's variable scope and returns
+	// its value. A bare expression is evaluated as "return <expr>;".
+	Evaluate(frame int, code string) (types.Value, error)
+}
+
+// Session is a task stopped by the debugger
+type Session struct {
+	TaskID     int64
+	Task       *task.Task
+	Target     Target
+	Reason     string
+	Breakpoint int64 // ID of the breakpoint hit, 0 after a step
+	Since      time.Time
+
+	depth int // Frames on the stack when paused, for stepping
+}
+
+// step is a pending step request for a continued task
+type step struct {
+	mode  StepMode
+	depth int
+}
+
+func (s step) stops(depth int) bool {
+	switch s.mode {
+	case StepIn:
+		return true
+	case StepOver:
+		return depth <= s.depth
+	case StepOut:
+		return depth < s.depth
+	}
+	return false
+}
+
+type debugger struct {
+	mu          sync.Mutex
+	nextID      int64
+	breakpoints []*Breakpoint // In ID order
+	steps       map[int64]step
+	sessions    map[int64]*Session
+	listeners   map[int]func(*Session)
+	nextListen  int
+}
+
+var (
+	active atomic.Bool // Breakpoints or steps are pending
+	global = &debugger{
+		steps:     make(map[int64]step),
+		sessions:  make(map[int64]*Session),
+		listeners: make(map[int]func(*Session)),
+	}
+)
+
+// Enabled reports whether the VM needs to call Check
+func Enabled() bool {
+	return active.Load()
+}
+
+func (d *debugger) updateLocked() {
+	active.Store(len(d.breakpoints) > 0 || len(d.steps) > 0)
+}
+
+// SetBreakpoint adds a breakpoint on line of the verb named verbName
+// defined on obj, or returns the existing one. Returns E_INVARG for an
+// invalid object or a line outside the verb, E_VERBNF if obj does not
+// define the verb.
+func SetBreakpoint(store *db.Store, obj types.ObjID, verbName string, line int) (Breakpoint, types.ErrorCode) {
+	if !store.Valid(obj) {
+		return Breakpoint{}, types.E_INVARG
+	}
+	verb, defObj, err := store.FindVerb(obj, verbName)
+	if err != nil || defObj != obj {
+		return Breakpoint{}, types.E_VERBNF
+	}
+	if line < 1 || line > len(verb.Code) {
+		return Breakpoint{}, types.E_INVARG
+	}
+
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	for _, bp := range global.breakpoints {
+		if bp.Object == obj && bp.Line == line && bp.verb == verb {
+			return *bp, types.E_NONE
+		}
+	}
+	global.nextID++
+	bp := &Breakpoint{ID: global.nextID, Object: obj, Verb: verbName, Line: line, verb: verb}
+	global.breakpoints = append(global.breakpoints, bp)
+	global.updateLocked()
+	return *bp, types.E_NONE
+}
+
+// ClearBreakpoint removes a breakpoint; returns false if there is none with id
+func ClearBreakpoint(id int64) bool {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	for i, bp := range global.breakpoints {
+		if bp.ID == id {
+			global.breakpoints = append(global.breakpoints[:i], global.breakpoints[i+1:]...)
+			global.updateLocked()
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints removes every breakpoint
+func ClearBreakpoints() {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.breakpoints = nil
+	global.updateLocked()
+}
+
+// Breakpoints returns a copy of the breakpoints in ID order
+func Breakpoints() []Breakpoint {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	bps := make([]Breakpoint, len(global.breakpoints))
+	for i, bp := range global.breakpoints {
+		bps[i] = *bp
+	}
+	return bps
+}
+
+// Check decides whether a task with depth frames, about to run loc, stops
+// there. Returns the stop reason ("" to keep running) and the ID of the
+// breakpoint hit.
+func Check(taskID int64, depth int, loc Location) (string, int64) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	reason := ""
+	var hit int64
+	if st, ok := global.steps[taskID]; ok && st.stops(depth) {
+		reason = ReasonStep
+	}
+	for _, bp := range global.breakpoints {
+		if bp.matches(loc) {
+			bp.Hits++
+			reason, hit = ReasonBreakpoint, bp.ID
+			break
+		}
+	}
+	if reason != "" {
+		delete(global.steps, taskID)
+		global.updateLocked()
+	}
+	return reason, hit
+}
+
+// Pause registers t, already suspended at a stop with depth frames on its
+// stack, and notifies listeners
+func Pause(t *task.Task, target Target, reason string, breakpoint int64, depth int) *Session {
+	s := &Session{
+		TaskID:     t.ID,
+		Task:       t,
+		Target:     target,
+		Reason:     reason,
+		Breakpoint: breakpoint,
+		Since:      time.Now(),
+		depth:      depth,
+	}
+	global.mu.Lock()
+	global.sessions[t.ID] = s
+	listeners := make([]func(*Session), 0, len(global.listeners))
+	for _, fn := range global.listeners {
+		listeners = append(listeners, fn)
+	}
+	global.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(s)
+	}
+	return s
+}
+
+// Lookup returns the session of a paused task, or nil
+func Lookup(taskID int64) *Session {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	return global.lookupLocked(taskID)
+}
+
+// lookupLocked drops sessions of tasks killed while paused
+func (d *debugger) lookupLocked(taskID int64) *Session {
+	s := d.sessions[taskID]
+	if s != nil && !s.Task.DebugPaused() {
+		delete(d.sessions, taskID)
+		return nil
+	}
+	return s
+}
+
+// Sessions returns the paused tasks in task ID order
+func Sessions() []*Session {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	sessions := make([]*Session, 0, len(global.sessions))
+	for id := range global.sessions {
+		if s := global.lookupLocked(id); s != nil {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].TaskID < sessions[j].TaskID })
+	return sessions
+}
+
+// Continue requeues a paused task; a step mode makes it stop again at the
+// matching line
+func Continue(taskID int64, mode StepMode) error {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	s := global.lookupLocked(taskID)
+	if s == nil {
+		return ErrNotPaused
+	}
+	delete(global.sessions, taskID)
+	if mode != StepNone {
+		global.steps[taskID] = step{mode: mode, depth: s.depth}
+		global.updateLocked()
+	}
+	if !s.Task.ContinueDebug() {
+		delete(global.steps, taskID)
+		global.updateLocked()
+		return ErrNotPaused
+	}
+	return nil
+}
+
+// Forget drops a finished task's pending step and session
+func Forget(taskID int64) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	if _, ok := global.steps[taskID]; ok {
+		delete(global.steps, taskID)
+		global.updateLocked()
+	}
+	delete(global.sessions, taskID)
+}
+
+// Listen calls fn (on the pausing goroutine) each time a task pauses.
+// The returned function stops the notifications.
+func Listen(fn func(*Session)) func() {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	id := global.nextListen
+	global.nextListen++
+	global.listeners[id] = fn
+	return func() {
+		global.mu.Lock()
+		defer global.mu.Unlock()
+		delete(global.listeners, id)
+	}
+}
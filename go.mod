@@ -5,6 +5,7 @@ go 1.24.6
 require (
 	github.com/go-crypt/x v0.4.12
 	golang.org/x/crypto v0.46.0
+	golang.org/x/text v0.32.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
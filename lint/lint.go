@@ -0,0 +1,170 @@
+// Package lint finds likely bugs in MOO verb code without running it.
+//
+// Each verb is parsed from its source and walked once. The checks are
+// deliberately conservative: a variable is only reported when no path
+// through the verb could have assigned it, and property names are checked
+// only where the object is known (this, or #0 for $name references).
+package lint
+
+import (
+	"barn/db"
+	"barn/parser"
+	"barn/types"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Checks, as reported in Finding.Check
+const (
+	CheckParse       = "parse"
+	CheckUnassigned  = "unassigned"
+	CheckUnreachable = "unreachable"
+	CheckBuiltinArgs = "builtin-args"
+	CheckProperty    = "property"
+	CheckSysProp     = "sysprop"
+	CheckLoopShadow  = "loop-shadow"
+)
+
+// Finding is one problem in a verb
+type Finding struct {
+	Object  types.ObjID `json:"object"`
+	Verb    string      `json:"verb"`
+	Line    int         `json:"line"`
+	Check   string      `json:"check"`
+	Message string      `json:"message"`
+}
+
+// Location returns the finding's place as #obj:verb:line
+func (f Finding) Location() string {
+	return fmt.Sprintf("#%d:%s:%d", f.Object, f.Verb, f.Line)
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s [%s]", f.Location(), f.Message, f.Check)
+}
+
+// Arity reports the argument counts of a builtin, as the builtins
+// registry records them; max is -1 for any number. ok is false when the counts are unknown.
+type Arity func(name string) (min, max int, ok bool)
+
+// Linter checks verbs against a database
+type Linter struct {
+	store *db.Store
+	arity Arity
+}
+
+// New returns a Linter that resolves properties in store and builtin
+// argument counts with arity, which may be nil
+func New(store *db.Store, arity Arity) *Linter {
+	return &Linter{store: store, arity: arity}
+}
+
+// All checks every verb in the database, in object order
+func (l *Linter) All() []Finding {
+	objs := l.store.All()
+	sort.Slice(objs, func(i, j int) bool { return objs[i].ID < objs[j].ID })
+	var findings []Finding
+	for _, obj := range objs {
+		findings = append(findings, l.Object(obj)...)
+	}
+	return findings
+}
+
+// Object checks the verbs defined on obj
+func (l *Linter) Object(obj *db.Object) []Finding {
+	var findings []Finding
+	for _, verb := range obj.VerbList {
+		findings = append(findings, l.Verb(obj, verb)...)
+	}
+	return findings
+}
+
+// Verb checks one verb defined on obj
+func (l *Linter) Verb(obj *db.Object, verb *db.Verb) []Finding {
+	w := &walker{linter: l, definer: obj, verb: VerbName(verb)}
+	stmts, err := parser.NewParser(strings.Join(verb.Code, "\n")).ParseProgram()
+	if err != nil {
+		w.report(0, CheckParse, "%v", err)
+		return w.findings
+	}
+	assigned := make(varSet)
+	for name := range predefined {
+		assigned[name] = true
+	}
+	w.block(stmts, assigned)
+	sort.SliceStable(w.findings, func(i, j int) bool { return w.findings[i].Line < w.findings[j].Line })
+	return w.findings
+}
+
+// VerbName is the name findings use for a verb: its first alias
+func VerbName(verb *db.Verb) string {
+	if len(verb.Names) > 0 {
+		return verb.Names[0]
+	}
+	if fields := strings.Fields(verb.Name); len(fields) > 0 {
+		return fields[0]
+	}
+	return verb.Name
+}
+
+// hasProperty reports whether id or one of its ancestors defines name
+func (l *Linter) hasProperty(id types.ObjID, name string) bool {
+	if IsBuiltinProperty(name) {
+		return true
+	}
+	for _, obj := range Ancestry(l.store, id) {
+		if _, ok := obj.Properties[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Ancestry returns id and its ancestors in store, nearest first
+func Ancestry(store *db.Store, id types.ObjID) []*db.Object {
+	var objs []*db.Object
+	seen := make(map[types.ObjID]bool)
+	queue := []types.ObjID{id}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if seen[cur] {
+			continue
+		}
+		seen[cur] = true
+		obj := store.Get(cur)
+		if obj == nil {
+			continue
+		}
+		objs = append(objs, obj)
+		queue = append(queue, obj.Parents...)
+	}
+	return objs
+}
+
+// predefined are the variables every verb starts with, lower-cased
+var predefined = map[string]bool{
+	"player": true, "this": true, "caller": true, "verb": true, "args": true,
+	"argstr": true, "dobj": true, "dobjstr": true, "prepstr": true,
+	"iobj": true, "iobjstr": true,
+	"int": true, "num": true, "obj": true, "str": true, "err": true,
+	"list": true, "float": true, "map": true, "anon": true, "waif": true,
+	"bool": true,
+}
+
+// BuiltinProperties are the properties every object has
+var BuiltinProperties = []string{
+	"name", "owner", "location", "contents", "parent", "parents", "children",
+	"programmer", "wizard", "player", "r", "w", "f", "a",
+}
+
+// IsBuiltinProperty reports whether name is one of BuiltinProperties
+func IsBuiltinProperty(name string) bool {
+	for _, builtin := range BuiltinProperties {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package lint
+
+import (
+	"barn/db"
+	"barn/types"
+	"strings"
+	"testing"
+)
+
+func testArity(name string) (int, int, bool) {
+	switch name {
+	case "length":
+		return 1, 1, true
+	case "tostr":
+		return 0, -1, true
+	case "index":
+		return 2, 4, true
+	}
+	return 0, -1, false
+}
+
+// newTestStore returns #0 with property "login" and #2 with property
+// "title", whose child #3 defines the verb under test
+func newTestStore(code string) (*db.Store, *db.Object) {
+	store := db.NewStore()
+	sys := db.NewObject(0, 0)
+	sys.Properties["login"] = &db.Property{Name: "login", Value: types.NewObj(2)}
+	parent := db.NewObject(2, 0)
+	parent.Properties["title"] = &db.Property{Name: "title", Value: types.NewStr("")}
+	obj := db.NewObject(3, 0)
+	obj.Parents = []types.ObjID{2}
+	verb := &db.Verb{Name: "do_it do", Names: []string{"do_it", "do"}, Owner: 0, Code: strings.Split(code, "\n")}
+	obj.Verbs[verb.Name] = verb
+	obj.VerbList = []*db.Verb{verb}
+	store.Add(sys)
+	store.Add(parent)
+	store.Add(obj)
+	return store, obj
+}
+
+func lintCode(code string) []Finding {
+	store, _ := newTestStore(code)
+	return New(store, testArity).All()
+}
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		check string
+		line  int
+	}{
+		{"unassigned", "x = 1;\nreturn x + y;", CheckUnassigned, 2},
+		{"unreachable", "return 1;\n\"a comment\";\nplayer:tell(\"never\");\nplayer:tell(\"reported once\");", CheckUnreachable, 3},
+		{"unreachable after if", "if (args)\n  return 1;\nelse\n  return 2;\nendif\nreturn 3;", CheckUnreachable, 6},
+		{"too many args", "return length(args, 1);", CheckBuiltinArgs, 1},
+		{"too few args", "\nreturn index(\"abc\");", CheckBuiltinArgs, 2},
+		{"property", "return this.title + this.subtitle;", CheckProperty, 1},
+		{"sysprop", "$login:go();\n$logout:go();", CheckSysProp, 2},
+		{"loop shadow", "for i in [1..3]\n  for i in [1..3]\n  endfor\nendfor", CheckLoopShadow, 2},
+		{"parse", "return (1;", CheckParse, 0},
+		{"lambda body", "n = 1;\nf = {x} => x + n + y;", CheckUnassigned, 2},
+		{"lambda assignment", "f = {x} => (z = x);\nreturn z;", CheckUnassigned, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := lintCode(tt.code)
+			if len(findings) != 1 {
+				t.Fatalf("got %d findings, want 1: %v", len(findings), findings)
+			}
+			f := findings[0]
+			if f.Check != tt.check || f.Line != tt.line || f.Object != 3 || f.Verb != "do_it" {
+				t.Errorf("got %v, want %s at #3:do_it:%d", f, tt.check, tt.line)
+			}
+		})
+	}
+}
+
+func TestCleanCode(t *testing.T) {
+	clean := []string{
+		// Every path that reaches the read has assigned, or may have
+		"if (args)\n  x = 1;\nelse\n  x = 2;\nendif\nreturn x;",
+		"while (i = length(args))\n  args = args[2..$];\nendwhile\nreturn i;",
+		"for x in (args)\n  if (x)\n    found = x;\n  endif\nendfor\nreturn found;",
+		"try\n  x = args[1];\nexcept e (E_RANGE)\n  return e[2];\nendtry\nreturn x;",
+		"{a, ?b = a, @rest} = args;\nreturn {a, b, rest};",
+		"{a, b} = {1, 2};\nreturn a + b;",
+		"fork t (0)\n  player:tell(t);\nendfork\nreturn t;",
+		"X = 1;\nreturn x + NUM;",
+		"for i in [1..2]\nendfor\nfor i in [1..2]\nendfor",
+		// A splice may supply the missing arguments
+		"return index(@args);",
+		"return tostr(1, 2, 3) + this.name + $login.title;",
+		"n = 1;\nf = {x, ?y = x, @r} => x + y + n + length(r);\nreturn f(1);",
+	}
+	for _, code := range clean {
+		if findings := lintCode(code); len(findings) != 0 {
+			t.Errorf("%q: unexpected findings %v", code, findings)
+		}
+	}
+}
+
+func TestFindingString(t *testing.T) {
+	f := Finding{Object: 3, Verb: "do_it", Line: 2, Check: CheckUnassigned, Message: "variable y is read before it is assigned"}
+	if got, want := f.String(), "#3:do_it:2: variable y is read before it is assigned [unassigned]"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,483 @@
+package lint
+
+import (
+	"barn/db"
+	"barn/parser"
+	"barn/types"
+	"fmt"
+	"strings"
+)
+
+// varSet holds the lower-cased names of variables that may be assigned
+type varSet map[string]bool
+
+func (s varSet) clone() varSet {
+	c := make(varSet, len(s))
+	for name := range s {
+		c[name] = true
+	}
+	return c
+}
+
+func (s varSet) add(other varSet) {
+	for name := range other {
+		s[name] = true
+	}
+}
+
+// walker checks one verb's syntax tree
+type walker struct {
+	linter   *Linter
+	definer  *db.Object
+	verb     string
+	findings []Finding
+	loopVars []string // for-loop variables of the enclosing loops
+}
+
+func (w *walker) report(line int, check, format string, args ...any) {
+	w.findings = append(w.findings, Finding{
+		Object:  w.definer.ID,
+		Verb:    w.verb,
+		Line:    line,
+		Check:   check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// block walks stmts with the variables in vars, adding the ones they
+// assign. It returns the keyword of the statement that makes the end of
+// the block unreachable, or "" if control can fall through.
+func (w *walker) block(stmts []parser.Stmt, vars varSet) string {
+	exit, reported := "", false
+	for _, stmt := range stmts {
+		if exit == "" {
+			exit = w.stmt(stmt, vars)
+			continue
+		}
+		// Keep checking the rest, but only report the block once
+		if !reported && !isComment(stmt) {
+			w.report(stmt.Position().Line, CheckUnreachable, "unreachable code after %s", exit)
+			reported = true
+		}
+		w.stmt(stmt, vars)
+	}
+	return exit
+}
+
+// isComment reports whether stmt is a bare string, which MOO code uses
+// for comments
+func isComment(stmt parser.Stmt) bool {
+	s, ok := stmt.(*parser.ExprStmt)
+	if !ok {
+		return false
+	}
+	lit, ok := s.Expr.(*parser.LiteralExpr)
+	if !ok {
+		return false
+	}
+	_, ok = lit.Value.(types.StrValue)
+	return ok
+}
+
+func (w *walker) stmt(stmt parser.Stmt, vars varSet) string {
+	switch s := stmt.(type) {
+	case *parser.ExprStmt:
+		w.expr(s.Expr, vars)
+	case *parser.IfStmt:
+		w.expr(s.Condition, vars)
+		branches := []varSet{vars.clone()}
+		exits := []string{w.block(s.Body, branches[0])}
+		for _, clause := range s.ElseIfs {
+			w.expr(clause.Condition, vars)
+			branch := vars.clone()
+			branches = append(branches, branch)
+			exits = append(exits, w.block(clause.Body, branch))
+		}
+		if s.Else != nil {
+			branch := vars.clone()
+			branches = append(branches, branch)
+			exits = append(exits, w.block(s.Else, branch))
+		}
+		for _, branch := range branches {
+			vars.add(branch)
+		}
+		if s.Else != nil && allExit(exits) {
+			return "if"
+		}
+	case *parser.WhileStmt:
+		// Later iterations see everything the loop assigns
+		inner := vars.clone()
+		inner.add(assignedIn(s.Body))
+		w.expr(s.Condition, inner)
+		if s.Label != "" {
+			inner[strings.ToLower(s.Label)] = true
+		}
+		w.block(s.Body, inner)
+		vars.add(inner)
+	case *parser.ForStmt:
+		w.expr(s.Container, vars)
+		w.expr(s.RangeStart, vars)
+		w.expr(s.RangeEnd, vars)
+		names := []string{s.Value}
+		if s.Index != "" {
+			names = append(names, s.Index)
+		}
+		for _, name := range names {
+			for _, outer := range w.loopVars {
+				if strings.EqualFold(name, outer) {
+					w.report(s.Pos.Line, CheckLoopShadow, "loop variable %s is already the variable of an enclosing loop", name)
+				}
+			}
+		}
+		inner := vars.clone()
+		inner.add(assignedIn(s.Body))
+		for _, name := range names {
+			inner[strings.ToLower(name)] = true
+		}
+		depth := len(w.loopVars)
+		w.loopVars = append(w.loopVars, names...)
+		w.block(s.Body, inner)
+		w.loopVars = w.loopVars[:depth]
+		vars.add(inner)
+	case *parser.BreakStmt:
+		w.expr(s.Value, vars)
+		return "break"
+	case *parser.ContinueStmt:
+		return "continue"
+	case *parser.ReturnStmt:
+		w.expr(s.Value, vars)
+		return "return"
+	case *parser.TryExceptStmt:
+		if w.try(s.Body, s.Excepts, vars) {
+			return "try"
+		}
+	case *parser.TryFinallyStmt:
+		exit := w.block(s.Body, vars)
+		if w.block(s.Finally, vars) != "" || exit != "" {
+			return "try"
+		}
+	case *parser.TryExceptFinallyStmt:
+		exits := w.try(s.Body, s.Excepts, vars)
+		if w.block(s.Finally, vars) != "" || exits {
+			return "try"
+		}
+	case *parser.ScatterStmt:
+		w.expr(s.Value, vars)
+		for _, target := range s.Targets {
+			w.expr(target.Default, vars)
+			vars[strings.ToLower(target.Name)] = true
+		}
+	case *parser.ForkStmt:
+		w.expr(s.Delay, vars)
+		if s.VarName != "" {
+			vars[strings.ToLower(s.VarName)] = true
+		}
+		w.block(s.Body, vars.clone())
+	}
+	return ""
+}
+
+// try walks a try body and its handlers, reporting whether every one of
+// them exits
+func (w *walker) try(body []parser.Stmt, excepts []*parser.ExceptClause, vars varSet) bool {
+	exits := []string{w.block(body, vars)}
+	// A handler may start after any statement of the body
+	branches := make([]varSet, 0, len(excepts))
+	for _, clause := range excepts {
+		branch := vars.clone()
+		if clause.Variable != "" {
+			branch[strings.ToLower(clause.Variable)] = true
+		}
+		branches = append(branches, branch)
+		exits = append(exits, w.block(clause.Body, branch))
+	}
+	for _, branch := range branches {
+		vars.add(branch)
+	}
+	return allExit(exits)
+}
+
+func allExit(exits []string) bool {
+	for _, exit := range exits {
+		if exit == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *walker) expr(expr parser.Expr, vars varSet) {
+	switch e := expr.(type) {
+	case nil:
+	case *parser.IdentifierExpr:
+		name := strings.ToLower(e.Name)
+		if !vars[name] {
+			w.report(e.Pos.Line, CheckUnassigned, "variable %s is read before it is assigned", e.Name)
+			// Report each variable once
+			vars[name] = true
+		}
+	case *parser.UnaryExpr:
+		w.expr(e.Operand, vars)
+	case *parser.BinaryExpr:
+		w.expr(e.Left, vars)
+		w.expr(e.Right, vars)
+	case *parser.TernaryExpr:
+		w.expr(e.Condition, vars)
+		w.expr(e.ThenExpr, vars)
+		w.expr(e.ElseExpr, vars)
+	case *parser.ParenExpr:
+		w.expr(e.Expr, vars)
+	case *parser.IndexExpr:
+		w.expr(e.Expr, vars)
+		w.expr(e.Index, vars)
+	case *parser.RangeExpr:
+		w.expr(e.Expr, vars)
+		w.expr(e.Start, vars)
+		w.expr(e.End, vars)
+	case *parser.PropertyExpr:
+		w.expr(e.Expr, vars)
+		w.expr(e.PropertyExpr, vars)
+		if e.Property != "" {
+			w.property(e)
+		}
+	case *parser.VerbCallExpr:
+		w.expr(e.Expr, vars)
+		w.expr(e.VerbExpr, vars)
+		w.exprs(e.Args, vars)
+	case *parser.BuiltinCallExpr:
+		w.exprs(e.Args, vars)
+		w.builtinArgs(e)
+	case *parser.SpliceExpr:
+		w.expr(e.Expr, vars)
+	case *parser.CatchExpr:
+		w.expr(e.Expr, vars)
+		w.expr(e.Default, vars)
+	case *parser.AssignExpr:
+		w.expr(e.Value, vars)
+		switch target := e.Target.(type) {
+		case *parser.IdentifierExpr:
+			vars[strings.ToLower(target.Name)] = true
+		case *parser.ListExpr:
+			for _, elem := range target.Elements {
+				if id, ok := elem.(*parser.IdentifierExpr); ok {
+					vars[strings.ToLower(id.Name)] = true
+				}
+			}
+		default:
+			// x[i] = v and x.p = v read x
+			w.expr(target, vars)
+		}
+	case *parser.ListExpr:
+		w.exprs(e.Elements, vars)
+	case *parser.ListRangeExpr:
+		w.expr(e.Start, vars)
+		w.expr(e.End, vars)
+	case *parser.MapExpr:
+		for _, pair := range e.Pairs {
+			w.expr(pair.Key, vars)
+			w.expr(pair.Value, vars)
+		}
+	case *parser.LambdaExpr:
+		// The body runs later on a copy of the variables, so what it
+		// assigns is not seen here
+		inner := vars.clone()
+		for _, param := range e.Params {
+			w.expr(param.Default, inner)
+			inner[strings.ToLower(param.Name)] = true
+		}
+		w.expr(e.Body, inner)
+	}
+}
+
+func (w *walker) exprs(exprs []parser.Expr, vars varSet) {
+	for _, expr := range exprs {
+		w.expr(expr, vars)
+	}
+}
+
+// property checks a static property reference on this or #0
+func (w *walker) property(e *parser.PropertyExpr) {
+	switch base := e.Expr.(type) {
+	case *parser.IdentifierExpr:
+		if strings.EqualFold(base.Name, "this") && !w.linter.hasProperty(w.definer.ID, e.Property) {
+			w.report(e.Pos.Line, CheckProperty, "property %s is not defined on #%d or its ancestors", e.Property, w.definer.ID)
+		}
+	case *parser.LiteralExpr:
+		obj, ok := base.Value.(types.ObjValue)
+		if !ok || obj.ID() != 0 || w.linter.store.Get(0) == nil {
+			return
+		}
+		if !w.linter.hasProperty(0, e.Property) {
+			w.report(e.Pos.Line, CheckSysProp, "$%s is not a property of #0", e.Property)
+		}
+	}
+}
+
+// builtinArgs checks a builtin call's argument count
+func (w *walker) builtinArgs(e *parser.BuiltinCallExpr) {
+	if w.linter.arity == nil {
+		return
+	}
+	name := strings.ToLower(e.Name)
+	min, max, ok := w.linter.arity(name)
+	if !ok {
+		return
+	}
+	fixed, spliced := 0, false
+	for _, arg := range e.Args {
+		if _, ok := arg.(*parser.SpliceExpr); ok {
+			spliced = true
+		} else {
+			fixed++
+		}
+	}
+	// A splice can supply any number of arguments, but not take any away
+	if (max >= 0 && fixed > max) || (!spliced && fixed < min) {
+		w.report(e.Pos.Line, CheckBuiltinArgs, "%s() takes %s, called with %d", name, describeArity(min, max), fixed)
+	}
+}
+
+func describeArity(min, max int) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+	switch {
+	case max < 0:
+		return "at least " + plural(min)
+	case min == max:
+		return plural(min)
+	default:
+		return fmt.Sprintf("%d to %d arguments", min, max)
+	}
+}
+
+// assignedIn returns the variables stmts may assign
+func assignedIn(stmts []parser.Stmt) varSet {
+	vars := make(varSet)
+	var visitExpr func(parser.Expr)
+	var visitStmts func([]parser.Stmt)
+	visitExprs := func(exprs []parser.Expr) {
+		for _, expr := range exprs {
+			visitExpr(expr)
+		}
+	}
+	visitExpr = func(expr parser.Expr) {
+		switch e := expr.(type) {
+		case *parser.AssignExpr:
+			switch target := e.Target.(type) {
+			case *parser.IdentifierExpr:
+				vars[strings.ToLower(target.Name)] = true
+			case *parser.ListExpr:
+				for _, elem := range target.Elements {
+					if id, ok := elem.(*parser.IdentifierExpr); ok {
+						vars[strings.ToLower(id.Name)] = true
+					}
+				}
+			default:
+				visitExpr(target)
+			}
+			visitExpr(e.Value)
+		case *parser.UnaryExpr:
+			visitExpr(e.Operand)
+		case *parser.BinaryExpr:
+			visitExprs([]parser.Expr{e.Left, e.Right})
+		case *parser.TernaryExpr:
+			visitExprs([]parser.Expr{e.Condition, e.ThenExpr, e.ElseExpr})
+		case *parser.ParenExpr:
+			visitExpr(e.Expr)
+		case *parser.IndexExpr:
+			visitExprs([]parser.Expr{e.Expr, e.Index})
+		case *parser.RangeExpr:
+			visitExprs([]parser.Expr{e.Expr, e.Start, e.End})
+		case *parser.PropertyExpr:
+			visitExprs([]parser.Expr{e.Expr, e.PropertyExpr})
+		case *parser.VerbCallExpr:
+			visitExprs([]parser.Expr{e.Expr, e.VerbExpr})
+			visitExprs(e.Args)
+		case *parser.BuiltinCallExpr:
+			visitExprs(e.Args)
+		case *parser.SpliceExpr:
+			visitExpr(e.Expr)
+		case *parser.CatchExpr:
+			visitExprs([]parser.Expr{e.Expr, e.Default})
+		case *parser.ListExpr:
+			visitExprs(e.Elements)
+		case *parser.ListRangeExpr:
+			visitExprs([]parser.Expr{e.Start, e.End})
+		case *parser.MapExpr:
+			for _, pair := range e.Pairs {
+				visitExprs([]parser.Expr{pair.Key, pair.Value})
+			}
+		case *parser.LambdaExpr:
+			// Assignments in a lambda body are local to the call
+		}
+	}
+	visitExcepts := func(excepts []*parser.ExceptClause) {
+		for _, clause := range excepts {
+			if clause.Variable != "" {
+				vars[strings.ToLower(clause.Variable)] = true
+			}
+			visitStmts(clause.Body)
+		}
+	}
+	visitStmts = func(stmts []parser.Stmt) {
+		for _, stmt := range stmts {
+			switch s := stmt.(type) {
+			case *parser.ExprStmt:
+				visitExpr(s.Expr)
+			case *parser.IfStmt:
+				visitExpr(s.Condition)
+				visitStmts(s.Body)
+				for _, clause := range s.ElseIfs {
+					visitExpr(clause.Condition)
+					visitStmts(clause.Body)
+				}
+				visitStmts(s.Else)
+			case *parser.WhileStmt:
+				if s.Label != "" {
+					vars[strings.ToLower(s.Label)] = true
+				}
+				visitExpr(s.Condition)
+				visitStmts(s.Body)
+			case *parser.ForStmt:
+				vars[strings.ToLower(s.Value)] = true
+				if s.Index != "" {
+					vars[strings.ToLower(s.Index)] = true
+				}
+				visitExprs([]parser.Expr{s.Container, s.RangeStart, s.RangeEnd})
+				visitStmts(s.Body)
+			case *parser.BreakStmt:
+				visitExpr(s.Value)
+			case *parser.ReturnStmt:
+				visitExpr(s.Value)
+			case *parser.TryExceptStmt:
+				visitStmts(s.Body)
+				visitExcepts(s.Excepts)
+			case *parser.TryFinallyStmt:
+				visitStmts(s.Body)
+				visitStmts(s.Finally)
+			case *parser.TryExceptFinallyStmt:
+				visitStmts(s.Body)
+				visitExcepts(s.Excepts)
+				visitStmts(s.Finally)
+			case *parser.ScatterStmt:
+				for _, target := range s.Targets {
+					vars[strings.ToLower(target.Name)] = true
+					visitExpr(target.Default)
+				}
+				visitExpr(s.Value)
+			case *parser.ForkStmt:
+				if s.VarName != "" {
+					vars[strings.ToLower(s.VarName)] = true
+				}
+				visitExpr(s.Delay)
+				visitStmts(s.Body)
+			}
+		}
+	}
+	visitStmts(stmts)
+	return vars
+}
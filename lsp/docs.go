@@ -0,0 +1,120 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Doc is the documentation for one builtin
+type Doc struct {
+	Signature string // e.g. "index(haystack, needle [, case_matters [, start]]) → INT"
+	Markdown  string // The builtin's section of the spec
+}
+
+// LoadDocs reads builtin documentation from the markdown files in dir,
+// such as spec/builtins. A section documents a builtin when its heading
+// ends with the builtin's name and its text shows a call to it; it runs
+// until the next heading at the same or a higher level.
+func LoadDocs(dir string) (map[string]Doc, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	docs := make(map[string]Doc)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		addDocs(docs, strings.Split(string(data), "\n"))
+	}
+	return docs, nil
+}
+
+// addDocs adds the builtins documented in lines, keeping any already
+// documented
+func addDocs(docs map[string]Doc, lines []string) {
+	for i, line := range lines {
+		level := headingLevel(line)
+		if level == 0 {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := fields[len(fields)-1]
+		if !isIdentifier(name) {
+			continue
+		}
+		if _, ok := docs[name]; ok {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) {
+			if l := headingLevel(lines[end]); l > 0 && l <= level {
+				break
+			}
+			end++
+		}
+		section := lines[i:end]
+		sig := findSignature(name, section)
+		if sig == "" {
+			continue
+		}
+		for len(section) > 0 {
+			last := strings.TrimSpace(section[len(section)-1])
+			if last != "" && last != "---" {
+				break
+			}
+			section = section[:len(section)-1]
+		}
+		docs[name] = Doc{Signature: sig, Markdown: strings.Join(section, "\n")}
+	}
+}
+
+// headingLevel returns the level of a markdown heading, or 0 if line is
+// not one
+func headingLevel(line string) int {
+	n := 0
+	for n < len(line) && line[n] == '#' {
+		n++
+	}
+	if n == 0 || n == len(line) || line[n] != ' ' {
+		return 0
+	}
+	return n
+}
+
+// findSignature returns the first call to name in section, up to the end
+// of its code span or line
+func findSignature(name string, section []string) string {
+	for _, line := range section[1:] {
+		i := strings.Index(line, name+"(")
+		if i < 0 || (i > 0 && isIdentByte(line[i-1])) {
+			continue
+		}
+		sig := line[i:]
+		if j := strings.IndexByte(sig, '`'); j >= 0 {
+			sig = sig[:j]
+		}
+		return strings.TrimSpace(sig)
+	}
+	return ""
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isIdentByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,268 @@
+package lsp
+
+import (
+	"barn/builtins"
+	"barn/db"
+	"barn/types"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestServer serves a database where #0.thing is #2, #2 defines
+// property "title" and verb "l*ook", and #3 is a child of #2
+func newTestServer(t *testing.T) *Server {
+	store := db.NewStore()
+	sys := db.NewObject(0, 0)
+	sys.Properties["thing"] = &db.Property{Name: "thing", Value: types.NewObj(2)}
+	addVerb(sys, "go", "return 1;")
+	parent := db.NewObject(2, 0)
+	parent.Properties["title"] = &db.Property{Name: "title", Value: types.NewStr("")}
+	addVerb(parent, "l*ook @look", "player:tell(this.title);")
+	obj := db.NewObject(3, 0)
+	obj.Parents = []types.ObjID{2}
+	addVerb(obj, "do_it", "return;")
+	store.Add(sys)
+	store.Add(parent)
+	store.Add(obj)
+
+	docs := make(map[string]Doc)
+	addDocs(docs, strings.Split("## Strings\n\n### 1.1 length\n\n**Signature:** `length(string) → INT`\n\nCounts characters.\n\n---\n\n### 1.2 strsub\n", "\n"))
+	s := NewServer(store, builtins.NewRegistry(), docs)
+	s.CacheDir = t.TempDir()
+	return s
+}
+
+func addVerb(obj *db.Object, names, code string) {
+	verb := &db.Verb{Name: names, Names: strings.Fields(names), Code: strings.Split(code, "\n")}
+	obj.Verbs[verb.Name] = verb
+	obj.VerbList = append(obj.VerbList, verb)
+}
+
+// session runs requests, given as method and params, through a server
+// and returns what it wrote. Requests with a nil id are notifications.
+func session(t *testing.T, s *Server, reqs ...any) []map[string]any {
+	var in bytes.Buffer
+	id := 0
+	for i := 0; i < len(reqs); i += 2 {
+		msg := map[string]any{"jsonrpc": "2.0", "method": reqs[i], "params": reqs[i+1]}
+		if m := reqs[i].(string); !strings.HasPrefix(m, "textDocument/did") && m != "exit" {
+			id++
+			msg["id"] = id
+		}
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := s.Serve(&in, &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	var msgs []map[string]any
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readFrame(r)
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+const docURI = "file:///work/%233:do_it.moo"
+
+func open(text string) []any {
+	return []any{"textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": docURI, "text": text}}}
+}
+
+func at(method string, line, char int) []any {
+	return []any{method, map[string]any{
+		"textDocument": map[string]any{"uri": docURI},
+		"position":     map[string]any{"line": line, "character": char},
+	}}
+}
+
+func run(t *testing.T, text string, reqs ...[]any) []map[string]any {
+	args := open(text)
+	for _, req := range reqs {
+		args = append(args, req...)
+	}
+	return session(t, newTestServer(t), append(args, "shutdown", nil, "exit", nil)...)
+}
+
+// result returns the result of the request with the given id
+func result(t *testing.T, msgs []map[string]any, id int) any {
+	for _, msg := range msgs {
+		if n, ok := msg["id"].(float64); ok && int(n) == id {
+			if msg["error"] != nil {
+				t.Fatalf("request %d failed: %v", id, msg["error"])
+			}
+			return msg["result"]
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+	return nil
+}
+
+func labels(res any) string {
+	var names []string
+	for _, item := range res.([]any) {
+		names = append(names, item.(map[string]any)["label"].(string))
+	}
+	return strings.Join(names, " ")
+}
+
+func TestDiagnostics(t *testing.T) {
+	msgs := run(t, "x = 1;\nreturn (1;")
+	params := msgs[0]["params"].(map[string]any)
+	diags := params["diagnostics"].([]any)
+	if msgs[0]["method"] != "textDocument/publishDiagnostics" || len(diags) != 1 {
+		t.Fatalf("got %v, want one diagnostic", msgs[0])
+	}
+	start := diags[0].(map[string]any)["range"].(map[string]any)["start"]
+	if got := fmt.Sprint(start); got != "map[character:9 line:1]" {
+		t.Errorf("diagnostic starts at %s", got)
+	}
+
+	msgs = run(t, "return 1;")
+	if diags := msgs[0]["params"].(map[string]any)["diagnostics"].([]any); len(diags) != 0 {
+		t.Errorf("unexpected diagnostics %v", diags)
+	}
+}
+
+func TestHover(t *testing.T) {
+	msgs := run(t, "x = length(args);\ny = strsub(x, \"a\", \"b\");\nz = toupper(y) + this.length(1);",
+		at("textDocument/hover", 0, 6), at("textDocument/hover", 1, 4), at("textDocument/hover", 2, 22), at("textDocument/hover", 0, 0))
+	hover := result(t, msgs, 1).(map[string]any)
+	if got := hover["contents"].(map[string]any)["value"].(string); !strings.HasPrefix(got, "### 1.1 length") || !strings.HasSuffix(got, "Counts characters.") {
+		t.Errorf("length hover = %q", got)
+	}
+	if got := hover["range"].(map[string]any)["end"]; fmt.Sprint(got) != "map[character:10 line:0]" {
+		t.Errorf("length hover ends at %v", got)
+	}
+	// strsub's section has no signature, so it falls back to its arity
+	if got := result(t, msgs, 2).(map[string]any)["contents"].(map[string]any)["value"]; got != "`strsub()` takes 3 to 4 arguments." {
+		t.Errorf("strsub hover = %q", got)
+	}
+	for _, id := range []int{3, 4} {
+		if got := result(t, msgs, id); got != nil {
+			t.Errorf("request %d: hover = %v, want none", id, got)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	msgs := run(t, "$th\nthis.\nthis:l\n$thing:\nx = leng\n\"leng",
+		at("textDocument/completion", 0, 3), at("textDocument/completion", 1, 5),
+		at("textDocument/completion", 2, 6), at("textDocument/completion", 3, 7),
+		at("textDocument/completion", 4, 8), at("textDocument/completion", 5, 5))
+	tests := []string{
+		"thing",
+		"title name owner location contents parent parents children programmer wizard player r w f a",
+		"look",
+		"look",
+		"length",
+		"",
+	}
+	for i, want := range tests {
+		if got := labels(result(t, msgs, i+1)); got != want {
+			t.Errorf("completion %d = %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	s := newTestServer(t)
+	msgs := session(t, s, append(append(append(append(open("this:look();\n$go();\n#3:nothing();"),
+		at("textDocument/definition", 0, 6)...), at("textDocument/definition", 1, 2)...),
+		at("textDocument/definition", 2, 4)...), "shutdown", nil, "exit", nil)...)
+
+	uri := result(t, msgs, 1).(map[string]any)["uri"].(string)
+	if want := fileURI(filepath.ToSlash(filepath.Join(s.CacheDir, "#2%3Al%2Aook.moo"))); uri != want {
+		t.Fatalf("definition = %s, want %s", uri, want)
+	}
+	code, err := os.ReadFile(filepath.Join(s.CacheDir, "#2%3Al%2Aook.moo"))
+	if err != nil || string(code) != "player:tell(this.title);\n" {
+		t.Errorf("cached verb = %q, %v", code, err)
+	}
+	if uri := result(t, msgs, 2).(map[string]any)["uri"].(string); !strings.HasSuffix(uri, "/%230%253Ago.moo") {
+		t.Errorf("$go definition = %s", uri)
+	}
+	if got := result(t, msgs, 3); got != nil {
+		t.Errorf("missing verb definition = %v", got)
+	}
+}
+
+func TestVerbForURI(t *testing.T) {
+	tests := []struct {
+		uri string
+		obj types.ObjID
+		ok  bool
+	}{
+		{"file:///work/%233:do_it.moo", 3, true},
+		{"file:///work/%233:do_it", 3, true},
+		{fileURI("/work/" + verbFileName(12, "l*ook")), 12, true},
+		{fileURI("/work/" + verbFileName(4, "a/b:c%d")), 4, true},
+		{"file:///work/notes.moo", 0, false},
+		{"file:///work/%233:.moo", 0, false},
+	}
+	for _, tt := range tests {
+		obj, ok := verbForURI(tt.uri)
+		if obj != tt.obj || ok != tt.ok {
+			t.Errorf("verbForURI(%s) = #%d, %v; want #%d, %v", tt.uri, obj, ok, tt.obj, tt.ok)
+		}
+	}
+	if got := verbFileName(4, "a/b:c%d"); got != "#4%3Aa%2Fb%3Ac%25d.moo" {
+		t.Errorf("verbFileName = %q", got)
+	}
+}
+
+func TestLoadDocs(t *testing.T) {
+	docs, err := LoadDocs("../spec/builtins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, sig := range map[string]string{
+		"strsub": "strsub(subject, old, new [, case_matters]) → STR",
+		"index":  "index(haystack, needle [, case_matters [, start]]) → INT",
+	} {
+		if got := docs[name].Signature; got != sig {
+			t.Errorf("%s signature = %q, want %q", name, got, sig)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	text := "a = \"日本\";\n😀x = 1;"
+	for _, tt := range []struct {
+		pos position
+		off int
+	}{
+		{position{0, 0}, 0},
+		{position{0, 7}, 11},
+		{position{1, 2}, 18},
+		{position{1, 99}, len(text)},
+	} {
+		if got := offsetAt(text, tt.pos); got != tt.off {
+			t.Errorf("offsetAt(%v) = %d, want %d", tt.pos, got, tt.off)
+		}
+		if tt.pos.Character < 99 {
+			if got := positionAt(text, tt.off); got != tt.pos {
+				t.Errorf("positionAt(%d) = %v, want %v", tt.off, got, tt.pos)
+			}
+		}
+	}
+}
@@ -0,0 +1,438 @@
+// Package lsp serves the Language Server Protocol for MOO code, backed by
+// a database. Documents are verbs named "#obj:verb" (a ".moo" suffix is
+// allowed, and characters a file name cannot hold may be percent-escaped),
+// the same convention the debugger uses for sources, so "this" can be
+// resolved to the object the verb is on.
+package lsp
+
+import (
+	"barn/builtins"
+	"barn/db"
+	"barn/lint"
+	"barn/parser"
+	"barn/types"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Server answers one client's requests. The database is read but never
+// changed.
+type Server struct {
+	store    *db.Store
+	registry *builtins.Registry
+	docs     map[string]Doc
+	files    map[string]string // Open documents by URI
+	w        io.Writer
+	shutdown bool
+
+	// CacheDir is where go-to-definition writes verbs that have no file
+	// next to the document being edited
+	CacheDir string
+}
+
+// NewServer returns a server for store. registry supplies the builtin
+// names and docs their documentation, as loaded by LoadDocs; docs may be
+// nil.
+func NewServer(store *db.Store, registry *builtins.Registry, docs map[string]Doc) *Server {
+	return &Server{
+		store:    store,
+		registry: registry,
+		docs:     docs,
+		files:    make(map[string]string),
+		CacheDir: filepath.Join(os.TempDir(), "barn-lsp"),
+	}
+}
+
+// Serve reads requests from r and writes responses to w until the client
+// sends exit or closes r. Exiting without a shutdown request is an error,
+// as the protocol asks.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+	for {
+		body, err := readFrame(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+		s.dispatch(&msg)
+	}
+}
+
+// dispatch handles one message. A request that panics gets an error
+// response rather than taking the server down.
+func (s *Server) dispatch(msg *message) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("LSP %s: panic: %v", msg.Method, r)
+			if msg.ID != nil {
+				s.replyError(msg.ID, codeInvalidParams, fmt.Sprint(r))
+			}
+		}
+	}()
+
+	switch msg.Method {
+	case "initialize":
+		s.reply(msg.ID, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1, // Full
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]any{"triggerCharacters": []string{"$", ".", ":"}},
+			},
+			"serverInfo": map[string]any{"name": "barn"},
+		})
+	case "shutdown":
+		s.shutdown = true
+		s.reply(msg.ID, nil)
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if s.decode(msg, &params) {
+			s.files[params.TextDocument.URI] = params.TextDocument.Text
+			s.publishDiagnostics(params.TextDocument.URI)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if s.decode(msg, &params) && len(params.ContentChanges) > 0 {
+			s.files[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+			s.publishDiagnostics(params.TextDocument.URI)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if s.decode(msg, &params) {
+			delete(s.files, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []diagnostic{}})
+		}
+	case "textDocument/hover":
+		var params positionParams
+		if s.decode(msg, &params) {
+			s.reply(msg.ID, s.hover(params.TextDocument.URI, params.Position))
+		}
+	case "textDocument/completion":
+		var params positionParams
+		if s.decode(msg, &params) {
+			s.reply(msg.ID, s.completion(params.TextDocument.URI, params.Position))
+		}
+	case "textDocument/definition":
+		var params positionParams
+		if s.decode(msg, &params) {
+			s.reply(msg.ID, s.definition(params.TextDocument.URI, params.Position))
+		}
+	default:
+		if msg.ID != nil {
+			s.replyError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+		}
+	}
+}
+
+// decode unmarshals a message's params, answering a request with an error
+// if they are malformed
+func (s *Server) decode(msg *message, params any) bool {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		if msg.ID != nil {
+			s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+func (s *Server) reply(id *json.RawMessage, result any) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, msg string) {
+	s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: rpcError{Code: code, Message: msg}})
+}
+
+func (s *Server) notify(method string, params any) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) write(msg any) {
+	if err := writeMessage(s.w, msg); err != nil {
+		log.Printf("LSP: %v", err)
+	}
+}
+
+// publishDiagnostics reports the document's parse error, if it has one
+func (s *Server) publishDiagnostics(uri string) {
+	text := s.files[uri]
+	diags := []diagnostic{}
+	p := parser.NewParser(text)
+	if _, err := p.ParseProgram(); err != nil {
+		start := positionAt(text, p.Pos().Offset)
+		end := start
+		end.Character++
+		diags = append(diags, diagnostic{
+			Range:    textRange{Start: start, End: end},
+			Severity: severityError,
+			Source:   "barn",
+			Message:  err.Error(),
+		})
+	}
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+// hover documents the builtin called at pos
+func (s *Server) hover(uri string, pos position) *hover {
+	text := s.files[uri]
+	toks := tokenize(text)
+	i := identAt(toks, offsetAt(text, pos))
+	if i < 0 || tokenType(toks, i+1) != parser.TOKEN_LPAREN {
+		return nil
+	}
+	switch tokenType(toks, i-1) {
+	case parser.TOKEN_DOT, parser.TOKEN_COLON, parser.TOKEN_DOLLAR:
+		return nil
+	}
+	name := strings.ToLower(toks[i].Value)
+	if !s.registry.Has(name) {
+		return nil
+	}
+	r := textRange{
+		Start: positionAt(text, toks[i].Position.Offset),
+		End:   positionAt(text, tokenEnd(toks[i])),
+	}
+	return &hover{Contents: markupContent{Kind: "markdown", Value: s.builtinMarkdown(name)}, Range: &r}
+}
+
+// builtinMarkdown returns the documentation for a builtin, falling back
+// to its arity when the spec does not cover it
+func (s *Server) builtinMarkdown(name string) string {
+	if doc, ok := s.docs[name]; ok {
+		return doc.Markdown
+	}
+	minArgs, maxArgs, ok := s.registry.Arity(name)
+	switch {
+	case !ok:
+		return fmt.Sprintf("`%s()` is a builtin function.", name)
+	case maxArgs < 0:
+		return fmt.Sprintf("`%s()` takes at least %d arguments.", name, minArgs)
+	case minArgs == maxArgs:
+		return fmt.Sprintf("`%s()` takes %d arguments.", name, minArgs)
+	default:
+		return fmt.Sprintf("`%s()` takes %d to %d arguments.", name, minArgs, maxArgs)
+	}
+}
+
+// completion offers what can follow the text before pos: properties of
+// #0 after "$", properties or verbs of a known object after "." or ":",
+// and builtin names anywhere else
+func (s *Server) completion(uri string, pos position) []completionItem {
+	text := s.files[uri]
+	off := offsetAt(text, pos)
+	toks := tokenize(text[:off])
+	i := len(toks) - 1
+	prefix := ""
+	if i >= 0 && toks[i].Type == parser.TOKEN_IDENTIFIER && tokenEnd(toks[i]) == off {
+		prefix = toks[i].Value
+		i--
+	}
+
+	var items []completionItem
+	switch tokenType(toks, i) {
+	case parser.TOKEN_DOLLAR:
+		items = append(s.propertyItems(0, false), s.verbItems(0)...)
+	case parser.TOKEN_DOT:
+		if obj, ok := s.receiver(uri, toks, i-1); ok {
+			items = s.propertyItems(obj, true)
+		}
+	case parser.TOKEN_COLON:
+		if obj, ok := s.receiver(uri, toks, i-1); ok {
+			items = s.verbItems(obj)
+		}
+	case parser.TOKEN_STRING, parser.TOKEN_ERROR:
+		// Inside a string, or at the end of one
+	default:
+		for _, name := range s.registry.Names() {
+			detail := ""
+			if doc, ok := s.docs[name]; ok {
+				detail = doc.Signature
+			}
+			items = append(items, completionItem{Label: name, Kind: kindFunction, Detail: detail})
+		}
+	}
+
+	matches := []completionItem{}
+	for _, item := range items {
+		if strings.HasPrefix(strings.ToLower(item.Label), strings.ToLower(prefix)) {
+			matches = append(matches, item)
+		}
+	}
+	return matches
+}
+
+// receiver resolves the object named by the tokens ending at toks[i]:
+// an object number, "this", or a "$" property holding an object
+func (s *Server) receiver(uri string, toks []parser.Token, i int) (types.ObjID, bool) {
+	switch tokenType(toks, i) {
+	case parser.TOKEN_OBJECT:
+		var n int64
+		if _, err := fmt.Sscanf(toks[i].Value, "#%d", &n); err != nil {
+			return 0, false
+		}
+		return types.ObjID(n), true
+	case parser.TOKEN_IDENTIFIER:
+		if tokenType(toks, i-1) == parser.TOKEN_DOLLAR {
+			return s.sysObject(toks[i].Value)
+		}
+		if strings.EqualFold(toks[i].Value, "this") {
+			return verbForURI(uri)
+		}
+	}
+	return 0, false
+}
+
+// sysObject returns the object held in a property of #0
+func (s *Server) sysObject(name string) (types.ObjID, bool) {
+	sys := s.store.Get(0)
+	if sys == nil {
+		return 0, false
+	}
+	prop, ok := sys.Properties[name]
+	if !ok {
+		return 0, false
+	}
+	obj, ok := prop.Value.(types.ObjValue)
+	if !ok {
+		return 0, false
+	}
+	return obj.ID(), true
+}
+
+// propertyItems lists the properties of id, each with the ancestor that
+// defines it, and the builtin properties if builtin is set
+func (s *Server) propertyItems(id types.ObjID, builtin bool) []completionItem {
+	definer := make(map[string]types.ObjID)
+	var names []string
+	for _, obj := range lint.Ancestry(s.store, id) {
+		for name := range obj.Properties {
+			if _, ok := definer[name]; !ok {
+				names = append(names, name)
+			}
+			// Objects carry copies of inherited properties; the farthest
+			// ancestor with one defines it
+			definer[name] = obj.ID
+		}
+	}
+	sort.Strings(names)
+
+	var items []completionItem
+	for _, name := range names {
+		items = append(items, completionItem{Label: name, Kind: kindProperty, Detail: fmt.Sprintf("#%d.%s", definer[name], name)})
+	}
+	if builtin {
+		for _, name := range lint.BuiltinProperties {
+			if _, ok := definer[name]; !ok {
+				items = append(items, completionItem{Label: name, Kind: kindProperty, Detail: "builtin property"})
+			}
+		}
+	}
+	return items
+}
+
+// verbItems lists the verbs callable on id by name, nearest definition
+// first. A name's "*" is dropped; names that are not identifiers cannot
+// follow ":" and are left out.
+func (s *Server) verbItems(id types.ObjID) []completionItem {
+	seen := make(map[string]bool)
+	var items []completionItem
+	for _, obj := range lint.Ancestry(s.store, id) {
+		for _, verb := range obj.VerbList {
+			for _, alias := range verb.Names {
+				name := strings.ReplaceAll(alias, "*", "")
+				if !isIdentifier(name) || seen[name] {
+					continue
+				}
+				seen[name] = true
+				items = append(items, completionItem{Label: name, Kind: kindMethod, Detail: fmt.Sprintf("#%d:%s", obj.ID, lint.VerbName(verb))})
+			}
+		}
+	}
+	return items
+}
+
+// definition finds the verb called at pos, as "obj:verb(...)" or
+// "$verb(...)", by looking it up the way the server would
+func (s *Server) definition(uri string, pos position) *location {
+	text := s.files[uri]
+	toks := tokenize(text)
+	i := identAt(toks, offsetAt(text, pos))
+	if i < 0 {
+		return nil
+	}
+	var obj types.ObjID
+	switch {
+	case tokenType(toks, i-1) == parser.TOKEN_COLON:
+		var ok bool
+		if obj, ok = s.receiver(uri, toks, i-2); !ok {
+			return nil
+		}
+	case tokenType(toks, i-1) == parser.TOKEN_DOLLAR && tokenType(toks, i+1) == parser.TOKEN_LPAREN:
+		obj = 0
+	default:
+		return nil
+	}
+	verb, definer, err := s.store.FindVerb(obj, toks[i].Value)
+	if err != nil || verb == nil {
+		return nil
+	}
+	target, err := s.verbFile(uri, definer, verb)
+	if err != nil {
+		log.Printf("LSP definition: %v", err)
+		return nil
+	}
+	return &location{URI: target}
+}
+
+// verbFile returns the URI of a file holding verb: "#definer:verb.moo",
+// or its escaped name (see verbFileName), next to the document if there is
+// one, otherwise a copy of the verb's code written to CacheDir
+func (s *Server) verbFile(uri string, definer types.ObjID, verb *db.Verb) (string, error) {
+	plain := fmt.Sprintf("#%d:%s.moo", definer, lint.VerbName(verb))
+	name := verbFileName(definer, lint.VerbName(verb))
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		for _, sibling := range []string{plain, name} {
+			sibling = path.Join(path.Dir(u.Path), sibling)
+			if _, err := os.Stat(sibling); err == nil {
+				return fileURI(sibling), nil
+			}
+		}
+	}
+	if err := os.MkdirAll(s.CacheDir, 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(s.CacheDir, name)
+	if err := os.WriteFile(file, []byte(strings.Join(verb.Code, "\n")+"\n"), 0644); err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return fileURI(filepath.ToSlash(abs)), nil
+}
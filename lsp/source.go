@@ -0,0 +1,127 @@
+package lsp
+
+import (
+	"barn/parser"
+	"barn/types"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// offsetAt converts an LSP position in text to a byte offset, clamped to
+// the line it names
+func offsetAt(text string, pos position) int {
+	off := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[off:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		off += i + 1
+	}
+	for units := 0; off < len(text) && text[off] != '\n' && units < pos.Character; {
+		r, size := utf8.DecodeRuneInString(text[off:])
+		units += utf16.RuneLen(r)
+		off += size
+	}
+	return off
+}
+
+// positionAt converts a byte offset in text to an LSP position
+func positionAt(text string, off int) position {
+	off = min(off, len(text))
+	start := strings.LastIndexByte(text[:off], '\n') + 1
+	units := 0
+	for _, r := range text[start:off] {
+		units += utf16.RuneLen(r)
+	}
+	return position{Line: strings.Count(text[:off], "\n"), Character: units}
+}
+
+// tokenize lexes text up to EOF. Code being edited rarely parses, but it
+// nearly always lexes.
+func tokenize(text string) []parser.Token {
+	lexer := parser.NewLexer(text)
+	var toks []parser.Token
+	for len(toks) <= len(text) {
+		tok := lexer.NextToken()
+		if tok.Type == parser.TOKEN_EOF {
+			break
+		}
+		toks = append(toks, tok)
+	}
+	return toks
+}
+
+// tokenEnd returns the offset just past tok
+func tokenEnd(tok parser.Token) int {
+	return tok.Position.Offset + len(tok.Value)
+}
+
+// identAt returns the index of the identifier token at off, or -1
+func identAt(toks []parser.Token, off int) int {
+	for i, tok := range toks {
+		if tok.Position.Offset > off {
+			break
+		}
+		if tok.Type == parser.TOKEN_IDENTIFIER && off <= tokenEnd(tok) {
+			return i
+		}
+	}
+	return -1
+}
+
+// tokenType returns the type of toks[i], or TOKEN_EOF out of range
+func tokenType(toks []parser.Token, i int) parser.TokenType {
+	if i < 0 || i >= len(toks) {
+		return parser.TOKEN_EOF
+	}
+	return toks[i].Type
+}
+
+// verbForURI returns the object a document's verb is on, from a file
+// named "#obj:verb" with an optional ".moo" suffix, or as verbFileName
+// escapes it
+func verbForURI(uri string) (types.ObjID, bool) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return 0, false
+	}
+	name := strings.TrimSuffix(path.Base(u.Path), ".moo")
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	obj, verb, ok := strings.Cut(strings.TrimPrefix(name, "#"), ":")
+	if !ok || verb == "" || !strings.HasPrefix(name, "#") {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(obj, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return types.ObjID(n), true
+}
+
+// verbFileName returns the name of a file holding verb on obj:
+// "#obj:verb.moo" with '%' and every character Windows does not allow in a
+// file name percent-escaped, so "#2:l*ook" is "#2%3Al%2Aook.moo"
+func verbFileName(obj types.ObjID, verb string) string {
+	var b strings.Builder
+	for _, c := range []byte(fmt.Sprintf("#%d:%s", obj, verb)) {
+		if c < ' ' || strings.IndexByte(`%<>:"/\|?*`, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String() + ".moo"
+}
+
+// fileURI returns the file URI for an absolute path
+func fileURI(p string) string {
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
@@ -211,6 +211,17 @@ type MapPair struct {
 func (e *MapExpr) Position() Position { return e.Pos }
 func (e *MapExpr) exprNode()          {}
 
+// LambdaExpr represents an anonymous function: {params} => body
+// Params take the same forms as scatter targets.
+type LambdaExpr struct {
+	Pos    Position
+	Params []ScatterTarget
+	Body   Expr
+}
+
+func (e *LambdaExpr) Position() Position { return e.Pos }
+func (e *LambdaExpr) exprNode()          {}
+
 // Statement AST nodes
 
 // ExprStmt represents an expression used as a statement
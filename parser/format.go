@@ -0,0 +1,16 @@
+package parser
+
+// Format parses MOO source and returns it in canonical form: one
+// statement per line, two spaces of indentation per block and single
+// spaces around binary operators. Comments are string statements, so they
+// are kept; blank lines and the original spacing are not.
+//
+// Formatting is idempotent, and the result parses to the same tree as the
+// source, so it compiles to the same bytecode.
+func Format(source string) ([]string, error) {
+	stmts, err := NewParser(source).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	return UnparseProgram(stmts), nil
+}
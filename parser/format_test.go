@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"barn/types"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"x=1+2*3;", "x = 1 + 2 * 3;"},
+		{"if(x>1&&!y)z=x^2^3;else z=(x^2)^3;endif",
+			"if (x > 1 && !y)\n  z = x ^ 2 ^ 3;\nelse\n  z = (x ^ 2) ^ 3;\nendif"},
+		{"\"a comment\";\n\n\nreturn;", "\"a comment\";\nreturn;"},
+		{"for a,b in (args) for i in [1..$] endfor endfor",
+			"for a, b in (args)\n  for i in [1..$]\n  endfor\nendfor"},
+		{"while loop (1) break; continue loop; endwhile", "while loop (1)\n  break;\n  continue loop;\nendwhile"},
+		{"fork t (0) #0:foo(@args); endfork", "fork t (0)\n  $foo(@args);\nendfork"},
+		{"try x=#0.bar; except e (E_PROPNF,E_PERM) ; except (ANY) finally return; endtry",
+			"try\n  x = $bar;\nexcept e (E_PROPNF, E_PERM)\n  ;\nexcept (ANY)\nfinally\n  return;\nendtry"},
+		{"y=`x.(p)!ANY=>0';z=`o:(v)()!E_TYPE';", "y = `x.(p) ! ANY => 0';\nz = `o:(v)() ! E_TYPE';"},
+		{"{a,?b=5,@c}={1,2|.3&.4^.~5};", "{a, ?b = 5, @c} = {1, 2 |. 3 &. 4 ^. ~5};"},
+		{"return -(-5)- -3- - 4;", "return -(-5) - -3 - - 4;"},
+		{`return ["a\"b" -> 1.0, "c\\" -> {1..2}][x ? y | z];`, `return ["a\"b" -> 1.0, "c\\" -> {1..2}][x ? y | z];`},
+		{"return a[1][2..3].b:c(d) in e;", "return a[1][2..3].b:c(d) in e;"},
+		{"f={x,?y=x+1,@r}=>x+y;return {map(l,{a}=>{a}),({}=>0)}=={};", "f = {x, ?y = x + 1, @r} => x + y;\nreturn {map(l, {a} => {a}), ({} => 0)} == {};"},
+	}
+	for _, tt := range tests {
+		lines, err := Format(tt.src)
+		if err != nil {
+			t.Errorf("Format(%q): %v", tt.src, err)
+			continue
+		}
+		if got := strings.Join(lines, "\n"); got != tt.want {
+			t.Errorf("Format(%q) =\n%s\nwant\n%s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// TestFormatIdempotent formats trees the unparser has to parenthesize
+// itself and checks the output formats to itself
+func TestFormatIdempotent(t *testing.T) {
+	sources := []string{
+		"return (a = b) + 1;",
+		"return (a ? b | c) ? d | e;",
+		"return a ? b | (c ? d | e);",
+		"return -(x ^ 2) + (-x) ^ 2;",
+		"return (1 + 2) * 3 - (4 - 5);",
+		"return `(a || b) ! ANY => (c ? d | e)';",
+		"return {@(a ? b | c), -(1)};",
+		"x[1] = y.z = {1, 2};",
+	}
+	for _, src := range sources {
+		once, err := Format(src)
+		if err != nil {
+			t.Errorf("Format(%q): %v", src, err)
+			continue
+		}
+		twice, err := Format(strings.Join(once, "\n"))
+		if err != nil {
+			t.Errorf("Format(%q) produced unparseable %q: %v", src, once, err)
+			continue
+		}
+		if strings.Join(once, "\n") != strings.Join(twice, "\n") || strings.Join(once, "\n") != src {
+			t.Errorf("Format(%q) = %q, then %q", src, once, twice)
+		}
+	}
+}
+
+// TestUnparseParenthesizes checks the unparser adds the parentheses a
+// tree built without ParenExpr nodes needs
+func TestUnparseParenthesizes(t *testing.T) {
+	sum := &BinaryExpr{Left: &IdentifierExpr{Name: "a"}, Operator: TOKEN_PLUS, Right: &IdentifierExpr{Name: "b"}}
+	stmts := []Stmt{
+		&ExprStmt{Expr: &BinaryExpr{Left: sum, Operator: TOKEN_STAR, Right: sum}},
+		&ExprStmt{Expr: &BinaryExpr{Left: &IdentifierExpr{Name: "c"}, Operator: TOKEN_MINUS, Right: sum}},
+		&ExprStmt{Expr: &UnaryExpr{Operator: TOKEN_MINUS, Operand: &LiteralExpr{Value: types.NewInt(5)}}},
+		&ExprStmt{Expr: &IndexExpr{Expr: &UnaryExpr{Operator: TOKEN_NOT, Operand: &IdentifierExpr{Name: "x"}}, Index: sum}},
+	}
+	want := "(a + b) * (a + b);\nc - (a + b);\n- 5;\n(!x)[a + b];"
+	if got := strings.Join(UnparseProgram(stmts), "\n"); got != want {
+		t.Errorf("UnparseProgram =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -30,6 +30,12 @@ func (p *Parser) nextToken() {
 	p.peek = p.lexer.NextToken()
 }
 
+// Pos returns the position of the token the parser is looking at. After
+// ParseProgram fails, that is where the error was found.
+func (p *Parser) Pos() Position {
+	return p.current.Position
+}
+
 // ParseLiteral parses a literal value
 func (p *Parser) ParseLiteral() (types.Value, error) {
 	switch p.current.Type {
@@ -162,6 +168,15 @@ func (p *Parser) ParseExpression(prec int) (Expr, error) {
 		}
 
 	case TOKEN_LBRACE:
+		// Parse lambda: {params} => body
+		lambda, err := p.tryParseLambda()
+		if err != nil {
+			return nil, err
+		}
+		if lambda != nil {
+			left = lambda
+			break
+		}
 		// Parse list expression: {expr, expr, ...}
 		// Uses ListExpr to support sub-expressions including splice (@)
 		left, err = p.parseListExpr()
@@ -610,6 +625,15 @@ func (p *Parser) ParseExpression(prec int) (Expr, error) {
 	return left, err
 }
 
+// anyErrorCodes are the codes ANY stands for in a catch expression
+var anyErrorCodes = []types.ErrorCode{
+	types.E_NONE, types.E_TYPE, types.E_DIV, types.E_PERM,
+	types.E_PROPNF, types.E_VERBNF, types.E_VARNF, types.E_INVIND,
+	types.E_RECMOVE, types.E_MAXREC, types.E_RANGE, types.E_ARGS,
+	types.E_NACC, types.E_INVARG, types.E_QUOTA, types.E_FLOAT,
+	types.E_FILE, types.E_EXEC,
+}
+
 // parseCatchCodes parses error codes in a catch expression
 // Supports: ANY, single error (E_TYPE), or comma-separated list (E_TYPE, E_RANGE)
 func (p *Parser) parseCatchCodes() ([]types.ErrorCode, error) {
@@ -617,13 +641,7 @@ func (p *Parser) parseCatchCodes() ([]types.ErrorCode, error) {
 	if p.current.Type == TOKEN_IDENTIFIER && p.current.Value == "ANY" {
 		p.nextToken()
 		// Return all error codes
-		return []types.ErrorCode{
-			types.E_NONE, types.E_TYPE, types.E_DIV, types.E_PERM,
-			types.E_PROPNF, types.E_VERBNF, types.E_VARNF, types.E_INVIND,
-			types.E_RECMOVE, types.E_MAXREC, types.E_RANGE, types.E_ARGS,
-			types.E_NACC, types.E_INVARG, types.E_QUOTA, types.E_FLOAT,
-			types.E_FILE, types.E_EXEC,
-		}, nil
+		return append([]types.ErrorCode(nil), anyErrorCodes...), nil
 	}
 
 	// Parse comma-separated list of error codes
@@ -771,6 +789,57 @@ func (p *Parser) parseListExpr() (Expr, error) {
 	return &ListExpr{Pos: pos, Elements: elements}, nil
 }
 
+// tryParseLambda parses a lambda if one starts at the current '{'. A
+// parameter list reads the same as the start of a list, so it is only a
+// lambda once "} =>" follows; otherwise the parser is rewound and nil
+// returned.
+func (p *Parser) tryParseLambda() (*LambdaExpr, error) {
+	switch p.peek.Type {
+	case TOKEN_IDENTIFIER, TOKEN_QUESTION, TOKEN_AT, TOKEN_RBRACE:
+	default:
+		return nil, nil
+	}
+	pos := p.current.Position
+	lexer, current, peek := *p.lexer, p.current, p.peek
+	params, err := p.parseLambdaParams()
+	if err != nil {
+		*p.lexer, p.current, p.peek = lexer, current, peek
+		return nil, nil
+	}
+
+	body, err := p.ParseExpression(PREC_LOWEST)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lambda body: %w", err)
+	}
+	return &LambdaExpr{Pos: pos, Params: params, Body: body}, nil
+}
+
+// parseLambdaParams parses "{params} =>"
+func (p *Parser) parseLambdaParams() ([]ScatterTarget, error) {
+	p.nextToken() // skip '{'
+
+	var params []ScatterTarget
+	for p.current.Type != TOKEN_RBRACE {
+		param, err := p.parseScatterTarget()
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, param)
+		if p.current.Type == TOKEN_COMMA {
+			p.nextToken() // skip ','
+		} else if p.current.Type != TOKEN_RBRACE {
+			return nil, fmt.Errorf("expected ',' or '}' in lambda parameters")
+		}
+	}
+	p.nextToken() // skip '}'
+
+	if p.current.Type != TOKEN_FATARROW {
+		return nil, fmt.Errorf("expected '=>' after lambda parameters")
+	}
+	p.nextToken() // skip '=>'
+	return params, nil
+}
+
 // parseMapExpr parses a map expression: [key -> value, ...]
 // Unlike parseMapLiteral, this allows full expressions
 func (p *Parser) parseMapExpr() (*MapExpr, error) {
@@ -2,434 +2,300 @@ package parser
 
 import (
 	"barn/types"
-	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 )
 
-// Operator precedence levels (higher = tighter binding)
-const (
-	precedenceLowest = iota
-	precedenceAssign      // =
-	precedenceTernary     // ? |
-	precedenceOr          // ||
-	precedenceAnd         // &&
-	precedenceBitOr       // |
-	precedenceBitXor      // ^
-	precedenceBitAnd      // &
-	precedenceEquality    // == !=
-	precedenceComparison  // < <= > >= in
-	precedenceShift       // << >>
-	precedenceAdditive    // + -
-	precedenceMultiply    // * / %
-	precedenceExponent    // ^
-	precedenceUnary       // - ! ~
-	precedenceProperty    // . : [] (highest - property access, verb call, index)
-)
+// precPrimary is the precedence of expressions that never need
+// parentheses: literals, variables, lists, maps and bracketed forms
+const precPrimary = PREC_POSTFIX + 1
 
-// UnparseProgram converts AST statements back to source code lines
+// UnparseProgram converts AST statements back to source code lines,
+// indenting two spaces per block.
+//
+// Parentheses come from ParenExpr nodes; others are only added where the
+// parser would otherwise read the tree differently, so unparsing a parsed
+// program and parsing the result gives the same tree back.
 func UnparseProgram(stmts []Stmt) []string {
-	if len(stmts) == 0 {
-		return []string{}
-	}
+	u := &unparser{lines: []string{}}
+	u.block(stmts, 0)
+	return u.lines
+}
+
+type unparser struct {
+	lines []string
+}
+
+func (u *unparser) line(indent int, text string) {
+	u.lines = append(u.lines, strings.Repeat("  ", indent)+text)
+}
 
-	var lines []string
+func (u *unparser) block(stmts []Stmt, indent int) {
 	for _, stmt := range stmts {
-		line := unparseStmt(stmt, 0)
-		lines = append(lines, line)
+		u.stmt(stmt, indent)
 	}
-	return lines
 }
 
-// unparseStmt converts a statement to source code
-func unparseStmt(stmt Stmt, indent int) string {
-	indentStr := strings.Repeat("  ", indent)
-
+// stmt appends the lines of one statement
+func (u *unparser) stmt(stmt Stmt, indent int) {
 	switch s := stmt.(type) {
 	case *ExprStmt:
-		return indentStr + unparseExpr(s.Expr, precedenceLowest) + ";"
+		if s.Expr == nil {
+			u.line(indent, ";")
+			return
+		}
+		u.line(indent, unparseExpr(s.Expr, PREC_LOWEST)+";")
 
 	case *ReturnStmt:
 		if s.Value == nil {
-			return indentStr + "return;"
+			u.line(indent, "return;")
+			return
 		}
-		return indentStr + "return " + unparseExpr(s.Value, precedenceLowest) + ";"
+		u.line(indent, "return "+unparseExpr(s.Value, PREC_LOWEST)+";")
 
 	case *IfStmt:
-		var sb strings.Builder
-		sb.WriteString(indentStr + "if (" + unparseExpr(s.Condition, precedenceLowest) + ")\n")
-		for _, bodyStmt := range s.Body {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-		}
-		for _, elseif := range s.ElseIfs {
-			sb.WriteString(indentStr + "elseif (" + unparseExpr(elseif.Condition, precedenceLowest) + ")\n")
-			for _, bodyStmt := range elseif.Body {
-				sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-			}
+		u.line(indent, "if ("+unparseExpr(s.Condition, PREC_LOWEST)+")")
+		u.block(s.Body, indent+1)
+		for _, clause := range s.ElseIfs {
+			u.line(indent, "elseif ("+unparseExpr(clause.Condition, PREC_LOWEST)+")")
+			u.block(clause.Body, indent+1)
 		}
 		if len(s.Else) > 0 {
-			sb.WriteString(indentStr + "else\n")
-			for _, bodyStmt := range s.Else {
-				sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-			}
+			u.line(indent, "else")
+			u.block(s.Else, indent+1)
 		}
-		sb.WriteString(indentStr + "endif")
-		return strings.TrimSuffix(sb.String(), "\n")
+		u.line(indent, "endif")
 
 	case *WhileStmt:
-		var sb strings.Builder
+		head := "while "
 		if s.Label != "" {
-			sb.WriteString(indentStr + "while " + s.Label + " (" + unparseExpr(s.Condition, precedenceLowest) + ")\n")
-		} else {
-			sb.WriteString(indentStr + "while (" + unparseExpr(s.Condition, precedenceLowest) + ")\n")
-		}
-		for _, bodyStmt := range s.Body {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
+			head += s.Label + " "
 		}
-		sb.WriteString(indentStr + "endwhile")
-		return strings.TrimSuffix(sb.String(), "\n")
+		u.line(indent, head+"("+unparseExpr(s.Condition, PREC_LOWEST)+")")
+		u.block(s.Body, indent+1)
+		u.line(indent, "endwhile")
 
 	case *ForStmt:
-		var sb strings.Builder
-		sb.WriteString(indentStr + "for ")
+		head := "for "
 		if s.Label != "" {
-			sb.WriteString(s.Label + " ")
+			head += s.Label + " "
 		}
+		head += s.Value
 		if s.Index != "" {
-			sb.WriteString(s.Value + " in [" + s.Index + ".." + strconv.Itoa(len(s.Body)) + "]\n")
-		} else if s.Container != nil {
-			sb.WriteString(s.Value + " in (" + unparseExpr(s.Container, precedenceLowest) + ")\n")
-		} else {
-			// Range loop
-			sb.WriteString(s.Value + " in [" + unparseExpr(s.RangeStart, precedenceLowest) + ".." + unparseExpr(s.RangeEnd, precedenceLowest) + "]\n")
+			head += ", " + s.Index
 		}
-		for _, bodyStmt := range s.Body {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
+		if s.Container != nil {
+			head += " in (" + unparseExpr(s.Container, PREC_LOWEST) + ")"
+		} else {
+			head += " in [" + unparseExpr(s.RangeStart, PREC_LOWEST) + ".." + unparseExpr(s.RangeEnd, PREC_LOWEST) + "]"
 		}
-		sb.WriteString(indentStr + "endfor")
-		return strings.TrimSuffix(sb.String(), "\n")
+		u.line(indent, head)
+		u.block(s.Body, indent+1)
+		u.line(indent, "endfor")
 
 	case *BreakStmt:
-		if s.Value != nil {
-			return indentStr + "break " + unparseExpr(s.Value, precedenceLowest) + ";"
-		}
-		if s.Label != "" {
-			return indentStr + "break " + s.Label + ";"
+		switch {
+		case s.Value != nil:
+			u.line(indent, "break "+unparseExpr(s.Value, PREC_LOWEST)+";")
+		case s.Label != "":
+			u.line(indent, "break "+s.Label+";")
+		default:
+			u.line(indent, "break;")
 		}
-		return indentStr + "break;"
 
 	case *ContinueStmt:
 		if s.Label != "" {
-			return indentStr + "continue " + s.Label + ";"
+			u.line(indent, "continue "+s.Label+";")
+			return
 		}
-		return indentStr + "continue;"
+		u.line(indent, "continue;")
 
 	case *TryExceptStmt:
-		var sb strings.Builder
-		sb.WriteString(indentStr + "try\n")
-		for _, bodyStmt := range s.Body {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-		}
-		for _, except := range s.Excepts {
-			sb.WriteString(indentStr + "except ")
-			if except.Variable != "" {
-				sb.WriteString(except.Variable + " ")
-			}
-			sb.WriteString("(")
-			if except.IsAny {
-				sb.WriteString("ANY")
-			} else {
-				for i, code := range except.Codes {
-					if i > 0 {
-						sb.WriteString(", ")
-					}
-					sb.WriteString(code.String())
-				}
-			}
-			sb.WriteString(")\n")
-			for _, bodyStmt := range except.Body {
-				sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-			}
-		}
-		sb.WriteString(indentStr + "endtry")
-		return strings.TrimSuffix(sb.String(), "\n")
+		u.try(s.Body, s.Excepts, nil, indent)
 
 	case *TryFinallyStmt:
-		var sb strings.Builder
-		sb.WriteString(indentStr + "try\n")
-		for _, bodyStmt := range s.Body {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-		}
-		sb.WriteString(indentStr + "finally\n")
-		for _, bodyStmt := range s.Finally {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-		}
-		sb.WriteString(indentStr + "endtry")
-		return strings.TrimSuffix(sb.String(), "\n")
+		u.try(s.Body, nil, s.Finally, indent)
 
 	case *TryExceptFinallyStmt:
-		var sb strings.Builder
-		sb.WriteString(indentStr + "try\n")
-		for _, bodyStmt := range s.Body {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-		}
-		for _, except := range s.Excepts {
-			sb.WriteString(indentStr + "except ")
-			if except.Variable != "" {
-				sb.WriteString(except.Variable + " ")
-			}
-			sb.WriteString("(")
-			if except.IsAny {
-				sb.WriteString("ANY")
-			} else {
-				for i, code := range except.Codes {
-					if i > 0 {
-						sb.WriteString(", ")
-					}
-					sb.WriteString(code.String())
-				}
-			}
-			sb.WriteString(")\n")
-			for _, bodyStmt := range except.Body {
-				sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-			}
-		}
-		sb.WriteString(indentStr + "finally\n")
-		for _, bodyStmt := range s.Finally {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
-		}
-		sb.WriteString(indentStr + "endtry")
-		return strings.TrimSuffix(sb.String(), "\n")
+		u.try(s.Body, s.Excepts, s.Finally, indent)
 
 	case *ScatterStmt:
-		var sb strings.Builder
-		sb.WriteString(indentStr + "{")
-		for i, target := range s.Targets {
-			if i > 0 {
-				sb.WriteString(", ")
-			}
-			if target.Optional {
-				sb.WriteString("?")
-			}
-			if target.Rest {
-				sb.WriteString("@")
-			}
-			sb.WriteString(target.Name)
-			if target.Default != nil {
-				sb.WriteString(" = " + unparseExpr(target.Default, precedenceLowest))
-			}
-		}
-		sb.WriteString("} = " + unparseExpr(s.Value, precedenceLowest) + ";")
-		return sb.String()
+		u.line(indent, unparseTargets(s.Targets)+" = "+unparseExpr(s.Value, PREC_LOWEST)+";")
 
 	case *ForkStmt:
-		var sb strings.Builder
-		sb.WriteString(indentStr + "fork ")
+		head := "fork "
 		if s.VarName != "" {
-			sb.WriteString(s.VarName + " ")
-		}
-		sb.WriteString("(" + unparseExpr(s.Delay, precedenceLowest) + ")\n")
-		for _, bodyStmt := range s.Body {
-			sb.WriteString(unparseStmt(bodyStmt, indent+1) + "\n")
+			head += s.VarName + " "
 		}
-		sb.WriteString(indentStr + "endfork")
-		return strings.TrimSuffix(sb.String(), "\n")
+		u.line(indent, head+"("+unparseExpr(s.Delay, PREC_LOWEST)+")")
+		u.block(s.Body, indent+1)
+		u.line(indent, "endfork")
 
 	default:
-		return indentStr + fmt.Sprintf("<unknown statement: %T>", stmt)
+		u.line(indent, "<unknown statement>;")
+	}
+}
+
+// try appends a try statement; a nil finally means there is none
+func (u *unparser) try(body []Stmt, excepts []*ExceptClause, finally []Stmt, indent int) {
+	u.line(indent, "try")
+	u.block(body, indent+1)
+	for _, except := range excepts {
+		head := "except "
+		if except.Variable != "" {
+			head += except.Variable + " "
+		}
+		codes := "ANY"
+		if !except.IsAny {
+			codes = unparseCodes(except.Codes)
+		}
+		u.line(indent, head+"("+codes+")")
+		u.block(except.Body, indent+1)
+	}
+	if finally != nil || len(excepts) == 0 {
+		u.line(indent, "finally")
+		u.block(finally, indent+1)
 	}
+	u.line(indent, "endtry")
+}
+
+// UnparseExpr converts an expression back to source code
+func UnparseExpr(expr Expr) string {
+	return unparseExpr(expr, PREC_LOWEST)
 }
 
-// unparseExpr converts an expression to source code
-func unparseExpr(expr Expr, parentPrecedence int) string {
+// unparseExpr converts an expression to source code, parenthesized if the
+// parser would not accept it where the minimum precedence is prec
+func unparseExpr(expr Expr, prec int) string {
+	text, exprPrec := unparseNode(expr)
+	if exprPrec < prec {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// unparseNode returns an expression's source and the precedence it binds
+// with, using the parser's precedence levels
+func unparseNode(expr Expr) (string, int) {
 	switch e := expr.(type) {
 	case *LiteralExpr:
-		return unparseLiteral(e.Value)
+		return unparseLiteral(e.Value), precPrimary
 
 	case *IdentifierExpr:
-		return e.Name
+		return e.Name, precPrimary
 
 	case *UnaryExpr:
+		operand := unparseExpr(e.Operand, PREC_UNARY)
 		op := unparseUnaryOp(e.Operator)
-		operand := unparseExpr(e.Operand, precedenceUnary)
-		return op + operand
+		// -5 would lex as a negative literal rather than negation
+		if e.Operator == TOKEN_MINUS && operand != "" && operand[0] >= '0' && operand[0] <= '9' {
+			op += " "
+		}
+		return op + operand, PREC_UNARY
 
 	case *BinaryExpr:
-		return unparseBinaryExpr(e, parentPrecedence)
+		prec := precedence(e.Operator)
+		leftPrec, rightPrec := prec, prec+1
+		if e.Operator == TOKEN_CARET {
+			// Exponentiation is right-associative
+			leftPrec, rightPrec = prec+1, prec
+		}
+		return unparseExpr(e.Left, leftPrec) + " " + unparseBinaryOp(e.Operator) + " " + unparseExpr(e.Right, rightPrec), prec
 
 	case *TernaryExpr:
-		prec := precedenceTernary
-		cond := unparseExpr(e.Condition, prec)
-		then := unparseExpr(e.ThenExpr, prec)
-		els := unparseExpr(e.ElseExpr, prec)
-		result := cond + " ? " + then + " | " + els
-		if prec < parentPrecedence {
-			return "(" + result + ")"
-		}
-		return result
+		return unparseExpr(e.Condition, PREC_TERNARY+1) + " ? " + unparseExpr(e.ThenExpr, PREC_LOWEST) +
+			" | " + unparseExpr(e.ElseExpr, PREC_TERNARY), PREC_TERNARY
 
 	case *ParenExpr:
-		return "(" + unparseExpr(e.Expr, precedenceLowest) + ")"
+		return "(" + unparseExpr(e.Expr, PREC_LOWEST) + ")", precPrimary
 
 	case *IndexMarkerExpr:
 		if e.Marker == TOKEN_CARET {
-			return "^"
+			return "^", precPrimary
 		}
-		return "$"
+		return "$", precPrimary
 
 	case *IndexExpr:
-		base := unparseExpr(e.Expr, precedenceProperty)
-		index := unparseExpr(e.Index, precedenceLowest)
-		return base + "[" + index + "]"
+		return unparseExpr(e.Expr, PREC_POSTFIX) + "[" + unparseExpr(e.Index, PREC_LOWEST) + "]", PREC_POSTFIX
 
 	case *RangeExpr:
-		base := unparseExpr(e.Expr, precedenceProperty)
-		start := unparseExpr(e.Start, precedenceLowest)
-		end := unparseExpr(e.End, precedenceLowest)
-		// NO spaces around ..
-		return base + "[" + start + ".." + end + "]"
+		return unparseExpr(e.Expr, PREC_POSTFIX) + "[" + unparseExpr(e.Start, PREC_LOWEST) + ".." +
+			unparseExpr(e.End, PREC_LOWEST) + "]", PREC_POSTFIX
 
 	case *PropertyExpr:
-		return unparsePropertyExpr(e)
+		if e.Property != "" && isSystemObject(e.Expr) {
+			return "$" + e.Property, PREC_POSTFIX
+		}
+		base := unparseExpr(e.Expr, PREC_POSTFIX)
+		if e.Property != "" {
+			return base + "." + e.Property, PREC_POSTFIX
+		}
+		return base + ".(" + unparseExpr(e.PropertyExpr, PREC_LOWEST) + ")", PREC_POSTFIX
 
 	case *VerbCallExpr:
-		base := unparseExpr(e.Expr, precedenceProperty)
-		var verb string
+		args := "(" + unparseArgs(e.Args) + ")"
+		if e.Verb != "" && isSystemObject(e.Expr) {
+			return "$" + e.Verb + args, PREC_POSTFIX
+		}
+		base := unparseExpr(e.Expr, PREC_POSTFIX)
 		if e.Verb != "" {
-			verb = e.Verb
-		} else {
-			verb = "(" + unparseExpr(e.VerbExpr, precedenceLowest) + ")"
+			return base + ":" + e.Verb + args, PREC_POSTFIX
 		}
-		args := unparseArgs(e.Args)
-		return base + ":" + verb + "(" + args + ")"
+		return base + ":(" + unparseExpr(e.VerbExpr, PREC_LOWEST) + ")" + args, PREC_POSTFIX
 
 	case *BuiltinCallExpr:
-		args := unparseArgs(e.Args)
-		return e.Name + "(" + args + ")"
+		return e.Name + "(" + unparseArgs(e.Args) + ")", PREC_POSTFIX
 
 	case *SpliceExpr:
-		return "@" + unparseExpr(e.Expr, precedenceUnary)
+		return "@" + unparseExpr(e.Expr, PREC_TERNARY), PREC_TERNARY
 
 	case *CatchExpr:
-		result := unparseExpr(e.Expr, precedenceTernary)
-		result += " `! "
-		if len(e.Codes) == 0 {
-			result += "ANY"
+		text := "`" + unparseExpr(e.Expr, PREC_ASSIGNMENT) + " ! "
+		if slices.Equal(e.Codes, anyErrorCodes) {
+			text += "ANY"
 		} else {
-			for i, code := range e.Codes {
-				if i > 0 {
-					result += ", "
-				}
-				result += code.String()
-			}
+			text += unparseCodes(e.Codes)
 		}
 		if e.Default != nil {
-			result += " => " + unparseExpr(e.Default, precedenceTernary)
+			text += " => " + unparseExpr(e.Default, PREC_CATCH)
 		}
-		return result
+		return text + "'", precPrimary
 
 	case *AssignExpr:
-		prec := precedenceAssign
-		target := unparseExpr(e.Target, prec)
-		value := unparseExpr(e.Value, prec)
-		result := target + " = " + value
-		if prec < parentPrecedence {
-			return "(" + result + ")"
-		}
-		return result
+		return unparseExpr(e.Target, PREC_ASSIGNMENT+1) + " = " + unparseExpr(e.Value, PREC_ASSIGNMENT), PREC_ASSIGNMENT
 
 	case *ListExpr:
-		var elements []string
-		for _, elem := range e.Elements {
-			elements = append(elements, unparseExpr(elem, precedenceLowest))
-		}
-		return "{" + strings.Join(elements, ", ") + "}"
+		return "{" + unparseArgs(e.Elements) + "}", precPrimary
 
 	case *ListRangeExpr:
-		start := unparseExpr(e.Start, precedenceLowest)
-		end := unparseExpr(e.End, precedenceLowest)
-		return "{" + start + ".." + end + "}"
+		return "{" + unparseExpr(e.Start, PREC_LOWEST) + ".." + unparseExpr(e.End, PREC_LOWEST) + "}", precPrimary
 
 	case *MapExpr:
-		var pairs []string
-		for _, pair := range e.Pairs {
-			key := unparseExpr(pair.Key, precedenceLowest)
-			val := unparseExpr(pair.Value, precedenceLowest)
-			pairs = append(pairs, key+" -> "+val)
+		pairs := make([]string, len(e.Pairs))
+		for i, pair := range e.Pairs {
+			pairs[i] = unparseExpr(pair.Key, PREC_LOWEST) + " -> " + unparseExpr(pair.Value, PREC_LOWEST)
 		}
-		return "[" + strings.Join(pairs, ", ") + "]"
-
-	default:
-		return fmt.Sprintf("<unknown expr: %T>", expr)
-	}
-}
+		return "[" + strings.Join(pairs, ", ") + "]", precPrimary
 
-// unparsePropertyExpr handles property access with #0.prop → $prop conversion
-func unparsePropertyExpr(e *PropertyExpr) string {
-	// Check if base is #0 (system object)
-	if lit, ok := e.Expr.(*LiteralExpr); ok {
-		if obj, ok := lit.Value.(types.ObjValue); ok {
-			if obj.ID() == 0 {
-				// Use $property syntax for system object
-				return "$" + e.Property
-			}
-		}
-	}
+	case *LambdaExpr:
+		// Like an assignment, the body extends as far right as it can
+		return unparseTargets(e.Params) + " => " + unparseExpr(e.Body, PREC_LOWEST), PREC_ASSIGNMENT
 
-	// Otherwise use obj.property syntax
-	base := unparseExpr(e.Expr, precedenceProperty)
-	if e.Property != "" {
-		return base + "." + e.Property
+	default:
+		return "<unknown expr>", precPrimary
 	}
-	// Dynamic property
-	return base + ".(" + unparseExpr(e.PropertyExpr, precedenceLowest) + ")"
 }
 
-// unparseBinaryExpr handles binary expressions with proper precedence
-func unparseBinaryExpr(e *BinaryExpr, parentPrecedence int) string {
-	prec := binaryPrecedence(e.Operator)
-	left := unparseExpr(e.Left, prec)
-	right := unparseExpr(e.Right, prec+1) // Right-associative for same precedence
-	op := unparseBinaryOp(e.Operator)
-
-	result := left + " " + op + " " + right
-
-	if prec < parentPrecedence {
-		return "(" + result + ")"
-	}
-	return result
-}
-
-// binaryPrecedence returns the precedence level for a binary operator
-func binaryPrecedence(op TokenType) int {
-	switch op {
-	case TOKEN_ASSIGN:
-		return precedenceAssign
-	case TOKEN_OR:
-		return precedenceOr
-	case TOKEN_AND:
-		return precedenceAnd
-	case TOKEN_BITOR:
-		return precedenceBitOr
-	case TOKEN_BITXOR:
-		return precedenceBitXor
-	case TOKEN_BITAND:
-		return precedenceBitAnd
-	case TOKEN_EQ, TOKEN_NE:
-		return precedenceEquality
-	case TOKEN_LT, TOKEN_LE, TOKEN_GT, TOKEN_GE, TOKEN_IN:
-		return precedenceComparison
-	case TOKEN_LSHIFT, TOKEN_RSHIFT:
-		return precedenceShift
-	case TOKEN_PLUS, TOKEN_MINUS:
-		return precedenceAdditive
-	case TOKEN_STAR, TOKEN_SLASH, TOKEN_PERCENT:
-		return precedenceMultiply
-	case TOKEN_CARET:
-		return precedenceExponent
-	default:
-		return precedenceLowest
+// isSystemObject reports whether expr is the literal #0, which $name
+// abbreviates
+func isSystemObject(expr Expr) bool {
+	lit, ok := expr.(*LiteralExpr)
+	if !ok {
+		return false
 	}
+	obj, ok := lit.Value.(types.ObjValue)
+	return ok && obj.ID() == 0
 }
 
 // unparseBinaryOp converts a token type to its string representation
@@ -464,11 +330,11 @@ func unparseBinaryOp(op TokenType) string {
 	case TOKEN_OR:
 		return "||"
 	case TOKEN_BITAND:
-		return "&"
+		return "&."
 	case TOKEN_BITOR:
-		return "|"
+		return "|."
 	case TOKEN_BITXOR:
-		return "^"
+		return "^."
 	case TOKEN_LSHIFT:
 		return "<<"
 	case TOKEN_RSHIFT:
@@ -498,14 +364,14 @@ func unparseUnaryOp(op TokenType) string {
 func unparseLiteral(v types.Value) string {
 	switch val := v.(type) {
 	case types.IntValue:
-		return strconv.Itoa(int(val.Val))
+		return strconv.FormatInt(val.Val, 10)
 	case types.FloatValue:
-		return fmt.Sprintf("%g", val.Val)
+		// Always has a decimal point or exponent, so it reads back as a float
+		return val.String()
 	case types.StrValue:
-		// Need proper string escaping
-		return strconv.Quote(val.Value())
+		return quoteString(val.Value())
 	case types.ObjValue:
-		return fmt.Sprintf("#%d", val.ID())
+		return "#" + strconv.FormatInt(int64(val.ID()), 10)
 	case types.ErrValue:
 		return val.Code().String()
 	default:
@@ -513,14 +379,56 @@ func unparseLiteral(v types.Value) string {
 	}
 }
 
+// quoteString quotes s as a MOO string literal. The lexer only gives
+// backslash a meaning before the next character, so only quotes and
+// backslashes are escaped.
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// unparseCodes lists error codes for except clauses and catch expressions
+func unparseCodes(codes []types.ErrorCode) string {
+	names := make([]string, len(codes))
+	for i, code := range codes {
+		names[i] = code.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// unparseTargets converts scatter targets or lambda parameters to
+// "{a, ?b = 1, @c}"
+func unparseTargets(targets []ScatterTarget) string {
+	parts := make([]string, len(targets))
+	for i, target := range targets {
+		switch {
+		case target.Rest:
+			parts[i] = "@" + target.Name
+		case target.Optional:
+			parts[i] = "?" + target.Name
+			if target.Default != nil {
+				parts[i] += " = " + unparseExpr(target.Default, PREC_LOWEST)
+			}
+		default:
+			parts[i] = target.Name
+		}
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
 // unparseArgs converts argument expressions to a comma-separated string
 func unparseArgs(args []Expr) string {
-	if len(args) == 0 {
-		return ""
-	}
-	var parts []string
-	for _, arg := range args {
-		parts = append(parts, unparseExpr(arg, precedenceLowest))
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = unparseExpr(arg, PREC_LOWEST)
 	}
 	return strings.Join(parts, ", ")
 }
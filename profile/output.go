@@ -0,0 +1,195 @@
+package profile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Output formats accepted by Write
+const (
+	FormatPprof  = "pprof"
+	FormatFolded = "folded"
+)
+
+// String returns the frame as "#definer:verb"
+func (f Frame) String() string {
+	return fmt.Sprintf("#%d:%s", f.Definer, f.Verb)
+}
+
+// Write writes the collected profile in the given format
+func Write(w io.Writer, format string) error {
+	switch format {
+	case FormatPprof, "":
+		return WritePprof(w)
+	case FormatFolded:
+		return WriteFolded(w)
+	default:
+		return fmt.Errorf("unknown profile format %q (want %s or %s)", format, FormatPprof, FormatFolded)
+	}
+}
+
+// foldedName keeps ';' (frame separator) and ' ' (end of stack) out of
+// folded frame names
+var foldedName = strings.NewReplacer(";", "_", " ", "_")
+
+// WriteFolded writes one line per call path, "#0:a;#5:b <microseconds>",
+// the input format of flamegraph.pl and most flame graph viewers
+func WriteFolded(w io.Writer) error {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	names := make([]string, 0, 16)
+	global.walk(func(stack []Frame, n *Node) {
+		us := n.time.Microseconds()
+		if us == 0 {
+			return
+		}
+		names = names[:0]
+		for _, f := range stack {
+			names = append(names, foldedName.Replace(f.String()))
+		}
+		fmt.Fprintf(bw, "%s %d\n", strings.Join(names, ";"), us)
+	})
+	return bw.Flush()
+}
+
+// WritePprof writes a gzipped pprof profile with "ticks" and "time"
+// sample values, readable by `go tool pprof`
+func WritePprof(w io.Writer) error {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	pb := &pprofBuilder{strings: map[string]int64{"": 0}, stringTable: []string{""}, functions: map[Frame]uint64{}}
+	var body protoBuf
+
+	for _, st := range [][2]string{{"ticks", "count"}, {"time", "nanoseconds"}} {
+		var vt protoBuf
+		vt.int(1, pb.str(st[0]))
+		vt.int(2, pb.str(st[1]))
+		body.bytes(1, vt)
+	}
+
+	global.walk(func(stack []Frame, n *Node) {
+		if n.ticks == 0 && n.time == 0 {
+			return
+		}
+		var sample protoBuf
+		// Locations are listed leaf first
+		ids := make([]uint64, len(stack))
+		for i, f := range stack {
+			ids[len(stack)-1-i] = pb.function(f)
+		}
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{uint64(n.ticks), uint64(n.time.Nanoseconds())})
+		body.bytes(2, sample)
+	})
+
+	// One location per function, with the same ID
+	for id := uint64(1); id <= uint64(len(pb.frames)); id++ {
+		var line protoBuf
+		line.int(1, int64(id))
+		var loc protoBuf
+		loc.int(1, int64(id))
+		loc.bytes(4, line)
+		body.bytes(4, loc)
+	}
+	for i, f := range pb.frames {
+		var fn protoBuf
+		fn.int(1, int64(i+1))
+		fn.int(2, pb.str(f.String()))
+		fn.int(3, pb.str(f.String()))
+		fn.int(4, pb.str(fmt.Sprintf("#%d", f.Definer)))
+		body.bytes(5, fn)
+	}
+	for _, s := range pb.stringTable {
+		body.string(6, s)
+	}
+	body.int(9, global.started.UnixNano())
+	elapsed := global.elapsed
+	if running.Load() {
+		elapsed += time.Since(global.started)
+	}
+	body.int(10, elapsed.Nanoseconds())
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(body); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// pprofBuilder interns strings and functions for WritePprof
+type pprofBuilder struct {
+	strings     map[string]int64
+	stringTable []string
+	functions   map[Frame]uint64
+	frames      []Frame
+}
+
+func (pb *pprofBuilder) str(s string) int64 {
+	if i, ok := pb.strings[s]; ok {
+		return i
+	}
+	i := int64(len(pb.stringTable))
+	pb.strings[s] = i
+	pb.stringTable = append(pb.stringTable, s)
+	return i
+}
+
+func (pb *pprofBuilder) function(f Frame) uint64 {
+	if id, ok := pb.functions[f]; ok {
+		return id
+	}
+	pb.frames = append(pb.frames, f)
+	id := uint64(len(pb.frames))
+	pb.functions[f] = id
+	return id
+}
+
+// protoBuf encodes the few protobuf wire types profile.proto needs
+type protoBuf []byte
+
+func (b *protoBuf) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuf) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// int writes a varint field, omitting zero as proto3 does
+func (b *protoBuf) int(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(uint64(v))
+}
+
+func (b *protoBuf) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+// string writes a string field; repeated strings keep empty entries
+func (b *protoBuf) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protoBuf) packed(field int, vs []uint64) {
+	var inner protoBuf
+	for _, v := range vs {
+		inner.varint(v)
+	}
+	b.bytes(field, inner)
+}
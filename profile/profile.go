@@ -0,0 +1,326 @@
+// Package profile attributes VM execution cost to verbs.
+//
+// The profiler is process-wide and off by default. While it is running,
+// every VM step charges its ticks and wall time to the verb that executed
+// it (and optionally to the source line), and builtin calls charge their
+// time separately. Samples are kept in a call tree so the data can be
+// written as folded stacks or a pprof profile.
+package profile
+
+import (
+	"barn/types"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Frame identifies a profiled function: a verb and the object defining it
+type Frame struct {
+	Definer types.ObjID
+	Verb    string
+}
+
+// Node is one call path in the profile's call tree. VM frames cache their
+// node; a node from before the last Reset is no longer Current.
+type Node struct {
+	parent   *Node
+	frame    Frame
+	children map[Frame]*Node
+	gen      int64
+
+	ticks int64
+	time  time.Duration
+}
+
+// LineStats is the cost charged to one source line
+type LineStats struct {
+	Ticks int64
+	Time  time.Duration
+}
+
+// VerbStats is the cost charged to one verb
+type VerbStats struct {
+	Frame
+	Calls       int64
+	Ticks       int64         // Ticks executed in the verb itself
+	SelfTime    time.Duration // Time in the verb itself, including builtins it called
+	TotalTime   time.Duration // SelfTime plus time in the verbs it called
+	BuiltinTime time.Duration // Part of SelfTime spent inside builtin functions
+	Lines       map[int]*LineStats
+}
+
+// BuiltinStats is the cost of one builtin function across all callers
+type BuiltinStats struct {
+	Name  string
+	Calls int64
+	Time  time.Duration
+}
+
+// Snapshot is a copy of the profiler's counters
+type Snapshot struct {
+	Running  bool
+	Lines    bool
+	Elapsed  time.Duration // Time spent running since the last Reset
+	Verbs    []VerbStats   // Sorted by SelfTime, highest first
+	Builtins []BuiltinStats
+}
+
+// profiler is the global profiler state
+type profiler struct {
+	mu       sync.Mutex
+	root     *Node
+	gen      int64
+	verbs    map[Frame]*VerbStats
+	builtins map[string]*BuiltinStats
+	started  time.Time     // Start of the current running period
+	elapsed  time.Duration // Completed running periods
+}
+
+var (
+	running atomic.Bool
+	lines   atomic.Bool
+	global  = newProfiler()
+)
+
+func newProfiler() *profiler {
+	p := &profiler{}
+	p.resetLocked()
+	return p
+}
+
+func (p *profiler) resetLocked() {
+	p.gen++
+	p.root = &Node{gen: p.gen}
+	p.verbs = make(map[Frame]*VerbStats)
+	p.builtins = make(map[string]*BuiltinStats)
+	p.elapsed = 0
+	p.started = time.Now()
+}
+
+// Enabled reports whether the profiler is collecting samples
+func Enabled() bool {
+	return running.Load()
+}
+
+// LinesEnabled reports whether samples are also charged to source lines
+func LinesEnabled() bool {
+	return lines.Load()
+}
+
+// Start begins (or continues) collecting; perLine also charges source lines
+func Start(perLine bool) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	if !running.Load() {
+		global.started = time.Now()
+	}
+	lines.Store(perLine)
+	running.Store(true)
+}
+
+// Stop pauses collecting; the counters are kept until Reset
+func Stop() {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	if running.Load() {
+		global.elapsed += time.Since(global.started)
+	}
+	running.Store(false)
+}
+
+// Reset discards all collected samples
+func Reset() {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	global.resetLocked()
+}
+
+// Current reports whether n belongs to the profile being collected
+func Current(n *Node) bool {
+	if n == nil {
+		return false
+	}
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	return n.gen == global.gen
+}
+
+// Enter returns the node for a call to frame from parent (nil for the
+// bottom of a task's stack) and counts the call
+func Enter(parent *Node, frame Frame) *Node {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	if parent == nil || parent.gen != global.gen {
+		parent = global.root
+	}
+	child := parent.children[frame]
+	if child == nil {
+		child = &Node{parent: parent, frame: frame, gen: global.gen}
+		if parent.children == nil {
+			parent.children = make(map[Frame]*Node)
+		}
+		parent.children[frame] = child
+	}
+	global.verbLocked(frame).Calls++
+	return child
+}
+
+// Step charges one VM step to n and, when line > 0, to that source line
+func Step(n *Node, line int, ticks int64, d time.Duration) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	if n.gen != global.gen {
+		return
+	}
+
+	n.ticks += ticks
+	n.time += d
+	vs := global.verbLocked(n.frame)
+	vs.Ticks += ticks
+	vs.SelfTime += d
+	if line > 0 {
+		if vs.Lines == nil {
+			vs.Lines = make(map[int]*LineStats)
+		}
+		ls := vs.Lines[line]
+		if ls == nil {
+			ls = &LineStats{}
+			vs.Lines[line] = ls
+		}
+		ls.Ticks += ticks
+		ls.Time += d
+	}
+}
+
+// Builtin charges a builtin call made from n
+func Builtin(n *Node, name string, d time.Duration) {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+	if n.gen != global.gen {
+		return
+	}
+
+	global.verbLocked(n.frame).BuiltinTime += d
+	bs := global.builtins[name]
+	if bs == nil {
+		bs = &BuiltinStats{Name: name}
+		global.builtins[name] = bs
+	}
+	bs.Calls++
+	bs.Time += d
+}
+
+// verbLocked returns the stats entry for frame; the caller holds p.mu
+func (p *profiler) verbLocked(frame Frame) *VerbStats {
+	vs := p.verbs[frame]
+	if vs == nil {
+		vs = &VerbStats{Frame: frame}
+		p.verbs[frame] = vs
+	}
+	return vs
+}
+
+// Stats returns a copy of the current counters
+func Stats() Snapshot {
+	global.mu.Lock()
+	defer global.mu.Unlock()
+
+	snap := Snapshot{
+		Running: running.Load(),
+		Lines:   lines.Load(),
+		Elapsed: global.elapsed,
+	}
+	if snap.Running {
+		snap.Elapsed += time.Since(global.started)
+	}
+
+	total := make(map[Frame]time.Duration)
+	global.root.totalTimes(total, make(map[Frame]int))
+
+	for _, vs := range global.verbs {
+		cp := *vs
+		cp.TotalTime = total[vs.Frame]
+		if vs.Lines != nil {
+			cp.Lines = make(map[int]*LineStats, len(vs.Lines))
+			for line, ls := range vs.Lines {
+				l := *ls
+				cp.Lines[line] = &l
+			}
+		}
+		snap.Verbs = append(snap.Verbs, cp)
+	}
+	sort.Slice(snap.Verbs, func(i, j int) bool {
+		a, b := snap.Verbs[i], snap.Verbs[j]
+		if a.SelfTime != b.SelfTime {
+			return a.SelfTime > b.SelfTime
+		}
+		if a.Definer != b.Definer {
+			return a.Definer < b.Definer
+		}
+		return a.Verb < b.Verb
+	})
+
+	for _, bs := range global.builtins {
+		snap.Builtins = append(snap.Builtins, *bs)
+	}
+	sort.Slice(snap.Builtins, func(i, j int) bool {
+		if snap.Builtins[i].Time != snap.Builtins[j].Time {
+			return snap.Builtins[i].Time > snap.Builtins[j].Time
+		}
+		return snap.Builtins[i].Name < snap.Builtins[j].Name
+	})
+	return snap
+}
+
+// totalTimes adds each node's inclusive time to its frame's total. A frame
+// that recurses is only charged at its outermost call (onStack tracks the
+// frames between the root and n). Returns n's inclusive time.
+func (n *Node) totalTimes(total map[Frame]time.Duration, onStack map[Frame]int) time.Duration {
+	inclusive := n.time
+	if n.parent != nil {
+		onStack[n.frame]++
+	}
+	for _, child := range n.children {
+		inclusive += child.totalTimes(total, onStack)
+	}
+	if n.parent != nil {
+		onStack[n.frame]--
+		if onStack[n.frame] == 0 {
+			total[n.frame] += inclusive
+		}
+	}
+	return inclusive
+}
+
+// walk calls fn for every node below the root with its stack, outermost first
+func (p *profiler) walk(fn func(stack []Frame, n *Node)) {
+	var visit func(n *Node, stack []Frame)
+	visit = func(n *Node, stack []Frame) {
+		if n.parent != nil {
+			stack = append(stack, n.frame)
+			fn(stack, n)
+		}
+		for _, child := range n.sortedChildren() {
+			visit(child, stack)
+		}
+	}
+	visit(p.root, nil)
+}
+
+// sortedChildren returns n's children in a stable order
+func (n *Node) sortedChildren() []*Node {
+	children := make([]*Node, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i].frame, children[j].frame
+		if a.Definer != b.Definer {
+			return a.Definer < b.Definer
+		}
+		return a.Verb < b.Verb
+	})
+	return children
+}
@@ -0,0 +1,83 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsChargesSelfAndTotalTime(t *testing.T) {
+	Reset()
+	Start(true)
+	defer func() {
+		Stop()
+		Reset()
+	}()
+
+	outer := Frame{Definer: 1, Verb: "outer"}
+	inner := Frame{Definer: 2, Verb: "inner"}
+
+	// outer -> inner -> outer (recursion is charged once in TotalTime)
+	a := Enter(nil, outer)
+	Step(a, 1, 1, 10*time.Millisecond)
+	b := Enter(a, inner)
+	Step(b, 3, 2, 20*time.Millisecond)
+	Builtin(b, "length", 5*time.Millisecond)
+	c := Enter(b, outer)
+	Step(c, 1, 1, 30*time.Millisecond)
+
+	byVerb := map[string]VerbStats{}
+	for _, vs := range Stats().Verbs {
+		byVerb[vs.Verb] = vs
+	}
+	o, i := byVerb["outer"], byVerb["inner"]
+	if o.Calls != 2 || o.Ticks != 2 || o.SelfTime != 40*time.Millisecond || o.TotalTime != 60*time.Millisecond {
+		t.Errorf("outer = %+v", o)
+	}
+	if i.Calls != 1 || i.Ticks != 2 || i.SelfTime != 20*time.Millisecond || i.TotalTime != 50*time.Millisecond || i.BuiltinTime != 5*time.Millisecond {
+		t.Errorf("inner = %+v", i)
+	}
+	if ls := o.Lines[1]; ls == nil || ls.Ticks != 2 {
+		t.Errorf("outer line 1 = %+v", ls)
+	}
+
+	var folded bytes.Buffer
+	if err := WriteFolded(&folded); err != nil {
+		t.Fatal(err)
+	}
+	want := "#1:outer 10000\n#1:outer;#2:inner 20000\n#1:outer;#2:inner;#1:outer 30000\n"
+	if folded.String() != want {
+		t.Errorf("folded output:\n%s\nwant:\n%s", folded.String(), want)
+	}
+
+	var pprof bytes.Buffer
+	if err := WritePprof(&pprof); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&pprof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"ticks", "nanoseconds", "#1:outer", "#2:inner"} {
+		if !strings.Contains(string(raw), s) {
+			t.Errorf("pprof string table is missing %q", s)
+		}
+	}
+
+	// Nodes from before a reset are no longer charged
+	Reset()
+	if Current(a) {
+		t.Error("node survived Reset")
+	}
+	Step(a, 1, 1, time.Second)
+	if verbs := Stats().Verbs; len(verbs) != 0 {
+		t.Errorf("after reset, verbs = %+v", verbs)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"barn/builtins"
 	"barn/db"
+	"barn/debug"
 	"barn/parser"
 	"barn/task"
 	"barn/trace"
@@ -40,6 +41,9 @@ type Scheduler struct {
 	store       *db.Store
 	connManager *ConnectionManager
 	inputQueue  chan InputEvent
+	calls       chan func()   // Functions to run on the scheduler goroutine (see Do)
+	gc          *vm.Collector // Anonymous object and waif collector, stepped between tasks
+	running     atomic.Int32  // Task VMs running on the Go stack; the collector waits for none
 	mu          sync.Mutex
 	ctx         context.Context
 	cancel      context.CancelFunc
@@ -58,6 +62,7 @@ func NewScheduler(store *db.Store) *Scheduler {
 		registry:   vm.BuildVMRegistry(store),
 		store:      store,
 		inputQueue: make(chan InputEvent, 256),
+		calls:      make(chan func()),
 		ctx:        ctx,
 		cancel:     cancel,
 	}
@@ -75,6 +80,9 @@ func NewScheduler(store *db.Store) *Scheduler {
 		return s.CallVerb(objID, verbName, args, player)
 	})
 
+	s.gc = vm.NewCollector(store, s.registry, s.gcTasks)
+	s.registry.SetGarbageCollector(s.gc)
+
 	return s
 }
 
@@ -106,6 +114,22 @@ func (s *Scheduler) EnqueueInput(evt InputEvent) {
 	s.inputQueue <- evt
 }
 
+// Do runs fn on the scheduler goroutine, between tasks, and waits for it
+// to finish. Other goroutines use it to touch MOO state safely. Returns
+// without running fn once the scheduler has stopped.
+func (s *Scheduler) Do(fn func()) {
+	done := make(chan struct{})
+	select {
+	case s.calls <- func() { defer close(done); fn() }:
+	case <-s.ctx.Done():
+		return
+	}
+	select {
+	case <-done:
+	case <-s.ctx.Done():
+	}
+}
+
 // run is the main scheduler loop
 func (s *Scheduler) run() {
 	defer s.wg.Done()
@@ -119,8 +143,11 @@ func (s *Scheduler) run() {
 			return
 		case input := <-s.inputQueue:
 			s.processInput(input)
+		case fn := <-s.calls:
+			fn()
 		case <-ticker.C:
 			s.processReadyTasks()
+			s.collectGarbage(0)
 		}
 	}
 }
@@ -470,6 +497,7 @@ func (s *Scheduler) executeVerbTaskSync(player types.ObjID, match *VerbMatch, cm
 	if err != nil {
 		log.Printf("Task %d (#%d:%s) error: %v", t.ID, t.This, t.VerbName, err)
 	}
+	s.collectGarbage(0)
 
 	// Flush output buffer for the player
 	if s.connManager != nil {
@@ -905,6 +933,7 @@ func (s *Scheduler) processReadyTasks() {
 		if err != nil {
 			log.Printf("Task %d (#%d:%s) error: %v", t.ID, t.This, t.VerbName, err)
 		}
+		s.collectGarbage(0)
 
 		// Flush output buffer for the player
 		if s.connManager != nil {
@@ -926,6 +955,9 @@ func (s *Scheduler) processReadyTasks() {
 
 // runTask executes a task's code using the bytecode VM
 func (s *Scheduler) runTask(t *task.Task) (retErr error) {
+	s.running.Add(1)
+	defer s.running.Add(-1)
+
 	// Recover from panics to avoid crashing the server
 	defer func() {
 		if r := recover(); r != nil {
@@ -967,14 +999,22 @@ func (s *Scheduler) runTask(t *task.Task) (retErr error) {
 		}
 		// Attach task context (may have been updated since VM was created)
 		bcVM.Context = ctx
+		bcVM.Debuggable = true
 		if bcVM.IsYielded() {
-			// If this task was read()-suspended, deliver the input line
-			if t.WakeValue != nil {
-				bcVM.SetResumeValue(t.WakeValue)
-				t.WakeValue = nil // Consume — don't leak into future suspends
+			if e := t.WakeError; e != nil {
+				// A threaded builtin's background work failed: raise its
+				// error where the builtin was called
+				t.WakeError = nil
+				result = bcVM.ResumeWithError(e.Error, e.Val)
+			} else {
+				// If this task was read()-suspended, deliver the input line
+				if t.WakeValue != nil {
+					bcVM.SetResumeValue(t.WakeValue)
+					t.WakeValue = nil // Consume — don't leak into future suspends
+				}
+				// Resume after suspend
+				result = bcVM.Resume()
 			}
-			// Resume after suspend
-			result = bcVM.Resume()
 		} else {
 			// First run for forked child task (VM was pre-configured by CreateForkedTask)
 			result = bcVM.ExecuteLoop()
@@ -1019,6 +1059,7 @@ func (s *Scheduler) runTask(t *task.Task) (retErr error) {
 		bcVM = vm.NewVM(s.store, s.registry)
 		bcVM.Context = ctx
 		bcVM.TickLimit = t.TicksLimit
+		bcVM.Debuggable = true
 
 		if t.VerbName != "" {
 			// Convert string args to Value list for verb context
@@ -1100,14 +1141,45 @@ func (s *Scheduler) runTask(t *task.Task) (retErr error) {
 		t.SetState(task.TaskCompleted)
 	}
 
-	// Match Toast lifecycle semantics: orphan anonymous objects are collected
-	// when a task completes (locals and stack references are gone).
-	vm.AutoRecycleOrphanAnonymousSince(s.store, s.registry, ctx, anonGCFloor)
+	// Match Toast lifecycle semantics: anonymous objects the task made and
+	// dropped are recycled as soon as it completes, not at the next cycle
+	if s.store.AnonymousSince(anonGCFloor) {
+		s.gc.Request()
+	}
 
+	debug.Forget(t.ID)
 	t.BytecodeVM = nil // Release VM after completion
 	return nil
 }
 
+// collectGarbage steps the collector unless more than own task VMs are
+// running: the collector can't see the variables of a VM that is still on
+// the Go stack. Callers that are themselves running a task's VM pass 1.
+func (s *Scheduler) collectGarbage(own int32) {
+	if s.running.Load() > own {
+		return
+	}
+	s.gc.Step()
+}
+
+// gcTasks returns every task the collector must keep values for
+func (s *Scheduler) gcTasks() []*task.Task {
+	seen := make(map[*task.Task]bool)
+	var tasks []*task.Task
+	s.mu.Lock()
+	for _, t := range s.tasks {
+		seen[t] = true
+		tasks = append(tasks, t)
+	}
+	s.mu.Unlock()
+	for _, t := range task.GetManager().GetAllTasks() {
+		if !seen[t] {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
 // QueueTask adds a task to the scheduler
 func (s *Scheduler) QueueTask(t *task.Task) int64 {
 	s.mu.Lock()
@@ -1309,6 +1381,9 @@ func (s *Scheduler) CallVerb(objID types.ObjID, verbName string, args []types.Va
 		}
 	}()
 
+	s.running.Add(1)
+	defer s.running.Add(-1)
+
 	// Trace verb call
 	trace.VerbCall(objID, verbName, args, player, player)
 
@@ -1454,6 +1529,8 @@ func (s *Scheduler) EvalCommand(player types.ObjID, code string, conn interface{
 			log.Printf("PANIC in EvalCommand: %v", r)
 		}
 	}()
+	s.running.Add(1)
+	defer s.running.Add(-1)
 
 	// Parse the code
 	p := parser.NewParser(code)
@@ -1602,9 +1679,12 @@ func (s *Scheduler) EvalCommand(player types.ObjID, code string, conn interface{
 		result = bcVM.Resume()
 	}
 
-	// Match Toast lifecycle semantics for eval: orphan anonymous objects are
-	// collected once evaluation completes and locals are out of scope.
-	vm.AutoRecycleOrphanAnonymousSince(s.store, s.registry, ctx, anonGCFloor)
+	// Match Toast lifecycle semantics for eval: anonymous objects it dropped
+	// are recycled once evaluation completes and locals are out of scope
+	if s.store.AnonymousSince(anonGCFloor) {
+		s.gc.Request()
+	}
+	s.collectGarbage(1)
 
 	// Send result wrapped with prefix/suffix in ToastStunt eval format:
 	// Success: {1, value}
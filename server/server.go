@@ -3,6 +3,7 @@ package server
 import (
 	"barn/builtins"
 	"barn/db"
+	"barn/debug"
 	"barn/parser"
 	"barn/vm"
 	"context"
@@ -18,7 +19,7 @@ import (
 // Server represents the MOO server
 type Server struct {
 	store              *db.Store
-	database           *db.Database
+	backend            db.Backend
 	scheduler          *Scheduler
 	connManager        *ConnectionManager
 	dbPath             string
@@ -47,15 +48,23 @@ func NewServer(dbPath string, port int, checkpointIntervalSec int) (*Server, err
 	}, nil
 }
 
+// SetBackend selects the storage backend used to load and checkpoint the
+// database. Without one, the server uses a textdump at dbPath.
+func (s *Server) SetBackend(backend db.Backend) {
+	s.backend = backend
+}
+
 // LoadDatabase loads the database from disk
 func (s *Server) LoadDatabase() error {
-	database, err := db.LoadDatabase(s.dbPath)
+	if s.backend == nil {
+		s.backend = db.NewTextdumpBackend(s.dbPath)
+	}
+	store, err := s.backend.Load()
 	if err != nil {
 		return fmt.Errorf("load database: %w", err)
 	}
 
-	s.database = database
-	s.store = database.NewStoreFromDatabase()
+	s.store = store
 	s.scheduler = NewScheduler(s.store)
 	s.connManager = NewConnectionManager(s, s.port)
 
@@ -71,7 +80,22 @@ func (s *Server) LoadDatabase() error {
 	// Wire dump_database() builtin to server checkpoint
 	builtins.SetDumpFunc(func() error { return s.checkpoint() })
 
-	log.Printf("Loaded database version %d with %d objects", database.Version, len(database.Objects))
+	// Cache $server_options (value limits, max_stack_depth) as LambdaMOO does at startup
+	builtins.LoadServerOptionsFromStore(s.store)
+
+	log.Printf("Loaded database %s (max object #%d)", s.backend.Path(), store.MaxObject())
+	return nil
+}
+
+// ServeDebugAdapter starts a Debug Adapter Protocol server for the MOO
+// debugger on a loopback port. Call after LoadDatabase.
+func (s *Server) ServeDebugAdapter(port int) error {
+	dap, err := debug.ListenDAP(fmt.Sprintf("127.0.0.1:%d", port), s.store, s.scheduler.Do)
+	if err != nil {
+		return err
+	}
+	log.Printf("Debug adapter listening on %s", dap.Addr())
+	go dap.Serve()
 	return nil
 }
 
@@ -175,37 +199,9 @@ func (s *Server) checkpoint() error {
 
 	start := time.Now()
 
-	// Write to temp file
-	tempPath := s.dbPath + ".tmp"
-	tempFile, err := os.Create(tempPath)
-	if err != nil {
-		s.callCheckpointFinished(false)
-		return fmt.Errorf("create temp file: %w", err)
-	}
-
-	writer := db.NewWriter(tempFile, s.store)
-	writer.SetTaskSource(s.scheduler) // Provide tasks for serialization
-	if err := writer.WriteDatabase(); err != nil {
-		tempFile.Close()
-		os.Remove(tempPath)
-		s.callCheckpointFinished(false)
-		return fmt.Errorf("write database: %w", err)
-	}
-
-	if err := tempFile.Close(); err != nil {
-		os.Remove(tempPath)
+	if err := s.backend.Save(s.store, s.scheduler); err != nil {
 		s.callCheckpointFinished(false)
-		return fmt.Errorf("close temp file: %w", err)
-	}
-
-	// Atomic rename temp -> main database
-	if err := os.Rename(tempPath, s.dbPath); err != nil {
-		// On Windows, need to remove dest first
-		os.Remove(s.dbPath)
-		if err := os.Rename(tempPath, s.dbPath); err != nil {
-			s.callCheckpointFinished(false)
-			return fmt.Errorf("rename temp to main: %w", err)
-		}
+		return err
 	}
 
 	// Call #0:checkpoint_finished(success)
@@ -251,6 +247,9 @@ func (s *Server) shutdown() error {
 	} else {
 		log.Println("Final checkpoint skipped (checkpointing disabled)")
 	}
+	if err := s.backend.Close(); err != nil {
+		log.Printf("Warning: close database: %v", err)
+	}
 
 	s.mu.Lock()
 	s.running = false
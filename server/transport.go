@@ -1,6 +1,7 @@
 package server
 
 import (
+	"barn/types"
 	"bufio"
 	"errors"
 	"io"
@@ -18,6 +19,8 @@ const (
 	tnWILL = 251
 	tnSB   = 250 // Subnegotiation Begin
 	tnSE   = 240 // Subnegotiation End
+
+	tnOptBinary = 0 // TRANSMIT-BINARY option (RFC 856)
 )
 
 // Telnet state machine states, matching ToastStunt's implementation
@@ -47,6 +50,9 @@ type TCPTransport struct {
 	mu          sync.Mutex
 	tState      telnetState
 	lastWasCR   bool
+	tCmd        byte // WILL/WONT/DO/DONT awaiting its option byte
+	binaryIn    bool // Client agreed to send 8-bit data
+	binaryOut   bool // We agreed to send 8-bit data
 }
 
 // NewTCPTransport creates a new TCP transport from a net.Conn
@@ -112,6 +118,7 @@ func (t *TCPTransport) ReadLine() (string, error) {
 				t.tState = telnetStateSubneg
 			} else if b == tnWILL || b == tnWONT || b == tnDO || b == tnDONT {
 				// Two-byte command (WILL/WONT/DO/DONT + option byte)
+				t.tCmd = b
 				t.tState = telnetStateCommand
 			} else {
 				// Unknown command byte - consume and return to normal
@@ -122,6 +129,11 @@ func (t *TCPTransport) ReadLine() (string, error) {
 			// This is the option byte after WILL/WONT/DO/DONT - consume it
 			// and return to normal state
 			t.tState = telnetStateNormal
+			if b == tnOptBinary && types.UnicodeStrings() {
+				if err := t.negotiateBinary(t.tCmd); err != nil {
+					return "", err
+				}
+			}
 
 		case telnetStateSubneg:
 			// Inside subnegotiation - consume bytes until IAC SE
@@ -145,6 +157,34 @@ func (t *TCPTransport) ReadLine() (string, error) {
 	}
 }
 
+// negotiateBinary answers a client's request about TRANSMIT-BINARY. In
+// unicode string mode we agree to it both ways, so clients send and
+// accept UTF-8 unmodified. Only changes of state are answered, so the
+// negotiation can't loop (RFC 854).
+func (t *TCPTransport) negotiateBinary(cmd byte) error {
+	var reply byte
+	switch {
+	case cmd == tnDO && !t.binaryOut:
+		t.binaryOut, reply = true, tnWILL
+	case cmd == tnDONT && t.binaryOut:
+		t.binaryOut, reply = false, tnWONT
+	case cmd == tnWILL && !t.binaryIn:
+		t.binaryIn, reply = true, tnDO
+	case cmd == tnWONT && t.binaryIn:
+		t.binaryIn, reply = false, tnDONT
+	default:
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := t.writer.Write([]byte{tnIAC, reply, tnOptBinary}); err != nil {
+		return err
+	}
+	return t.writer.Flush()
+}
+
 // WriteLine writes a line to the connection with newline
 func (t *TCPTransport) WriteLine(msg string) error {
 	t.mu.Lock()
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"barn/types"
 	"bytes"
 	"io"
 	"net"
@@ -216,3 +217,44 @@ func TestReadLineOnlyIAC(t *testing.T) {
 		t.Errorf("expected empty string, got %q", line)
 	}
 }
+
+// recordingConn is a fakeConn that keeps what is written to it
+type recordingConn struct {
+	fakeConn
+	written bytes.Buffer
+}
+
+func (r *recordingConn) Write(b []byte) (int, error) { return r.written.Write(b) }
+
+func TestReadLineUTF8Binary(t *testing.T) {
+	// DO BINARY, WILL BINARY, then a UTF-8 line, then DO BINARY again
+	data := []byte{0xFF, 0xFD, 0x00, 0xFF, 0xFB, 0x00}
+	data = append(data, "héllo 日本\r\n"...)
+	data = append(data, 0xFF, 0xFD, 0x00, '\n')
+
+	for _, unicode := range []bool{false, true} {
+		types.SetUnicodeStrings(unicode)
+		conn := &recordingConn{fakeConn: fakeConn{bytes.NewReader(data)}}
+		transport := NewTCPTransport(conn)
+		line, err := transport.ReadLine()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if line != "héllo 日本" {
+			t.Errorf("unicode %v: expected UTF-8 unmodified, got %q", unicode, line)
+		}
+		if _, err := transport.ReadLine(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// Each request is answered once, and only in unicode mode
+		var want []byte
+		if unicode {
+			want = []byte{0xFF, 0xFB, 0x00, 0xFF, 0xFD, 0x00}
+		}
+		if got := conn.written.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("unicode %v: replies % X, want % X", unicode, got, want)
+		}
+	}
+	types.SetUnicodeStrings(false)
+}
@@ -148,7 +148,7 @@ func hasVerbNameOnObject(store *db.Store, objID types.ObjID, cmdVerb string) boo
 			continue
 		}
 
-		for _, verb := range obj.Verbs {
+		for _, verb := range obj.VerbList {
 			for _, name := range verb.Names {
 				if verbNameMatches(name, cmdVerb) {
 					return true
@@ -201,7 +201,7 @@ func findVerbOnObject(store *db.Store, objID types.ObjID, cmd *ParsedCommand) *V
 		}
 
 		// Check verbs on this object
-		for _, verb := range obj.Verbs {
+		for _, verb := range obj.VerbList {
 			if verbMatches(verb, cmd, objID) {
 				return &VerbMatch{
 					Verb:    verb,
@@ -67,6 +67,7 @@ type ActivationFrame struct {
 	SourceLine      string        // Source text at LineNumber (best-effort, for debugging/logging)
 	ServerInitiated bool          // True if this is a server-invoked call (do_login_command, etc.)
 	IsEvalFrame     bool          // True if this is an eval() infrastructure frame (excluded from tracebacks)
+	MemoryBytes     int64         // Bytes held by this frame's variables when the task was last measured
 }
 
 // ToList converts an activation frame to a MOO list for callers()
@@ -117,11 +118,19 @@ type Task struct {
 	CallStack    []ActivationFrame
 	TaskLocal    types.Value // Task-local storage (set_task_local/task_local)
 
+	// Memory accounting (see max_task_memory)
+	MemoryUsed   int64 // Bytes the task's values held when last measured
+	MemoryExempt bool  // A wizard exempted the task from max_task_memory
+
 	// For suspension/resumption
 	WakeTime        time.Time
-	WakeValue       types.Value  // Value to return when resumed
-	IsExecSuspended bool         // True if suspended by exec() (can't resume, only kill)
-	ReadingPlayer   types.ObjID  // Player this task is read()ing from (ObjNothing = not reading)
+	WakeValue       types.Value   // Value to return when resumed
+	WakeError       *types.Result // Exception to raise when resumed, in place of WakeValue
+	IsExecSuspended bool          // True if suspended by exec() or a threaded builtin (can't resume, only kill)
+	backgroundSince time.Time     // When a threaded builtin suspended the task
+	IsDebugPaused   bool          // True if stopped by the debugger (resumed by the debugger, not resume())
+	debugPausedAt   time.Time     // When the debugger stopped the task
+	ReadingPlayer   types.ObjID   // Player this task is read()ing from (ObjNothing = not reading)
 
 	// For forked tasks
 	ForkInfo *types.ForkInfo // Fork information (only for forked tasks)
@@ -289,6 +298,38 @@ func (t *Task) UpdateCallStackLineNumbers(lineNumbers []int) {
 	}
 }
 
+// UpdateMemoryUsage records a measurement of the task's memory: the total,
+// and the share of each frame. perFrame[0] corresponds to CallStack[0].
+func (t *Task) UpdateMemoryUsage(total int64, perFrame []int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.MemoryUsed = total
+	for i := 0; i < len(perFrame) && i < len(t.CallStack); i++ {
+		t.CallStack[i].MemoryBytes = perFrame[i]
+	}
+}
+
+// MemoryUsage returns the task's memory at its last measurement
+func (t *Task) MemoryUsage() int64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.MemoryUsed
+}
+
+// SetMemoryExempt exempts the task from max_task_memory, or ends the exemption
+func (t *Task) SetMemoryExempt(exempt bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.MemoryExempt = exempt
+}
+
+// IsMemoryExempt reports whether the task is exempt from max_task_memory
+func (t *Task) IsMemoryExempt() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.MemoryExempt
+}
+
 // TicksLeft returns remaining ticks
 func (t *Task) TicksLeft() int64 {
 	t.mu.RLock()
@@ -347,6 +388,10 @@ func (t *Task) Resume(value types.Value) bool {
 	if t.IsExecSuspended {
 		return false
 	}
+	// Debugger-paused tasks are stopped mid-instruction; only the debugger may continue them
+	if t.IsDebugPaused {
+		return false
+	}
 	t.State = TaskQueued
 	t.WakeValue = value
 	return true
@@ -368,6 +413,69 @@ func (t *Task) CompleteExec(value types.Value) bool {
 	return true
 }
 
+// SuspendBackground suspends the task while a threaded builtin runs on the
+// thread pool. Like exec(), the task can't be resumed, only killed.
+func (t *Task) SuspendBackground() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.State = TaskSuspended
+	t.IsExecSuspended = true
+	t.backgroundSince = time.Now()
+}
+
+// CompleteBackground requeues a task suspended by SuspendBackground with
+// the builtin's result: the value it returned, or the error it raised.
+// Time spent in the background does not count against the task's seconds
+// limit. Returns false if the task was killed meanwhile.
+func (t *Task) CompleteBackground(result types.Result) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.State != TaskSuspended || !t.IsExecSuspended {
+		return false
+	}
+	t.IsExecSuspended = false
+	t.StartTime = t.StartTime.Add(time.Since(t.backgroundSince))
+	t.State = TaskQueued
+	if result.Flow == types.FlowException {
+		t.WakeValue, t.WakeError = nil, &result
+	} else {
+		t.WakeValue, t.WakeError = result.Val, nil
+	}
+	return true
+}
+
+// PauseDebug suspends the task indefinitely at a debugger stop
+func (t *Task) PauseDebug() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.State = TaskSuspended
+	t.IsDebugPaused = true
+	t.debugPausedAt = time.Now()
+}
+
+// ContinueDebug requeues a debugger-paused task. Time spent paused does not
+// count against the task's seconds limit. Returns false if the task is not
+// paused (e.g. it was killed meanwhile).
+func (t *Task) ContinueDebug() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.State != TaskSuspended || !t.IsDebugPaused {
+		return false
+	}
+	t.IsDebugPaused = false
+	t.StartTime = t.StartTime.Add(time.Since(t.debugPausedAt))
+	t.State = TaskQueued
+	t.WakeValue = nil
+	return true
+}
+
+// DebugPaused reports whether the task is stopped by the debugger
+func (t *Task) DebugPaused() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.State == TaskSuspended && t.IsDebugPaused
+}
+
 // WakeDue reports whether a suspended task has a timed wake deadline due.
 func (t *Task) WakeDue(now time.Time) bool {
 	t.mu.RLock()
@@ -386,6 +494,7 @@ func (t *Task) Kill() {
 		t.ExecCancelFunc = nil
 	}
 	t.IsExecSuspended = false
+	t.IsDebugPaused = false
 }
 
 // ToQueuedTaskInfo returns task info for queued_tasks()
@@ -418,8 +527,8 @@ func (t *Task) ToQueuedTaskInfo() types.Value {
 		thisObj = t.This
 	}
 
-	// Estimate bytes (0 for now, can be calculated later if needed)
-	bytes := int64(0)
+	// Bytes held by the task's values when it last stopped running
+	bytes := t.MemoryUsed
 
 	return types.NewList([]types.Value{
 		types.NewInt(t.ID),               // [1] task_id
@@ -0,0 +1,86 @@
+package types
+
+// LambdaValue represents a MOO anonymous function: {params} => expr
+// A lambda holds its compiled body and a copy of the variables of the
+// verb that made it, so it can be called after that verb returns. Lambdas
+// only live in running tasks; they cannot be stored in properties.
+type LambdaValue struct {
+	fn *lambdaFunc
+}
+
+type lambdaFunc struct {
+	code     any     // Compiled body, owned by the VM
+	captured []Value // Variables of the enclosing verb when the lambda was made
+	source   string  // Source text, e.g. "{x} => x + 1"
+}
+
+// NewLambda creates a lambda over a compiled body and captured variables
+func NewLambda(code any, captured []Value, source string) LambdaValue {
+	return LambdaValue{fn: &lambdaFunc{code: code, captured: captured, source: source}}
+}
+
+// Type returns TYPE_LAMBDA
+func (l LambdaValue) Type() TypeCode {
+	return TYPE_LAMBDA
+}
+
+// String returns the lambda's source text
+func (l LambdaValue) String() string {
+	return l.fn.source
+}
+
+// Equal checks if two lambdas are equal
+// Lambdas are equal only if they're the same instance (reference equality)
+func (l LambdaValue) Equal(other Value) bool {
+	otherLambda, ok := other.(LambdaValue)
+	return ok && l.fn == otherLambda.fn
+}
+
+// Truthy returns whether the lambda is truthy
+// Like objects and waifs, lambdas are never truthy
+func (l LambdaValue) Truthy() bool {
+	return false
+}
+
+// Code returns the compiled body the lambda was created with
+func (l LambdaValue) Code() any {
+	return l.fn.code
+}
+
+// Captured returns the variables the lambda closed over. Callers must
+// copy them before assigning to any.
+func (l LambdaValue) Captured() []Value {
+	return l.fn.captured
+}
+
+// ContainsLambda reports whether v is a lambda or a list or map holding
+// one, at any depth. Lists and maps count the elements holding lambdas as
+// they are built, so this never walks them.
+func ContainsLambda(v Value) bool {
+	switch v := v.(type) {
+	case LambdaValue:
+		return true
+	case ListValue:
+		return v.lambdas > 0
+	case MapValue:
+		return v.lambdas > 0
+	}
+	return false
+}
+
+// lambdaCount is 1 if v counts toward a list or map's lambdas, else 0
+func lambdaCount(v Value) int {
+	if ContainsLambda(v) {
+		return 1
+	}
+	return 0
+}
+
+// countLambdas counts the values that are or hold lambdas
+func countLambdas(vs []Value) int {
+	n := 0
+	for _, v := range vs {
+		n += lambdaCount(v)
+	}
+	return n
+}
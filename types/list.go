@@ -1,6 +1,9 @@
 package types
 
-import "strings"
+import (
+	"strings"
+	"sync/atomic"
+)
 
 // MooList abstracts list storage - allows swapping implementation later
 type MooList interface {
@@ -8,13 +11,32 @@ type MooList interface {
 	Get(index int) Value            // 1-based MOO index
 	Set(index int, v Value) MooList // Returns new list (COW)
 	Append(v Value) MooList
+	AppendAll(vs []Value) MooList
 	Slice(start, end int) MooList
 	Elements() []Value // For iteration
+	meta() *listMeta
+}
+
+// listMeta holds what a list remembers about itself
+type listMeta struct {
+	bytes atomic.Int64 // ByteSize + 1, or 0 if not yet known
+}
+
+func (m *listMeta) meta() *listMeta {
+	return m
 }
 
 // sliceList is the concrete implementation (private)
+//
+// Lists made by appending share a backing array: each one is a prefix of
+// it. The first list to append to a given length claims the spare capacity
+// and writes in place, so building a list one element at a time is
+// amortized O(1) per element. Any other list appending at that length finds
+// the claim taken and copies, so no list ever sees another's elements.
 type sliceList struct {
 	elements []Value
+	claim    *atomic.Int64 // Length claimed in the backing array; nil if it isn't ours to extend
+	listMeta
 }
 
 func (s *sliceList) Len() int {
@@ -32,6 +54,10 @@ func (s *sliceList) Set(i int, v Value) MooList {
 	if i < 1 || i > len(s.elements) {
 		return s // Out of bounds - return unchanged
 	}
+	if len(s.elements) > vecWidth {
+		// Long lists move to a vector, whose updates copy only a path
+		return newVecList(s.elements).Set(i, v)
+	}
 	newElems := make([]Value, len(s.elements))
 	copy(newElems, s.elements)
 	newElems[i-1] = v
@@ -39,10 +65,24 @@ func (s *sliceList) Set(i int, v Value) MooList {
 }
 
 func (s *sliceList) Append(v Value) MooList {
-	newElems := make([]Value, len(s.elements)+1)
-	copy(newElems, s.elements)
-	newElems[len(s.elements)] = v
-	return &sliceList{elements: newElems}
+	return s.AppendAll([]Value{v})
+}
+
+func (s *sliceList) AppendAll(vs []Value) MooList {
+	if len(vs) == 0 {
+		return s
+	}
+	n := len(s.elements)
+	if s.claim != nil && n+len(vs) <= cap(s.elements) && s.claim.CompareAndSwap(int64(n), int64(n+len(vs))) {
+		elems := s.elements[:n+len(vs)]
+		copy(elems[n:], vs)
+		return &sliceList{elements: elems, claim: s.claim}
+	}
+	// Grow the way append does, so repeated appends amortize
+	elems := append(s.elements[:n:n], vs...)
+	claim := new(atomic.Int64)
+	claim.Store(int64(len(elems)))
+	return &sliceList{elements: elems, claim: claim}
 }
 
 func (s *sliceList) Slice(start, end int) MooList {
@@ -62,17 +102,19 @@ func (s *sliceList) Slice(start, end int) MooList {
 }
 
 func (s *sliceList) Elements() []Value {
-	return s.elements
+	// Cap the slice so appending to it can't write into claimed space
+	return s.elements[:len(s.elements):len(s.elements)]
 }
 
 // ListValue represents a MOO list
 type ListValue struct {
-	data MooList
+	data    MooList
+	lambdas int // Elements that are or hold lambdas (see ContainsLambda)
 }
 
 // NewList creates a new list value
 func NewList(elements []Value) ListValue {
-	return ListValue{data: &sliceList{elements: elements}}
+	return ListValue{data: &sliceList{elements: elements}, lambdas: countLambdas(elements)}
 }
 
 // NewEmptyList creates an empty list
@@ -141,12 +183,23 @@ func (l ListValue) Get(index int) Value {
 
 // Set returns a new list with the element at index set to value (1-based, COW)
 func (l ListValue) Set(index int, value Value) ListValue {
-	return ListValue{data: l.data.Set(index, value)}
+	lambdas := l.lambdas
+	if lambdas > 0 || ContainsLambda(value) {
+		if old := l.data.Get(index); old != nil {
+			lambdas += lambdaCount(value) - lambdaCount(old)
+		}
+	}
+	return ListValue{data: l.data.Set(index, value), lambdas: lambdas}
 }
 
 // Append returns a new list with the value appended (COW)
 func (l ListValue) Append(value Value) ListValue {
-	return ListValue{data: l.data.Append(value)}
+	return ListValue{data: l.data.Append(value), lambdas: l.lambdas + lambdaCount(value)}
+}
+
+// AppendAll returns a new list with values appended (COW)
+func (l ListValue) AppendAll(values []Value) ListValue {
+	return ListValue{data: l.data.AppendAll(values), lambdas: l.lambdas + countLambdas(values)}
 }
 
 // Elements returns the internal slice for iteration
@@ -154,6 +207,18 @@ func (l ListValue) Elements() []Value {
 	return l.data.Elements()
 }
 
+// ByteSize returns the size recorded with SetByteSize, if any
+func (l ListValue) ByteSize() (int, bool) {
+	n := l.data.meta().bytes.Load()
+	return int(n - 1), n > 0
+}
+
+// SetByteSize records the list's size as builtins.ValueBytes counts it, so
+// it need not walk the list again. Lists never change, so it stays right.
+func (l ListValue) SetByteSize(n int) {
+	l.data.meta().bytes.Store(int64(n) + 1)
+}
+
 // InsertAt returns a new list with value inserted at index (1-based, COW)
 func (l ListValue) InsertAt(index int, value Value) ListValue {
 	elements := l.data.Elements()
@@ -165,6 +230,9 @@ func (l ListValue) InsertAt(index int, value Value) ListValue {
 	if index > len(elements)+1 {
 		index = len(elements) + 1
 	}
+	if index == len(elements)+1 {
+		return l.Append(value)
+	}
 
 	// Create new slice with space for inserted element
 	newElems := make([]Value, len(elements)+1)
@@ -181,7 +249,7 @@ func (l ListValue) InsertAt(index int, value Value) ListValue {
 	// Copy elements after insertion point
 	copy(newElems[idx0+1:], elements[idx0:])
 
-	return ListValue{data: &sliceList{elements: newElems}}
+	return ListValue{data: &sliceList{elements: newElems}, lambdas: l.lambdas + lambdaCount(value)}
 }
 
 // DeleteAt returns a new list with element at index removed (1-based, COW)
@@ -193,6 +261,8 @@ func (l ListValue) DeleteAt(index int) ListValue {
 		return l // Out of bounds - return unchanged
 	}
 
+	lambdas := l.lambdas - lambdaCount(elements[index-1])
+
 	// Create new slice without the element
 	newElems := make([]Value, len(elements)-1)
 
@@ -205,10 +275,14 @@ func (l ListValue) DeleteAt(index int) ListValue {
 	// Copy elements after deletion point
 	copy(newElems[idx0:], elements[idx0+1:])
 
-	return ListValue{data: &sliceList{elements: newElems}}
+	return ListValue{data: &sliceList{elements: newElems}, lambdas: lambdas}
 }
 
 // Slice returns a new list containing elements from start to end (1-based, inclusive)
 func (l ListValue) Slice(start, end int) ListValue {
-	return ListValue{data: l.data.Slice(start, end)}
+	data := l.data.Slice(start, end)
+	if l.lambdas == 0 {
+		return ListValue{data: data}
+	}
+	return ListValue{data: data, lambdas: countLambdas(data.Elements())}
 }
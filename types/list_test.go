@@ -0,0 +1,246 @@
+package types
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func listInts(l ListValue) []int64 {
+	var out []int64
+	for i := 1; i <= l.Len(); i++ {
+		out = append(out, l.Get(i).(IntValue).Val)
+	}
+	return out
+}
+
+func checkList(t *testing.T, what string, l ListValue, want []int64) {
+	t.Helper()
+	got := listInts(l)
+	if len(got) != len(want) {
+		t.Fatalf("%s: length %d, want %d", what, len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s: element %d is %d, want %d", what, i+1, got[i], want[i])
+		}
+	}
+	elems := l.Elements()
+	if len(elems) != len(want) || cap(elems) != len(elems) {
+		t.Fatalf("%s: Elements() has len %d cap %d, want %d", what, len(elems), cap(elems), len(want))
+	}
+	for i, e := range elems {
+		if e.(IntValue).Val != want[i] {
+			t.Fatalf("%s: Elements()[%d] is %v, want %d", what, i, e, want[i])
+		}
+	}
+}
+
+// TestListVersions keeps every version of a list made by random appends
+// and sets, and checks that none of them sees a later change
+func TestListVersions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	type version struct {
+		list ListValue
+		want []int64
+	}
+	versions := []version{{NewEmptyList(), nil}}
+	for step := 0; step < 3000; step++ {
+		// Most changes extend the newest version; some go back to an old one
+		from := versions[len(versions)-1]
+		if rng.Intn(4) == 0 {
+			from = versions[rng.Intn(len(versions))]
+		}
+		want := append([]int64(nil), from.want...)
+		var list ListValue
+		switch n := int64(step); {
+		case len(want) > 0 && rng.Intn(3) == 0:
+			i := rng.Intn(len(want)) + 1
+			list = from.list.Set(i, NewInt(n))
+			want[i-1] = n
+		case rng.Intn(10) == 0:
+			list = from.list.AppendAll([]Value{NewInt(n), NewInt(-n)})
+			want = append(want, n, -n)
+		default:
+			list = from.list.Append(NewInt(n))
+			want = append(want, n)
+		}
+		versions = append(versions, version{list, want})
+	}
+	for i, v := range versions {
+		checkList(t, fmt.Sprintf("version %d", i), v.list, v.want)
+	}
+}
+
+func TestListAppendSharesNothing(t *testing.T) {
+	base := NewEmptyList()
+	for i := 0; i < 5; i++ {
+		base = base.Append(NewInt(int64(i)))
+	}
+	a := base.Append(NewInt(100))
+	b := base.Append(NewInt(200))
+	checkList(t, "base", base, []int64{0, 1, 2, 3, 4})
+	checkList(t, "a", a, []int64{0, 1, 2, 3, 4, 100})
+	checkList(t, "b", b, []int64{0, 1, 2, 3, 4, 200})
+
+	// A slice taken from Elements can be appended to without touching a
+	elems := append(a.Elements(), NewInt(300))
+	c := a.Append(NewInt(400))
+	if elems[6].(IntValue).Val != 300 {
+		t.Errorf("appending to Elements() was overwritten: %v", elems[6])
+	}
+	checkList(t, "c", c, []int64{0, 1, 2, 3, 4, 100, 400})
+}
+
+func TestListVectorShapes(t *testing.T) {
+	// Sizes around the tail and each trie level
+	for _, n := range []int{33, 64, 65, 1024, 1056, 1057, 33 * 32 * 32, 40000} {
+		want := make([]int64, n)
+		elems := make([]Value, n)
+		for i := range elems {
+			want[i] = int64(i)
+			elems[i] = NewInt(int64(i))
+		}
+		list := NewList(elems).Set(1, NewInt(0))
+		checkList(t, fmt.Sprintf("vector of %d", n), list, want)
+		for i := n; i < n+1100; i++ {
+			list = list.Append(NewInt(int64(i)))
+			want = append(want, int64(i))
+		}
+		list = list.Set(n/2+1, NewInt(-1))
+		want[n/2] = -1
+		checkList(t, fmt.Sprintf("vector of %d after appends", n), list, want)
+		if got := listInts(list.Slice(n/2, n/2+2)); got[0] != want[n/2-1] || got[1] != -1 || len(got) != 3 {
+			t.Errorf("vector of %d: slice = %v", n, got)
+		}
+	}
+}
+
+func TestListByteSize(t *testing.T) {
+	l := NewList([]Value{NewInt(1)})
+	if _, ok := l.ByteSize(); ok {
+		t.Fatal("new list has a byte size")
+	}
+	l.SetByteSize(0)
+	if n, ok := l.ByteSize(); !ok || n != 0 {
+		t.Errorf("ByteSize() = %d, %v; want 0, true", n, ok)
+	}
+	if _, ok := l.Append(NewInt(2)).ByteSize(); ok {
+		t.Error("appended list inherited a byte size")
+	}
+}
+
+// The old list implementation copied on every change; these are the
+// baselines the benchmarks compare against.
+func copyAppend(elems []Value, v Value) []Value {
+	out := make([]Value, len(elems)+1)
+	copy(out, elems)
+	out[len(elems)] = v
+	return out
+}
+
+func copySet(elems []Value, i int, v Value) []Value {
+	out := make([]Value, len(elems))
+	copy(out, elems)
+	out[i-1] = v
+	return out
+}
+
+const benchListLen = 100000
+
+func TestContainsLambdaTracksEdits(t *testing.T) {
+	fn := NewLambda(nil, nil, "{} => 0")
+	elems := make([]Value, 100)
+	for i := range elems {
+		elems[i] = NewInt(int64(i))
+	}
+	l := NewList(elems)
+	if ContainsLambda(l) {
+		t.Fatal("a list of ints holds a lambda")
+	}
+	// Nested, in a vector, then replaced, deleted and sliced away
+	held := l.Set(50, NewList([]Value{NewMap([][2]Value{{NewStr("f"), fn}})}))
+	if !ContainsLambda(held) {
+		t.Error("a lambda two levels down went unnoticed")
+	}
+	if ContainsLambda(held.Set(50, NewInt(0))) {
+		t.Error("replacing the only lambda left the list holding one")
+	}
+	if ContainsLambda(held.DeleteAt(50)) || ContainsLambda(held.Slice(1, 49)) {
+		t.Error("deleting or slicing away the only lambda left the list holding one")
+	}
+	if !ContainsLambda(held.Slice(40, 60)) || !ContainsLambda(l.InsertAt(1, fn)) || !ContainsLambda(l.Append(fn)) {
+		t.Error("a slice, insert or append with a lambda lost it")
+	}
+
+	m := NewMap([][2]Value{{NewStr("f"), fn}, {NewStr("g"), fn}})
+	if !ContainsLambda(m.Delete(NewStr("f"))) || ContainsLambda(m.Delete(NewStr("f")).Set(NewStr("g"), NewInt(1))) {
+		t.Error("a map's lambdas weren't counted through deletes and sets")
+	}
+}
+
+func BenchmarkListAppend(b *testing.B) {
+	for _, n := range []int{10000, benchListLen} {
+		b.Run(fmt.Sprintf("list/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				l := NewEmptyList()
+				for j := 0; j < n; j++ {
+					l = l.Append(NewInt(int64(j)))
+				}
+			}
+		})
+		if n > 10000 {
+			// Copying takes minutes at this size
+			continue
+		}
+		b.Run(fmt.Sprintf("copy/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var elems []Value
+				for j := 0; j < n; j++ {
+					elems = copyAppend(elems, NewInt(int64(j)))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkListSet(b *testing.B) {
+	elems := make([]Value, benchListLen)
+	for i := range elems {
+		elems[i] = NewInt(int64(i))
+	}
+	b.Run("list", func(b *testing.B) {
+		b.ReportAllocs()
+		l := NewList(elems)
+		for i := 0; i < b.N; i++ {
+			l = l.Set(i%benchListLen+1, NewInt(int64(i)))
+		}
+	})
+	b.Run("copy", func(b *testing.B) {
+		b.ReportAllocs()
+		cur := elems
+		for i := 0; i < b.N; i++ {
+			cur = copySet(cur, i%benchListLen+1, NewInt(int64(i)))
+		}
+	})
+}
+
+func BenchmarkListGet(b *testing.B) {
+	elems := make([]Value, benchListLen)
+	for i := range elems {
+		elems[i] = NewInt(int64(i))
+	}
+	lists := map[string]ListValue{
+		"slice":  NewList(elems),
+		"vector": NewList(elems).Set(1, NewInt(0)),
+	}
+	for name, l := range lists {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				l.Get(i%benchListLen + 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package types
+
+import "sync/atomic"
+
+// vecList is a persistent vector: a trie of 32-wide nodes holding all but
+// the last few elements, which sit in a separate tail. Set copies only the
+// path to the changed leaf and Append usually only the tail, so both are
+// O(log32 n) or better no matter how many versions of the list are alive.
+type vecList struct {
+	count int
+	shift uint // Depth of the trie times vecBits
+	root  *vecNode
+	tail  []Value                 // Last 1 to 32 elements; capped, never written
+	flat  atomic.Pointer[[]Value] // Elements, once asked for
+	listMeta
+}
+
+// vecNode is a branch with kids or a leaf of vecWidth values
+type vecNode struct {
+	kids []*vecNode
+	vals []Value
+}
+
+const (
+	vecBits  = 5
+	vecWidth = 1 << vecBits
+	vecMask  = vecWidth - 1
+)
+
+// newVecList builds a vector over elems. Leaves share elems, which must
+// not be written again.
+func newVecList(elems []Value) *vecList {
+	v := &vecList{count: len(elems), shift: vecBits, root: &vecNode{}}
+	if len(elems) == 0 {
+		return v
+	}
+	tailOff := (len(elems) - 1) &^ vecMask
+	v.tail = elems[tailOff:len(elems):len(elems)]
+
+	var nodes []*vecNode
+	for i := 0; i < tailOff; i += vecWidth {
+		nodes = append(nodes, &vecNode{vals: elems[i : i+vecWidth : i+vecWidth]})
+	}
+	for len(nodes) > vecWidth {
+		var parents []*vecNode
+		for i := 0; i < len(nodes); i += vecWidth {
+			parents = append(parents, &vecNode{kids: nodes[i:min(i+vecWidth, len(nodes)):min(i+vecWidth, len(nodes))]})
+		}
+		nodes = parents
+		v.shift += vecBits
+	}
+	v.root = &vecNode{kids: nodes}
+	return v
+}
+
+func (v *vecList) tailOff() int {
+	return v.count - len(v.tail)
+}
+
+func (v *vecList) Len() int {
+	return v.count
+}
+
+func (v *vecList) Get(i int) Value {
+	if i < 1 || i > v.count {
+		return nil
+	}
+	j := i - 1
+	if off := v.tailOff(); j >= off {
+		return v.tail[j-off]
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vecBits {
+		node = node.kids[(j>>level)&vecMask]
+	}
+	return node.vals[j&vecMask]
+}
+
+func (v *vecList) Set(i int, val Value) MooList {
+	if i < 1 || i > v.count {
+		return v // Out of bounds - return unchanged
+	}
+	j := i - 1
+	if off := v.tailOff(); j >= off {
+		tail := make([]Value, len(v.tail))
+		copy(tail, v.tail)
+		tail[j-off] = val
+		return &vecList{count: v.count, shift: v.shift, root: v.root, tail: tail}
+	}
+	return &vecList{count: v.count, shift: v.shift, root: setInNode(v.root, v.shift, j, val), tail: v.tail}
+}
+
+func setInNode(node *vecNode, level uint, j int, val Value) *vecNode {
+	if level == 0 {
+		vals := make([]Value, len(node.vals))
+		copy(vals, node.vals)
+		vals[j&vecMask] = val
+		return &vecNode{vals: vals}
+	}
+	kids := make([]*vecNode, len(node.kids))
+	copy(kids, node.kids)
+	k := (j >> level) & vecMask
+	kids[k] = setInNode(kids[k], level-vecBits, j, val)
+	return &vecNode{kids: kids}
+}
+
+func (v *vecList) Append(val Value) MooList {
+	if len(v.tail) < vecWidth {
+		n := len(v.tail)
+		return &vecList{count: v.count + 1, shift: v.shift, root: v.root, tail: append(v.tail[:n:n], val)}
+	}
+	// The tail is full: it becomes a leaf and a new tail starts
+	leaf := &vecNode{vals: v.tail}
+	root, shift := v.root, v.shift
+	if v.count>>vecBits > 1<<shift {
+		root = &vecNode{kids: []*vecNode{root, newVecPath(shift, leaf)}}
+		shift += vecBits
+	} else {
+		root = v.pushTail(root, shift, leaf)
+	}
+	return &vecList{count: v.count + 1, shift: shift, root: root, tail: []Value{val}}
+}
+
+// pushTail returns a copy of node with leaf added after its last leaf
+func (v *vecList) pushTail(node *vecNode, level uint, leaf *vecNode) *vecNode {
+	k := ((v.count - 1) >> level) & vecMask
+	kids := make([]*vecNode, len(node.kids), max(len(node.kids), k+1))
+	copy(kids, node.kids)
+	var child *vecNode
+	switch {
+	case level == vecBits:
+		child = leaf
+	case k < len(node.kids):
+		child = v.pushTail(node.kids[k], level-vecBits, leaf)
+	default:
+		child = newVecPath(level-vecBits, leaf)
+	}
+	if k < len(kids) {
+		kids[k] = child
+	} else {
+		kids = append(kids, child)
+	}
+	return &vecNode{kids: kids}
+}
+
+// newVecPath returns leaf under enough single-child branches to sit at level
+func newVecPath(level uint, leaf *vecNode) *vecNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vecNode{kids: []*vecNode{newVecPath(level-vecBits, leaf)}}
+}
+
+func (v *vecList) AppendAll(vals []Value) MooList {
+	var list MooList = v
+	for _, val := range vals {
+		list = list.Append(val)
+	}
+	return list
+}
+
+func (v *vecList) Slice(start, end int) MooList {
+	// 1-based inclusive range
+	if start < 1 {
+		start = 1
+	}
+	if end > v.count {
+		end = v.count
+	}
+	if start > end {
+		return &sliceList{elements: []Value{}}
+	}
+	elems := make([]Value, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		elems = append(elems, v.Get(i))
+	}
+	return &sliceList{elements: elems}
+}
+
+// Elements flattens the vector the first time it is asked, and keeps the
+// result for later calls
+func (v *vecList) Elements() []Value {
+	if flat := v.flat.Load(); flat != nil {
+		return *flat
+	}
+	elems := make([]Value, 0, v.count)
+	var walk func(node *vecNode, level uint)
+	walk = func(node *vecNode, level uint) {
+		if level == 0 {
+			elems = append(elems, node.vals...)
+			return
+		}
+		for _, kid := range node.kids {
+			walk(kid, level-vecBits)
+		}
+	}
+	walk(v.root, v.shift)
+	elems = append(elems, v.tail...)
+	v.flat.Store(&elems)
+	return elems
+}
@@ -6,7 +6,8 @@ import (
 	"strings"
 )
 
-// MooMap abstracts map storage - allows swapping implementation later
+// MooMap abstracts map storage - allows swapping implementation later.
+// The implementation is a persistent trie (see map_hamt.go).
 type MooMap interface {
 	Len() int
 	Get(key Value) (Value, bool)
@@ -16,132 +17,24 @@ type MooMap interface {
 	Pairs() [][2]Value // For iteration
 }
 
-// mapEntry stores a key-value pair
-type mapEntry struct {
-	key Value
-	val Value
-}
-
-// goMap is the concrete implementation using Go's map (private)
-// Key is stringified Value (since Go maps need comparable keys)
-// Maintains insertion order via the 'order' slice
-type goMap struct {
-	order []string            // Key hashes in insertion order
-	pairs map[string]mapEntry // key hash -> entry
-}
-
-// keyHash converts a value to a string key for Go map lookup
-func keyHash(v Value) string {
-	// Use String() representation for hashing
-	// This ensures that equal values hash to the same key
-	// MOO strings are case-insensitive, so normalize to lowercase
-	if str, ok := v.(StrValue); ok {
-		return fmt.Sprintf("%T:%s", v, strings.ToLower(str.Value()))
-	}
-	return fmt.Sprintf("%T:%s", v, v.String())
-}
-
-func (m *goMap) Len() int {
-	return len(m.pairs)
-}
-
-func (m *goMap) Get(k Value) (Value, bool) {
-	if e, ok := m.pairs[keyHash(k)]; ok {
-		return e.val, true
-	}
-	return nil, false
-}
-
-func (m *goMap) Set(k, v Value) MooMap {
-	hash := keyHash(k)
-	newPairs := make(map[string]mapEntry, len(m.pairs)+1)
-	for h, e := range m.pairs {
-		newPairs[h] = e
-	}
-	newPairs[hash] = mapEntry{key: k, val: v}
-
-	// Copy order, adding new key if needed
-	var newOrder []string
-	_, exists := m.pairs[hash]
-	if exists {
-		// Key already exists, keep same order
-		newOrder = make([]string, len(m.order))
-		copy(newOrder, m.order)
-	} else {
-		// New key, append to order
-		newOrder = make([]string, len(m.order)+1)
-		copy(newOrder, m.order)
-		newOrder[len(m.order)] = hash
-	}
-
-	return &goMap{order: newOrder, pairs: newPairs}
-}
-
-func (m *goMap) Delete(k Value) MooMap {
-	hash := keyHash(k)
-	if _, exists := m.pairs[hash]; !exists {
-		return m // Key doesn't exist, return unchanged
-	}
-
-	newPairs := make(map[string]mapEntry, len(m.pairs)-1)
-	for h, e := range m.pairs {
-		if h != hash {
-			newPairs[h] = e
-		}
-	}
-
-	// Remove from order
-	newOrder := make([]string, 0, len(m.order)-1)
-	for _, h := range m.order {
-		if h != hash {
-			newOrder = append(newOrder, h)
-		}
-	}
-
-	return &goMap{order: newOrder, pairs: newPairs}
-}
-
-func (m *goMap) Keys() []Value {
-	keys := make([]Value, 0, len(m.order))
-	for _, h := range m.order {
-		keys = append(keys, m.pairs[h].key)
-	}
-	return keys
-}
-
-func (m *goMap) Pairs() [][2]Value {
-	pairs := make([][2]Value, 0, len(m.order))
-	for _, h := range m.order {
-		e := m.pairs[h]
-		pairs = append(pairs, [2]Value{e.key, e.val})
-	}
-	return pairs
-}
-
 // MapValue represents a MOO map
 type MapValue struct {
-	data MooMap
+	data    MooMap
+	lambdas int // Values that are or hold lambdas (see ContainsLambda)
 }
 
 // NewMap creates a new map value
 func NewMap(pairs [][2]Value) MapValue {
-	m := &goMap{
-		order: make([]string, 0, len(pairs)),
-		pairs: make(map[string]mapEntry),
-	}
+	m := NewEmptyMap()
 	for _, p := range pairs {
-		hash := keyHash(p[0])
-		if _, exists := m.pairs[hash]; !exists {
-			m.order = append(m.order, hash)
-		}
-		m.pairs[hash] = mapEntry{key: p[0], val: p[1]}
+		m = m.Set(p[0], p[1])
 	}
-	return MapValue{data: m}
+	return m
 }
 
 // NewEmptyMap creates an empty map
 func NewEmptyMap() MapValue {
-	return MapValue{data: &goMap{order: nil, pairs: make(map[string]mapEntry)}}
+	return MapValue{data: newHamtMap()}
 }
 
 // String returns the MOO string representation
@@ -305,12 +198,25 @@ func (m MapValue) GetWithCase(key Value, caseSensitive bool) (Value, bool) {
 
 // Set returns a new map with the key-value pair set (COW)
 func (m MapValue) Set(key, val Value) MapValue {
-	return MapValue{data: m.data.Set(key, val)}
+	lambdas := m.lambdas
+	if lambdas > 0 || ContainsLambda(val) {
+		lambdas += lambdaCount(val)
+		if old, ok := m.data.Get(key); ok {
+			lambdas -= lambdaCount(old)
+		}
+	}
+	return MapValue{data: m.data.Set(key, val), lambdas: lambdas}
 }
 
 // Delete returns a new map with the key removed (COW)
 func (m MapValue) Delete(key Value) MapValue {
-	return MapValue{data: m.data.Delete(key)}
+	lambdas := m.lambdas
+	if lambdas > 0 {
+		if old, ok := m.data.Get(key); ok {
+			lambdas -= lambdaCount(old)
+		}
+	}
+	return MapValue{data: m.data.Delete(key), lambdas: lambdas}
 }
 
 // Keys returns all keys in the map
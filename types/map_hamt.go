@@ -0,0 +1,371 @@
+package types
+
+import (
+	"cmp"
+	"math"
+	"math/bits"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hamtMap is a persistent hash array mapped trie. Set and Delete copy only
+// the path from the root to the changed entry, so every version of a map
+// shares most of its nodes with the ones before it.
+//
+// Insertion order is kept by numbering entries as they are added; Pairs
+// puts them back in that order.
+type hamtMap struct {
+	root *hamtNode
+	size int
+	next uint64 // Number given to the next new key
+}
+
+type hamtEntry struct {
+	hash uint64
+	key  Value
+	val  Value
+	seq  uint64 // When the key was first added
+}
+
+// hamtNode holds up to 32 slots, one per 5-bit slice of the hash at its
+// level. Below the last level that has hash bits left, keys with equal
+// hashes share a collision node whose slots are all entries.
+type hamtNode struct {
+	bitmap uint32 // Which slots are present; unused in collision nodes
+	slots  []hamtSlot
+}
+
+// hamtSlot is either an entry or a subtree
+type hamtSlot struct {
+	entry *hamtEntry
+	child *hamtNode
+}
+
+const (
+	hamtBits     = 5
+	hamtMask     = 1<<hamtBits - 1
+	hamtMaxShift = 60 // Deepest level that still has hash bits
+)
+
+var emptyHamtNode = &hamtNode{}
+
+func newHamtMap() *hamtMap {
+	return &hamtMap{root: emptyHamtNode}
+}
+
+func (m *hamtMap) Len() int {
+	return m.size
+}
+
+func (m *hamtMap) Get(k Value) (Value, bool) {
+	if e := m.root.get(hashKey(k), k); e != nil {
+		return e.val, true
+	}
+	return nil, false
+}
+
+func (m *hamtMap) Set(k, v Value) MooMap {
+	e := &hamtEntry{hash: hashKey(k), key: k, val: v, seq: m.next}
+	root, old := m.root.set(e, 0)
+	if old != nil {
+		return &hamtMap{root: root, size: m.size, next: m.next}
+	}
+	return &hamtMap{root: root, size: m.size + 1, next: m.next + 1}
+}
+
+func (m *hamtMap) Delete(k Value) MooMap {
+	root, ok := m.root.delete(hashKey(k), k, 0)
+	if !ok {
+		return m
+	}
+	return &hamtMap{root: root, size: m.size - 1, next: m.next}
+}
+
+func (m *hamtMap) Keys() []Value {
+	entries := m.entries()
+	keys := make([]Value, len(entries))
+	for i, e := range entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+func (m *hamtMap) Pairs() [][2]Value {
+	entries := m.entries()
+	pairs := make([][2]Value, len(entries))
+	for i, e := range entries {
+		pairs[i] = [2]Value{e.key, e.val}
+	}
+	return pairs
+}
+
+// entries returns the map's entries in insertion order
+func (m *hamtMap) entries() []*hamtEntry {
+	if m.next <= 2*uint64(m.size) {
+		// Few keys were deleted: place each entry by its number
+		slots := make([]*hamtEntry, m.next)
+		m.root.each(func(e *hamtEntry) { slots[e.seq] = e })
+		entries := slots[:0]
+		for _, e := range slots {
+			if e != nil {
+				entries = append(entries, e)
+			}
+		}
+		return entries
+	}
+	entries := make([]*hamtEntry, 0, m.size)
+	m.root.each(func(e *hamtEntry) { entries = append(entries, e) })
+	slices.SortFunc(entries, func(a, b *hamtEntry) int { return cmp.Compare(a.seq, b.seq) })
+	return entries
+}
+
+func (n *hamtNode) get(hash uint64, key Value) *hamtEntry {
+	for shift := uint(0); ; shift += hamtBits {
+		if shift > hamtMaxShift {
+			for _, s := range n.slots {
+				if keysEqual(s.entry.key, key) {
+					return s.entry
+				}
+			}
+			return nil
+		}
+		bit := uint32(1) << ((hash >> shift) & hamtMask)
+		if n.bitmap&bit == 0 {
+			return nil
+		}
+		s := n.slots[n.index(bit)]
+		if s.entry != nil {
+			if s.entry.hash == hash && keysEqual(s.entry.key, key) {
+				return s.entry
+			}
+			return nil
+		}
+		n = s.child
+	}
+}
+
+// set returns a copy of n with e added, and the entry e replaced if its key
+// was already present. A replacement keeps the old entry's place in order.
+func (n *hamtNode) set(e *hamtEntry, shift uint) (*hamtNode, *hamtEntry) {
+	if shift > hamtMaxShift {
+		for i, s := range n.slots {
+			if keysEqual(s.entry.key, e.key) {
+				e.seq = s.entry.seq
+				return n.replace(i, hamtSlot{entry: e}), s.entry
+			}
+		}
+		return n.insert(len(n.slots), 0, hamtSlot{entry: e}), nil
+	}
+	bit := uint32(1) << ((e.hash >> shift) & hamtMask)
+	i := n.index(bit)
+	if n.bitmap&bit == 0 {
+		return n.insert(i, bit, hamtSlot{entry: e}), nil
+	}
+	s := n.slots[i]
+	if s.child != nil {
+		child, old := s.child.set(e, shift+hamtBits)
+		return n.replace(i, hamtSlot{child: child}), old
+	}
+	if s.entry.hash == e.hash && keysEqual(s.entry.key, e.key) {
+		e.seq = s.entry.seq
+		return n.replace(i, hamtSlot{entry: e}), s.entry
+	}
+	// Two keys want the same slot: move both down a level
+	return n.replace(i, hamtSlot{child: newHamtPair(s.entry, e, shift+hamtBits)}), nil
+}
+
+func newHamtPair(a, b *hamtEntry, shift uint) *hamtNode {
+	if shift > hamtMaxShift {
+		return &hamtNode{slots: []hamtSlot{{entry: a}, {entry: b}}}
+	}
+	ia := (a.hash >> shift) & hamtMask
+	ib := (b.hash >> shift) & hamtMask
+	switch {
+	case ia == ib:
+		return &hamtNode{bitmap: 1 << ia, slots: []hamtSlot{{child: newHamtPair(a, b, shift+hamtBits)}}}
+	case ia < ib:
+		return &hamtNode{bitmap: 1<<ia | 1<<ib, slots: []hamtSlot{{entry: a}, {entry: b}}}
+	default:
+		return &hamtNode{bitmap: 1<<ia | 1<<ib, slots: []hamtSlot{{entry: b}, {entry: a}}}
+	}
+}
+
+// delete returns a copy of n without key, and whether it was there
+func (n *hamtNode) delete(hash uint64, key Value, shift uint) (*hamtNode, bool) {
+	if shift > hamtMaxShift {
+		for i, s := range n.slots {
+			if keysEqual(s.entry.key, key) {
+				return n.remove(i, 0), true
+			}
+		}
+		return n, false
+	}
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := n.index(bit)
+	s := n.slots[i]
+	if s.entry != nil {
+		if s.entry.hash != hash || !keysEqual(s.entry.key, key) {
+			return n, false
+		}
+		return n.remove(i, bit), true
+	}
+	child, ok := s.child.delete(hash, key, shift+hamtBits)
+	if !ok {
+		return n, false
+	}
+	switch {
+	case len(child.slots) == 0:
+		return n.remove(i, bit), true
+	case len(child.slots) == 1 && child.slots[0].entry != nil:
+		// A lone entry takes the place of its subtree
+		return n.replace(i, child.slots[0]), true
+	}
+	return n.replace(i, hamtSlot{child: child}), true
+}
+
+func (n *hamtNode) each(fn func(*hamtEntry)) {
+	for _, s := range n.slots {
+		if s.entry != nil {
+			fn(s.entry)
+		} else {
+			s.child.each(fn)
+		}
+	}
+}
+
+// index returns the position in slots of the slot for bit
+func (n *hamtNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) insert(i int, bit uint32, s hamtSlot) *hamtNode {
+	slots := make([]hamtSlot, len(n.slots)+1)
+	copy(slots, n.slots[:i])
+	slots[i] = s
+	copy(slots[i+1:], n.slots[i:])
+	return &hamtNode{bitmap: n.bitmap | bit, slots: slots}
+}
+
+func (n *hamtNode) replace(i int, s hamtSlot) *hamtNode {
+	slots := make([]hamtSlot, len(n.slots))
+	copy(slots, n.slots)
+	slots[i] = s
+	return &hamtNode{bitmap: n.bitmap, slots: slots}
+}
+
+func (n *hamtNode) remove(i int, bit uint32) *hamtNode {
+	slots := make([]hamtSlot, 0, len(n.slots)-1)
+	slots = append(slots, n.slots[:i]...)
+	slots = append(slots, n.slots[i+1:]...)
+	return &hamtNode{bitmap: n.bitmap &^ bit, slots: slots}
+}
+
+// hashKey hashes a map key without allocating. Keys that keysEqual calls
+// equal hash the same: strings are hashed case-folded.
+func hashKey(v Value) uint64 {
+	switch v := v.(type) {
+	case IntValue:
+		return mixHash(uint64(v.Val) ^ uint64(TYPE_INT)<<56)
+	case ObjValue:
+		return mixHash(uint64(v.id) ^ uint64(v.Type())<<56)
+	case FloatValue:
+		return mixHash(floatKeyBits(v.Val) ^ uint64(TYPE_FLOAT)<<56)
+	case ErrValue:
+		return mixHash(uint64(v.code) ^ uint64(TYPE_ERR)<<56)
+	case StrValue:
+		return mixHash(hashFolded(v.val))
+	}
+	// Not a valid key type; hash the printed form
+	h := uint64(fnvOffset) ^ uint64(v.Type())
+	s := v.String()
+	for i := 0; i < len(s); i++ {
+		h = (h ^ uint64(s[i])) * fnvPrime
+	}
+	return mixHash(h)
+}
+
+// keysEqual reports whether two values are the same map key
+func keysEqual(a, b Value) bool {
+	switch a := a.(type) {
+	case IntValue:
+		b, ok := b.(IntValue)
+		return ok && a.Val == b.Val
+	case ObjValue:
+		b, ok := b.(ObjValue)
+		return ok && a == b
+	case FloatValue:
+		b, ok := b.(FloatValue)
+		return ok && floatKeyBits(a.Val) == floatKeyBits(b.Val)
+	case ErrValue:
+		b, ok := b.(ErrValue)
+		return ok && a.code == b.code
+	case StrValue:
+		b, ok := b.(StrValue)
+		return ok && equalFolded(a.val, b.val)
+	}
+	return a.Type() == b.Type() && a.String() == b.String()
+}
+
+// floatKeyBits returns the bits of f as a key: 0.0 and -0.0 are different
+// keys, but every NaN is the same one
+func floatKeyBits(f float64) uint64 {
+	if math.IsNaN(f) {
+		return math.Float64bits(math.NaN())
+	}
+	return math.Float64bits(f)
+}
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// hashFolded hashes s as strings.ToLower(s) would read
+func hashFolded(s string) uint64 {
+	h := uint64(fnvOffset)
+	for s != "" {
+		var r rune
+		r, s = nextFolded(s)
+		h = (h ^ uint64(r)) * fnvPrime
+	}
+	return h
+}
+
+// equalFolded reports whether strings.ToLower(a) == strings.ToLower(b)
+func equalFolded(a, b string) bool {
+	for a != "" && b != "" {
+		var ra, rb rune
+		ra, a = nextFolded(a)
+		rb, b = nextFolded(b)
+		if ra != rb {
+			return false
+		}
+	}
+	return a == b
+}
+
+// nextFolded returns the first rune of s in lower case and the rest of s
+func nextFolded(s string) (rune, string) {
+	if c := s[0]; c < utf8.RuneSelf {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		return rune(c), s[1:]
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return unicode.ToLower(r), s[size:]
+}
+
+// mixHash spreads the bits of h so every 5-bit slice is usable
+func mixHash(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
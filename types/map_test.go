@@ -0,0 +1,366 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// copyMapEntry stores a key-value pair of a copyMap
+type copyMapEntry struct {
+	key Value
+	val Value
+}
+
+// copyMap is the map implementation the trie replaced, kept as a reference
+// for the tests and a baseline for the benchmarks. Every Set and Delete
+// copies the whole map.
+type copyMap struct {
+	order []string                // Key hashes in insertion order
+	pairs map[string]copyMapEntry // key hash -> entry
+}
+
+// copyKeyHash converts a value to a string key for Go map lookup
+func copyKeyHash(v Value) string {
+	// Use String() representation for hashing
+	// This ensures that equal values hash to the same key
+	// MOO strings are case-insensitive, so normalize to lowercase
+	if str, ok := v.(StrValue); ok {
+		return fmt.Sprintf("%T:%s", v, strings.ToLower(str.Value()))
+	}
+	return fmt.Sprintf("%T:%s", v, v.String())
+}
+
+func (m *copyMap) Len() int {
+	return len(m.pairs)
+}
+
+func (m *copyMap) Get(k Value) (Value, bool) {
+	if e, ok := m.pairs[copyKeyHash(k)]; ok {
+		return e.val, true
+	}
+	return nil, false
+}
+
+func (m *copyMap) Set(k, v Value) MooMap {
+	hash := copyKeyHash(k)
+	newPairs := make(map[string]copyMapEntry, len(m.pairs)+1)
+	for h, e := range m.pairs {
+		newPairs[h] = e
+	}
+	newPairs[hash] = copyMapEntry{key: k, val: v}
+
+	// Copy order, adding new key if needed
+	var newOrder []string
+	_, exists := m.pairs[hash]
+	if exists {
+		// Key already exists, keep same order
+		newOrder = make([]string, len(m.order))
+		copy(newOrder, m.order)
+	} else {
+		// New key, append to order
+		newOrder = make([]string, len(m.order)+1)
+		copy(newOrder, m.order)
+		newOrder[len(m.order)] = hash
+	}
+
+	return &copyMap{order: newOrder, pairs: newPairs}
+}
+
+func (m *copyMap) Delete(k Value) MooMap {
+	hash := copyKeyHash(k)
+	if _, exists := m.pairs[hash]; !exists {
+		return m // Key doesn't exist, return unchanged
+	}
+
+	newPairs := make(map[string]copyMapEntry, len(m.pairs)-1)
+	for h, e := range m.pairs {
+		if h != hash {
+			newPairs[h] = e
+		}
+	}
+
+	// Remove from order
+	newOrder := make([]string, 0, len(m.order)-1)
+	for _, h := range m.order {
+		if h != hash {
+			newOrder = append(newOrder, h)
+		}
+	}
+
+	return &copyMap{order: newOrder, pairs: newPairs}
+}
+
+func (m *copyMap) Keys() []Value {
+	keys := make([]Value, 0, len(m.order))
+	for _, h := range m.order {
+		keys = append(keys, m.pairs[h].key)
+	}
+	return keys
+}
+
+func (m *copyMap) Pairs() [][2]Value {
+	pairs := make([][2]Value, 0, len(m.order))
+	for _, h := range m.order {
+		e := m.pairs[h]
+		pairs = append(pairs, [2]Value{e.key, e.val})
+	}
+	return pairs
+}
+
+func newCopyMap() MooMap {
+	return &copyMap{pairs: make(map[string]copyMapEntry)}
+}
+
+// randomKey returns one of a small set of keys, so sets and deletes often
+// hit keys already present, in any case
+func randomKey(rng *rand.Rand) Value {
+	n := rng.Intn(200)
+	switch rng.Intn(5) {
+	case 0:
+		return NewInt(int64(n))
+	case 1:
+		return NewObj(ObjID(n))
+	case 2:
+		return NewFloat(float64(n) / 4)
+	case 3:
+		return NewErr(ErrorCode(n % 18))
+	}
+	s := fmt.Sprintf("key%d", n)
+	if rng.Intn(2) == 0 {
+		s = strings.ToUpper(s)
+	}
+	return NewStr(s)
+}
+
+func samePairs(a, b [][2]Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i][0].String() != b[i][0].String() || !a[i][1].Equal(b[i][1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// TestMapMatchesCopyMap runs random sets and deletes on the trie and the
+// old implementation and expects the same contents in the same order
+func TestMapMatchesCopyMap(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var got, want MooMap = newHamtMap(), newCopyMap()
+	for i := 0; i < 5000; i++ {
+		key := randomKey(rng)
+		if rng.Intn(3) == 0 {
+			got, want = got.Delete(key), want.Delete(key)
+		} else {
+			val := NewInt(int64(i))
+			got, want = got.Set(key, val), want.Set(key, val)
+		}
+		probe := randomKey(rng)
+		gv, gok := got.Get(probe)
+		wv, wok := want.Get(probe)
+		if gok != wok || (gok && !gv.Equal(wv)) {
+			t.Fatalf("step %d: Get(%s) = %v, %v; want %v, %v", i, probe, gv, gok, wv, wok)
+		}
+		if got.Len() != want.Len() {
+			t.Fatalf("step %d: Len() = %d, want %d", i, got.Len(), want.Len())
+		}
+		if i%500 == 0 && !samePairs(got.Pairs(), want.Pairs()) {
+			t.Fatalf("step %d: Pairs() = %v, want %v", i, got.Pairs(), want.Pairs())
+		}
+	}
+	if !samePairs(got.Pairs(), want.Pairs()) {
+		t.Fatalf("Pairs() = %v, want %v", got.Pairs(), want.Pairs())
+	}
+}
+
+func TestMapPersistence(t *testing.T) {
+	m := NewEmptyMap()
+	var versions []MapValue
+	for i := 0; i < 1000; i++ {
+		versions = append(versions, m)
+		m = m.Set(NewInt(int64(i)), NewInt(int64(i)))
+	}
+	m = m.Delete(NewInt(0)).Set(NewInt(1), NewStr("changed"))
+	for i, v := range versions {
+		if v.Len() != i {
+			t.Fatalf("version %d has %d entries", i, v.Len())
+		}
+		if i > 1 {
+			if val, ok := v.Get(NewInt(1)); !ok || !val.Equal(NewInt(1)) {
+				t.Fatalf("version %d: [1] = %v, %v", i, val, ok)
+			}
+		}
+	}
+	if keys := m.Keys(); len(keys) != 999 || !keys[0].Equal(NewInt(1)) {
+		t.Errorf("after delete and update, keys start %v", keys[:2])
+	}
+}
+
+func TestMapKeys(t *testing.T) {
+	m := NewMap([][2]Value{
+		{NewStr("Name"), NewInt(1)},
+		{NewInt(1), NewInt(2)},
+		{NewObj(1), NewInt(3)},
+		{NewAnon(1), NewInt(4)},
+		{NewFloat(0), NewInt(5)},
+		{NewFloat(math.Copysign(0, -1)), NewInt(6)},
+		{NewFloat(math.NaN()), NewInt(7)},
+	})
+	tests := []struct {
+		key  Value
+		want Value
+	}{
+		{NewStr("NAME"), NewInt(1)},
+		{NewStr("name"), NewInt(1)},
+		{NewInt(1), NewInt(2)},
+		{NewObj(1), NewInt(3)},
+		{NewAnon(1), NewInt(4)},
+		{NewFloat(0), NewInt(5)},
+		{NewFloat(math.Copysign(0, -1)), NewInt(6)},
+		{NewFloat(math.NaN()), NewInt(7)},
+		{NewStr("nam"), nil},
+		{NewErr(E_NONE), nil},
+		{NewInt(2), nil},
+	}
+	for _, tt := range tests {
+		got, ok := m.Get(tt.key)
+		if (tt.want == nil && ok) || (tt.want != nil && (!ok || !got.Equal(tt.want))) {
+			t.Errorf("Get(%s) = %v, %v; want %v", tt.key, got, ok, tt.want)
+		}
+	}
+	// Setting a key again keeps its place, with the new spelling
+	m = m.Set(NewStr("NAME"), NewInt(0))
+	if first := m.Pairs()[0]; first[0].String() != `"NAME"` || !first[1].Equal(NewInt(0)) {
+		t.Errorf("first pair after update = %v", first)
+	}
+}
+
+// TestMapCollisions forces every key into one collision node
+func TestMapCollisions(t *testing.T) {
+	root := emptyHamtNode
+	for i := 0; i < 10; i++ {
+		root, _ = root.set(&hamtEntry{hash: 42, key: NewInt(int64(i)), val: NewInt(int64(i)), seq: uint64(i)}, 0)
+	}
+	for i := 0; i < 10; i += 2 {
+		root, _ = root.delete(42, NewInt(int64(i)), 0)
+	}
+	for i := 0; i < 10; i++ {
+		e := root.get(42, NewInt(int64(i)))
+		if (e != nil) != (i%2 == 1) {
+			t.Errorf("get(%d) = %v", i, e)
+		}
+	}
+}
+
+func TestMapHashAllocations(t *testing.T) {
+	keys := []Value{NewInt(7), NewObj(3), NewFloat(1.5), NewErr(E_PERM), NewStr("Some Key"), NewStr("Ünïcode")}
+	m := NewEmptyMap()
+	for _, k := range keys {
+		m = m.Set(k, k)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, k := range keys {
+			m.Get(k)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Get allocated %v times per run, want 0", allocs)
+	}
+}
+
+func benchmarkKeys(n int) []Value {
+	keys := make([]Value, n)
+	for i := range keys {
+		if i%2 == 0 {
+			keys[i] = NewInt(int64(i))
+		} else {
+			keys[i] = NewStr(fmt.Sprintf("key-%d", i))
+		}
+	}
+	return keys
+}
+
+var mapImplementations = []struct {
+	name  string
+	empty func() MooMap
+}{
+	{"hamt", func() MooMap { return newHamtMap() }},
+	{"copy", newCopyMap},
+}
+
+// BenchmarkMapBuild builds a map one Set at a time, as a verb filling a
+// cache in a loop does
+func BenchmarkMapBuild(b *testing.B) {
+	for _, impl := range mapImplementations {
+		for _, n := range []int{100, 1000, 10000} {
+			keys := benchmarkKeys(n)
+			b.Run(fmt.Sprintf("%s/%d", impl.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					m := impl.empty()
+					for _, k := range keys {
+						m = m.Set(k, k)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMapGet(b *testing.B) {
+	for _, impl := range mapImplementations {
+		for _, n := range []int{100, 10000} {
+			keys := benchmarkKeys(n)
+			m := impl.empty()
+			for _, k := range keys {
+				m = m.Set(k, k)
+			}
+			b.Run(fmt.Sprintf("%s/%d", impl.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					m.Get(keys[i%n])
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMapUpdate(b *testing.B) {
+	for _, impl := range mapImplementations {
+		for _, n := range []int{100, 10000} {
+			keys := benchmarkKeys(n)
+			m := impl.empty()
+			for _, k := range keys {
+				m = m.Set(k, k)
+			}
+			b.Run(fmt.Sprintf("%s/%d", impl.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					k := keys[i%n]
+					m.Delete(k).Set(k, NewInt(int64(i)))
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMapPairs(b *testing.B) {
+	for _, impl := range mapImplementations {
+		keys := benchmarkKeys(10000)
+		m := impl.empty()
+		for _, k := range keys {
+			m = m.Set(k, k)
+		}
+		b.Run(impl.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m.Pairs()
+			}
+		})
+	}
+}
@@ -3,25 +3,100 @@ package types
 import (
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
 )
 
 // StrValue represents a MOO string
 type StrValue struct {
 	val string
+	buf *strBuffer // Backing array val was built in by Concat, if any
 }
 
+// strBuffer is the backing array shared by strings built with Concat.
+//
+// It works like a list's backing array: every string in it is a prefix, and
+// the first string to be extended at a given length claims the spare bytes
+// and writes in place. Bytes below the claim are never written again, so
+// each string stays immutable, and s = s + piece in a loop is amortized
+// O(len(piece)). The strings are always contiguous; nothing ever has to be
+// flattened before indexing, length() or output.
+type strBuffer struct {
+	bytes []byte
+	claim atomic.Int64 // Bytes written so far
+}
+
+// strBufferMin is the shortest concatenation given a buffer; shorter
+// results are copied, which is cheaper than reserving room
+const strBufferMin = 64
+
+// strBufferMaxSlack bounds the spare room a new buffer reserves, so a long
+// string doesn't hold on to as much again
+const strBufferMaxSlack = 1 << 20
+
 // NewStr creates a new string value
 func NewStr(s string) StrValue {
 	return StrValue{val: s}
 }
 
+// Concat returns s followed by t
+func (s StrValue) Concat(t StrValue) StrValue {
+	if t.val == "" {
+		return s
+	}
+	if s.val == "" {
+		return t
+	}
+	n, total := len(s.val), len(s.val)+len(t.val)
+	if b := s.buf; b != nil && total <= len(b.bytes) && b.claim.CompareAndSwap(int64(n), int64(total)) {
+		copy(b.bytes[n:total], t.val)
+		return StrValue{val: unsafe.String(&b.bytes[0], total), buf: b}
+	}
+	if total < strBufferMin {
+		return StrValue{val: s.val + t.val}
+	}
+	// Start a new buffer with room to grow into
+	b := &strBuffer{bytes: make([]byte, total+min(total, strBufferMaxSlack))}
+	copy(b.bytes, s.val)
+	copy(b.bytes[n:], t.val)
+	b.claim.Store(int64(total))
+	return StrValue{val: unsafe.String(&b.bytes[0], total), buf: b}
+}
+
+// Trimmed returns s without its buffer's spare room, copying it if the
+// buffer has any. Values kept in properties are trimmed, so that a string
+// built by Concat doesn't keep up to twice its size for as long as it's
+// stored.
+func (s StrValue) Trimmed() StrValue {
+	if s.buf == nil || len(s.buf.bytes) == len(s.val) {
+		return s
+	}
+	return StrValue{val: strings.Clone(s.val)}
+}
+
+// Len returns the length of the string in bytes
+func (s StrValue) Len() int {
+	return len(s.val)
+}
+
 // String returns the MOO string representation with binary encoding
-// Non-printable characters (< 32 or > 126) are encoded as ~XX
+// Non-printable characters (< 32 or > 126) are encoded as ~XX. In unicode
+// string mode, printable UTF-8 characters are written as they are.
 func (s StrValue) String() string {
 	var result strings.Builder
 	result.WriteByte('"')
+	unicodeMode := UnicodeStrings()
 	for i := 0; i < len(s.val); i++ {
 		b := s.val[i]
+		if b >= utf8.RuneSelf && unicodeMode {
+			if r, size := utf8.DecodeRuneInString(s.val[i:]); size > 1 && unicode.IsPrint(r) {
+				result.WriteString(s.val[i : i+size])
+				i += size - 1
+				continue
+			}
+		}
 		if b == '"' {
 			result.WriteString("\\\"")
 		} else if b == '\\' {
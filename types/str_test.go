@@ -0,0 +1,134 @@
+package types
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestStrConcatVersions keeps every string made by random concatenations,
+// some of them onto old versions, and checks that none sees a later change
+func TestStrConcatVersions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	type version struct {
+		str  StrValue
+		want string
+	}
+	versions := []version{{NewStr(""), ""}}
+	for step := 0; step < 3000; step++ {
+		from := versions[len(versions)-1]
+		if rng.Intn(4) == 0 {
+			from = versions[rng.Intn(len(versions))]
+		}
+		piece := strings.Repeat(string(rune('a'+step%26)), rng.Intn(20))
+		if rng.Intn(10) == 0 {
+			// Concatenating onto the front never writes into a buffer
+			versions = append(versions, version{NewStr(piece).Concat(from.str), piece + from.want})
+			continue
+		}
+		versions = append(versions, version{from.str.Concat(NewStr(piece)), from.want + piece})
+	}
+	for i, v := range versions {
+		if v.str.Value() != v.want || v.str.Len() != len(v.want) {
+			t.Fatalf("version %d: got %q, want %q", i, v.str.Value(), v.want)
+		}
+	}
+}
+
+func TestStrConcatSharesBuffer(t *testing.T) {
+	s := NewStr(strings.Repeat("x", strBufferMin))
+	s = s.Concat(NewStr("y"))
+	if s.buf == nil {
+		t.Fatal("long concatenation has no buffer")
+	}
+	a := s.Concat(NewStr("a"))
+	b := s.Concat(NewStr("b"))
+	if a.buf != s.buf {
+		t.Error("first concatenation did not extend the buffer")
+	}
+	if b.buf == s.buf {
+		t.Error("second concatenation at the same length wrote into the buffer")
+	}
+	if !strings.HasSuffix(a.Value(), "ya") || !strings.HasSuffix(b.Value(), "yb") || !strings.HasSuffix(s.Value(), "xy") {
+		t.Errorf("got %q, %q, %q", s.Value(), a.Value(), b.Value())
+	}
+	if !a.Equal(NewStr(strings.Repeat("X", strBufferMin) + "YA")) {
+		t.Error("buffered string does not compare case-insensitively")
+	}
+	if short := NewStr("a").Concat(NewStr("b")); short.buf != nil || short.Value() != "ab" {
+		t.Errorf("short concatenation = %q with buffer %v", short.Value(), short.buf)
+	}
+}
+
+func BenchmarkStrConcat(b *testing.B) {
+	piece := NewStr("0123456789")
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("concat/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s := NewStr("")
+				for j := 0; j < n; j++ {
+					s = s.Concat(piece)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("copy/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s := NewStr("")
+				for j := 0; j < n; j++ {
+					s = NewStr(s.Value() + piece.Value())
+				}
+			}
+		})
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	s := "naïve 日本" // ï and the two kanji are multibyte
+	if StrLen(s) != len(s) || StrSlice(s, 2, 4) != s[2:4] {
+		t.Errorf("byte mode: StrLen = %d, StrSlice = %q", StrLen(s), StrSlice(s, 2, 4))
+	}
+
+	SetUnicodeStrings(true)
+	defer SetUnicodeStrings(false)
+	if n := StrLen(s); n != 8 {
+		t.Errorf("StrLen = %d, want 8", n)
+	}
+	if got := StrSlice(s, 2, 3); got != "ï" {
+		t.Errorf("StrSlice(2, 3) = %q", got)
+	}
+	if got := StrSlice(s, 6, 100); got != "日本" {
+		t.Errorf("StrSlice(6, 100) = %q", got)
+	}
+	if got := StrOffset(s, 3); got != 4 {
+		t.Errorf("StrOffset(3) = %d, want 4", got)
+	}
+	if got := StrChars("a\xffé"); len(got) != 3 || got[1] != "\xff" || got[2] != "é" {
+		t.Errorf("StrChars = %q", got)
+	}
+	if got := NewStr("é\xff\n").String(); got != `"é~FF~0A"` {
+		t.Errorf("String() = %s", got)
+	}
+	SetUnicodeStrings(false)
+	if got := NewStr("é").String(); got != `"~C3~A9"` {
+		t.Errorf("byte mode String() = %s", got)
+	}
+}
+
+func TestStrTrimmed(t *testing.T) {
+	s := NewStr(strings.Repeat("x", strBufferMin)).Concat(NewStr("y"))
+	trimmed := s.Trimmed()
+	if trimmed.buf != nil || trimmed.Value() != s.Value() {
+		t.Errorf("Trimmed() = %q with buffer %v, want %q on its own", trimmed.Value(), trimmed.buf, s.Value())
+	}
+	if plain := NewStr("plain"); plain.Trimmed().Value() != "plain" {
+		t.Error("Trimmed() changed a plain string")
+	}
+
+	long := NewStr(strings.Repeat("x", 2*strBufferMaxSlack)).Concat(NewStr("y"))
+	if spare := len(long.buf.bytes) - long.Len(); spare != strBufferMaxSlack {
+		t.Errorf("a long concatenation reserved %d spare bytes, want %d", spare, strBufferMaxSlack)
+	}
+}
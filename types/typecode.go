@@ -4,16 +4,17 @@ package types
 type TypeCode int
 
 const (
-	TYPE_INT   TypeCode = 0
-	TYPE_OBJ   TypeCode = 1
-	TYPE_STR   TypeCode = 2
-	TYPE_ERR   TypeCode = 3
-	TYPE_LIST  TypeCode = 4
-	TYPE_FLOAT TypeCode = 9
-	TYPE_MAP   TypeCode = 10
-	TYPE_ANON  TypeCode = 12
-	TYPE_WAIF  TypeCode = 13
-	TYPE_BOOL  TypeCode = 14
+	TYPE_INT    TypeCode = 0
+	TYPE_OBJ    TypeCode = 1
+	TYPE_STR    TypeCode = 2
+	TYPE_ERR    TypeCode = 3
+	TYPE_LIST   TypeCode = 4
+	TYPE_FLOAT  TypeCode = 9
+	TYPE_MAP    TypeCode = 10
+	TYPE_ANON   TypeCode = 12
+	TYPE_WAIF   TypeCode = 13
+	TYPE_BOOL   TypeCode = 14
+	TYPE_LAMBDA TypeCode = 15
 )
 
 // String returns the string representation of the type code
@@ -39,6 +40,8 @@ func (t TypeCode) String() string {
 		return "WAIF"
 	case TYPE_BOOL:
 		return "BOOL"
+	case TYPE_LAMBDA:
+		return "LAMBDA"
 	default:
 		return "UNKNOWN"
 	}
@@ -17,6 +17,7 @@ func TestTypeCodes(t *testing.T) {
 		{TYPE_MAP, 10, "MAP"},
 		{TYPE_WAIF, 13, "WAIF"},
 		{TYPE_BOOL, 14, "BOOL"},
+		{TYPE_LAMBDA, 15, "LAMBDA"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// unicodeStrings is the unicode_strings server option. When it is set, the
+// string builtins and indexing operators count characters as UTF-8 runes;
+// otherwise, as in LambdaMOO, every byte is a character.
+var unicodeStrings atomic.Bool
+
+// SetUnicodeStrings turns unicode string mode on or off
+func SetUnicodeStrings(on bool) {
+	unicodeStrings.Store(on)
+}
+
+// UnicodeStrings reports whether strings are counted in runes
+func UnicodeStrings() bool {
+	return unicodeStrings.Load()
+}
+
+// StrLen returns the number of characters in s
+func StrLen(s string) int {
+	if !unicodeStrings.Load() {
+		return len(s)
+	}
+	return utf8.RuneCountInString(s)
+}
+
+// StrOffset returns the byte offset of the character after the first n in
+// s, or len(s) if s has no more than n characters
+func StrOffset(s string, n int) int {
+	if !unicodeStrings.Load() {
+		return min(max(n, 0), len(s))
+	}
+	i := 0
+	for ; n > 0 && i < len(s); n-- {
+		if s[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
+
+// StrSlice returns characters from through to-1 of s, counting from 0.
+// Offsets past the end of s are taken as the end.
+func StrSlice(s string, from, to int) string {
+	start := StrOffset(s, from)
+	if to <= from {
+		return ""
+	}
+	return s[start : start+StrOffset(s[start:], to-from)]
+}
+
+// StrChars splits s into its characters
+func StrChars(s string) []string {
+	chars := make([]string, 0, StrLen(s))
+	for s != "" {
+		n := StrOffset(s, 1)
+		chars = append(chars, s[:n])
+		s = s[n:]
+	}
+	return chars
+}
@@ -1,6 +1,9 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
 // WaifValue represents a MOO waif (lightweight object)
 // WAIFs are prototype-based lightweight objects with properties
@@ -74,6 +77,12 @@ func (w WaifValue) SetProperty(name string, value Value) WaifValue {
 	return w
 }
 
+// Identity returns a key shared by every copy of this waif and no other.
+// Waifs made with NewWaif are distinct; zero waifs all share key 0.
+func (w WaifValue) Identity() uintptr {
+	return reflect.ValueOf(w.properties).Pointer()
+}
+
 // PropertyNames returns the names of all properties set on this WAIF.
 func (w WaifValue) PropertyNames() []string {
 	names := make([]string, 0, len(w.properties))
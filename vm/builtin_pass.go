@@ -89,7 +89,7 @@ func (e *Evaluator) RegisterPassBuiltin() {
 			}
 
 			// Check verb aliases
-			for _, v := range obj.Verbs {
+			for _, v := range obj.VerbList {
 				for _, alias := range v.Names {
 					if alias == verbName {
 						verb = v
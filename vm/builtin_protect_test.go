@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"barn/builtins"
+	"barn/db"
+	"barn/task"
+	"barn/types"
+	"testing"
+)
+
+// TestProtectedBuiltins verifies protect_<name> options: calls from outside
+// #0 go to #0:bf_<name> when it exists, and otherwise need a wizard.
+func TestProtectedBuiltins(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+
+	system := db.NewObject(0, 2)
+	system.Properties["server_options"] = &db.Property{Name: "server_options", Value: types.NewObj(1), Owner: 2, Defined: true}
+	options := db.NewObject(1, 2)
+	options.Properties["protect_length"] = &db.Property{Name: "protect_length", Value: types.NewInt(1), Owner: 2, Defined: true}
+	options.Properties["protect_tostr"] = &db.Property{Name: "protect_tostr", Value: types.NewInt(1), Owner: 2, Defined: true}
+	options.Properties["protect_typeof"] = &db.Property{Name: "protect_typeof", Value: types.NewInt(0), Owner: 2, Defined: true}
+	wizard := db.NewObject(2, 2)
+	wizard.Flags = db.FlagWizard | db.FlagProgrammer
+	thing := db.NewObject(3, 2)
+	for _, obj := range []*db.Object{system, options, wizard, thing} {
+		store.Add(obj)
+	}
+
+	addVerb := func(obj *db.Object, name string, code ...string) {
+		v := &db.Verb{
+			Name:    name,
+			Names:   []string{name},
+			Owner:   2,
+			Perms:   db.VerbExecute | db.VerbRead | db.VerbDebug,
+			ArgSpec: db.VerbArgs{This: "this", Prep: "none", That: "none"},
+			Code:    code,
+		}
+		obj.Verbs[name] = v
+		obj.VerbList = append(obj.VerbList, v)
+	}
+	// The wrapper runs on #0, so its own length() call reaches the builtin
+	addVerb(system, "bf_length", `return {"wrapped", length(@args)};`)
+	addVerb(thing, "measure", `return length("abc");`)
+	addVerb(thing, "stringify", `return tostr(1);`)
+	addVerb(thing, "indirect", `return call_function("length", "abcd");`)
+	addVerb(thing, "kind", `return typeof(1);`)
+
+	if n := builtins.LoadServerOptionsFromStore(store); n != 2 {
+		t.Errorf("LoadServerOptionsFromStore loaded %d options, want 2", n)
+	}
+	t.Cleanup(func() { builtins.LoadServerOptionsFromStore(nil) })
+
+	run := func(name string, wizard bool) types.Result {
+		t.Helper()
+		prog, err := CompileVerbBytecode(thing.Verbs[name], reg)
+		if err != nil {
+			t.Fatalf("compile %s: %v", name, err)
+		}
+		ctx := types.NewTaskContext()
+		ctx.Player = 2
+		ctx.Programmer = 2
+		ctx.IsWizard = wizard
+		ctx.ThisObj = 3
+		ctx.Task = task.NewTask(1, 2, 100000, 5.0)
+		machine := NewVM(store, reg)
+		machine.Context = ctx
+		return machine.RunWithVerbContext(prog, 3, 2, 2, name, 3, nil)
+	}
+
+	want := types.NewList([]types.Value{types.NewStr("wrapped"), types.NewInt(3)})
+	if result := run("measure", false); result.Flow != types.FlowReturn || !result.Val.Equal(want) {
+		t.Errorf("length() with a wrapper: got flow %v value %v error %v, want %s", result.Flow, result.Val, result.Error, want)
+	}
+	want = types.NewList([]types.Value{types.NewStr("wrapped"), types.NewInt(4)})
+	if result := run("indirect", false); result.Flow != types.FlowReturn || !result.Val.Equal(want) {
+		t.Errorf("call_function(\"length\") with a wrapper: got %v %v, want %s", result.Val, result.Error, want)
+	}
+	if result := run("stringify", false); result.Error != types.E_PERM {
+		t.Errorf("protected tostr() from a non-wizard: got error %v, want E_PERM", result.Error)
+	}
+	if result := run("stringify", true); result.Flow != types.FlowReturn || !result.Val.Equal(types.NewStr("1")) {
+		t.Errorf("protected tostr() from a wizard: got %v %v, want \"1\"", result.Val, result.Error)
+	}
+	if result := run("kind", false); result.Flow != types.FlowReturn {
+		t.Errorf("typeof() with protect_typeof = 0: got error %v", result.Error)
+	}
+
+	builtins.LoadServerOptionsFromStore(nil)
+	if builtins.IsBuiltinProtected("length") {
+		t.Error("protect flags survived a reload without $server_options")
+	}
+}
@@ -407,3 +407,74 @@ func TestBuiltinExceptionTracebackLines(t *testing.T) {
 		t.Fatalf("frame 2 mismatch: verb=%s line=%d (want c line 2)", stack[2].Verb, stack[2].LineNumber)
 	}
 }
+
+// TestStackDepthLimit verifies that runaway recursion through verb calls,
+// pass() and eval() raises E_MAXREC once max_stack_depth activations exist.
+func TestStackDepthLimit(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+
+	parent := db.NewObject(1, 1)
+	parent.Flags = db.FlagProgrammer
+	child := db.NewObject(2, 1)
+	child.Parents = []types.ObjID{1}
+	parent.Children = []types.ObjID{2}
+	store.Add(parent)
+	store.Add(child)
+
+	addVerb := func(obj *db.Object, name string, code ...string) {
+		v := &db.Verb{
+			Name:    name,
+			Names:   []string{name},
+			Owner:   1,
+			Perms:   db.VerbExecute | db.VerbRead | db.VerbDebug,
+			ArgSpec: db.VerbArgs{This: "this", Prep: "none", That: "none"},
+			Code:    code,
+		}
+		obj.Verbs[name] = v
+		obj.VerbList = append(obj.VerbList, v)
+	}
+	addVerb(parent, "recurse", "return this:recurse();")
+	addVerb(parent, "guarded", "try", "return this:recurse();", "except (E_MAXREC)", "return \"caught\";", "endtry")
+	addVerb(parent, "bounce", "return this:bounce();")
+	addVerb(child, "bounce", "return pass();")
+	addVerb(parent, "nested_eval", "return eval(\"return #1:nested_eval();\");")
+
+	run := func(objID types.ObjID, name string) types.Result {
+		t.Helper()
+		verb, verbLoc, err := store.FindVerb(objID, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, err := CompileVerbBytecode(verb, reg)
+		if err != nil {
+			t.Fatalf("compile %s: %v", name, err)
+		}
+		ctx := types.NewTaskContext()
+		ctx.Player = 1
+		ctx.Programmer = 1
+		ctx.ThisObj = objID
+		ctx.Task = task.NewTask(1, 1, 100000, 5.0)
+		machine := NewVM(store, reg)
+		machine.Context = ctx
+		return machine.RunWithVerbContext(prog, objID, 1, 1, name, verbLoc, nil)
+	}
+
+	result := run(1, "recurse")
+	if result.Flow != types.FlowException || result.Error != types.E_MAXREC {
+		t.Fatalf("recurse: got flow %v error %v, want E_MAXREC", result.Flow, result.Error)
+	}
+	if stack, ok := result.CallStack.([]task.ActivationFrame); !ok || len(stack) != builtins.GetMaxStackDepth() {
+		t.Errorf("recurse: traceback has %d frames, want %d", len(stack), builtins.GetMaxStackDepth())
+	}
+
+	if result := run(1, "guarded"); result.Flow != types.FlowReturn || !result.Val.Equal(types.NewStr("caught")) {
+		t.Errorf("guarded: got flow %v value %v, want \"caught\"", result.Flow, result.Val)
+	}
+	if result := run(2, "bounce"); result.Error != types.E_MAXREC {
+		t.Errorf("bounce through pass(): got error %v, want E_MAXREC", result.Error)
+	}
+	if result := run(1, "nested_eval"); result.Error != types.E_MAXREC {
+		t.Errorf("nested_eval: got error %v, want E_MAXREC", result.Error)
+	}
+}
@@ -104,6 +104,9 @@ func (c *Compiler) Compile(node parser.Node) (*Program, error) {
 	// End global scope
 	c.endScope()
 
+	if OptimizeEnabled() {
+		Optimize(c.program)
+	}
 	return c.program, nil
 }
 
@@ -154,6 +157,9 @@ func (c *Compiler) CompileStatements(stmts []parser.Stmt) (*Program, error) {
 	// so program.VarNames[idx] == name for all entries in c.variables.
 	// No extra work needed here — VarNames is populated incrementally.
 
+	if OptimizeEnabled() {
+		Optimize(c.program)
+	}
 	return c.program, nil
 }
 
@@ -459,6 +465,8 @@ func (c *Compiler) compileNode(node parser.Node) error {
 		return c.compileListRange(n)
 	case *parser.MapExpr:
 		return c.compileMap(n)
+	case *parser.LambdaExpr:
+		return c.compileLambda(n)
 
 	// Statements
 	case *parser.ExprStmt:
@@ -542,17 +550,18 @@ func (c *Compiler) emitIntLiteral(v int64) {
 // builtinConstants maps MOO type constant names to their integer values.
 // These are always available in any scope without explicit declaration.
 var builtinConstants = map[string]types.Value{
-	"INT":   types.NewInt(int64(types.TYPE_INT)),
-	"NUM":   types.NewInt(int64(types.TYPE_INT)), // alias for INT
-	"OBJ":   types.NewInt(int64(types.TYPE_OBJ)),
-	"STR":   types.NewInt(int64(types.TYPE_STR)),
-	"ERR":   types.NewInt(int64(types.TYPE_ERR)),
-	"LIST":  types.NewInt(int64(types.TYPE_LIST)),
-	"FLOAT": types.NewInt(int64(types.TYPE_FLOAT)),
-	"MAP":   types.NewInt(int64(types.TYPE_MAP)),
-	"ANON":  types.NewInt(int64(types.TYPE_ANON)),
-	"WAIF":  types.NewInt(int64(types.TYPE_WAIF)),
-	"BOOL":  types.NewInt(int64(types.TYPE_BOOL)),
+	"INT":    types.NewInt(int64(types.TYPE_INT)),
+	"NUM":    types.NewInt(int64(types.TYPE_INT)), // alias for INT
+	"OBJ":    types.NewInt(int64(types.TYPE_OBJ)),
+	"STR":    types.NewInt(int64(types.TYPE_STR)),
+	"ERR":    types.NewInt(int64(types.TYPE_ERR)),
+	"LIST":   types.NewInt(int64(types.TYPE_LIST)),
+	"FLOAT":  types.NewInt(int64(types.TYPE_FLOAT)),
+	"MAP":    types.NewInt(int64(types.TYPE_MAP)),
+	"ANON":   types.NewInt(int64(types.TYPE_ANON)),
+	"WAIF":   types.NewInt(int64(types.TYPE_WAIF)),
+	"BOOL":   types.NewInt(int64(types.TYPE_BOOL)),
+	"LAMBDA": types.NewInt(int64(types.TYPE_LAMBDA)),
 }
 
 // compileIdentifier compiles a variable reference
@@ -1365,12 +1374,17 @@ func (c *Compiler) compileBuiltinCall(n *parser.BuiltinCallExpr) error {
 	// Resolve function name to numeric ID at compile time
 	funcID, ok := c.registry.GetID(n.Name)
 	if !ok {
+		// Not a builtin: f(args) calls the lambda in variable f
+		if idx, isVar := c.resolveVariable(n.Name); isVar {
+			return c.compileLambdaCall(idx, n.Args)
+		}
 		return fmt.Errorf("unknown builtin function: %s", n.Name)
 	}
 
-	// Check builtin function ID overflow (emitted as single byte)
-	if funcID > 255 {
-		return fmt.Errorf("too many builtin functions (id %d exceeds max 255)", funcID)
+	// Check builtin function ID overflow. IDs are emitted as a 16-bit
+	// operand: more than 256 builtins are registered, so a byte won't do
+	if funcID > 0xFFFF {
+		return fmt.Errorf("too many builtin functions (id %d exceeds max 65535)", funcID)
 	}
 
 	// Check if any argument is a splice expression
@@ -1400,7 +1414,7 @@ func (c *Compiler) compileBuiltinCall(n *parser.BuiltinCallExpr) error {
 		}
 		// argc=0xFF signals that args list is on top of stack
 		c.emit(OP_CALL_BUILTIN)
-		c.emitByte(byte(funcID))
+		c.emitShort(uint16(funcID))
 		c.emitByte(0xFF)
 	} else {
 		// Fast path: no splices, push args directly
@@ -1410,7 +1424,7 @@ func (c *Compiler) compileBuiltinCall(n *parser.BuiltinCallExpr) error {
 			}
 		}
 		c.emit(OP_CALL_BUILTIN)
-		c.emitByte(byte(funcID))
+		c.emitShort(uint16(funcID))
 		c.emitByte(byte(len(n.Args)))
 	}
 
@@ -2686,6 +2700,92 @@ func (c *Compiler) compileFork(n *parser.ForkStmt) error {
 	return nil
 }
 
+func (c *Compiler) compileLambda(n *parser.LambdaExpr) error {
+	// Lambda expression: {params} => body
+	//
+	// Bytecode layout:
+	//   OP_MAKE_LAMBDA <argsVar> <srcIdx> <bodyLen:short>  -- pushes the lambda, jumps over body
+	//   [scatter argsVar into params]
+	//   [body expression]
+	//   OP_RETURN
+	//
+	// A call runs the body in a new frame holding a copy of the variables
+	// captured when the lambda was made, with the arguments in argsVar.
+	argsName := c.tempVar("lambda_args")
+	argsVar := c.declareVariable(argsName)
+	srcIdx := c.addConstant(types.NewStr(parser.UnparseExpr(n)))
+
+	c.emit(OP_MAKE_LAMBDA)
+	c.emitByte(byte(argsVar))
+	c.emitByte(byte(srcIdx))
+	bodyLenPatch := len(c.program.Code)
+	c.emitShort(0xFFFF) // placeholder for body length
+
+	bodyStart := c.currentOffset()
+	params := &parser.ScatterStmt{
+		Pos:     n.Pos,
+		Targets: n.Params,
+		Value:   &parser.IdentifierExpr{Pos: n.Pos, Name: argsName},
+	}
+	if err := c.compileScatter(params); err != nil {
+		return err
+	}
+	if err := c.compileNode(n.Body); err != nil {
+		return err
+	}
+	c.emit(OP_RETURN)
+
+	bodyLen := c.currentOffset() - bodyStart
+	if bodyLen > 0xFFFF {
+		return fmt.Errorf("lambda body too large (max 65535 bytes, got %d)", bodyLen)
+	}
+	c.program.Code[bodyLenPatch] = byte(bodyLen >> 8)
+	c.program.Code[bodyLenPatch+1] = byte(bodyLen)
+	return nil
+}
+
+// compileLambdaCall compiles f(args) where f is a variable
+func (c *Compiler) compileLambdaCall(varIdx int, args []parser.Expr) error {
+	hasSplice := hasSpliceArgs(args)
+	if !hasSplice && len(args) > 254 {
+		return fmt.Errorf("too many arguments (max 254)")
+	}
+
+	c.emit(OP_GET_VAR)
+	c.emitByte(byte(varIdx))
+
+	if hasSplice {
+		// argc=0xFF signals that args list is on top of stack
+		c.emit(OP_MAKE_LIST)
+		c.emitByte(0)
+		for _, arg := range args {
+			if splice, ok := arg.(*parser.SpliceExpr); ok {
+				if err := c.compileNode(splice.Expr); err != nil {
+					return err
+				}
+				c.emit(OP_LIST_EXTEND)
+			} else {
+				if err := c.compileNode(arg); err != nil {
+					return err
+				}
+				c.emit(OP_LIST_APPEND)
+			}
+		}
+		c.emit(OP_CALL_LAMBDA)
+		c.emitByte(0xFF)
+		return nil
+	}
+
+	for _, arg := range args {
+		if err := c.compileNode(arg); err != nil {
+			return err
+		}
+	}
+	c.emit(OP_CALL_LAMBDA)
+	c.emitByte(byte(len(args)))
+	return nil
+}
+
 // isLoopStmt returns true if a statement node is a loop (pushes a result value).
 func isLoopStmt(stmt parser.Stmt) bool {
 	switch stmt.(type) {
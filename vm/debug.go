@@ -0,0 +1,175 @@
+package vm
+
+import (
+	"barn/db"
+	"barn/debug"
+	"barn/parser"
+	"barn/task"
+	"barn/types"
+	"fmt"
+	"strings"
+)
+
+// debugStop pauses the task before frame's next instruction when it starts
+// a line with a breakpoint or ends a pending step. Reports whether the VM
+// yielded.
+func (vm *VM) debugStop(frame *StackFrame) bool {
+	if !vm.Debuggable || vm.Context == nil || frame.Program == nil {
+		return false
+	}
+	line := frame.Program.LineForIP(frame.IP)
+	if line == frame.debugLine {
+		return false
+	}
+	frame.debugLine = line
+
+	t, ok := vm.Context.Task.(*task.Task)
+	if !ok || t == nil {
+		return false
+	}
+	loc := debug.Location{Object: frame.VerbLoc, Verb: frame.Verb, Line: line}
+	reason, bp := debug.Check(t.ID, len(vm.Frames), loc)
+	if reason == "" {
+		return false
+	}
+
+	t.PauseDebug()
+	debug.Pause(t, &debugTarget{vm: vm}, reason, bp, len(vm.Frames))
+	vm.yielded = true
+	vm.yieldResult = types.Suspend(-1)
+	return true
+}
+
+// debugTarget exposes a paused VM to the debugger
+type debugTarget struct {
+	vm *VM
+}
+
+// frame returns the i'th frame counting from the innermost
+func (d *debugTarget) frame(i int) (*StackFrame, error) {
+	if i < 0 || i >= len(d.vm.Frames) {
+		return nil, fmt.Errorf("no frame %d", i)
+	}
+	return d.vm.Frames[len(d.vm.Frames)-1-i], nil
+}
+
+// programmer returns the permissions the i'th frame runs with; callers'
+// permissions are saved in the frame above them
+func (d *debugTarget) programmer(i int) types.ObjID {
+	if i > 0 {
+		above := d.vm.Frames[len(d.vm.Frames)-i]
+		if above.IsVerbCall || above.IsEvalFrame {
+			return above.SavedProgrammer
+		}
+	}
+	return d.vm.Context.Programmer
+}
+
+func (d *debugTarget) Frames() []debug.Frame {
+	frames := make([]debug.Frame, 0, len(d.vm.Frames))
+	for i := range d.vm.Frames {
+		f, _ := d.frame(i)
+		// The innermost frame is stopped before the instruction at IP;
+		// the others are inside the call made by the instruction before IP
+		ip := f.IP
+		if i > 0 && ip > 0 {
+			ip--
+		}
+		frames = append(frames, debug.Frame{
+			This:       f.This,
+			Player:     f.Player,
+			Programmer: d.programmer(i),
+			Verb:       f.Verb,
+			VerbLoc:    f.VerbLoc,
+			Line:       f.Program.LineForIP(ip),
+			Eval:       f.IsEvalFrame,
+		})
+	}
+	return frames
+}
+
+func (d *debugTarget) Variables(i int) ([]debug.Variable, error) {
+	f, err := d.frame(i)
+	if err != nil {
+		return nil, err
+	}
+	var vars []debug.Variable
+	for j, name := range f.Program.VarNames {
+		if j >= len(f.Locals) || isCompilerTemp(name) {
+			continue
+		}
+		if _, unbound := f.Locals[j].(types.UnboundValue); unbound || f.Locals[j] == nil {
+			continue
+		}
+		vars = append(vars, debug.Variable{Name: name, Value: f.Locals[j]})
+	}
+	return vars, nil
+}
+
+// Evaluate runs code on a separate VM whose frame starts with a copy of
+// the paused frame's variables; assignments are copied back
+func (d *debugTarget) Evaluate(i int, code string) (types.Value, error) {
+	f, err := d.frame(i)
+	if err != nil {
+		return nil, err
+	}
+	stmts, err := parser.NewParser("return " + strings.TrimSuffix(strings.TrimSpace(code), ";") + ";").ParseProgram()
+	if err != nil {
+		if stmts, err = parser.NewParser(code).ParseProgram(); err != nil {
+			return nil, err
+		}
+	}
+	prog, err := NewCompilerWithRegistry(d.vm.Builtins).CompileStatements(stmts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := types.NewTaskContext()
+	ctx.Player = f.Player
+	ctx.Programmer = d.programmer(i)
+	ctx.ThisObj = f.This
+	ctx.Verb = f.Verb
+	ctx.TaskID = d.vm.Context.TaskID
+	progObj := d.vm.Store.Get(ctx.Programmer)
+	ctx.IsWizard = progObj != nil && progObj.Flags.Has(db.FlagWizard)
+
+	evalVM := NewVM(d.vm.Store, d.vm.Builtins)
+	evalVM.Context = ctx
+	evalVM.TickLimit = 30000
+	ef := evalVM.PrepareVerbFrame(prog, f.This, f.Player, f.Caller, f.Verb, f.VerbLoc, f.Args)
+	for j, name := range f.Program.VarNames {
+		if j < len(f.Locals) && !isCompilerTemp(name) {
+			setLocalByName(ef, prog, name, f.Locals[j])
+		}
+	}
+
+	result := evalVM.ExecuteLoop()
+
+	for j, name := range f.Program.VarNames {
+		if j >= len(f.Locals) || isCompilerTemp(name) {
+			continue
+		}
+		for k, evalName := range prog.VarNames {
+			if evalName == name {
+				f.Locals[j] = ef.Locals[k]
+				break
+			}
+		}
+	}
+
+	if result.Flow == types.FlowException {
+		if msg, ok := result.Val.(types.StrValue); ok {
+			return nil, fmt.Errorf("%s", msg.Value())
+		}
+		return nil, fmt.Errorf("%s", result.Error)
+	}
+	if result.Val == nil {
+		return types.NewInt(0), nil
+	}
+	return result.Val, nil
+}
+
+// isCompilerTemp reports whether a variable was introduced by the compiler
+func isCompilerTemp(name string) bool {
+	return strings.HasPrefix(name, "__")
+}
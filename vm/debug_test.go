@@ -0,0 +1,143 @@
+package vm
+
+import (
+	"barn/db"
+	"barn/debug"
+	"barn/task"
+	"barn/types"
+	"testing"
+)
+
+// TestDebuggerBreakpointsAndStepping pauses a task at a breakpoint, inspects
+// and changes its frame, then steps into a call and back out.
+func TestDebuggerBreakpointsAndStepping(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+
+	obj := db.NewObject(1, 1)
+	obj.Flags = db.FlagProgrammer | db.FlagWizard
+	store.Add(obj)
+	addVerb := func(name string, code ...string) {
+		v := &db.Verb{
+			Name:    name,
+			Names:   []string{name},
+			Owner:   1,
+			Perms:   db.VerbExecute | db.VerbRead | db.VerbDebug,
+			ArgSpec: db.VerbArgs{This: "this", Prep: "none", That: "none"},
+			Code:    code,
+		}
+		obj.Verbs[name] = v
+		obj.VerbList = append(obj.VerbList, v)
+	}
+	addVerb("outer", "x = 1;", "y = this:inner(x);", "return y + 1;")
+	addVerb("inner", "z = args[1] * 10;", "return z;")
+
+	if _, errCode := debug.SetBreakpoint(store, 1, "outer", 9); errCode != types.E_INVARG {
+		t.Errorf("breakpoint past the last line: got %v, want E_INVARG", errCode)
+	}
+	if _, errCode := debug.SetBreakpoint(store, 1, "missing", 1); errCode != types.E_VERBNF {
+		t.Errorf("breakpoint on a missing verb: got %v, want E_VERBNF", errCode)
+	}
+	bp, errCode := debug.SetBreakpoint(store, 1, "outer", 2)
+	if errCode != types.E_NONE {
+		t.Fatalf("SetBreakpoint: %v", errCode)
+	}
+	t.Cleanup(debug.ClearBreakpoints)
+
+	prog, err := CompileVerbBytecode(obj.Verbs["outer"], reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := task.NewTask(7, 1, 100000, 5.0)
+	ctx := types.NewTaskContext()
+	ctx.Player = 1
+	ctx.Programmer = 1
+	ctx.IsWizard = true
+	ctx.ThisObj = 1
+	ctx.Task = tk
+	ctx.TaskID = tk.ID
+	machine := NewVM(store, reg)
+	machine.Context = ctx
+	machine.Debuggable = true
+	t.Cleanup(func() { debug.Forget(tk.ID) })
+
+	// paused checks the task stopped at verb:line and returns its session
+	paused := func(result types.Result, verb string, line int, reason string) *debug.Session {
+		t.Helper()
+		if result.Flow != types.FlowSuspend {
+			t.Fatalf("got flow %v (%v), want the task paused at %s line %d", result.Flow, result.Val, verb, line)
+		}
+		s := debug.Lookup(tk.ID)
+		if s == nil || s.Reason != reason {
+			t.Fatalf("session = %+v, want reason %q", s, reason)
+		}
+		if top := s.Target.Frames()[0]; top.Verb != verb || top.Line != line {
+			t.Fatalf("stopped at %s line %d, want %s line %d", top.Verb, top.Line, verb, line)
+		}
+		return s
+	}
+	eval := func(s *debug.Session, frame int, code string) types.Value {
+		t.Helper()
+		val, err := s.Target.Evaluate(frame, code)
+		if err != nil {
+			t.Fatalf("Evaluate(%q): %v", code, err)
+		}
+		return val
+	}
+
+	s := paused(machine.RunWithVerbContext(prog, 1, 1, 1, "outer", 1, nil), "outer", 2, debug.ReasonBreakpoint)
+	if s.Breakpoint != bp.ID || debug.Breakpoints()[0].Hits != 1 {
+		t.Errorf("session breakpoint %d, hits %d; want breakpoint %d hit once", s.Breakpoint, debug.Breakpoints()[0].Hits, bp.ID)
+	}
+	if tk.Resume(types.NewInt(0)) {
+		t.Error("resume() continued a task paused by the debugger")
+	}
+	vars, _ := s.Target.Variables(0)
+	locals := map[string]types.Value{}
+	for _, v := range vars {
+		locals[v.Name] = v.Value
+	}
+	if !locals["x"].Equal(types.NewInt(1)) || !locals["this"].Equal(types.NewObj(1)) {
+		t.Errorf("locals = %v, want x = 1 and this = #1", locals)
+	}
+	if _, bound := locals["y"]; bound {
+		t.Error("y is listed before it is assigned")
+	}
+	if val := eval(s, 0, "x + 41"); !val.Equal(types.NewInt(42)) {
+		t.Errorf("x + 41 = %v", val)
+	}
+	eval(s, 0, "x = 5;")
+	if _, err := s.Target.Evaluate(0, "1 +"); err == nil {
+		t.Error("Evaluate accepted a syntax error")
+	}
+
+	// Step into inner(), then out to the line after the call
+	if err := debug.Continue(tk.ID, debug.StepIn); err != nil {
+		t.Fatal(err)
+	}
+	s = paused(machine.Resume(), "inner", 1, debug.ReasonStep)
+	frames := s.Target.Frames()
+	if len(frames) != 2 || frames[1].Verb != "outer" || frames[1].Line != 2 {
+		t.Fatalf("frames = %+v, want inner called from outer line 2", frames)
+	}
+	if val := eval(s, 1, "x"); !val.Equal(types.NewInt(5)) {
+		t.Errorf("caller's x = %v, want the assigned 5", val)
+	}
+	if err := debug.Continue(tk.ID, debug.StepOut); err != nil {
+		t.Fatal(err)
+	}
+	s = paused(machine.Resume(), "outer", 3, debug.ReasonStep)
+	if val := eval(s, 0, "y"); !val.Equal(types.NewInt(50)) {
+		t.Errorf("y = %v, want 50", val)
+	}
+
+	if err := debug.Continue(tk.ID, debug.StepNone); err != nil {
+		t.Fatal(err)
+	}
+	if result := machine.Resume(); result.Flow != types.FlowReturn || !result.Val.Equal(types.NewInt(51)) {
+		t.Errorf("after continue: got flow %v value %v, want 51", result.Flow, result.Val)
+	}
+	if debug.Lookup(tk.ID) != nil {
+		t.Error("session survived continue")
+	}
+}
@@ -30,6 +30,7 @@ func NewEnvironment() *Environment {
 	env.vars["ANON"] = types.NewInt(int64(types.TYPE_ANON))
 	env.vars["WAIF"] = types.NewInt(int64(types.TYPE_WAIF))
 	env.vars["BOOL"] = types.NewInt(int64(types.TYPE_BOOL))
+	env.vars["LAMBDA"] = types.NewInt(int64(types.TYPE_LAMBDA))
 
 	// Define special object constants
 	env.vars["$nothing"] = types.NewObj(types.ObjNothing)
@@ -196,6 +196,11 @@ func BuildVMRegistry(store *db.Store) *builtins.Registry {
 			return types.Ok(types.NewList([]types.Value{types.NewInt(1), result.Val}))
 		}
 
+		// Nested eval() counts against max_stack_depth like a verb call
+		if callerVM.checkStackDepth() != nil {
+			return types.Err(types.E_MAXREC)
+		}
+
 		// Push eval frame on the calling VM (same activation stack).
 		// Save current context for restore on return/unwind.
 		frame := &StackFrame{
@@ -262,6 +267,15 @@ func BuildVMRegistry(store *db.Store) *builtins.Registry {
 		return types.Result{Flow: types.FlowEvalPush}
 	})
 
+	// Builtins such as map() call lambdas on the VM that called them
+	registry.SetLambdaCaller(func(fn types.LambdaValue, args []types.Value, ctx *types.TaskContext) types.Result {
+		callerVM, ok := ctx.CallerVM.(*VM)
+		if !ok || callerVM == nil {
+			return types.Err(types.E_INVARG)
+		}
+		return callerVM.CallLambda(fn, args)
+	})
+
 	// Register pass() as a stub -- the VM handles pass() natively via OP_PASS.
 	// This stub is needed so the compiler can resolve "pass" to a function ID.
 	// The builtin is never actually called in the bytecode VM path.
@@ -439,11 +439,10 @@ func (e *Evaluator) forMap(stmt *parser.ForStmt, mapVal *types.MapValue, ctx *ty
 
 // forString evaluates for loops over strings (iterating characters)
 func (e *Evaluator) forString(stmt *parser.ForStmt, strVal *types.StrValue, ctx *types.TaskContext) types.Result {
-	// Get characters as runes for proper Unicode handling
-	s := strVal.Value()
-	runes := []rune(s)
+	// Characters are bytes, or runes in unicode string mode
+	chars := types.StrChars(strVal.Value())
 
-	for i, r := range runes {
+	for i, ch := range chars {
 		// Update line number to for statement before each iteration
 		if ctx.Task != nil {
 			if t, ok := ctx.Task.(*task.Task); ok {
@@ -452,7 +451,7 @@ func (e *Evaluator) forString(stmt *parser.ForStmt, strVal *types.StrValue, ctx
 		}
 
 		// Bind value (character as string)
-		e.env.Set(stmt.Value, types.NewStr(string(r)))
+		e.env.Set(stmt.Value, types.NewStr(ch))
 
 		// Bind index if requested (1-based)
 		if stmt.Index != "" {
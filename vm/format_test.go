@@ -0,0 +1,40 @@
+package vm
+
+import (
+	"barn/parser"
+	"barn/types"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestFormatKeepsBytecode checks formatted code compiles to the same
+// instructions, constants and variables as the original
+func TestFormatKeepsBytecode(t *testing.T) {
+	programs := []string{
+		"x=1+2*3;return x;",
+		"if(args)return 1;elseif(0)return 2;else return 3;endif",
+		"s=0;for i in[1..10]s=s+i;endfor return s;",
+		"l={};for v,k in([1->2])l={@l,v};endfor return l;",
+		"i=0;while(1)i=i+1;if(i>5)break;endif endwhile return i;",
+		"try return 1/0;except e(E_DIV)return e[1];except(ANY)finally x=1;endtry",
+		"x=`1/0!E_DIV=>7';y=`$nothing!ANY';return x+y;",
+		"fork t(0)y=-(2^3^2);endfork return t;",
+		"{a,?b=2+3,@c}={1};return {a,b,c};",
+		"\"comment\";return -5- -3- - 4+(1|.2&.~3);",
+		"return #0:foo(@args)[1..$].bar;",
+	}
+	for _, src := range programs {
+		lines, err := parser.Format(src)
+		if err != nil {
+			t.Fatalf("Format(%q): %v", src, err)
+		}
+		formatted := strings.Join(lines, "\n")
+		before := compileWith(t, src, true)
+		after := compileWith(t, formatted, true)
+		if !slices.Equal(before.Code, after.Code) || !slices.Equal(before.VarNames, after.VarNames) ||
+			!slices.EqualFunc(before.Constants, after.Constants, func(a, b types.Value) bool { return a.Equal(b) }) {
+			t.Errorf("%q formatted as\n%s\ncompiles differently", src, formatted)
+		}
+	}
+}
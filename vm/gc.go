@@ -0,0 +1,424 @@
+package vm
+
+import (
+	"barn/builtins"
+	"barn/db"
+	"barn/task"
+	"barn/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cycle collection for anonymous objects and waifs.
+//
+// Toast counts references, so an anonymous object is recycled the moment
+// the last value naming it goes away, and a separate cycle collector finds
+// groups of anonymous objects and waifs that only name each other. Barn's
+// values are Go values, so there are no counts to keep: instead a tracing
+// collector marks everything reachable from the roots, and the anonymous
+// objects and waifs it never reaches are garbage.
+//
+// The roots are the properties of every persistent (not anonymous) object
+// and, for every task, its VM stack and variables, its fork vector, its
+// task_local and the value it will wake with. A cycle works through the
+// persistent objects a few thousand values at a time between tasks, so a
+// large database doesn't stall the server. While it does, tasks keep
+// running: Store.StoreValue shades every value they write into a property,
+// so nothing moves out of the collector's sight. Tasks hold their variables
+// off to the side, so the task roots are scanned in one go at the end of
+// the cycle, together with whatever was shaded since; what is left
+// unmarked then is recycled at once, firing each anonymous object's
+// :recycle verb, and waifs left unmarked stop being tracked.
+//
+// Objects and waifs made after a cycle starts are left for the next one.
+
+// gcStepBudget is how many values a Step traces before it returns
+const gcStepBudget = 5000
+
+// gcInterval is the least time between cycles the collector starts itself
+const gcInterval = 10 * time.Second
+
+// gcPhase is where the collector is in a cycle
+type gcPhase int
+
+const (
+	gcIdle     gcPhase = iota // No cycle running
+	gcMarking                 // Tracing from persistent objects, a step at a time
+	gcSweeping                // Recycling what the cycle found unreachable
+)
+
+var gcPhaseNames = map[gcPhase]string{
+	gcIdle:     "idle",
+	gcMarking:  "marking",
+	gcSweeping: "sweeping",
+}
+
+// gcWaif is a waif the store tracks, as the collector found it when the
+// cycle started
+type gcWaif struct {
+	class types.ObjID
+	waif  *types.WaifValue
+}
+
+// Collector finds anonymous objects and waifs that nothing can reach. The
+// scheduler calls Step between tasks; nothing else may run MOO code while
+// a Step does.
+type Collector struct {
+	store    *db.Store
+	registry *builtins.Registry
+	tasks    func() []*task.Task // Every task that may still run
+
+	mu        sync.Mutex
+	phase     gcPhase
+	requested bool        // run_gc() or a task asked for a cycle
+	startID   types.ObjID // Objects numbered this or above were made during the cycle
+	nextScan  types.ObjID // Next persistent object to trace from
+	gray      []types.Value
+	traced    map[any]bool         // Lists and maps already traced
+	marked    map[types.ObjID]bool // Anonymous objects reached
+	waifs     map[uintptr]gcWaif   // Waifs that existed when the cycle started
+	reached   map[uintptr]bool     // Waifs reached
+	garbage   []types.ObjID        // Anonymous objects being recycled
+
+	lastCycle  time.Time
+	lastNextID types.ObjID
+	lastWaifs  int
+	cycles     int64
+	recycled   int64
+	waifsFreed int64
+}
+
+// NewCollector makes a collector for store. tasks returns every task whose
+// values must be kept: running, queued, suspended or forked.
+func NewCollector(store *db.Store, registry *builtins.Registry, tasks func() []*task.Task) *Collector {
+	return &Collector{
+		store:      store,
+		registry:   registry,
+		tasks:      tasks,
+		lastCycle:  time.Now(),
+		lastNextID: store.NextID(),
+	}
+}
+
+// Request asks for a cycle at the next Step, which then runs it to the end
+// rather than a step at a time
+func (c *Collector) Request() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requested = true
+}
+
+// Collect runs a whole cycle now, finishing any cycle already under way
+func (c *Collector) Collect() {
+	c.Request()
+	c.Step()
+}
+
+// Step does a bounded amount of collection: it starts a cycle if one is
+// due, traces part of the database, or finishes the cycle and recycles its
+// garbage. A requested cycle is run to the end in one Step.
+func (c *Collector) Step() {
+	c.mu.Lock()
+	if c.phase == gcSweeping {
+		// A :recycle verb is running
+		c.mu.Unlock()
+		return
+	}
+	if c.phase == gcIdle {
+		if !c.requested && !c.due() {
+			c.mu.Unlock()
+			return
+		}
+		c.start()
+	}
+	budget := gcStepBudget
+	if c.requested {
+		budget = -1
+	}
+	if !c.mark(budget) {
+		c.mu.Unlock()
+		return
+	}
+	c.finish()
+	garbage := c.garbage
+	c.mu.Unlock()
+
+	c.sweep(garbage)
+
+	c.mu.Lock()
+	c.phase = gcIdle
+	c.garbage = nil
+	c.mu.Unlock()
+}
+
+// due reports whether the collector should start a cycle of its own: some
+// time has passed, objects or waifs have been made since the last cycle,
+// and there are anonymous objects or waifs to collect
+func (c *Collector) due() bool {
+	if time.Since(c.lastCycle) < gcInterval {
+		return false
+	}
+	waifs := c.store.WaifCount()
+	if c.store.NextID() == c.lastNextID && waifs <= c.lastWaifs {
+		return false
+	}
+	return waifs > 0 || c.store.AnonymousSince(0)
+}
+
+// start begins a cycle
+func (c *Collector) start() {
+	c.phase = gcMarking
+	c.startID = c.store.NextID()
+	c.nextScan = 0
+	c.gray = nil
+	c.traced = make(map[any]bool)
+	c.marked = make(map[types.ObjID]bool)
+	c.reached = make(map[uintptr]bool)
+	c.waifs = make(map[uintptr]gcWaif)
+	c.store.EachWaif(func(class types.ObjID, waif *types.WaifValue) {
+		c.waifs[waif.Identity()] = gcWaif{class, waif}
+	})
+	c.store.SetWriteBarrier(c.shade)
+}
+
+// shade is the write barrier: a value stored during the mark phase is
+// traced even if it went into an object the cycle has already traced
+func (c *Collector) shade(v types.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.phase == gcMarking {
+		c.gray = append(c.gray, v)
+	}
+}
+
+// mark traces from persistent objects until budget values have been
+// traced, or without limit if budget is negative. It reports whether every
+// persistent object has been traced.
+func (c *Collector) mark(budget int) bool {
+	for budget != 0 {
+		if len(c.gray) > 0 {
+			v := c.gray[len(c.gray)-1]
+			c.gray = c.gray[:len(c.gray)-1]
+			c.trace(v)
+			budget--
+			continue
+		}
+		if c.nextScan >= c.startID {
+			return true
+		}
+		obj := c.store.Get(c.nextScan)
+		c.nextScan++
+		budget--
+		if obj == nil || obj.Anonymous {
+			// Anonymous objects are traced only once reached
+			continue
+		}
+		c.pushProperties(obj)
+	}
+	return false
+}
+
+// finish traces from every task, then works out what the cycle found
+// unreachable. Tasks don't run between the tracing and the sweep, so
+// nothing unmarked can be reached again.
+func (c *Collector) finish() {
+	for _, t := range c.tasks() {
+		c.pushTaskRoots(t)
+	}
+	c.mark(-1)
+	c.store.SetWriteBarrier(nil)
+	c.phase = gcSweeping
+
+	c.garbage = nil
+	for _, obj := range c.store.GetAnonymousObjects() {
+		// Never collect players, even ones with the anonymous flag
+		if obj.ID >= c.startID || c.marked[obj.ID] || obj.Flags.Has(db.FlagUser) || obj.Flags.Has(db.FlagInvalid) {
+			continue
+		}
+		c.garbage = append(c.garbage, obj.ID)
+	}
+	sort.Slice(c.garbage, func(i, j int) bool { return c.garbage[i] < c.garbage[j] })
+
+	for id, w := range c.waifs {
+		if !c.reached[id] {
+			c.store.UnregisterWaif(w.class, w.waif)
+			c.waifsFreed++
+		}
+	}
+
+	// Objects made during the cycle weren't candidates; if a task asked for
+	// them to be collected, that takes another cycle
+	c.requested = c.requested && c.store.AnonymousSince(c.startID)
+	c.cycles++
+	c.lastCycle = time.Now()
+	c.lastNextID = c.store.NextID()
+	c.lastWaifs = c.store.WaifCount()
+	c.gray, c.traced, c.marked, c.reached, c.waifs = nil, nil, nil, nil, nil
+}
+
+// sweep recycles the anonymous objects a cycle found unreachable, calling
+// each one's :recycle verb. A verb may recycle objects later in the list,
+// which recycle() then skips.
+func (c *Collector) sweep(garbage []types.ObjID) {
+	recycle, ok := c.registry.Get("recycle")
+	if !ok {
+		return
+	}
+	for _, id := range garbage {
+		obj := c.store.Get(id)
+		if obj == nil {
+			continue
+		}
+		ctx := types.NewTaskContext()
+		ctx.Player = obj.Owner
+		ctx.Programmer = obj.Owner
+		ctx.IsWizard = true
+		recycle(ctx, []types.Value{types.NewAnon(id)})
+	}
+
+	// recycle() takes the anonymous objects an object holds with it, so
+	// count what is gone rather than the calls that succeeded
+	gone := 0
+	for _, id := range garbage {
+		if c.store.Get(id) == nil {
+			gone++
+		}
+	}
+	c.mu.Lock()
+	c.recycled += int64(gone)
+	c.mu.Unlock()
+}
+
+// trace marks what v reaches and queues what it holds
+func (c *Collector) trace(v types.Value) {
+	switch v := v.(type) {
+	case types.ObjValue:
+		if !v.IsAnonymous() || c.marked[v.ID()] {
+			return
+		}
+		c.marked[v.ID()] = true
+		if obj := c.store.Get(v.ID()); obj != nil {
+			c.pushProperties(obj)
+		}
+	case types.ListValue:
+		if c.traced[v] {
+			return
+		}
+		c.traced[v] = true
+		c.gray = append(c.gray, v.Elements()...)
+	case types.MapValue:
+		if c.traced[v] {
+			return
+		}
+		c.traced[v] = true
+		for _, pair := range v.Pairs() {
+			c.gray = append(c.gray, pair[0], pair[1])
+		}
+	case types.WaifValue:
+		id := v.Identity()
+		if c.reached[id] {
+			return
+		}
+		c.reached[id] = true
+		for _, name := range v.PropertyNames() {
+			val, _ := v.GetProperty(name)
+			c.gray = append(c.gray, val)
+		}
+	case types.LambdaValue:
+		c.gray = append(c.gray, v.Captured()...)
+	}
+}
+
+// pushProperties queues the values of obj's properties. Clear properties
+// keep the value they had, so they are traced too.
+func (c *Collector) pushProperties(obj *db.Object) {
+	for _, prop := range obj.Properties {
+		if prop != nil && prop.Value != nil {
+			c.gray = append(c.gray, prop.Value)
+		}
+	}
+}
+
+// pushTaskRoots queues every value t holds outside the database
+func (c *Collector) pushTaskRoots(t *task.Task) {
+	c.push(t.GetTaskLocal(), t.WakeValue, t.Result.Val)
+	for _, frame := range t.GetCallStack() {
+		c.push(frame.ThisValue)
+		c.push(frame.Args...)
+	}
+	if t.Context != nil {
+		c.push(t.Context.ThisValue)
+	}
+	if t.ForkInfo != nil {
+		for _, v := range t.ForkInfo.Variables {
+			c.push(v)
+		}
+	}
+	if machine, ok := t.BytecodeVM.(*VM); ok && machine != nil {
+		c.pushVMRoots(machine)
+	}
+	if e, ok := t.Evaluator.(*Evaluator); ok && e != nil {
+		for env := e.env; env != nil; env = env.parent {
+			for _, v := range env.vars {
+				c.push(v)
+			}
+		}
+	}
+}
+
+// pushVMRoots queues a saved VM's operand stack and variables
+func (c *Collector) pushVMRoots(machine *VM) {
+	c.push(machine.Stack[:min(max(machine.SP, 0), len(machine.Stack))]...)
+	if machine.Context != nil {
+		c.push(machine.Context.ThisValue)
+	}
+	for _, frame := range machine.Frames {
+		c.push(frame.Locals...)
+		c.push(frame.Args...)
+		c.push(frame.SavedThisValue)
+		for _, loop := range frame.LoopStack {
+			if v, ok := loop.Iterator.(types.Value); ok {
+				c.push(v)
+			}
+			if v, ok := loop.End.(types.Value); ok {
+				c.push(v)
+			}
+		}
+	}
+}
+
+// push queues values, skipping nils
+func (c *Collector) push(values ...types.Value) {
+	for _, v := range values {
+		if v != nil {
+			c.gray = append(c.gray, v)
+		}
+	}
+}
+
+// Stats reports on the collector for gc_stats()
+func (c *Collector) Stats() builtins.GCStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := builtins.GCStats{
+		Phase:      gcPhaseNames[c.phase],
+		Gray:       len(c.gray),
+		Purple:     len(c.garbage),
+		Cycles:     c.cycles,
+		Recycled:   c.recycled,
+		WaifsFreed: c.waifsFreed,
+	}
+	if c.phase == gcMarking {
+		stats.Black = len(c.marked) + len(c.reached)
+		candidates := len(c.waifs)
+		for _, obj := range c.store.GetAnonymousObjects() {
+			if obj.ID < c.startID {
+				candidates++
+			}
+		}
+		stats.White = max(candidates-stats.Black, 0)
+	}
+	return stats
+}
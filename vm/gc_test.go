@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"barn/db"
+	"barn/task"
+	"barn/types"
+	"testing"
+)
+
+// newGCTestStore makes a store with a persistent #0 and anonymous objects
+// #10 to #19
+func newGCTestStore() *db.Store {
+	store := db.NewStore()
+	store.Add(db.NewObject(0, 0))
+	for id := types.ObjID(10); id < 20; id++ {
+		obj := db.NewObject(id, 0)
+		obj.Anonymous = true
+		store.Add(obj)
+	}
+	return store
+}
+
+func setGCTestProp(store *db.Store, id types.ObjID, name string, v types.Value) {
+	store.StoreValue(v)
+	store.Get(id).Properties[name] = &db.Property{Name: name, Value: v, Owner: 0, Defined: true}
+}
+
+func TestCollectorRoots(t *testing.T) {
+	store := newGCTestStore()
+	reg := BuildVMRegistry(store)
+	var recycleVerbs []types.ObjID
+	reg.SetVerbCaller(func(objID types.ObjID, verbName string, args []types.Value, ctx *types.TaskContext) types.Result {
+		if verbName == "recycle" {
+			recycleVerbs = append(recycleVerbs, objID)
+		}
+		return types.Ok(types.NewInt(0))
+	})
+
+	// #10 is held by a persistent object, through a list and a map
+	setGCTestProp(store, 0, "keep", types.NewList([]types.Value{
+		types.NewMap([][2]types.Value{{types.NewStr("k"), types.NewAnon(10)}}),
+	}))
+	// #11 and #12 only hold each other
+	setGCTestProp(store, 11, "next", types.NewAnon(12))
+	setGCTestProp(store, 12, "next", types.NewAnon(11))
+	// #13 is a suspended task's variable; #14 is held by a waif in its
+	// task_local; #15 is in a fork vector, and #16 is held by #15
+	suspended := NewVM(store, reg)
+	suspended.Frames = []*StackFrame{{Locals: []types.Value{types.NewAnon(13)}}}
+	holder := types.NewWaif(0, 0).SetProperty("p", types.NewAnon(14))
+	store.RegisterWaif(0, &holder)
+	setGCTestProp(store, 15, "child", types.NewAnon(16))
+	// #17 is only captured by a lambda in #0.fn
+	setGCTestProp(store, 0, "fn", types.NewLambda(nil, []types.Value{types.NewAnon(17)}, ""))
+	// A waif nothing holds
+	dropped := types.NewWaif(0, 0)
+	store.RegisterWaif(0, &dropped)
+
+	waiting := task.NewTask(1, 0, 1000, 5.0)
+	waiting.BytecodeVM = suspended
+	waiting.TaskLocal = types.NewList([]types.Value{holder})
+	forked := task.NewTask(2, 0, 1000, 5.0)
+	forked.ForkInfo = &types.ForkInfo{Variables: map[string]types.Value{"x": types.NewAnon(15)}}
+
+	c := NewCollector(store, reg, func() []*task.Task { return []*task.Task{waiting, forked} })
+	c.Collect()
+
+	for id := types.ObjID(10); id < 20; id++ {
+		want := id <= 17 && id != 11 && id != 12
+		if got := store.Valid(id); got != want {
+			t.Errorf("valid(#%d) = %v after a cycle, want %v", id, got, want)
+		}
+	}
+	if len(recycleVerbs) < 3 || recycleVerbs[0] != 11 {
+		t.Errorf(":recycle called on %v, want #11, #12 (or cascaded), #18 and #19", recycleVerbs)
+	}
+	if n := store.WaifCount(); n != 1 {
+		t.Errorf("%d waifs tracked after a cycle, want the held one only", n)
+	}
+	stats := c.Stats()
+	if stats.Cycles != 1 || stats.Recycled != 4 || stats.WaifsFreed != 1 || stats.Phase != "idle" {
+		t.Errorf("Stats() = %+v, want 1 cycle, 4 recycled, 1 waif freed, idle", stats)
+	}
+}
+
+func TestCollectorWriteBarrier(t *testing.T) {
+	store := newGCTestStore()
+	store.Add(db.NewObject(1, 0))
+	reg := BuildVMRegistry(store)
+	setGCTestProp(store, 1, "ref", types.NewAnon(10))
+
+	c := NewCollector(store, reg, func() []*task.Task { return nil })
+	// Trace #0 only, then move #10 from #1, not yet traced, to #0
+	c.mu.Lock()
+	c.start()
+	for c.nextScan < 1 || len(c.gray) > 0 {
+		c.mark(1)
+	}
+	c.mu.Unlock()
+	setGCTestProp(store, 0, "ref", types.NewAnon(10))
+	store.Get(1).Properties["ref"].Value = types.NewInt(0)
+
+	// Objects made mid-cycle are left for the next one
+	late := db.NewObject(store.NextID(), 0)
+	late.Anonymous = true
+	store.Add(late)
+
+	c.Collect()
+	if !store.Valid(10) {
+		t.Error("#10, moved into an object already traced, was recycled")
+	}
+	if !store.Valid(late.ID) {
+		t.Errorf("#%d, made during the cycle, was recycled", late.ID)
+	}
+	if store.Valid(11) {
+		t.Error("#11, which nothing holds, survived the cycle")
+	}
+}
+
+func TestCollectorStepsIncrementally(t *testing.T) {
+	store := db.NewStore()
+	for id := types.ObjID(0); id < 3*gcStepBudget; id++ {
+		store.Add(db.NewObject(id, 0))
+	}
+	c := NewCollector(store, BuildVMRegistry(store), func() []*task.Task { return nil })
+	c.Step()
+	if c.Stats().Phase != "idle" {
+		t.Fatal("a cycle started with nothing to collect")
+	}
+
+	// Once an interval has passed, a new anonymous object makes a cycle due
+	anon := db.NewObject(store.NextID(), 0)
+	anon.Anonymous = true
+	store.Add(anon)
+	c.lastCycle = c.lastCycle.Add(-gcInterval)
+	c.Step()
+	if stats := c.Stats(); stats.Phase != "marking" || stats.White != 1 {
+		t.Fatalf("after one step: %+v, want marking with one candidate", stats)
+	}
+	for steps := 1; c.Stats().Phase != "idle"; steps++ {
+		if steps > 10 {
+			t.Fatal("the cycle didn't finish in 10 steps")
+		}
+		c.Step()
+	}
+	if store.Valid(anon.ID) {
+		t.Error("the unreachable anonymous object survived the cycle")
+	}
+}
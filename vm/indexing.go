@@ -71,7 +71,7 @@ func getCollectionLength(val types.Value) int {
 	case types.ListValue:
 		return coll.Len()
 	case types.StrValue:
-		return len(coll.Value())
+		return types.StrLen(coll.Value())
 	case types.MapValue:
 		return coll.Len()
 	default:
@@ -199,7 +199,7 @@ func strIndex(str types.StrValue, index types.Value) types.Result {
 
 	// Get underlying string
 	s := str.Value()
-	length := int64(len(s))
+	length := int64(types.StrLen(s))
 
 	// Check bounds (1-based indexing)
 	if idx < 1 || idx > length {
@@ -207,7 +207,7 @@ func strIndex(str types.StrValue, index types.Value) types.Result {
 	}
 
 	// Get character (0-based in Go)
-	char := s[idx-1 : idx]
+	char := types.StrSlice(s, int(idx-1), int(idx))
 	return types.Ok(types.NewStr(char))
 }
 
@@ -215,7 +215,7 @@ func strIndex(str types.StrValue, index types.Value) types.Result {
 func strRange(str types.StrValue, start, end int64) types.Result {
 	// Get underlying string
 	s := str.Value()
-	length := int64(len(s))
+	length := int64(types.StrLen(s))
 
 	// If start > end, return empty string (before bounds checking per MOO semantics)
 	if start > end {
@@ -231,7 +231,7 @@ func strRange(str types.StrValue, start, end int64) types.Result {
 	}
 
 	// Extract substring (1-based to 0-based conversion, Go slice is [start:end+1])
-	substr := s[start-1 : end]
+	substr := types.StrSlice(s, int(start-1), int(end))
 	return types.Ok(types.NewStr(substr))
 }
 
@@ -475,7 +475,7 @@ func setAtIndex(coll types.Value, index types.Value, value types.Value) (types.V
 		result := c.Set(i, value)
 
 		// Check size limit
-		if err := builtins.CheckListLimit(result); err != types.E_NONE {
+		if err := builtins.CheckListGrowth(c, result, []types.Value{value}, []types.Value{c.Get(i)}); err != types.E_NONE {
 			return nil, err
 		}
 
@@ -488,16 +488,16 @@ func setAtIndex(coll types.Value, index types.Value, value types.Value) (types.V
 		}
 		i := int(idx.Val)
 		s := c.Value()
-		if i < 1 || i > len(s) {
+		if i < 1 || i > types.StrLen(s) {
 			return nil, types.E_RANGE
 		}
 		// Value must be a single-character string
 		newChar, ok := value.(types.StrValue)
-		if !ok || len(newChar.Value()) != 1 {
+		if !ok || types.StrLen(newChar.Value()) != 1 {
 			return nil, types.E_INVARG
 		}
 		// Create new string with replaced character
-		newStr := s[:i-1] + newChar.Value() + s[i:]
+		newStr := s[:types.StrOffset(s, i-1)] + newChar.Value() + s[types.StrOffset(s, i):]
 
 		// Check string limit
 		if err := builtins.CheckStringLimit(newStr); err != types.E_NONE {
@@ -688,7 +688,7 @@ func (e *Evaluator) assignRange(target *parser.RangeExpr, value types.Value, ctx
 		}
 
 		s := coll.Value()
-		strLen := int64(len(s))
+		strLen := int64(types.StrLen(s))
 
 		// For inverted ranges (startIdx > endIdx), MOO has special semantics:
 		// s[7..1] = x means: s[1..6] + x + s[2..7]
@@ -723,7 +723,7 @@ func (e *Evaluator) assignRange(target *parser.RangeExpr, value types.Value, ctx
 
 		// Build new string: s[1..start-1] + newStr + s[end+1..$]
 		// For inverted ranges, this naturally duplicates characters
-		result := s[:startIdx-1] + newStr.Value() + s[effectiveEnd:]
+		result := s[:types.StrOffset(s, int(startIdx-1))] + newStr.Value() + s[types.StrOffset(s, int(effectiveEnd)):]
 
 		// Check string limit
 		if err := builtins.CheckStringLimit(result); err != types.E_NONE {
@@ -1123,7 +1123,7 @@ foundBase:
 		if _, ok := innerVal.(types.StrValue); !ok {
 			return types.Err(types.E_TYPE)
 		}
-		length = len(innerVal.(types.StrValue).Value())
+		length = types.StrLen(innerVal.(types.StrValue).Value())
 	}
 
 	// Resolve start index
@@ -1184,7 +1184,7 @@ foundBase:
 			return types.Err(types.E_TYPE)
 		}
 		s := inner.Value()
-		strLen := int64(len(s))
+		strLen := int64(types.StrLen(s))
 
 		// Bounds check
 		if startIdx < 1 || startIdx > strLen+1 {
@@ -1200,7 +1200,7 @@ foundBase:
 			effectiveEnd = strLen
 		}
 
-		result := s[:startIdx-1] + newStr.Value() + s[effectiveEnd:]
+		result := s[:types.StrOffset(s, int(startIdx-1))] + newStr.Value() + s[types.StrOffset(s, int(effectiveEnd)):]
 
 		// Check string limit
 		if err := builtins.CheckStringLimit(result); err != types.E_NONE {
@@ -0,0 +1,223 @@
+package vm
+
+import (
+	"barn/task"
+	"barn/types"
+	"fmt"
+)
+
+// lambdaCode is the VM's side of a types.LambdaValue: where the body is and
+// the verb context it was made in. A call runs with that context, the way a
+// verb runs with its owner's permissions wherever it is called from.
+type lambdaCode struct {
+	prog       *Program
+	ip         int // First instruction of the body
+	argsVar    int // Local the body scatters its parameters from
+	this       types.ObjID
+	thisValue  types.Value
+	verb       string
+	verbLoc    types.ObjID
+	programmer types.ObjID
+	isWizard   bool
+	debug      bool
+}
+
+// executeMakeLambda handles OP_MAKE_LAMBDA: push a lambda over the body that
+// follows and skip it.
+//
+// Bytecode format: OP_MAKE_LAMBDA <argsVar:byte> <srcIdx:byte> <bodyLen:short>
+//
+// The lambda captures a copy of the current frame's variables, so later
+// assignments on either side are not seen by the other.
+func (vm *VM) executeMakeLambda() error {
+	argsVar := int(vm.ReadByte())
+	srcIdx := vm.ReadByte()
+	bodyLen := int(vm.ReadShort())
+
+	frame := vm.CurrentFrame()
+	code := &lambdaCode{
+		prog:       frame.Program,
+		ip:         frame.IP,
+		argsVar:    argsVar,
+		this:       frame.This,
+		verb:       frame.Verb,
+		verbLoc:    frame.VerbLoc,
+		programmer: types.ObjNothing,
+		debug:      frame.VerbDebug,
+	}
+	if vm.Context != nil {
+		code.thisValue = vm.Context.ThisValue
+		code.programmer = vm.Context.Programmer
+		code.isWizard = vm.Context.IsWizard
+	}
+	frame.IP += bodyLen
+
+	captured := make([]types.Value, len(frame.Locals))
+	copy(captured, frame.Locals)
+	source := ""
+	if src, ok := frame.Program.Constants[srcIdx].(types.StrValue); ok {
+		source = src.Value()
+	}
+	vm.Push(types.NewLambda(code, captured, source))
+	return nil
+}
+
+// executeCallLambda handles OP_CALL_LAMBDA: call the lambda pushed before
+// the arguments.
+//
+// Bytecode format: OP_CALL_LAMBDA <argc:byte>
+// argc = 0xFF: splice mode, pop one args list and expand it
+// Stack: [lambda, arg1, ..., argN] (argN on top)
+func (vm *VM) executeCallLambda() error {
+	argc := vm.ReadByte()
+
+	var args []types.Value
+	if argc == 0xFF {
+		list, ok := vm.Pop().(types.ListValue)
+		if !ok {
+			return fmt.Errorf("E_TYPE: expected list for spliced lambda args")
+		}
+		args = append([]types.Value(nil), list.Elements()...)
+	} else {
+		args = vm.PopN(int(argc))
+	}
+
+	fn, ok := vm.Pop().(types.LambdaValue)
+	if !ok {
+		return fmt.Errorf("E_TYPE: called value is not a lambda")
+	}
+	return vm.pushLambdaFrame(fn, args)
+}
+
+// pushLambdaFrame starts a call to fn. Its return value is pushed onto the
+// caller's stack when it returns.
+func (vm *VM) pushLambdaFrame(fn types.LambdaValue, args []types.Value) error {
+	code, ok := fn.Code().(*lambdaCode)
+	if !ok {
+		return fmt.Errorf("E_TYPE: lambda was not made by this server")
+	}
+	if err := vm.checkStackDepth(); err != nil {
+		return err
+	}
+
+	locals := make([]types.Value, code.prog.NumLocals)
+	n := copy(locals, fn.Captured())
+	for i := n; i < len(locals); i++ {
+		locals[i] = types.UnboundValue{}
+	}
+	locals[code.argsVar] = types.NewList(args)
+
+	caller := types.ObjNothing
+	player := types.ObjNothing
+	if current := vm.CurrentFrame(); current != nil {
+		caller = current.This
+		player = current.Player
+	}
+	if vm.Context != nil && vm.Context.Player != types.ObjNothing {
+		player = vm.Context.Player
+	}
+
+	frame := &StackFrame{
+		Program:     code.prog,
+		IP:          code.ip,
+		BasePointer: vm.SP,
+		Locals:      locals,
+		This:        code.this,
+		Player:      player,
+		Verb:        code.verb,
+		Caller:      caller,
+		VerbLoc:     code.verbLoc,
+		Args:        args,
+		LoopStack:   make([]LoopState, 0, 4),
+		ExceptStack: make([]Handler, 0, 4),
+		IsVerbCall:  true,
+		VerbDebug:   code.debug,
+	}
+
+	if vm.Context != nil {
+		frame.SavedThisObj = vm.Context.ThisObj
+		frame.SavedThisValue = vm.Context.ThisValue
+		frame.SavedVerb = vm.Context.Verb
+		frame.SavedProgrammer = vm.Context.Programmer
+		frame.SavedIsWizard = vm.Context.IsWizard
+
+		vm.Context.ThisObj = code.this
+		vm.Context.ThisValue = code.thisValue
+		vm.Context.Verb = code.verb
+		vm.Context.Programmer = code.programmer
+		vm.Context.IsWizard = code.isWizard
+
+		// Keep the task's call stack 1:1 with the VM's frames
+		if t, ok := vm.Context.Task.(*task.Task); ok {
+			t.PushFrame(task.ActivationFrame{
+				This:       code.this,
+				ThisValue:  code.thisValue,
+				Player:     player,
+				Programmer: code.programmer,
+				Caller:     caller,
+				Verb:       code.verb,
+				VerbLoc:    code.verbLoc,
+				Args:       args,
+			})
+		}
+	}
+
+	vm.Frames = append(vm.Frames, frame)
+	return nil
+}
+
+// CallLambda runs fn to completion for a builtin such as map() and returns
+// its result. The call runs on this VM's stack, so it sees the task's
+// context and counts against its ticks, but it cannot suspend: the builtin
+// that made it is still running. Suspending fails with E_INVARG.
+func (vm *VM) CallLambda(fn types.LambdaValue, args []types.Value) types.Result {
+	// A call counts a tick, as OP_CALL_LAMBDA does
+	vm.Ticks++
+	vm.syncContextTicks()
+
+	depth := len(vm.Frames)
+	if err := vm.pushLambdaFrame(fn, args); err != nil {
+		return types.Err(errorCode(err))
+	}
+
+	floor, debuggable := vm.floor, vm.Debuggable
+	vm.floor, vm.Debuggable = depth, false
+	result := vm.runFrames(depth)
+	vm.floor, vm.Debuggable = floor, debuggable
+	if vm.Context != nil {
+		// Builtins called by the lambda clear it
+		vm.Context.CallerVM = vm
+	}
+
+	switch {
+	case vm.yielded:
+		vm.yielded = false
+		vm.yieldResult = types.Result{}
+		vm.unwindTo(depth)
+		return types.Err(types.E_INVARG)
+	case result.Flow == types.FlowException:
+		vm.unwindTo(depth)
+		return types.Err(result.Error)
+	}
+	return types.Ok(result.Val)
+}
+
+// unwindTo pops frames until depth are left, restoring the context saved by
+// verb, eval and lambda frames
+func (vm *VM) unwindTo(depth int) {
+	for len(vm.Frames) > depth {
+		frame := vm.CurrentFrame()
+		if (frame.IsVerbCall || frame.IsEvalFrame) && vm.Context != nil {
+			vm.Context.ThisObj = frame.SavedThisObj
+			vm.Context.ThisValue = frame.SavedThisValue
+			vm.Context.Verb = frame.SavedVerb
+			vm.Context.Programmer = frame.SavedProgrammer
+			vm.Context.IsWizard = frame.SavedIsWizard
+			if t, ok := vm.Context.Task.(*task.Task); ok {
+				t.PopFrame()
+			}
+		}
+		vm.SP = frame.BasePointer
+		vm.Frames = vm.Frames[:len(vm.Frames)-1]
+	}
+}
@@ -0,0 +1,70 @@
+package vm
+
+import (
+	"barn/db"
+	"barn/parser"
+	"barn/task"
+	"barn/types"
+	"testing"
+)
+
+func TestLambdas(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+	wizard := db.NewObject(2, 2)
+	wizard.Flags = db.FlagWizard | db.FlagProgrammer
+	wizard.Properties["p"] = &db.Property{Name: "p", Value: types.NewInt(0), Owner: 2, Defined: true}
+	store.Add(wizard)
+
+	run := func(code string) types.Result {
+		t.Helper()
+		stmts, err := parser.NewParser(code).ParseProgram()
+		if err != nil {
+			t.Fatalf("parse %q: %v", code, err)
+		}
+		prog, err := NewCompilerWithRegistry(reg).CompileStatements(stmts)
+		if err != nil {
+			t.Fatalf("compile %q: %v", code, err)
+		}
+		ctx := types.NewTaskContext()
+		ctx.Player = 2
+		ctx.Programmer = 2
+		ctx.IsWizard = true
+		ctx.ThisObj = 2
+		ctx.Task = task.NewTask(1, 2, 100000, 5.0)
+		machine := NewVM(store, reg)
+		machine.Context = ctx
+		return machine.RunWithVerbContext(prog, 2, 2, 2, "test", 2, nil)
+	}
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"f = {x} => x * 2; return f(21);", "42"},
+		{"n = 10; f = {x} => x + n; n = 20; return {f(1), n};", "{11, 20}"},
+		{"f = {a, ?b = a + 1, @rest} => {a, b, rest}; return {f(1), f(1, 5, 6, 7)};", "{{1, 2, {}}, {1, 5, {6, 7}}}"},
+		{"f = {x, y} => x - y; return f(@{10, 3});", "7"},
+		{"f = {} => this; return f();", "#2"},
+		{"add = {x} => {y} => x + y; inc = add(1); return inc(41);", "42"},
+		{"f = {x} => x; return {typeof(f) == LAMBDA, f == f, f == ({x} => x), f ? 1 | 0};", "{1, 1, 0, 0}"},
+		{"return tostr({x, ?y = 2} => x + y);", `"{x, ?y = 2} => x + y"`},
+		{"return map({1, 2, 3}, {x} => x * x);", "{1, 4, 9}"},
+		{"return filter({1, 2, 3, 4}, {x} => x % 2);", "{1, 3}"},
+		{"return {reduce({1, 2, 3, 4}, {a, x} => a + x), reduce({}, {a, x} => a + x, 0)};", "{10, 0}"},
+		{`return sort({"b", "c", "a"}, {a, b} => a > b);`, `{"c", "b", "a"}`},
+		{"f = {x} => x[5]; try return f({}); except e (E_RANGE) return 1; endtry", "1"},
+		{"try return map({1, 0}, {x} => 1 / x); except e (E_DIV) return e[1]; endtry", "E_DIV"},
+		{"f = 1; try return f(1); except e (E_TYPE) return 2; endtry", "2"},
+		{"f = {x} => x; try return f(); except e (E_ARGS) return 3; endtry", "3"},
+		{"try this.p = {x} => x; except e (E_TYPE) return 4; endtry", "4"},
+		{"try this.p = {{} => 0}; except e (E_TYPE) return 5; endtry", "5"},
+		{"try return reduce({}, {a, x} => a); except e (E_INVARG) return 6; endtry", "6"},
+	}
+	for _, tt := range tests {
+		result := run(tt.code)
+		if result.Flow != types.FlowReturn || result.Val.String() != tt.want {
+			t.Errorf("%q: got flow %v value %v error %v, want %s", tt.code, result.Flow, result.Val, result.Error, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package vm
+
+import (
+	"barn/builtins"
+	"barn/task"
+	"barn/types"
+	"fmt"
+	"unsafe"
+)
+
+// Per-task memory accounting (the max_task_memory server option).
+//
+// Operations that build strings, lists, maps and waifs charge the VM an
+// estimate of what they allocated. Charges only decide when to look: once
+// enough has been charged since the last look, measureMemory adds up the
+// values the task can still reach, counting each shared value once, and
+// that total is what is held against the limit. Garbage a task has let go
+// of never counts, and a measurement costs time in proportion to the
+// memory it finds, so its cost is spread over the allocations that led to
+// it. A task is also measured whenever it suspends, limit or not, so that
+// queued_tasks() and task_stack() report what suspended tasks hold.
+
+// memoryMeasureMin is the fewest bytes charged between measurements
+const memoryMeasureMin = 4096
+
+// chargeMemory records that the task allocated about n bytes, and measures
+// the task once enough has been charged
+func (vm *VM) chargeMemory(n int) {
+	if vm.MaxTaskMemory <= 0 {
+		return
+	}
+	vm.memCharged += int64(n)
+	if vm.memCharged >= max(vm.MaxTaskMemory/8, memoryMeasureMin) {
+		vm.measureMemory()
+	}
+}
+
+// chargeValue charges the memory a value just made for the task holds
+// directly: the characters of a string, the slots of a list or map, or
+// the properties of a waif. Elements it shares with other values are
+// left to measureMemory.
+func (vm *VM) chargeValue(v types.Value) {
+	if vm.MaxTaskMemory <= 0 {
+		return
+	}
+	const varSize = 16
+	switch v := v.(type) {
+	case types.StrValue:
+		vm.chargeMemory(varSize + v.Len() + 1)
+	case types.ListValue:
+		vm.chargeMemory(2*varSize + v.Len()*varSize)
+	case types.MapValue:
+		vm.chargeMemory(2*varSize + v.Len()*2*varSize)
+	case types.WaifValue:
+		vm.chargeMemory(2*varSize + len(v.PropertyNames())*varSize)
+	}
+}
+
+// measureMemory adds up the memory held by the task's variables, operand
+// stack and task_local, stores the total on the task, and marks the VM to
+// abort if there is a limit, the total is over it and the task isn't exempt
+func (vm *VM) measureMemory() {
+	vm.memCharged = 0
+	t := vm.memoryTask()
+	if t == nil {
+		return
+	}
+	m := memoryMeter{seen: make(map[any]bool)}
+	perFrame := make([]int64, len(vm.Frames))
+	for i, frame := range vm.Frames {
+		before := m.bytes
+		for _, v := range frame.Locals {
+			m.add(v)
+		}
+		top := vm.SP
+		if i+1 < len(vm.Frames) {
+			top = min(vm.Frames[i+1].BasePointer, vm.SP)
+		}
+		for j := max(frame.BasePointer, 0); j < top && j < len(vm.Stack); j++ {
+			m.add(vm.Stack[j])
+		}
+		perFrame[i] = m.bytes - before
+	}
+	m.add(t.GetTaskLocal())
+	t.UpdateMemoryUsage(m.bytes, perFrame)
+
+	if vm.MaxTaskMemory > 0 && m.bytes > vm.MaxTaskMemory && !t.IsMemoryExempt() {
+		vm.memExceeded = true
+	}
+}
+
+// memoryTask returns the task the VM runs for, if the scheduler made one
+func (vm *VM) memoryTask() *task.Task {
+	if vm.Context == nil || vm.Context.Task == nil {
+		return nil
+	}
+	t, _ := vm.Context.Task.(*task.Task)
+	return t
+}
+
+// memoryLimitError is the uncatchable error a task over its limit dies with
+func (vm *VM) memoryLimitError() types.Result {
+	return types.Result{
+		Flow:  types.FlowException,
+		Error: types.E_QUOTA,
+		Val:   types.NewStr(fmt.Sprintf("E_QUOTA: task memory limit exceeded (max_task_memory %d)", vm.MaxTaskMemory)),
+	}
+}
+
+// memoryMeter sums value sizes as builtins.ValueBytes does, except that a
+// string, list, map or waif reached more than once is counted only the
+// first time, and waif properties are counted
+type memoryMeter struct {
+	seen  map[any]bool
+	bytes int64
+}
+
+// stringKey identifies a string's bytes without hashing them
+type stringKey struct {
+	data *byte
+	n    int
+}
+
+func (m *memoryMeter) add(v types.Value) {
+	const varSize = 16
+	switch v := v.(type) {
+	case nil:
+	case types.StrValue:
+		s := v.Value()
+		if len(s) >= varSize && m.mark(stringKey{unsafe.StringData(s), len(s)}) {
+			return
+		}
+		m.bytes += int64(builtins.ValueBytes(v))
+	case types.ListValue:
+		if m.mark(v) {
+			return
+		}
+		m.bytes += 2 * varSize
+		for _, e := range v.Elements() {
+			m.add(e)
+		}
+	case types.MapValue:
+		if m.mark(v) {
+			return
+		}
+		m.bytes += 2 * varSize
+		for _, pair := range v.Pairs() {
+			m.add(pair[0])
+			m.add(pair[1])
+		}
+	case types.WaifValue:
+		if m.mark(waifKey(v.Identity())) {
+			return
+		}
+		m.bytes += 2 * varSize
+		for _, name := range v.PropertyNames() {
+			val, _ := v.GetProperty(name)
+			m.bytes += int64(varSize + len(name) + 1)
+			m.add(val)
+		}
+	default:
+		m.bytes += int64(builtins.ValueBytes(v))
+	}
+}
+
+// waifKey keeps waif identities apart from other keys in memoryMeter.seen
+type waifKey uintptr
+
+// mark records key as counted, and reports whether it already was
+func (m *memoryMeter) mark(key any) bool {
+	if m.seen[key] {
+		return true
+	}
+	m.seen[key] = true
+	return false
+}
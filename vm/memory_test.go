@@ -0,0 +1,117 @@
+package vm
+
+import (
+	"barn/db"
+	"barn/parser"
+	"barn/task"
+	"barn/types"
+	"strings"
+	"testing"
+)
+
+func TestTaskMemoryLimit(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+	wizard := db.NewObject(2, 2)
+	wizard.Flags = db.FlagWizard | db.FlagProgrammer
+	store.Add(wizard)
+
+	run := func(code string, limit int64, exempt bool) (types.Result, *task.Task) {
+		t.Helper()
+		stmts, err := parser.NewParser(code).ParseProgram()
+		if err != nil {
+			t.Fatalf("parse %q: %v", code, err)
+		}
+		prog, err := NewCompilerWithRegistry(reg).CompileStatements(stmts)
+		if err != nil {
+			t.Fatalf("compile %q: %v", code, err)
+		}
+		tk := task.NewTask(1, 2, 1000000, 5.0)
+		tk.SetMemoryExempt(exempt)
+		ctx := types.NewTaskContext()
+		ctx.Player = 2
+		ctx.Programmer = 2
+		ctx.IsWizard = true
+		ctx.ThisObj = 2
+		ctx.Task = tk
+		machine := NewVM(store, reg)
+		machine.Context = ctx
+		machine.TickLimit = 1000000
+		machine.MaxTaskMemory = limit
+		return machine.RunWithVerbContext(prog, 2, 2, 2, "test", 2, nil), tk
+	}
+
+	// Builds about 16 bytes a step and holds on to all of it
+	const grow = `l = {}; try for i in [1..20000] l = {@l, i}; endfor except (ANY) return "caught"; endtry return length(l);`
+
+	t.Run("abort", func(t *testing.T) {
+		result, tk := run(grow, 100000, false)
+		if result.Flow != types.FlowException || result.Error != types.E_QUOTA {
+			t.Fatalf("got flow %v error %v value %v, want an uncaught E_QUOTA", result.Flow, result.Error, result.Val)
+		}
+		if used := tk.MemoryUsage(); used <= 100000 || used > 200000 {
+			t.Errorf("MemoryUsage() = %d, want just over the limit", used)
+		}
+	})
+
+	t.Run("exempt", func(t *testing.T) {
+		result, tk := run(grow, 100000, true)
+		if result.Flow != types.FlowReturn || result.Val.String() != "20000" {
+			t.Fatalf("got flow %v error %v value %v, want 20000", result.Flow, result.Error, result.Val)
+		}
+		if used := tk.MemoryUsage(); used <= 100000 {
+			t.Errorf("MemoryUsage() = %d, want the exempt task still measured", used)
+		}
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		result, tk := run(grow, 0, false)
+		if result.Flow != types.FlowReturn || result.Val.String() != "20000" {
+			t.Fatalf("got flow %v error %v value %v, want 20000", result.Flow, result.Error, result.Val)
+		}
+		if used := tk.MemoryUsage(); used != 0 {
+			t.Errorf("MemoryUsage() = %d with no limit, want 0 (not measured)", used)
+		}
+	})
+
+	t.Run("measured on suspend without a limit", func(t *testing.T) {
+		result, tk := run(`l = {"`+strings.Repeat("x", 1000)+`"}; suspend(0); return l;`, 0, false)
+		if result.Flow != types.FlowSuspend {
+			t.Fatalf("got flow %v error %v value %v, want the task suspended", result.Flow, result.Error, result.Val)
+		}
+		if used := tk.MemoryUsage(); used < 1000 {
+			t.Errorf("MemoryUsage() = %d after suspending, want what the task holds", used)
+		}
+	})
+
+	t.Run("garbage is not held", func(t *testing.T) {
+		// Allocates far more than the limit in all, but never holds much
+		code := `for i in [1..5000] s = "` + strings.Repeat("x", 100) + `" + tostr(i); l = {s, s, s, s}; endfor return 1;`
+		result, _ := run(code, 20000, false)
+		if result.Flow != types.FlowReturn {
+			t.Fatalf("got flow %v error %v value %v, want a normal return", result.Flow, result.Error, result.Val)
+		}
+	})
+}
+
+func TestMemoryMeterCountsSharedValuesOnce(t *testing.T) {
+	elems := make([]types.Value, 100)
+	for i := range elems {
+		elems[i] = types.NewStr(strings.Repeat("y", 50))
+	}
+	list := types.NewList(elems)
+	waif := types.NewWaif(3, 2).SetProperty("p", list)
+
+	one := memoryMeter{seen: make(map[any]bool)}
+	one.add(list)
+	many := memoryMeter{seen: make(map[any]bool)}
+	for _, v := range []types.Value{list, list, types.NewMap([][2]types.Value{{types.NewInt(1), list}}), waif, waif} {
+		many.add(v)
+	}
+	// The map holds one entry and the waif one property; the list inside
+	// them, and the second copies, add nothing
+	want := one.bytes + (32 + 16) + (32 + 16 + int64(len("p")) + 1)
+	if many.bytes != want {
+		t.Errorf("shared values measured %d bytes, want %d", many.bytes, want)
+	}
+}
@@ -97,7 +97,7 @@ const (
 
 // Function/Verb Calls
 const (
-	OP_CALL_BUILTIN OpCode = OP_RAISE + 1 + iota // Call builtin function [func_id, argc]
+	OP_CALL_BUILTIN OpCode = OP_RAISE + 1 + iota // Call builtin function [func_id:short, argc]
 	OP_CALL_VERB                                 // Pop obj; call obj:verb [argc]
 	OP_SCATTER                                   // Scatter assignment [pattern]
 )
@@ -129,6 +129,12 @@ const (
 	OP_PASS OpCode = OP_FORK + 1 + iota // Native pass() [argc:byte] — call parent verb
 )
 
+// Lambdas
+const (
+	OP_MAKE_LAMBDA OpCode = OP_PASS + 1 + iota // Push lambda [argsVar:byte, srcIdx:byte, bodyLen:short], skip body
+	OP_CALL_LAMBDA                             // Pop args, lambda; call it [argc:byte]
+)
+
 // OpCodeNames maps opcodes to their string names for debugging
 var OpCodeNames = map[OpCode]string{
 	OP_PUSH:          "PUSH",
@@ -197,6 +203,8 @@ var OpCodeNames = map[OpCode]string{
 	OP_LIST_EXTEND:   "LIST_EXTEND",
 	OP_FORK:          "FORK",
 	OP_PASS:          "PASS",
+	OP_MAKE_LAMBDA:   "MAKE_LAMBDA",
+	OP_CALL_LAMBDA:   "CALL_LAMBDA",
 }
 
 // String returns the name of an opcode
@@ -235,7 +243,7 @@ func MakeImmediateOpcode(value int) (OpCode, bool) {
 // CountsTick reports whether an opcode counts toward tick limit
 func CountsTick(op OpCode) bool {
 	switch op {
-	case OP_CALL_BUILTIN, OP_CALL_VERB, OP_LOOP, OP_PASS:
+	case OP_CALL_BUILTIN, OP_CALL_VERB, OP_LOOP, OP_PASS, OP_CALL_LAMBDA:
 		return true
 	default:
 		return false
@@ -3,6 +3,7 @@ package vm
 import (
 	"barn/builtins"
 	"barn/db"
+	"barn/profile"
 	"barn/task"
 	"barn/trace"
 	"barn/types"
@@ -19,13 +20,14 @@ func (vm *VM) executeAdd() error {
 	a := vm.Pop()
 
 	// Handle string concatenation
-	if _, ok := a.(types.StrValue); ok {
-		if _, ok := b.(types.StrValue); ok {
-			resultStr := a.(types.StrValue).Value() + b.(types.StrValue).Value()
-			if errCode := builtins.CheckStringLimit(resultStr); errCode != types.E_NONE {
+	if aStr, ok := a.(types.StrValue); ok {
+		if bStr, ok := b.(types.StrValue); ok {
+			// Check the length before building, and build in place where we can
+			if errCode := builtins.CheckStringLength(aStr.Len() + bStr.Len()); errCode != types.E_NONE {
 				return fmt.Errorf("E_QUOTA: string too long")
 			}
-			vm.Push(types.NewStr(resultStr))
+			vm.Push(aStr.Concat(bStr))
+			vm.chargeMemory(bStr.Len())
 			return nil
 		}
 	}
@@ -39,11 +41,14 @@ func (vm *VM) executeAdd() error {
 			newElems := make([]types.Value, len(aElems)+len(bElems))
 			copy(newElems, aElems)
 			copy(newElems[len(aElems):], bElems)
-			vm.Push(types.NewList(newElems))
+			result := types.NewList(newElems)
+			vm.Push(result)
+			vm.chargeValue(result)
 			return nil
 		}
 		// list + any → append (new list)
 		vm.Push(aList.Append(b))
+		vm.chargeMemory(16)
 		return nil
 	}
 
@@ -411,7 +416,7 @@ func (vm *VM) executeIn() error {
 			haystack := strings.ToLower(coll.Value())
 			needle := strings.ToLower(elem.Value())
 			if pos := strings.Index(haystack, needle); pos >= 0 {
-				vm.Push(types.IntValue{Val: int64(pos + 1)})
+				vm.Push(types.IntValue{Val: int64(types.StrLen(haystack[:pos]) + 1)})
 			} else {
 				vm.Push(types.IntValue{Val: 0})
 			}
@@ -605,10 +610,11 @@ func (vm *VM) executeIndex() error {
 		if !indexOk {
 			return fmt.Errorf("E_TYPE: string index must be integer")
 		}
-		if indexInt.Val < 1 || indexInt.Val > int64(len(coll.Value())) {
+		if indexInt.Val < 1 || indexInt.Val > int64(types.StrLen(coll.Value())) {
 			return fmt.Errorf("E_RANGE: string index out of range")
 		}
-		vm.Push(types.NewStr(string(coll.Value()[indexInt.Val-1])))
+		i := int(indexInt.Val)
+		vm.Push(types.NewStr(types.StrSlice(coll.Value(), i-1, i)))
 		return nil
 
 	case types.MapValue:
@@ -660,6 +666,11 @@ func (vm *VM) executeIndexSet() error {
 
 	// Write the modified collection back to the variable slot
 	vm.CurrentFrame().Locals[varIdx] = newColl
+	if _, ok := newColl.(types.StrValue); ok {
+		vm.chargeValue(newColl)
+	} else {
+		vm.chargeMemory(16)
+	}
 
 	return nil
 }
@@ -743,7 +754,7 @@ func (vm *VM) executeRangeSet() error {
 		}
 
 		s := c.Value()
-		strLen := int64(len(s))
+		strLen := int64(types.StrLen(s))
 		isInverted := startIdx > endIdx+1
 
 		// Bounds check
@@ -770,7 +781,7 @@ func (vm *VM) executeRangeSet() error {
 		}
 
 		// Build new string: s[1..start-1] + newStr + s[end+1..$]
-		newColl = types.NewStr(s[:startIdx-1] + newStr.Value() + s[effectiveEnd:])
+		newColl = types.NewStr(s[:types.StrOffset(s, int(startIdx-1))] + newStr.Value() + s[types.StrOffset(s, int(effectiveEnd)):])
 
 	case types.MapValue:
 		var startIdx int64
@@ -861,6 +872,7 @@ func (vm *VM) executeRangeSet() error {
 
 	// Write modified collection back to variable slot
 	vm.CurrentFrame().Locals[varIdx] = newColl
+	vm.chargeValue(newColl)
 
 	return nil
 }
@@ -899,13 +911,14 @@ func (vm *VM) executeRange() error {
 			result = append(result, coll.Get(int(i)))
 		}
 		vm.Push(types.NewList(result))
+		vm.chargeMemory(32 + 16*len(result))
 		return nil
 
 	case types.StrValue:
 		startIdx := startInt.Val
 		endIdx := endInt.Val
 		s := coll.Value()
-		length := int64(len(s))
+		length := int64(types.StrLen(s))
 
 		if startIdx > endIdx {
 			vm.Push(types.NewStr(""))
@@ -918,7 +931,7 @@ func (vm *VM) executeRange() error {
 			return fmt.Errorf("E_RANGE: string range end out of range")
 		}
 
-		vm.Push(types.NewStr(s[startIdx-1 : endIdx]))
+		vm.Push(types.NewStr(types.StrSlice(s, int(startIdx-1), int(endIdx))))
 		return nil
 
 	case types.MapValue:
@@ -943,6 +956,7 @@ func (vm *VM) executeRange() error {
 			result = append(result, pairs[i-1])
 		}
 		vm.Push(types.NewMap(result))
+		vm.chargeMemory(32 + 32*len(result))
 		return nil
 
 	default:
@@ -958,6 +972,7 @@ func (vm *VM) executeMakeList() error {
 		return fmt.Errorf("E_QUOTA: list too large")
 	}
 	vm.Push(result)
+	vm.chargeValue(result)
 	return nil
 }
 
@@ -979,6 +994,7 @@ func (vm *VM) executeMakeMap() error {
 		return fmt.Errorf("E_QUOTA: map too large")
 	}
 	vm.Push(result)
+	vm.chargeValue(result)
 	return nil
 }
 
@@ -989,7 +1005,7 @@ func (vm *VM) executeLength() error {
 	case types.ListValue:
 		vm.Push(types.IntValue{Val: int64(c.Len())})
 	case types.StrValue:
-		vm.Push(types.IntValue{Val: int64(len(c.Value()))})
+		vm.Push(types.IntValue{Val: int64(types.StrLen(c.Value()))})
 	case types.MapValue:
 		vm.Push(types.IntValue{Val: int64(c.Len())})
 	default:
@@ -1019,7 +1035,7 @@ func (vm *VM) executeIndexMarker() error {
 		if marker == 0 {
 			vm.Push(types.NewInt(1))
 		} else if marker == 1 {
-			vm.Push(types.NewInt(int64(len(c.Value()))))
+			vm.Push(types.NewInt(int64(types.StrLen(c.Value()))))
 		} else {
 			return fmt.Errorf("E_INVARG: invalid index marker")
 		}
@@ -1116,19 +1132,13 @@ func (vm *VM) executeListAppend() error {
 		return fmt.Errorf("E_TYPE: LIST_APPEND requires a list")
 	}
 
-	// Build new list with element appended
-	newElems := make([]types.Value, list.Len()+1)
-	for i := 1; i <= list.Len(); i++ {
-		newElems[i-1] = list.Get(i)
-	}
-	newElems[list.Len()] = elem
-
-	result := types.NewList(newElems)
-	if errCode := builtins.CheckListLimit(result); errCode != types.E_NONE {
+	result := list.Append(elem)
+	if errCode := builtins.CheckListGrowth(list, result, []types.Value{elem}, nil); errCode != types.E_NONE {
 		return fmt.Errorf("E_QUOTA: list too large")
 	}
 
 	vm.Push(result)
+	vm.chargeMemory(16)
 	return nil
 }
 
@@ -1148,21 +1158,23 @@ func (vm *VM) executeListExtend() error {
 		return fmt.Errorf("E_TYPE: splice requires a list operand")
 	}
 
-	// Build new list with all elements of src appended
-	newElems := make([]types.Value, list.Len()+src.Len())
-	for i := 1; i <= list.Len(); i++ {
-		newElems[i-1] = list.Get(i)
-	}
-	for i := 1; i <= src.Len(); i++ {
-		newElems[list.Len()+i-1] = src.Get(i)
+	// {@l, x} starts from an empty list: take l as it is, so appending
+	// to it can extend it in place
+	if list.Len() == 0 {
+		if errCode := builtins.CheckListLimit(src); errCode != types.E_NONE {
+			return fmt.Errorf("E_QUOTA: list too large")
+		}
+		vm.Push(src)
+		return nil
 	}
 
-	result := types.NewList(newElems)
-	if errCode := builtins.CheckListLimit(result); errCode != types.E_NONE {
+	result := list.AppendAll(src.Elements())
+	if errCode := builtins.CheckListGrowth(list, result, src.Elements(), nil); errCode != types.E_NONE {
 		return fmt.Errorf("E_QUOTA: list too large")
 	}
 
 	vm.Push(result)
+	vm.chargeMemory(16 * src.Len())
 	return nil
 }
 
@@ -1179,7 +1191,7 @@ func (vm *VM) executeSplice() error {
 }
 
 func (vm *VM) executeCallBuiltin() error {
-	funcID := vm.ReadByte()
+	funcID := vm.ReadShort()
 	argc := vm.ReadByte()
 
 	var args []types.Value
@@ -1198,6 +1210,11 @@ func (vm *VM) executeCallBuiltin() error {
 		args = vm.PopN(int(argc))
 	}
 
+	// Protected builtins may be redirected to a #0:bf_<name> wrapper verb
+	if redirected, err := vm.callProtectedBuiltin(int(funcID), args); redirected || err != nil {
+		return err
+	}
+
 	// Sync task call-stack line numbers so builtins like callers() see
 	// accurate values.
 	vm.syncTaskLineNumbers()
@@ -1208,7 +1225,12 @@ func (vm *VM) executeCallBuiltin() error {
 	}
 
 	// Call builtin
-	result := vm.Builtins.CallByID(int(funcID), vm.Context, args)
+	var result types.Result
+	if profile.Enabled() {
+		result = vm.profiledCallBuiltin(int(funcID), args)
+	} else {
+		result = vm.Builtins.CallByID(int(funcID), vm.Context, args)
+	}
 
 	// Clear CallerVM after the call
 	if vm.Context != nil {
@@ -1239,9 +1261,40 @@ func (vm *VM) executeCallBuiltin() error {
 	}
 
 	vm.Push(result.Val)
+	vm.chargeValue(result.Val)
 	return nil
 }
 
+// callProtectedBuiltin applies LambdaMOO's protect_<name> rules to a
+// builtin call made from anywhere but #0 (so #0:bf_<name> can call the
+// real builtin). The call goes to #0:bf_<name> when that verb exists and
+// is executable; otherwise non-wizards get E_PERM. Reports whether a
+// wrapper frame was pushed.
+func (vm *VM) callProtectedBuiltin(funcID int, args []types.Value) (bool, error) {
+	name, ok := vm.Builtins.GetName(funcID)
+	// call_function(name, @args) is subject to name's protection
+	if name == "call_function" && len(args) > 0 {
+		if target, isStr := args[0].(types.StrValue); isStr {
+			name, args = target.Value(), args[1:]
+		}
+	}
+	if !ok || !builtins.IsBuiltinProtected(name) || vm.Store == nil {
+		return false, nil
+	}
+	if frame := vm.CurrentFrame(); frame == nil || frame.This == 0 {
+		return false, nil
+	}
+
+	wrapper := "bf_" + name
+	if verb, defObjID, err := vm.Store.FindVerb(0, wrapper); err == nil && verb.Perms.Has(db.VerbExecute) {
+		return true, vm.pushVerbFrame(0, nil, wrapper, verb, defObjID, args)
+	}
+	if vm.Context == nil || !vm.Context.IsWizard {
+		return false, fmt.Errorf("E_PERM: builtin %s() is protected", name)
+	}
+	return false, nil
+}
+
 // Property operations
 
 func (vm *VM) executeGetProp() error {
@@ -1396,6 +1449,11 @@ func (vm *VM) executeSetProp() error {
 	// Pop the value to assign
 	value := vm.Pop()
 
+	// Lambdas only live in running tasks; properties are saved with the database
+	if types.ContainsLambda(value) {
+		return fmt.Errorf("E_TYPE: cannot store a lambda in a property")
+	}
+
 	// Check if it's a waif (must check before ObjValue since waifs are a different type)
 	if waifVal, ok := objVal.(types.WaifValue); ok {
 		return vm.vmSetWaifProp(waifVal, propName, value)
@@ -1424,6 +1482,7 @@ func (vm *VM) executeSetProp() error {
 		if errCode != types.E_NONE {
 			return fmt.Errorf("%s: cannot set built-in property %s", errCode, propName)
 		}
+		vm.Store.ObjectChanged(obj)
 		return nil
 	}
 
@@ -1435,8 +1494,11 @@ func (vm *VM) executeSetProp() error {
 			return err
 		}
 		// Property exists locally - update it
+		value = vm.Store.StoreValue(value)
+		old := prop.Value
 		prop.Clear = false
 		prop.Value = value
+		vm.Store.PropertyWritten(obj, prop, old)
 		return nil
 	}
 
@@ -1454,13 +1516,14 @@ func (vm *VM) executeSetProp() error {
 	// Property is inherited - create a local copy with the new value
 	newProp := &db.Property{
 		Name:    propName,
-		Value:   value,
+		Value:   vm.Store.StoreValue(value),
 		Owner:   inheritedProp.Owner,
 		Perms:   inheritedProp.Perms,
 		Clear:   false,
 		Defined: false,
 	}
 	obj.Properties[propName] = newProp
+	vm.Store.PropertyWritten(obj, newProp, nil)
 
 	return nil
 }
@@ -1483,7 +1546,10 @@ func (vm *VM) vmSetWaifProp(waif types.WaifValue, propName string, value types.V
 	// Note: Waifs use copy-on-write semantics. The VM does not currently
 	// propagate the new waif back to the source variable. This matches
 	// the tree-walker's limitation for non-simple-identifier cases.
+	value = vm.Store.StoreValue(value)
 	_ = waif.SetProperty(propName, value)
+	vm.Store.WaifPropertyWritten(waif, value)
+	vm.chargeMemory(16 + len(propName) + 1)
 
 	return nil
 }
@@ -1866,22 +1932,21 @@ func (vm *VM) executeIterPrep() error {
 		vm.Push(types.IntValue{Val: 1})
 
 	case types.StrValue:
-		s := c.Value()
-		runes := []rune(s)
+		chars := types.StrChars(c.Value())
 		if hasIndex {
 			// Produce {char, 1-based-index} pairs
-			elements := make([]types.Value, len(runes))
-			for i, r := range runes {
-				pair := types.NewList([]types.Value{types.NewStr(string(r)), types.IntValue{Val: int64(i + 1)}})
+			elements := make([]types.Value, len(chars))
+			for i, ch := range chars {
+				pair := types.NewList([]types.Value{types.NewStr(ch), types.IntValue{Val: int64(i + 1)}})
 				elements[i] = pair
 			}
 			vm.Push(types.NewList(elements))
 			vm.Push(types.IntValue{Val: 1})
 		} else {
 			// Convert to list of single-char strings
-			elements := make([]types.Value, len(runes))
-			for i, r := range runes {
-				elements[i] = types.NewStr(string(r))
+			elements := make([]types.Value, len(chars))
+			for i, ch := range chars {
+				elements[i] = types.NewStr(ch)
 			}
 			vm.Push(types.NewList(elements))
 			vm.Push(types.IntValue{Val: 0})
@@ -2049,6 +2114,17 @@ func (vm *VM) executeCallVerb() error {
 		return fmt.Errorf("E_PERM: verb %s is not executable", verbName)
 	}
 
+	return vm.pushVerbFrame(objID, thisValue, verbName, verb, defObjID, args)
+}
+
+// pushVerbFrame starts a call to verb, defined on defObjID, with this set
+// to objID (or thisValue for waif, primitive and anonymous targets). The
+// verb's return value is pushed onto the caller's stack when it returns.
+func (vm *VM) pushVerbFrame(objID types.ObjID, thisValue types.Value, verbName string, verb *db.Verb, defObjID types.ObjID, args []types.Value) error {
+	if err := vm.checkStackDepth(); err != nil {
+		return err
+	}
+
 	// Try to compile verb to bytecode
 	prog, compileErr := CompileVerbBytecode(verb, vm.Builtins)
 	if compileErr != nil {
@@ -2286,7 +2362,7 @@ func (vm *VM) executePass() error {
 			break
 		}
 		// Check aliases
-		for _, v := range obj.Verbs {
+		for _, v := range obj.VerbList {
 			for _, alias := range v.Names {
 				if alias == verbName {
 					verb = v
@@ -2314,6 +2390,10 @@ func (vm *VM) executePass() error {
 		return fmt.Errorf("E_PERM: parent verb %s is not executable", verbName)
 	}
 
+	if err := vm.checkStackDepth(); err != nil {
+		return err
+	}
+
 	// Compile the parent verb to bytecode
 	prog, compileErr := CompileVerbBytecode(verb, vm.Builtins)
 	if compileErr != nil {
@@ -59,14 +59,12 @@ func add(left, right types.Value) types.Result {
 	// String concatenation
 	if leftStr, ok := left.(types.StrValue); ok {
 		if rightStr, ok := right.(types.StrValue); ok {
-			result := leftStr.Value() + rightStr.Value()
-
 			// Check string limit
-			if err := builtins.CheckStringLimit(result); err != types.E_NONE {
+			if err := builtins.CheckStringLength(leftStr.Len() + rightStr.Len()); err != types.E_NONE {
 				return types.Err(err)
 			}
 
-			return types.Ok(types.NewStr(result))
+			return types.Ok(leftStr.Concat(rightStr))
 		}
 		return types.Err(types.E_TYPE)
 	}
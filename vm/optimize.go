@@ -0,0 +1,569 @@
+package vm
+
+import (
+	"barn/types"
+	"sync/atomic"
+)
+
+// The optimizer rewrites a compiled program before it runs:
+//
+//   - constant arithmetic, bitwise operations and comparisons are folded
+//   - conditional jumps on constants become plain jumps or disappear, and
+//     code left unreachable is removed
+//   - jumps to jumps go straight to the final target; jumps to the next
+//     instruction are dropped
+//   - DUP/POP and PUSH/POP pairs left by expression statements are removed
+//
+// Folding uses the VM's own operators, so results and errors are the same
+// as at run time; anything that would raise is left for run time. No
+// instruction that counts a tick is added or removed from a reachable
+// path, and rewrites never span a line start, a jump target or a fork or
+// lambda body boundary, so ticks, line numbers and those bodies are
+// unchanged.
+
+// optimizeOff turns the optimizer off; it is on by default
+var optimizeOff atomic.Bool
+
+// SetOptimize turns the bytecode optimizer on or off for programs compiled
+// from now on. Verbs keep the bytecode they were compiled with. Turning it
+// off is meant for comparing optimized and unoptimized execution.
+func SetOptimize(on bool) {
+	optimizeOff.Store(!on)
+}
+
+// OptimizeEnabled reports whether compiled programs are optimized
+func OptimizeEnabled() bool {
+	return !optimizeOff.Load()
+}
+
+// instr is one decoded instruction. Control transfers are kept as
+// instruction indexes so instructions can be removed and the operands
+// re-encoded afterwards.
+type instr struct {
+	op      OpCode
+	operand []byte
+	targets []int // jump, loop, handler, or fork or lambda body end instructions
+	line    int   // source line starting here, 0 if none
+	dead    bool
+}
+
+// Optimize rewrites p in place. Programs it cannot decode are left alone.
+func Optimize(p *Program) {
+	instrs, ok := decodeProgram(p)
+	if !ok || len(instrs) == 0 {
+		return
+	}
+	o := &optimizer{prog: p, folder: NewVM(nil, nil)}
+	passes := []func([]instr) bool{
+		o.foldConstants,
+		o.foldBranches,
+		o.removeStackTraffic,
+		o.threadJumps,
+		removeUnreachable,
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, pass := range passes {
+			if pass(instrs) {
+				instrs = compact(instrs)
+				changed = true
+			}
+		}
+	}
+	encodeProgram(p, instrs)
+}
+
+type optimizer struct {
+	prog   *Program
+	folder *VM // evaluates folded operations
+}
+
+// foldConstants replaces an operation on constant operands with its result
+func (o *optimizer) foldConstants(instrs []instr) bool {
+	leader := leaders(instrs)
+	changed := false
+	for i := 0; i < len(instrs); i++ {
+		a, ok := o.constant(instrs[i])
+		if !ok {
+			continue
+		}
+		if i+2 < len(instrs) && !leader[i+1] && !leader[i+2] {
+			if b, ok := o.constant(instrs[i+1]); ok && foldable(instrs[i+2].op, a, b) {
+				if v, ok := o.eval(instrs[i+2].op, a, b); ok && o.setConstant(&instrs[i], v) {
+					instrs[i+1].dead = true
+					instrs[i+2].dead = true
+					changed = true
+					i += 2
+					continue
+				}
+			}
+		}
+		if i+1 < len(instrs) && !leader[i+1] && foldable(instrs[i+1].op, a) {
+			if v, ok := o.eval(instrs[i+1].op, a); ok && o.setConstant(&instrs[i], v) {
+				instrs[i+1].dead = true
+				changed = true
+				i++
+			}
+		}
+	}
+	return changed
+}
+
+// foldBranches resolves conditional jumps and short-circuit operators whose
+// operand is a constant
+func (o *optimizer) foldBranches(instrs []instr) bool {
+	leader := leaders(instrs)
+	changed := false
+	for i := 0; i+1 < len(instrs); i++ {
+		v, ok := o.constant(instrs[i])
+		if !ok || leader[i+1] {
+			continue
+		}
+		next := &instrs[i+1]
+		switch next.op {
+		case OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE:
+			// Both pop the condition
+			if v.Truthy() == (next.op == OP_JUMP_IF_TRUE) {
+				instrs[i].dead = true
+				next.op = OP_JUMP
+			} else {
+				instrs[i].dead = true
+				next.dead = true
+			}
+		case OP_AND, OP_OR:
+			// Both keep the operand when they jump and pop it otherwise
+			if v.Truthy() == (next.op == OP_OR) {
+				next.op = OP_JUMP
+			} else {
+				instrs[i].dead = true
+				next.dead = true
+			}
+		default:
+			continue
+		}
+		changed = true
+		i++
+	}
+	return changed
+}
+
+// removeStackTraffic drops values pushed only to be popped again
+func (o *optimizer) removeStackTraffic(instrs []instr) bool {
+	leader := leaders(instrs)
+	changed := false
+	for i := 0; i+1 < len(instrs); i++ {
+		in, next := &instrs[i], &instrs[i+1]
+		if leader[i+1] {
+			continue
+		}
+		if _, isConst := o.constant(*in); (isConst || in.op == OP_DUP) && next.op == OP_POP {
+			in.dead = true
+			next.dead = true
+			changed = true
+			i++
+			continue
+		}
+		// An assignment statement: DUP, SET_VAR n, POP
+		if in.op == OP_DUP && next.op == OP_SET_VAR && i+2 < len(instrs) && !leader[i+2] && instrs[i+2].op == OP_POP {
+			in.dead = true
+			instrs[i+2].dead = true
+			changed = true
+			i += 2
+		}
+	}
+	return changed
+}
+
+// threadJumps points jumps that land on an unconditional jump at its target
+// and drops jumps to the next instruction
+func (o *optimizer) threadJumps(instrs []instr) bool {
+	region := forkRegions(instrs)
+	changed := false
+	for i := range instrs {
+		in := &instrs[i]
+		switch in.op {
+		case OP_JUMP, OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE, OP_AND, OP_OR:
+		default:
+			continue
+		}
+		// Jumps only go forward, so this ends; staying in the same fork
+		// body keeps jumps inside it once the body is extracted
+		t := in.targets[0]
+		for t < len(instrs) && instrs[t].op == OP_JUMP && region[t] == region[i] {
+			t = instrs[t].targets[0]
+		}
+		if t != in.targets[0] {
+			in.targets[0] = t
+			changed = true
+		}
+		if t == i+1 {
+			switch in.op {
+			case OP_JUMP:
+				in.dead = true
+				changed = true
+			case OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE:
+				in.op = OP_POP
+				in.operand = nil
+				in.targets = nil
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// removeUnreachable drops instructions no path from the entry reaches
+func removeUnreachable(instrs []instr) bool {
+	reached := make([]bool, len(instrs))
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		if i >= len(instrs) || reached[i] {
+			continue
+		}
+		reached[i] = true
+		work = append(work, instrs[i].targets...)
+		switch instrs[i].op {
+		case OP_JUMP, OP_LOOP, OP_RETURN, OP_RETURN_NONE:
+		default:
+			work = append(work, i+1)
+		}
+	}
+	changed := false
+	for i := range instrs {
+		if !reached[i] {
+			instrs[i].dead = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// constant returns the value an instruction pushes if it pushes a constant
+func (o *optimizer) constant(in instr) (types.Value, bool) {
+	if in.dead {
+		return nil, false
+	}
+	if IsImmediateInt(in.op) {
+		return types.NewInt(int64(GetImmediateValue(in.op))), true
+	}
+	if in.op == OP_PUSH && int(in.operand[0]) < len(o.prog.Constants) {
+		return o.prog.Constants[in.operand[0]], true
+	}
+	return nil, false
+}
+
+// setConstant turns in into an instruction pushing v. Reports false if the
+// constant pool is full.
+func (o *optimizer) setConstant(in *instr, v types.Value) bool {
+	if i, ok := v.(types.IntValue); ok && i.Val >= OP_IMM_MIN && i.Val <= OP_IMM_MAX {
+		in.op, _ = MakeImmediateOpcode(int(i.Val))
+		in.operand = nil
+		return true
+	}
+	idx := -1
+	for j, c := range o.prog.Constants {
+		if c.Type() == v.Type() && c.String() == v.String() {
+			idx = j
+			break
+		}
+	}
+	if idx < 0 {
+		if len(o.prog.Constants) > 255 {
+			return false
+		}
+		idx = len(o.prog.Constants)
+		o.prog.Constants = append(o.prog.Constants, v)
+	}
+	in.op = OP_PUSH
+	in.operand = []byte{byte(idx)}
+	return true
+}
+
+// eval applies op to constant operands, reporting false if it raises
+func (o *optimizer) eval(op OpCode, args ...types.Value) (types.Value, bool) {
+	vm := o.folder
+	vm.SP = 0
+	for _, a := range args {
+		vm.Push(a)
+	}
+	if err := vm.Execute(op); err != nil || vm.SP != 1 {
+		return nil, false
+	}
+	return vm.Pop(), true
+}
+
+// foldable reports whether op may be folded for these operands. Arithmetic
+// is limited to numbers so run-time limits on strings still apply.
+func foldable(op OpCode, args ...types.Value) bool {
+	numeric, scalar := true, true
+	for _, a := range args {
+		switch a.(type) {
+		case types.IntValue, types.FloatValue:
+		case types.StrValue, types.ObjValue, types.ErrValue:
+			numeric = false
+		default:
+			numeric, scalar = false, false
+		}
+	}
+	switch op {
+	case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW,
+		OP_BITOR, OP_BITAND, OP_BITXOR, OP_SHL, OP_SHR:
+		return len(args) == 2 && numeric
+	case OP_EQ, OP_NE, OP_LT, OP_LE, OP_GT, OP_GE:
+		return len(args) == 2 && scalar
+	case OP_NEG, OP_BITNOT:
+		return len(args) == 1 && numeric
+	case OP_NOT:
+		return len(args) == 1 && scalar
+	}
+	return false
+}
+
+// leaders marks instructions a rewrite must not fold into the instruction
+// before them: line starts, control transfer targets and fork and lambda
+// body starts
+func leaders(instrs []instr) []bool {
+	leader := make([]bool, len(instrs)+1)
+	for i, in := range instrs {
+		if in.line != 0 {
+			leader[i] = true
+		}
+		for _, t := range in.targets {
+			leader[t] = true
+		}
+		if in.op == OP_FORK || in.op == OP_MAKE_LAMBDA {
+			leader[i+1] = true
+		}
+	}
+	return leader
+}
+
+// forkRegions returns, for each instruction, the index of the innermost
+// OP_FORK or OP_MAKE_LAMBDA whose body contains it, or -1
+func forkRegions(instrs []instr) []int {
+	region := make([]int, len(instrs)+1)
+	type body struct{ fork, end int }
+	var open []body
+	for i := range instrs {
+		for len(open) > 0 && i >= open[len(open)-1].end {
+			open = open[:len(open)-1]
+		}
+		region[i] = -1
+		if len(open) > 0 {
+			region[i] = open[len(open)-1].fork
+		}
+		if instrs[i].op == OP_FORK || instrs[i].op == OP_MAKE_LAMBDA {
+			open = append(open, body{i, instrs[i].targets[0]})
+		}
+	}
+	region[len(instrs)] = -1
+	return region
+}
+
+// compact drops dead instructions. Control transfers to a dropped
+// instruction go to the next live one, which also takes over its line
+// start unless it starts a line of its own.
+func compact(instrs []instr) []instr {
+	newIndex := make([]int, len(instrs)+1)
+	out := make([]instr, 0, len(instrs))
+	line := 0
+	for i, in := range instrs {
+		newIndex[i] = len(out)
+		if in.dead {
+			if in.line != 0 {
+				line = in.line
+			}
+			continue
+		}
+		if in.line == 0 {
+			in.line = line
+		}
+		line = 0
+		out = append(out, in)
+	}
+	newIndex[len(instrs)] = len(out)
+	for i := range out {
+		for j, t := range out[i].targets {
+			out[i].targets[j] = newIndex[t]
+		}
+	}
+	return out
+}
+
+// operandSize returns the length of the operands of the instruction whose
+// opcode is at code[ip-1]
+func operandSize(code []byte, ip int) (int, bool) {
+	op := OpCode(code[ip-1])
+	if IsImmediateInt(op) {
+		return 0, true
+	}
+	switch op {
+	case OP_POP, OP_DUP,
+		OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_POW, OP_NEG,
+		OP_EQ, OP_NE, OP_LT, OP_LE, OP_GT, OP_GE, OP_IN, OP_NOT,
+		OP_BITOR, OP_BITAND, OP_BITXOR, OP_BITNOT, OP_SHL, OP_SHR,
+		OP_RETURN, OP_RETURN_NONE, OP_END_EXCEPT, OP_END_FINALLY,
+		OP_INDEX, OP_RANGE, OP_LENGTH, OP_SPLICE,
+		OP_LIST_RANGE, OP_LIST_APPEND, OP_LIST_EXTEND:
+		return 0, true
+	case OP_PUSH, OP_GET_VAR, OP_SET_VAR, OP_GET_PROP, OP_SET_PROP,
+		OP_MAKE_LIST, OP_MAKE_MAP, OP_INDEX_SET, OP_RANGE_SET,
+		OP_INDEX_MARKER, OP_ITER_PREP, OP_PASS, OP_CALL_LAMBDA:
+		return 1, true
+	case OP_JUMP, OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE, OP_AND, OP_OR,
+		OP_LOOP, OP_TRY_FINALLY, OP_CALL_VERB:
+		return 2, true
+	case OP_CALL_BUILTIN, OP_SCATTER, OP_FORK:
+		return 3, true
+	case OP_MAKE_LAMBDA:
+		return 4, true
+	case OP_TRY_EXCEPT:
+		// num_clauses, then per clause num_codes, codes, var, handler:short
+		p := ip
+		if p >= len(code) {
+			return 0, false
+		}
+		n := int(code[p])
+		p++
+		for ; n > 0; n-- {
+			if p >= len(code) {
+				return 0, false
+			}
+			p += 1 + int(code[p]) + 1 + 2
+		}
+		return p - ip, true
+	}
+	return 0, false
+}
+
+// exceptHandlerOffsets returns where each clause's handler IP sits in an
+// OP_TRY_EXCEPT operand
+func exceptHandlerOffsets(operand []byte) []int {
+	var offsets []int
+	p := 1
+	for n := int(operand[0]); n > 0; n-- {
+		p += 1 + int(operand[p]) + 1
+		offsets = append(offsets, p)
+		p += 2
+	}
+	return offsets
+}
+
+func getShort(b []byte, at int) int {
+	return int(b[at])<<8 | int(b[at+1])
+}
+
+func putShort(b []byte, at, v int) bool {
+	if v < 0 || v > 0xFFFF {
+		return false
+	}
+	b[at] = byte(v >> 8)
+	b[at+1] = byte(v)
+	return true
+}
+
+// decodeProgram splits p.Code into instructions and resolves control
+// transfers and line starts to instruction indexes
+func decodeProgram(p *Program) ([]instr, bool) {
+	code := p.Code
+	index := make([]int, len(code)+1)
+	for i := range index {
+		index[i] = -1
+	}
+	var instrs []instr
+	var addrs []int
+	for ip := 0; ip < len(code); {
+		size, ok := operandSize(code, ip+1)
+		if !ok || ip+1+size > len(code) {
+			return nil, false
+		}
+		index[ip] = len(instrs)
+		instrs = append(instrs, instr{op: OpCode(code[ip]), operand: code[ip+1 : ip+1+size]})
+		addrs = append(addrs, ip)
+		ip += 1 + size
+	}
+	index[len(code)] = len(instrs)
+
+	for i := range instrs {
+		in := &instrs[i]
+		next := addrs[i] + 1 + len(in.operand)
+		var dests []int
+		switch in.op {
+		case OP_JUMP, OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE, OP_AND, OP_OR:
+			dests = []int{next + getShort(in.operand, 0)}
+		case OP_LOOP:
+			dests = []int{next - getShort(in.operand, 0)}
+		case OP_TRY_FINALLY:
+			dests = []int{getShort(in.operand, 0)}
+		case OP_FORK:
+			dests = []int{next + getShort(in.operand, 1)}
+		case OP_MAKE_LAMBDA:
+			dests = []int{next + getShort(in.operand, 2)}
+		case OP_TRY_EXCEPT:
+			for _, at := range exceptHandlerOffsets(in.operand) {
+				dests = append(dests, getShort(in.operand, at))
+			}
+		}
+		for _, addr := range dests {
+			if addr < 0 || addr > len(code) || index[addr] < 0 {
+				return nil, false
+			}
+			in.targets = append(in.targets, index[addr])
+		}
+	}
+
+	for _, entry := range p.LineInfo {
+		if entry.StartIP < 0 || entry.StartIP > len(code) || index[entry.StartIP] < 0 {
+			return nil, false
+		}
+		if i := index[entry.StartIP]; i < len(instrs) {
+			instrs[i].line = entry.Line
+		}
+	}
+	return instrs, true
+}
+
+// encodeProgram writes instrs back to p, leaving p alone if an operand no
+// longer fits
+func encodeProgram(p *Program, instrs []instr) bool {
+	addrs := make([]int, len(instrs)+1)
+	for i, in := range instrs {
+		addrs[i+1] = addrs[i] + 1 + len(in.operand)
+	}
+	code := make([]byte, 0, addrs[len(instrs)])
+	var lines []LineEntry
+	for i, in := range instrs {
+		operand := append([]byte(nil), in.operand...)
+		next := addrs[i+1]
+		ok := true
+		switch in.op {
+		case OP_JUMP, OP_JUMP_IF_FALSE, OP_JUMP_IF_TRUE, OP_AND, OP_OR:
+			ok = putShort(operand, 0, addrs[in.targets[0]]-next)
+		case OP_LOOP:
+			ok = putShort(operand, 0, next-addrs[in.targets[0]])
+		case OP_TRY_FINALLY:
+			ok = putShort(operand, 0, addrs[in.targets[0]])
+		case OP_FORK:
+			ok = putShort(operand, 1, addrs[in.targets[0]]-next)
+		case OP_MAKE_LAMBDA:
+			ok = putShort(operand, 2, addrs[in.targets[0]]-next)
+		case OP_TRY_EXCEPT:
+			for j, at := range exceptHandlerOffsets(operand) {
+				ok = ok && putShort(operand, at, addrs[in.targets[j]])
+			}
+		}
+		if !ok {
+			return false
+		}
+		code = append(code, byte(in.op))
+		code = append(code, operand...)
+		if in.line != 0 && (len(lines) == 0 || lines[len(lines)-1].Line != in.line) {
+			lines = append(lines, LineEntry{StartIP: addrs[i], Line: in.line})
+		}
+	}
+	p.Code = code
+	p.LineInfo = lines
+	return true
+}
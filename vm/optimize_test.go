@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"barn/parser"
+	"barn/types"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var noOptimize = flag.Bool("no-optimize", false, "run the VM tests on unoptimized bytecode")
+
+// TestMain lets the parity tests run against unoptimized bytecode with
+// go test ./vm -no-optimize
+func TestMain(m *testing.M) {
+	flag.Parse()
+	SetOptimize(!*noOptimize)
+	os.Exit(m.Run())
+}
+
+// compileWith compiles code with the optimizer on or off
+func compileWith(t *testing.T, code string, optimize bool) *Program {
+	t.Helper()
+	stmts, err := parser.NewParser(code).ParseProgram()
+	if err != nil {
+		t.Fatalf("parse %q: %v", code, err)
+	}
+	defer SetOptimize(OptimizeEnabled())
+	SetOptimize(optimize)
+	prog, err := NewCompilerWithRegistry(newTestRegistry()).CompileStatements(stmts)
+	if err != nil {
+		t.Fatalf("compile %q: %v", code, err)
+	}
+	return prog
+}
+
+// ops lists a program's opcodes by name
+func ops(p *Program) []string {
+	var names []string
+	for ip := 0; ip < len(p.Code); {
+		size, _ := operandSize(p.Code, ip+1)
+		names = append(names, OpCode(p.Code[ip]).String())
+		ip += 1 + size
+	}
+	return names
+}
+
+func TestOptimizeFoldsConstants(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"return 1 + 2 * 3;", "IMM RETURN"},
+		{"return -(2 ^ 10) / 4;", "PUSH RETURN"},
+		{"return 1.5 * 2.0 < 4.0;", "IMM RETURN"},
+		{`return "abc" == "ABC";`, "IMM RETURN"},
+		{"return !(3 > 2);", "IMM RETURN"},
+		// Errors are left to run time
+		{"return 1 / 0;", "IMM IMM DIV RETURN"},
+		{`return "a" + "b";`, "PUSH PUSH ADD RETURN"},
+		// Never folded into a line of its own
+		{"x = 1 +\n2;\nreturn x;", "IMM IMM ADD SET_VAR GET_VAR RETURN"},
+	}
+	for _, tt := range tests {
+		got := strings.Join(ops(compileWith(t, tt.code, true)), " ")
+		if got != tt.want {
+			t.Errorf("%q compiled to %s, want %s", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestOptimizeBranchesAndJumps(t *testing.T) {
+	prog := compileWith(t, "if (0)\n  x = 1;\nelseif (1)\n  x = 2;\nelse\n  x = 3;\nendif\nreturn x;", true)
+	if got := strings.Join(ops(prog), " "); got != "IMM SET_VAR GET_VAR RETURN" {
+		t.Errorf("constant if compiled to %s", got)
+	}
+	want := []LineEntry{{StartIP: 0, Line: 4}, {StartIP: 3, Line: 8}}
+	if len(prog.LineInfo) != len(want) || prog.LineInfo[0] != want[0] || prog.LineInfo[1] != want[1] {
+		t.Errorf("LineInfo = %v, want %v", prog.LineInfo, want)
+	}
+
+	// The loop drops its constant condition but keeps its ticking backward jump
+	prog = compileWith(t, "while (1)\n  if (x = x + 1) break; endif\nendwhile", true)
+	got := strings.Join(ops(prog), " ")
+	if strings.Count(got, "JUMP_IF_FALSE") != 1 || !strings.Contains(got, "LOOP") {
+		t.Errorf("while (1) compiled to %s", got)
+	}
+}
+
+// TestOptimizerParity runs programs with the optimizer on and off and
+// expects the same results, ticks and error lines
+func TestOptimizerParity(t *testing.T) {
+	programs := []string{
+		"return 1 + 2 * 3 - 4 / 2 % 3;",
+		"return {1 + 1, 2.0 * 3, 1 < 2 && 3, 0 || \"x\", !0};",
+		"x = 5; x = x * 2; return x;",
+		"s = 0; for i in [1..10] s = s + i; endfor return s;",
+		"i = 0; while (1) i = i + 1; if (i > 5) break; endif endwhile return i;",
+		"if (1 > 2) return 1; elseif (0) return 2; endif return 3;",
+		"while (0) x = 1; endwhile return 0;",
+		"x = 0; while (x < 3) x = x + 1; endwhile return x;",
+		"return 1 && 0 || 5;",
+		"try return 1 / 0; except e (E_DIV) return e[1]; endtry",
+		"try x = 1; finally x = x + (2 * 3); endtry return x;",
+		"x = `1 / 0 ! E_DIV => 7'; return x + 1;",
+		"fork (0) y = 1 + 1; endfork return 4 * 4;",
+		"l = {}; for x in ({1, 2, 3}) l = {@l, x * (2 + 2)}; endfor return l;",
+		"x = 1;\ny = x +\n(2 * 3);\nreturn y / (1 - 1);",
+		"{a, ?b = 2 + 3, @c} = {1}; return {a, b, c};",
+		"return length(tostr(1 + 2, 3 * 4));",
+	}
+	run := func(code string, optimize bool) (string, int64) {
+		vm := NewVM(nil, newTestRegistry())
+		vm.Context = types.NewTaskContext()
+		val, err := vmRunToCompletion(vm, compileWith(t, code, optimize))
+		if err != nil {
+			return "error " + err.Error(), vm.Ticks
+		}
+		return val.String(), vm.Ticks
+	}
+	for _, code := range programs {
+		want, wantTicks := run(code, false)
+		got, gotTicks := run(code, true)
+		if got != want || gotTicks != wantTicks {
+			t.Errorf("%q: optimized %s in %d ticks, unoptimized %s in %d ticks", code, got, gotTicks, want, wantTicks)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"barn/profile"
+	"barn/types"
+	"time"
+)
+
+// profiledExecute runs one opcode and charges its ticks and wall time to
+// frame's verb (and source line, when per-line profiling is on)
+func (vm *VM) profiledExecute(frame *StackFrame, op OpCode) error {
+	node := vm.profileNode(len(vm.Frames) - 1)
+	ip := frame.IP - 1
+
+	start := time.Now()
+	err := vm.Execute(op)
+	elapsed := time.Since(start)
+
+	line := 0
+	if profile.LinesEnabled() {
+		line = frame.Program.LineForIP(ip)
+	}
+	var ticks int64
+	if CountsTick(op) {
+		ticks = 1
+	}
+	profile.Step(node, line, ticks, elapsed)
+	return err
+}
+
+// profileNode returns the profiler call-tree node for vm.Frames[i],
+// entering it (and any frames below it not yet seen) on first use
+func (vm *VM) profileNode(i int) *profile.Node {
+	frame := vm.Frames[i]
+	if profile.Current(frame.profNode) {
+		return frame.profNode
+	}
+	var parent *profile.Node
+	if i > 0 {
+		parent = vm.profileNode(i - 1)
+	}
+	frame.profNode = profile.Enter(parent, profileFrame(frame))
+	return frame.profNode
+}
+
+// profileFrame names a stack frame for the profiler
+func profileFrame(frame *StackFrame) profile.Frame {
+	if frame.IsEvalFrame || frame.Verb == "" {
+		return profile.Frame{Definer: types.ObjNothing, Verb: "(eval)"}
+	}
+	return profile.Frame{Definer: frame.VerbLoc, Verb: frame.Verb}
+}
+
+// profiledCallBuiltin calls a builtin and charges its wall time to the
+// calling verb and to the builtin
+func (vm *VM) profiledCallBuiltin(funcID int, args []types.Value) types.Result {
+	node := vm.profileNode(len(vm.Frames) - 1)
+	start := time.Now()
+	result := vm.Builtins.CallByID(funcID, vm.Context, args)
+	name, _ := vm.Builtins.GetName(funcID)
+	profile.Builtin(node, name, time.Since(start))
+	return result
+}
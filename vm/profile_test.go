@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"barn/db"
+	"barn/parser"
+	"barn/profile"
+	"barn/task"
+	"barn/types"
+	"testing"
+)
+
+func TestProfilerChargesVerbs(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+	obj := db.NewObject(1, 1)
+	store.Add(obj)
+	for name, code := range map[string][]string{
+		"top":  {"for i in [1..3]", "this:leaf(i);", "endfor", "return length(\"abc\");"},
+		"leaf": {"return args[1] * 2;"},
+	} {
+		v := &db.Verb{Name: name, Names: []string{name}, Owner: 1, Perms: db.VerbExecute | db.VerbDebug, ArgSpec: db.VerbArgs{This: "this", Prep: "none", That: "none"}, Code: code}
+		obj.Verbs[name] = v
+		obj.VerbList = append(obj.VerbList, v)
+	}
+
+	profile.Reset()
+	profile.Start(true)
+	defer func() {
+		profile.Stop()
+		profile.Reset()
+	}()
+
+	prog, err := CompileVerbBytecode(obj.Verbs["top"], reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := types.NewTaskContext()
+	ctx.Player, ctx.Programmer, ctx.ThisObj = 1, 1, 1
+	ctx.Task = task.NewTask(1, 1, 100000, 5.0)
+	machine := NewVM(store, reg)
+	machine.Context = ctx
+	if result := machine.RunWithVerbContext(prog, 1, 1, 1, "top", 1, nil); result.Flow != types.FlowReturn {
+		t.Fatalf("top: flow %v error %v", result.Flow, result.Error)
+	}
+
+	stats := map[string]profile.VerbStats{}
+	for _, vs := range profile.Stats().Verbs {
+		stats[vs.Verb] = vs
+	}
+	if top := stats["top"]; top.Calls != 1 || top.Ticks == 0 || top.TotalTime < top.SelfTime || len(top.Lines) == 0 {
+		t.Errorf("top = %+v", top)
+	}
+	if leaf := stats["leaf"]; leaf.Calls != 3 || leaf.Definer != 1 || leaf.Lines[1] == nil {
+		t.Errorf("leaf = %+v", leaf)
+	}
+	if bfs := profile.Stats().Builtins; len(bfs) != 1 || bfs[0].Name != "length" || bfs[0].Calls != 1 {
+		t.Errorf("builtins = %+v", bfs)
+	}
+}
+
+// TestCallBuiltinPastByteIDs calls a builtin registered after the first
+// 256, as the profiler's builtins are: OP_CALL_BUILTIN carries a 16-bit ID
+func TestCallBuiltinPastByteIDs(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+	reg.Register("last_builtin", func(ctx *types.TaskContext, args []types.Value) types.Result {
+		return types.Ok(types.NewInt(int64(len(args))))
+	})
+	if id, _ := reg.GetID("last_builtin"); id <= 255 {
+		t.Fatalf("last_builtin has ID %d, want one past a byte", id)
+	}
+
+	stmts, err := parser.NewParser(`return last_builtin(1, 2, 3);`).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := NewCompilerWithRegistry(reg).CompileStatements(stmts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := types.NewTaskContext()
+	ctx.Task = task.NewTask(1, 1, 100000, 5.0)
+	machine := NewVM(store, reg)
+	machine.Context = ctx
+	if result := machine.Run(prog); result.Flow != types.FlowReturn || !result.Val.Equal(types.NewInt(3)) {
+		t.Errorf("last_builtin(1, 2, 3) = flow %v value %v, want 3", result.Flow, result.Val)
+	}
+}
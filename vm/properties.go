@@ -269,6 +269,7 @@ func (e *Evaluator) assignProperty(node *parser.PropertyExpr, value types.Value,
 		if errCode != types.E_NONE {
 			return types.Err(errCode)
 		}
+		e.store.ObjectChanged(obj)
 		return types.Ok(value)
 	}
 
@@ -276,8 +277,11 @@ func (e *Evaluator) assignProperty(node *parser.PropertyExpr, value types.Value,
 	prop, ok := obj.Properties[propName]
 	if ok {
 		// Property exists locally - update it
+		value = e.store.StoreValue(value)
+		old := prop.Value
 		prop.Clear = false
 		prop.Value = value
+		e.store.PropertyWritten(obj, prop, old)
 		return types.Ok(value)
 	}
 
@@ -294,13 +298,14 @@ func (e *Evaluator) assignProperty(node *parser.PropertyExpr, value types.Value,
 	// just a local value override of an inherited property
 	newProp := &db.Property{
 		Name:    propName,
-		Value:   value,
+		Value:   e.store.StoreValue(value),
 		Owner:   inheritedProp.Owner,
 		Perms:   inheritedProp.Perms,
 		Clear:   false, // Has local value now
 		Defined: false, // Not defined on this object, just overriding inherited
 	}
 	obj.Properties[propName] = newProp
+	e.store.PropertyWritten(obj, newProp, nil)
 
 	// Assignment returns the assigned value
 	return types.Ok(value)
@@ -532,7 +537,9 @@ func (e *Evaluator) assignWaifProperty(waif types.WaifValue, node *parser.Proper
 	// Set property on waif (this creates a new waif value with the property set)
 	// Waifs are immutable values, so this returns a new waif with the property set.
 	// The caller must update the variable that holds the waif.
+	value = e.store.StoreValue(value)
 	newWaif := waif.SetProperty(propName, value)
+	e.store.WaifPropertyWritten(newWaif, value)
 
 	return newWaif, types.Ok(value)
 }
@@ -738,7 +745,9 @@ func (e *Evaluator) waifPropertyIndexedAssign(waif types.WaifValue, propExpr *pa
 	// NOTE: Since waifs are immutable, we need to update the property and
 	// return success. The actual persistence is handled by the assignment
 	// expression evaluator which will update the variable holding the waif.
+	newPropVal = e.store.StoreValue(newPropVal)
 	_ = waif.SetProperty(propName, newPropVal)
+	e.store.WaifPropertyWritten(waif, newPropVal)
 
 	return types.Ok(value)
 }
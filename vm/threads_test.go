@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"barn/db"
+	"barn/task"
+	"barn/types"
+	"testing"
+	"time"
+)
+
+// TestThreadedBuiltinResumes runs a verb whose builtin calls go to the
+// thread pool, resuming it the way the scheduler does: with the value the
+// work returned, then raising the error it failed with.
+func TestThreadedBuiltinResumes(t *testing.T) {
+	store := db.NewStore()
+	reg := BuildVMRegistry(store)
+	obj := db.NewObject(1, 1)
+	obj.Flags = db.FlagProgrammer | db.FlagWizard
+	store.Add(obj)
+	v := &db.Verb{
+		Name:    "run",
+		Names:   []string{"run"},
+		Owner:   1,
+		Perms:   db.VerbExecute | db.VerbRead | db.VerbDebug,
+		ArgSpec: db.VerbArgs{This: "this", Prep: "none", That: "none"},
+		Code: []string{
+			"s = sort(args[1]);",
+			"try",
+			"  crypt(\"pw\", \"$2a$04$bad\");",
+			"except e (E_INVARG)",
+			"  return {s[1], s[$], \"caught\"};",
+			"endtry",
+			"return 0;",
+		},
+	}
+	obj.Verbs["run"] = v
+	obj.VerbList = append(obj.VerbList, v)
+	prog, err := CompileVerbBytecode(v, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tk := task.NewTask(8, 1, 100000, 5.0)
+	tk.SetState(task.TaskRunning)
+	ctx := types.NewTaskContext()
+	ctx.Player = 1
+	ctx.Programmer = 1
+	ctx.IsWizard = true
+	ctx.ThisObj = 1
+	ctx.Task = tk
+	ctx.TaskID = tk.ID
+	machine := NewVM(store, reg)
+	machine.Context = ctx
+	machine.Debuggable = true
+
+	// suspended waits for the background work to requeue the task
+	suspended := func(result types.Result) {
+		t.Helper()
+		if result.Flow != types.FlowSuspend {
+			t.Fatalf("got flow %v (%v), want the task suspended", result.Flow, result.Val)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for tk.GetState() != task.TaskQueued {
+			if time.Now().After(deadline) {
+				t.Fatal("the background work never requeued the task")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		tk.SetState(task.TaskRunning)
+	}
+
+	list := make([]types.Value, 10000)
+	for i := range list {
+		list[i] = types.NewInt(int64(len(list) - i))
+	}
+	suspended(machine.RunWithVerbContext(prog, 1, 1, 1, "run", 1, []types.Value{types.NewList(list)}))
+	machine.SetResumeValue(tk.WakeValue)
+	suspended(machine.Resume())
+	if tk.WakeError == nil || tk.WakeError.Error != types.E_INVARG {
+		t.Fatalf("crypt() with a bad salt woke the task with %v, want E_INVARG", tk.WakeError)
+	}
+	result := machine.ResumeWithError(tk.WakeError.Error, tk.WakeError.Val)
+	if want := `{1, 10000, "caught"}`; result.Flow != types.FlowReturn || result.Val.String() != want {
+		t.Errorf("verb returned %v %v, want %s", result.Flow, result.Val, want)
+	}
+}
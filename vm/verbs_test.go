@@ -26,7 +26,7 @@ func TestVerbBuiltins(t *testing.T) {
 	// Create an object directly with a verb
 	obj := db.NewObject(0, 0)
 	obj.Verbs = make(map[string]*db.Verb)
-	obj.Verbs["test"] = &db.Verb{
+	verb := &db.Verb{
 		Name:  "test",
 		Names: []string{"test"},
 		Owner: 0,
@@ -39,6 +39,8 @@ func TestVerbBuiltins(t *testing.T) {
 		Code:    []string{"return 42;"},
 		Program: nil,
 	}
+	obj.Verbs["test"] = verb
+	obj.VerbList = []*db.Verb{verb}
 	store.Add(obj)
 	objVal := types.NewObj(obj.ID)
 
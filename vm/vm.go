@@ -3,6 +3,8 @@ package vm
 import (
 	"barn/builtins"
 	"barn/db"
+	"barn/debug"
+	"barn/profile"
 	"barn/task"
 	"barn/trace"
 	"barn/types"
@@ -63,8 +65,16 @@ type VM struct {
 	TickLimit int64              // Maximum ticks before E_MAXREC
 	Ticks     int64              // Current tick count
 
+	MaxStackDepth int   // Maximum activations (verb, pass and eval frames) before E_MAXREC
+	MaxTaskMemory int64 // Bytes the task's values may hold before it is aborted with E_QUOTA; 0 for no limit
+	Debuggable    bool  // The scheduler runs this VM's task, so the debugger may pause it
+
 	yielded     bool         // VM has yielded control (suspend/fork)
 	yieldResult types.Result // Why we yielded
+	floor       int          // Frames below this belong to an outer run; errors don't unwind into them
+	memCharged  int64        // Bytes charged since the task's memory was last measured
+	memExceeded bool         // The last measurement was over MaxTaskMemory
+	resumeErr   error        // Raised by the builtin call the VM resumes from (see ResumeWithError)
 }
 
 // StackFrame represents a call frame
@@ -83,6 +93,7 @@ type StackFrame struct {
 	ExceptStack  []Handler     // Exception handlers
 	PendingError error         // Error saved during finally execution
 	VerbDebug    bool          // Verb's 'd' flag: when false, runtime errors are pushed as values instead of raising exceptions
+	ThreadsOff   bool          // set_thread_mode(0) was called in this activation
 
 	// Saved context fields — restored when this frame is popped (Return / HandleError).
 	// Only set for verb-call frames (not the initial frame).
@@ -93,6 +104,9 @@ type StackFrame struct {
 	SavedVerb       string      // ctx.Verb before verb call
 	SavedProgrammer types.ObjID // ctx.Programmer before verb call
 	SavedIsWizard   bool        // ctx.IsWizard before verb call
+
+	profNode  *profile.Node // Profiler call-tree node, set while profiling
+	debugLine int           // Last line reported to the debugger
 }
 
 // NewVM creates a new virtual machine
@@ -106,7 +120,19 @@ func NewVM(store *db.Store, registry *builtins.Registry) *VM {
 		Builtins:  registry,
 		TickLimit: 30000,
 		Ticks:     0,
+
+		MaxStackDepth: builtins.GetMaxStackDepth(),
+		MaxTaskMemory: builtins.GetMaxTaskMemory(),
+	}
+}
+
+// checkStackDepth returns E_MAXREC if pushing another activation would
+// exceed MaxStackDepth (LambdaMOO's max_stack_depth)
+func (vm *VM) checkStackDepth() error {
+	if vm.MaxStackDepth > 0 && len(vm.Frames) >= vm.MaxStackDepth {
+		return fmt.Errorf("E_MAXREC: too many verb calls (max_stack_depth %d)", vm.MaxStackDepth)
 	}
+	return nil
 }
 
 // Run executes a program and returns the result.
@@ -234,6 +260,38 @@ func (vm *VM) SetResumeValue(val types.Value) {
 	}
 }
 
+// ResumeWithError resumes a suspended VM as Resume does, except that the
+// builtin call it suspended in raises code (with value, if not nil) rather
+// than returning. Threaded builtins that fail in the background use it.
+func (vm *VM) ResumeWithError(code types.ErrorCode, value types.Value) types.Result {
+	if vm.SP > 0 {
+		vm.Pop() // The value pushed when the builtin suspended
+	}
+	vm.resumeErr = VMException{Code: code, Value: value}
+	return vm.Resume()
+}
+
+// Suspendable reports whether a builtin the VM calls now may suspend the
+// task and leave the scheduler to resume it: the scheduler runs the task,
+// and the call isn't inside a lambda that a builtin is running
+func (vm *VM) Suspendable() bool {
+	return vm.Debuggable
+}
+
+// ThreadMode reports whether the current activation lets threaded builtins
+// run on the thread pool (see set_thread_mode())
+func (vm *VM) ThreadMode() bool {
+	frame := vm.CurrentFrame()
+	return frame != nil && !frame.ThreadsOff
+}
+
+// SetThreadMode sets the current activation's thread mode
+func (vm *VM) SetThreadMode(on bool) {
+	if frame := vm.CurrentFrame(); frame != nil {
+		frame.ThreadsOff = !on
+	}
+}
+
 // SetForkResult sets the fork variable in the current frame to the child task ID.
 // This should be called after the scheduler creates the child task, before Resume().
 func (vm *VM) SetForkResult(childTaskID int64) {
@@ -250,7 +308,13 @@ func (vm *VM) SetForkResult(childTaskID int64) {
 
 // executeLoop is the core execution loop shared by Run() and Resume().
 func (vm *VM) executeLoop() types.Result {
-	for len(vm.Frames) > 0 {
+	return vm.runFrames(0)
+}
+
+// runFrames executes until only depth frames are left, then returns the
+// value the last frame returned
+func (vm *VM) runFrames(depth int) types.Result {
+	for len(vm.Frames) > depth {
 		if err := vm.Step(); err != nil {
 			// Verb debug flag check: when the current frame's VerbDebug is false,
 			// push the error as a value instead of propagating it as an exception.
@@ -258,18 +322,7 @@ func (vm *VM) executeLoop() types.Result {
 			// Matches Toast's PUSH_ERROR/RAISE_ERROR macro behavior in execute.cc.
 			frame := vm.CurrentFrame()
 			if frame != nil && !frame.VerbDebug {
-				var errCode types.ErrorCode
-				if vmErr, ok := err.(VMException); ok {
-					errCode = vmErr.Code
-				} else if mooErr, ok := err.(MooError); ok {
-					errCode = mooErr.Code
-				} else {
-					errCode = extractErrorCode(err)
-					if errCode == types.E_NONE {
-						errCode = types.E_EXEC
-					}
-				}
-				vm.Push(types.NewErr(errCode))
+				vm.Push(types.NewErr(errorCode(err)))
 				continue
 			}
 
@@ -288,21 +341,9 @@ func (vm *VM) executeLoop() types.Result {
 			}
 			// Handle error
 			if !vm.HandleError(err) {
-				// Extract error code, preferring the typed MooError
-				var errCode types.ErrorCode
-				if mooErr, ok := err.(MooError); ok {
-					errCode = mooErr.Code
-				} else if vmErr, ok := err.(VMException); ok {
-					errCode = vmErr.Code
-				} else {
-					errCode = extractErrorCode(err)
-					if errCode == types.E_NONE {
-						errCode = types.E_EXEC
-					}
-				}
 				return types.Result{
 					Flow:      types.FlowException,
-					Error:     errCode,
+					Error:     errorCode(err),
 					Val:       types.NewStr(vm.annotateError(err, line).Error()),
 					CallStack: stackSnapshot,
 				}
@@ -314,9 +355,15 @@ func (vm *VM) executeLoop() types.Result {
 			// Sync line numbers so task_stack() reports accurate lines
 			// for suspended tasks.
 			vm.syncTaskLineNumbers()
+			vm.measureMemory()
 			return vm.yieldResult
 		}
 
+		// Check memory limit; like the tick limit, it can't be caught
+		if vm.memExceeded {
+			return vm.memoryLimitError()
+		}
+
 		// Check tick limit
 		if vm.Ticks >= vm.TickLimit {
 			line := vm.CurrentLine()
@@ -337,6 +384,21 @@ func (vm *VM) executeLoop() types.Result {
 	return types.Result{Flow: types.FlowReturn, Val: types.IntValue{Val: 0}}
 }
 
+// errorCode returns the MOO error an execution error raises, E_EXEC if it
+// names none
+func errorCode(err error) types.ErrorCode {
+	if mooErr, ok := err.(MooError); ok {
+		return mooErr.Code
+	}
+	if vmErr, ok := err.(VMException); ok {
+		return vmErr.Code
+	}
+	if code := extractErrorCode(err); code != types.E_NONE {
+		return code
+	}
+	return types.E_EXEC
+}
+
 // syncTaskLineNumbers updates the task's CallStack line numbers from the VM's
 // current frame IPs.  This must be called before any code that reads
 // task.CallStack line numbers (callers(), task_stack(), traceback building).
@@ -445,12 +507,21 @@ func (vm *VM) Step() error {
 		return fmt.Errorf("no active frame")
 	}
 
+	if err := vm.resumeErr; err != nil {
+		vm.resumeErr = nil
+		return err
+	}
+
 	if frame.IP >= len(frame.Program.Code) {
 		// End of program - implicit return 0
 		vm.Return(types.IntValue{Val: 0})
 		return nil
 	}
 
+	if debug.Enabled() && vm.debugStop(frame) {
+		return nil
+	}
+
 	op := OpCode(frame.Program.Code[frame.IP])
 	frame.IP++
 
@@ -460,6 +531,9 @@ func (vm *VM) Step() error {
 		vm.syncContextTicks()
 	}
 
+	if profile.Enabled() {
+		return vm.profiledExecute(frame, op)
+	}
 	return vm.Execute(op)
 }
 
@@ -635,6 +709,12 @@ func (vm *VM) Execute(op OpCode) error {
 	case OP_PASS:
 		return vm.executePass()
 
+	// Lambdas
+	case OP_MAKE_LAMBDA:
+		return vm.executeMakeLambda()
+	case OP_CALL_LAMBDA:
+		return vm.executeCallLambda()
+
 	// Exception handling
 	case OP_TRY_EXCEPT:
 		return vm.executeTryExcept()
@@ -888,7 +968,7 @@ func (vm *VM) HandleError(err error) bool {
 
 		// No handler in this frame. If there are caller frames, pop this frame
 		// and continue searching. This implements cross-frame exception unwinding.
-		if len(vm.Frames) <= 1 {
+		if len(vm.Frames) <= vm.floor+1 {
 			if frame.IsVerbCall {
 				trace.Exception(frame.This, frame.Verb, errCode)
 			}
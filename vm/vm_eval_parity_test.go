@@ -7,6 +7,7 @@ import (
 	"barn/task"
 	"barn/types"
 	"fmt"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -1349,13 +1350,13 @@ func newPropertyTestStore() *db.Store {
 	root.Name = "Root"
 	root.Properties["foo"] = &db.Property{Name: "foo", Value: types.NewInt(42), Perms: db.PropRead | db.PropWrite, Defined: true}
 	root.Properties["bar"] = &db.Property{Name: "bar", Value: types.NewStr("hello"), Perms: db.PropRead | db.PropWrite, Defined: true}
-	store.Add(root)
+	store.Add(withVerbTable(root))
 
 	child := db.NewObject(1, 0)
 	child.Name = "Child"
 	child.Parents = []types.ObjID{0}
 	child.Properties["baz"] = &db.Property{Name: "baz", Value: types.NewInt(99), Perms: db.PropRead | db.PropWrite, Defined: true}
-	store.Add(child)
+	store.Add(withVerbTable(child))
 
 	return store
 }
@@ -1669,7 +1670,7 @@ func newVerbTestStore() *db.Store {
 		Code:  []string{"return 99;"},
 	}
 
-	store.Add(root)
+	store.Add(withVerbTable(root))
 
 	return store
 }
@@ -2986,7 +2987,7 @@ func newWaifTestStore() *db.Store {
 		Perms:   db.PropRead | db.PropWrite,
 		Defined: true,
 	}
-	store.Add(classObj)
+	store.Add(withVerbTable(classObj))
 
 	return store
 }
@@ -3121,7 +3122,7 @@ func TestParity_PropertyPermissions(t *testing.T) {
 		Perms:   db.PropRead, // Read only, no write
 		Defined: true,
 	}
-	store.Add(obj)
+	store.Add(withVerbTable(obj))
 
 	// Non-wizard, non-owner context
 	ctx := types.NewTaskContext()
@@ -3543,14 +3544,14 @@ func newInheritedVerbStore() *db.Store {
 		Code:  []string{"return this:inner_check();"},
 	}
 
-	store.Add(parent)
+	store.Add(withVerbTable(parent))
 
 	child := db.NewObject(1, 0)
 	child.Name = "Child"
 	child.Parents = []types.ObjID{0} // Inherits from parent #0
 	child.Flags = db.FlagRead | db.FlagWrite
 
-	store.Add(child)
+	store.Add(withVerbTable(child))
 
 	return store
 }
@@ -3838,7 +3839,7 @@ func TestParity_CommandEnvVarsInVerbFrame(t *testing.T) {
 		Code:  []string{"return iobj;"},
 	}
 
-	store.Add(root)
+	store.Add(withVerbTable(root))
 
 	// Create a task with command context fields populated
 	tsk := task.NewTask(1, 0, 30000, 5.0)
@@ -3938,7 +3939,7 @@ func newWaifVerbTestStore() *db.Store {
 		Defined: true,
 	}
 
-	store.Add(root)
+	store.Add(withVerbTable(root))
 	return store
 }
 
@@ -3980,8 +3981,8 @@ func newPrimitiveProtoTestStore() *db.Store {
 		Defined: true,
 	}
 
-	store.Add(root)
-	store.Add(proto)
+	store.Add(withVerbTable(root))
+	store.Add(withVerbTable(proto))
 	return store
 }
 
@@ -4024,8 +4025,8 @@ func newAnonVerbTestStore() *db.Store {
 		Defined: true,
 	}
 
-	store.Add(root)
-	store.Add(anon)
+	store.Add(withVerbTable(root))
+	store.Add(withVerbTable(anon))
 	return store
 }
 
@@ -4267,7 +4268,7 @@ func newPassTestStore() *db.Store {
 		Code:  []string{`return args;`},
 	}
 
-	store.Add(grandparent)
+	store.Add(withVerbTable(grandparent))
 
 	// Object #1 (parent) — parent is #0
 	parent := db.NewObject(1, 0)
@@ -4323,7 +4324,7 @@ func newPassTestStore() *db.Store {
 		Code:  []string{`return pass(99, @args, 100);`},
 	}
 
-	store.Add(parent)
+	store.Add(withVerbTable(parent))
 
 	// Add #0 -> children contains #1
 	grandparent.Children = append(grandparent.Children, 1)
@@ -4342,7 +4343,7 @@ func newPassTestStore() *db.Store {
 		Code:  []string{`return "child:" + pass();`},
 	}
 
-	store.Add(child)
+	store.Add(withVerbTable(child))
 
 	// Add #1 -> children contains #2
 	parent.Children = append(parent.Children, 2)
@@ -4528,3 +4529,147 @@ func TestCompileErrorReturnsError(t *testing.T) {
 	// confirms the VM handles all verb compilation natively.
 	t.Log("Tree-walker fallback functions removed; compile errors return proper exceptions")
 }
+
+// TestParity_ListAliasing checks that lists stay values: appends extend a
+// shared backing array and long lists are updated as vectors, but no
+// variable ever sees a change made through another
+func TestParity_ListAliasing(t *testing.T) {
+	cases := map[string]struct {
+		code string
+		want string
+	}{
+		"append_from_shared_base": {`a = {1, 2}; b = {@a, 3}; c = {@a, 4}; return {a, b, c};`,
+			"{{1, 2}, {1, 2, 3}, {1, 2, 4}}"},
+		"append_after_copy": {`a = {}; for i in [1..40] a = {@a, i}; endfor b = a; a = {@a, 41}; b = {@b, 99}; return {length(a), a[41], length(b), b[41], a[40] == b[40]};`,
+			"{41, 41, 41, 99, 1}"},
+		"set_through_alias": {`a = {}; for i in [1..100] a = {@a, i}; endfor b = a; b[50] = 0; return {a[50], b[50], a[51] == b[51]};`,
+			"{50, 0, 1}"},
+		"set_in_loop_keeps_old": {`l = {}; for i in [1..100] l = {@l, i}; endfor old = l; for i in [1..100] l[i] = -i; endfor return {old[1], old[100], l[1], l[100]};`,
+			"{1, 100, -1, -100}"},
+		"nested_alias": {`inner = {1, 2}; outer = {inner, inner}; outer[1][1] = 9; return {inner, outer};`,
+			"{{1, 2}, {{9, 2}, {1, 2}}}"},
+		"loop_over_growing_list": {`l = {1, 2, 3}; for x in (l) l = {@l, x}; endfor return l;`,
+			"{1, 2, 3, 1, 2, 3}"},
+		"append_after_set": {`l = {}; for i in [1..64] l = {@l, i}; endfor l[1] = 0; m = {@l, 65}; n = {@l, 66}; return {l[1], length(l), m[65], n[65], m[64]};`,
+			"{0, 64, 65, 66, 64}"},
+		"range_set_after_vector": {`l = {}; for i in [1..64] l = {@l, i}; endfor l[1] = 1; m = l; l[2..3] = {"a"}; return {length(l), length(m), m[2], l[2]};`,
+			`{63, 64, 2, "a"}`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			comparePrograms(t, tc.code)
+			got, err := vmEvalProgram(t, tc.code)
+			if err != nil || got.String() != tc.want {
+				t.Errorf("got %v, %v; want %s", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func benchmarkProgram(b *testing.B, code string) {
+	stmts, err := parser.NewParser(code).ParseProgram()
+	if err != nil {
+		b.Fatal(err)
+	}
+	registry := newTestRegistry()
+	prog, err := NewCompilerWithRegistry(registry).CompileStatements(stmts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vm := NewVM(nil, registry)
+		vm.Context = types.NewTaskContext()
+		vm.Context.TicksRemaining = 1 << 30
+		vm.TickLimit = 1 << 30
+		if _, err := vmRunToCompletion(vm, prog); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkListAppendLoop builds a 100k-element list the usual way
+func BenchmarkListAppendLoop(b *testing.B) {
+	benchmarkProgram(b, `l = {}; for i in [1..100000] l = {@l, i}; endfor return length(l);`)
+}
+
+// BenchmarkListIndexSetLoop updates every element of a 100k-element list
+func BenchmarkListIndexSetLoop(b *testing.B) {
+	benchmarkProgram(b, `l = {}; for i in [1..100000] l = {@l, i}; endfor for i in [1..100000] l[i] = l[i] * 2; endfor return l[$];`)
+}
+
+// TestParity_StringBuilding checks that strings built by concatenation in
+// a shared buffer stay values, whichever copy is extended
+func TestParity_StringBuilding(t *testing.T) {
+	cases := map[string]struct {
+		code string
+		want string
+	}{
+		"extend_from_shared_base": {`a = ""; for i in [1..40] a = a + "ab"; endfor b = a + "X"; c = a + "Y"; return {length(a), b[$], c[$], a[$]};`,
+			`{80, "X", "Y", "b"}`},
+		"index_while_building": {`s = ""; r = {}; for i in [1..100] s = s + tostr(i % 10); r = {@r, s[i]}; endfor return {length(s), r[100], s[91..$]};`,
+			`{100, "0", "1234567890"}`},
+		"set_through_alias": {`s = ""; for i in [1..50] s = s + "xy"; endfor t = s; t[1] = "Z"; return {s[1], t[1], length(t), s == t};`,
+			`{"x", "Z", 100, 0}`},
+		"prefix_then_extend": {`s = ""; for i in [1..50] s = s + "ab"; endfor p = s[1..60]; q = p + "!"; s = s + "?"; return {length(q), q[$], s[$], s[61]};`,
+			`{61, "!", "?", "a"}`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			comparePrograms(t, tc.code)
+			got, err := vmEvalProgram(t, tc.code)
+			if err != nil || got.String() != tc.want {
+				t.Errorf("got %v, %v; want %s", got, err, tc.want)
+			}
+		})
+	}
+}
+
+// BenchmarkStringConcatLoop builds a 1MB string ten bytes at a time
+func BenchmarkStringConcatLoop(b *testing.B) {
+	benchmarkProgram(b, `s = ""; for i in [1..100000] s = s + "0123456789"; endfor return length(s);`)
+}
+
+// TestParity_UnicodeStrings checks the indexing operators in unicode
+// string mode, where each character is a rune
+func TestParity_UnicodeStrings(t *testing.T) {
+	types.SetUnicodeStrings(true)
+	defer types.SetUnicodeStrings(false)
+	cases := map[string]struct {
+		code string
+		want string
+	}{
+		"index":      {`s = "añb"; return {s[2], s[$], length(s)};`, `{"ñ", "b", 3}`},
+		"range":      {`s = "日本語です"; return {s[2..3], s[4..$], s[3..2]};`, `{"本語", "です", ""}`},
+		"index_set":  {`s = "añb"; s[2] = "ü"; return s;`, `"aüb"`},
+		"range_set":  {`s = "日本語"; s[2..2] = "XY"; return {s, length(s)};`, `{"日XY語", 4}`},
+		"for_chars":  {`r = {}; for c, i in ("çé") r = {@r, {c, i}}; endfor return r;`, `{{"ç", 1}, {"é", 2}}`},
+		"in":         {`return "ü" in "añüb";`, `3`},
+		"multi_char": {`s = "ab"; try s[1] = "ñn"; except (E_INVARG) return 1; endtry`, `1`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := vmEvalProgram(t, tc.code)
+			if err != nil || got.String() != tc.want {
+				t.Errorf("got %v, %v; want %s", got, err, tc.want)
+			}
+		})
+	}
+}
+
+// withVerbTable fills in the verb table of a fixture object whose verbs
+// are only in its Verbs map, in name order; FindVerb searches the table
+func withVerbTable(obj *db.Object) *db.Object {
+	if len(obj.VerbList) > 0 {
+		return obj
+	}
+	names := make([]string, 0, len(obj.Verbs))
+	for name := range obj.Verbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		obj.VerbList = append(obj.VerbList, obj.Verbs[name])
+	}
+	return obj
+}